@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"monis.app/mlog"
+
+	"github.com/Azure/azure-workload-identity/pkg/proxyinit"
+	"github.com/Azure/azure-workload-identity/pkg/version"
+)
+
+var (
+	backend     string
+	cleanup     bool
+	logLevel    string
+	versionInfo bool
+)
+
+func main() {
+	if err := mainErr(); err != nil {
+		mlog.Fatal(err)
+	}
+}
+
+func mainErr() error {
+	defer mlog.Setup()()
+
+	flag.StringVar(&backend, "backend", string(proxyinit.BackendAuto), fmt.Sprintf("Backend used to program the redirect to the proxy: %s, %s, %s or %s. %s detects the first backend that is installed and supported by the kernel, in that order.",
+		proxyinit.BackendAuto, proxyinit.BackendNFT, proxyinit.BackendIPTablesNFT, proxyinit.BackendIPTablesLegacy, proxyinit.BackendAuto))
+	flag.BoolVar(&cleanup, "cleanup", false, "Remove the redirect to the proxy instead of programming it. With the auto backend, the redirect is removed from all the backends that are installed and supported by the kernel.")
+	flag.StringVar(&logLevel, "log-level", "",
+		"In order of increasing verbosity: unset (empty string), info, debug, trace and all.")
+	flag.BoolVar(&versionInfo, "version", false, "Print version information and exit")
+	flag.Parse()
+
+	if versionInfo {
+		return version.PrintVersionToStdout()
+	}
+
+	// the signal handler of controller-runtime is not used to keep the Kubernetes dependencies out of the binary
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := mlog.ValidateAndSetLogLevelAndFormatGlobally(ctx, mlog.LogSpec{
+		Level:  mlog.LogLevel(logLevel),
+		Format: mlog.FormatJSON,
+	}); err != nil {
+		return fmt.Errorf("invalid --log-level set: %w", err)
+	}
+
+	b, err := proxyinit.ParseBackend(backend)
+	if err != nil {
+		return fmt.Errorf("invalid --backend set: %w", err)
+	}
+	cfg, err := proxyinit.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("setup: failed to read config: %w", err)
+	}
+	logger := mlog.New().WithName("proxy-init")
+	if cleanup {
+		if err := proxyinit.Cleanup(ctx, logger, cfg, b); err != nil {
+			return fmt.Errorf("cleanup: failed to remove redirect: %w", err)
+		}
+		return nil
+	}
+	if err := proxyinit.Setup(ctx, logger, cfg, b); err != nil {
+		return fmt.Errorf("setup: failed to program redirect: %w", err)
+	}
+	return nil
+}
@@ -4,22 +4,34 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"monis.app/mlog"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 
+	"github.com/Azure/azure-workload-identity/pkg/metrics"
 	"github.com/Azure/azure-workload-identity/pkg/proxy"
 	"github.com/Azure/azure-workload-identity/pkg/version"
 )
 
 var (
-	proxyPort   int
-	probe       bool
-	logLevel    string
-	versionInfo bool
+	proxyPort      int
+	probe          bool
+	healthCheck    string
+	logLevel       string
+	versionInfo    bool
+	metricsAddr    string
+	metricsBackend string
+	identityMap    string
+	arcKeyDir      string
+	passthrough    string
+	strictMode     bool
 )
 
 func main() {
@@ -33,9 +45,16 @@ func mainErr() error {
 
 	flag.IntVar(&proxyPort, "proxy-port", 8000, "Port for the proxy to listen on")
 	flag.BoolVar(&probe, "probe", false, "Run a readyz probe on the proxy")
+	flag.StringVar(&healthCheck, "health-check", "", fmt.Sprintf("Run a single %s or %s check on the proxy and exit. Used by the probes of the proxy sidecar.", proxy.HealthCheckReadyz, proxy.HealthCheckHealthz))
 	flag.StringVar(&logLevel, "log-level", "",
 		"In order of increasing verbosity: unset (empty string), info, debug, trace and all.")
 	flag.BoolVar(&versionInfo, "version", false, "Print version information and exit")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "The address the metrics endpoint binds to. When empty, the metrics endpoint is disabled.")
+	flag.StringVar(&metricsBackend, "metrics-backend", "prometheus", "Backend used for metrics")
+	flag.StringVar(&identityMap, "identity-map-file", "", fmt.Sprintf("Path to the file that maps object IDs and resource IDs to client IDs. When empty, the map is read from the %s environment variable.", proxy.IdentityMapEnvVar))
+	flag.StringVar(&arcKeyDir, "arc-key-dir", "", "Directory to write the key files of the Azure Arc token endpoint challenges to. When empty, the Azure Arc token endpoint is disabled.")
+	flag.StringVar(&passthrough, "imds-passthrough-policy-file", "", fmt.Sprintf("Path to the file with the policy for the IMDS requests that are not token requests. When empty, the policy is read from the %s environment variable.", proxy.PassthroughPolicyEnvVar))
+	flag.BoolVar(&strictMode, "strict-mode", false, "Serve or reject all requests to the IMDS identity endpoints in the proxy. Identity requests are never forwarded to IMDS, regardless of the passthrough policy.")
 	flag.Parse()
 
 	if versionInfo {
@@ -59,9 +78,38 @@ func mainErr() error {
 		return nil
 	}
 
+	// when proxy is run with --health-check, it will check the proxy once
+	// this is used by the startup, readiness and liveness probes of the sidecar
+	if healthCheck != "" {
+		if err := proxy.Check(proxyPort, healthCheck); err != nil {
+			return fmt.Errorf("failed health check: %w", err)
+		}
+		return nil
+	}
+
 	ctx := withShutdownSignal(context.Background())
 
-	p, err := proxy.NewProxy(proxyPort, mlog.New().WithName("proxy"), proxy.CreateWICredCache())
+	if metricsAddr != "" {
+		// initialize metrics exporter before creating measurements
+		mlog.Info("initializing metrics backend", "backend", metricsBackend)
+		if err := metrics.InitMetricsExporter(metricsBackend); err != nil {
+			return fmt.Errorf("setup: failed to initialize metrics exporter: %w", err)
+		}
+		go runMetricsServer(ctx, metricsAddr)
+	}
+
+	identities, err := proxy.LoadIdentityMap(identityMap)
+	if err != nil {
+		return fmt.Errorf("setup: failed to load identity map: %w", err)
+	}
+
+	passthroughPolicy, err := proxy.LoadPassthroughPolicy(passthrough)
+	if err != nil {
+		return fmt.Errorf("setup: failed to load IMDS passthrough policy: %w", err)
+	}
+
+	logger := mlog.New().WithName("proxy")
+	p, err := proxy.NewProxy(proxyPort, logger, proxy.CreateWICredCache(), proxy.NewTokenCache(logger), identities, arcKeyDir, passthroughPolicy, strictMode)
 	if err != nil {
 		return fmt.Errorf("setup: failed to create proxy: %w", err)
 	}
@@ -72,6 +120,29 @@ func mainErr() error {
 	return nil
 }
 
+// runMetricsServer serves the metrics registered with the exporter on the address until the context is done
+func runMetricsServer(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler:           mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	mlog.Info("starting the metrics server", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		mlog.Error("failed to run the metrics server", err)
+	}
+}
+
 // withShutdownSignal returns a copy of the parent context that will close if
 // the process receives termination signals.
 func withShutdownSignal(ctx context.Context) context.Context {
@@ -4,14 +4,19 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/open-policy-agent/cert-controller/pkg/rotator"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"monis.app/mlog"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -19,6 +24,7 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	wiconfig "github.com/Azure/azure-workload-identity/pkg/config"
 	"github.com/Azure/azure-workload-identity/pkg/metrics"
 	"github.com/Azure/azure-workload-identity/pkg/util"
 	"github.com/Azure/azure-workload-identity/pkg/version"
@@ -30,6 +36,10 @@ var webhooks = []rotator.WebhookInfo{
 		Name: "azure-wi-webhook-mutating-webhook-configuration",
 		Type: rotator.Mutating,
 	},
+	{
+		Name: "azure-wi-webhook-validating-webhook-configuration",
+		Type: rotator.Validating,
+	},
 }
 
 const (
@@ -49,6 +59,9 @@ var (
 	metricsBackend      string
 	logLevel            string
 	versionInfo         bool
+	policyConfigMapName string
+	enableExplain       bool
+	explainAddr         string
 
 	// DNSName is <service name>.<namespace>.svc
 	dnsName = fmt.Sprintf("%s.%s.svc", serviceName, util.GetNamespace())
@@ -83,6 +96,16 @@ func mainErr() error {
 	flag.StringVar(&logLevel, "log-level", "",
 		"In order of increasing verbosity: unset (empty string), info, debug, trace and all.")
 	flag.BoolVar(&versionInfo, "version", false, "Print version information and exit")
+	flag.StringVar(&policyConfigMapName, "policy-configmap-name", "azure-wi-webhook-policy",
+		"Name of the ConfigMap in the webhook namespace that holds the cluster-wide webhook policy. "+
+			"When empty, the policy is disabled.")
+	// The explain endpoint is not authenticated and returns the client IDs and tenant IDs of the service accounts
+	// and the patch of any pod manifest, so it's only served on a loopback address that is reachable with
+	// kubectl port-forward, which requires the pods/portforward permission in the webhook namespace.
+	flag.BoolVar(&enableExplain, "enable-explain-endpoint", false,
+		"Expose the unauthenticated /explain-v1-pod endpoint on --explain-addr that returns the patch and decision trace of the pod mutator for a pod manifest")
+	flag.StringVar(&explainAddr, "explain-addr", "localhost:9444",
+		"The address the explain endpoint binds to. Must be a loopback address as the endpoint is not authenticated")
 
 	flag.StringVar(&customTokenEndpointAnnotationSuffix, "custom-token-endpoint-annotation-suffix", "",
 		"Suffix to append to 'azure.workload.identity/use-' when defining a custom token endpoint annotation. "+
@@ -98,6 +121,12 @@ func mainErr() error {
 		return version.PrintVersionToStdout()
 	}
 
+	if enableExplain {
+		if err := validateLoopbackAddr(explainAddr); err != nil {
+			return fmt.Errorf("invalid --explain-addr set: %w", err)
+		}
+	}
+
 	ctx := signals.SetupSignalHandler()
 
 	if err := mlog.ValidateAndSetLogLevelAndFormatGlobally(ctx, mlog.LogSpec{
@@ -140,6 +169,12 @@ func mainErr() error {
 		},
 		WebhookServer:  webhook.NewServer(serverOpts),
 		MapperProvider: apiutil.NewDynamicRESTMapper,
+		Cache: cache.Options{
+			// the webhook is only allowed to watch configmaps in its own namespace
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.ConfigMap{}: {Namespaces: map[string]cache.Config{util.GetNamespace(): {}}},
+			},
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("entrypoint: unable to set up controller manager: %w", err)
@@ -167,8 +202,19 @@ func mainErr() error {
 		close(setupFinished)
 	}
 
+	var policy *wiconfig.PolicyStore
+	if policyConfigMapName != "" {
+		entryLog.Info("setting up policy reconciler", "configmap", policyConfigMapName)
+		if policy, err = wh.SetupPolicyReconciler(mgr, types.NamespacedName{
+			Namespace: util.GetNamespace(),
+			Name:      policyConfigMapName,
+		}); err != nil {
+			return fmt.Errorf("entrypoint: unable to set up policy reconciler: %w", err)
+		}
+	}
+
 	setupProbeEndpoints(mgr, setupFinished)
-	go setupWebhook(mgr, setupFinished)
+	go setupWebhook(mgr, setupFinished, policy)
 
 	entryLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -178,7 +224,7 @@ func mainErr() error {
 	return nil
 }
 
-func setupWebhook(mgr manager.Manager, setupFinished chan struct{}) {
+func setupWebhook(mgr manager.Manager, setupFinished chan struct{}, policy *wiconfig.PolicyStore) {
 	// Block until the setup (certificate generation) finishes.
 	<-setupFinished
 
@@ -186,11 +232,33 @@ func setupWebhook(mgr manager.Manager, setupFinished chan struct{}) {
 
 	// setup webhooks
 	entryLog.Info("registering webhook to the webhook server")
-	podMutator, err := wh.NewPodMutator(mgr.GetClient(), mgr.GetAPIReader(), audience, mgr.GetScheme(), mgr.GetConfig(), customTokenEndpointAnnotationSuffix, customTokenEndpointAudience)
+	podMutator, err := wh.NewPodMutator(mgr.GetClient(), mgr.GetAPIReader(), audience, mgr.GetScheme(), mgr.GetConfig(), customTokenEndpointAnnotationSuffix, customTokenEndpointAudience, policy)
 	if err != nil {
 		panic(fmt.Errorf("unable to set up pod mutator: %w", err))
 	}
 	hookServer.Register("/mutate-v1-pod", &webhook.Admission{Handler: podMutator})
+	if enableExplain {
+		podExplainer, err := wh.NewPodExplainer(podMutator)
+		if err != nil {
+			panic(fmt.Errorf("unable to set up pod explainer: %w", err))
+		}
+		// the explain endpoint is served on its own plain HTTP server bound to a loopback address
+		// instead of the webhook server, which is reachable from every pod in the cluster
+		mux := http.NewServeMux()
+		mux.Handle("/explain-v1-pod", podExplainer)
+		if err := mgr.Add(&manager.Server{
+			Name: "explain",
+			Server: &http.Server{
+				Addr:              explainAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: 5 * time.Second,
+			},
+		}); err != nil {
+			panic(fmt.Errorf("unable to set up pod explainer server: %w", err))
+		}
+	}
+	hookServer.Register("/validate-v1-serviceaccount", &webhook.Admission{Handler: wh.NewServiceAccountValidator(mgr.GetScheme())})
+	hookServer.Register("/validate-v1-pod", &webhook.Admission{Handler: wh.NewPodValidator(mgr.GetScheme())})
 }
 
 func setupProbeEndpoints(mgr ctrl.Manager, setupFinished chan struct{}) {
@@ -217,6 +285,21 @@ func setupProbeEndpoints(mgr ctrl.Manager, setupFinished chan struct{}) {
 	entryLog.Info("added healthz and readyz check")
 }
 
+// validateLoopbackAddr returns an error if the host of the address is not localhost or a loopback IP address
+func validateLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("host %q must be localhost or a loopback IP address", host)
+	}
+	return nil
+}
+
 func parseTLSVersion(tlsVersion string) (uint16, error) {
 	switch tlsVersion {
 	case "1.0":
@@ -16,6 +16,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
 	"github.com/Azure/go-autorest/autorest/azure"
 	kiotaauth "github.com/microsoft/kiota-authentication-azure-go"
@@ -40,10 +41,13 @@ type Interface interface {
 	DeleteApplication(ctx context.Context, objectID string) error
 	GetServicePrincipal(ctx context.Context, displayName string) (models.ServicePrincipalable, error)
 	GetApplication(ctx context.Context, displayName string) (models.Applicationable, error)
+	GetApplicationByAppID(ctx context.Context, appID string) (models.Applicationable, error)
+	GetServicePrincipalByAppID(ctx context.Context, appID string) (models.ServicePrincipalable, error)
 
 	// Role assignment methods
 	CreateRoleAssignment(ctx context.Context, scope, roleName, principalID string) (armauthorization.RoleAssignment, error)
 	DeleteRoleAssignment(ctx context.Context, roleAssignmentID string) (armauthorization.RoleAssignment, error)
+	ListRoleAssignments(ctx context.Context, principalID string, scopes ...string) ([]armauthorization.RoleAssignment, error)
 
 	// Role definition methods
 	GetRoleDefinitionIDByName(ctx context.Context, scope, roleName string) (armauthorization.RoleDefinition, error)
@@ -51,17 +55,33 @@ type Interface interface {
 	// Federation methods
 	AddFederatedCredential(ctx context.Context, objectID string, fic models.FederatedIdentityCredentialable) error
 	GetFederatedCredential(ctx context.Context, objectID, issuer, subject string) (models.FederatedIdentityCredentialable, error)
+	ListFederatedCredentials(ctx context.Context, objectID string) ([]models.FederatedIdentityCredentialable, error)
+	UpdateFederatedCredential(ctx context.Context, objectID, federatedCredentialID string, fic models.FederatedIdentityCredentialable) error
 	DeleteFederatedCredential(ctx context.Context, objectID, federatedCredentialID string) error
+
+	// User-assigned managed identity methods
+	CreateUserAssignedIdentity(ctx context.Context, resourceGroup, name, location string, tags map[string]*string) (armmsi.Identity, error)
+	GetUserAssignedIdentity(ctx context.Context, resourceGroup, name string) (armmsi.Identity, error)
+	AddUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string, fic armmsi.FederatedIdentityCredential) error
+	GetUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, issuer, subject string) (armmsi.FederatedIdentityCredential, error)
+	ListUserAssignedIdentityFederatedCredentials(ctx context.Context, resourceGroup, identityName string) ([]armmsi.FederatedIdentityCredential, error)
+	ListUserAssignedIdentityFederatedCredentialsByID(ctx context.Context, resourceID string) ([]armmsi.FederatedIdentityCredential, error)
+	DeleteUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string) error
 }
 
 type AzureClient struct {
 	environment    azure.Environment
 	subscriptionID string
+	// credential is used to create the clients of resources in other subscriptions
+	credential azcore.TokenCredential
 
 	graphServiceClient *msgraphsdk.GraphServiceClient
 
 	roleAssignmentsClient *armauthorization.RoleAssignmentsClient
 	roleDefinitionsClient *armauthorization.RoleDefinitionsClient
+
+	userAssignedIdentitiesClient       *armmsi.UserAssignedIdentitiesClient
+	federatedIdentityCredentialsClient *armmsi.FederatedIdentityCredentialsClient
 }
 
 // NewAzureClientWithCLI creates an AzureClient configured from Azure CLI 2.0 for local development scenarios.
@@ -162,14 +182,28 @@ func getClient(env azure.Environment, subscriptionID string, credential azcore.T
 		return nil, errors.Wrap(err, "failed to create role definitions client")
 	}
 
+	userAssignedIdentitiesClient, err := armmsi.NewUserAssignedIdentitiesClient(subscriptionID, credential, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create user-assigned identities client")
+	}
+
+	federatedIdentityCredentialsClient, err := armmsi.NewFederatedIdentityCredentialsClient(subscriptionID, credential, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create federated identity credentials client")
+	}
+
 	azClient := &AzureClient{
 		environment:    env,
 		subscriptionID: subscriptionID,
+		credential:     credential,
 
 		graphServiceClient: msgraphsdk.NewGraphServiceClient(adapter),
 
 		roleAssignmentsClient: roleAssignmentsClient,
 		roleDefinitionsClient: roleDefinitionsClient,
+
+		userAssignedIdentitiesClient:       userAssignedIdentitiesClient,
+		federatedIdentityCredentialsClient: federatedIdentityCredentialsClient,
 	}
 
 	return azClient, nil
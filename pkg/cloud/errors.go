@@ -24,6 +24,10 @@ type GraphError struct {
 
 // IsNotFound returns true if the given error is a NotFound error.
 func IsNotFound(err error) bool {
+	derr := &azcore.ResponseError{}
+	if errors.As(err, &derr) {
+		return derr.StatusCode == http.StatusNotFound
+	}
 	return strings.Contains(err.Error(), "not found")
 }
 
@@ -42,6 +46,9 @@ func IsRoleAssignmentExists(err error) bool {
 
 // IsFederatedCredentialNotFound returns true if the given error is a federated credential not found error.
 func IsFederatedCredentialNotFound(err error) bool {
+	if errors.Is(err, ErrFederatedCredentialNotFound) {
+		return true
+	}
 	gerr := GraphError{}
 	return errors.As(err, &gerr) && *gerr.Errorable.GetCode() == GraphErrorCodeResourceNotFound
 }
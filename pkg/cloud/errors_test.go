@@ -25,6 +25,16 @@ func TestIsNotFound(t *testing.T) {
 			actualErr: errors.New("something else"),
 			want:      false,
 		},
+		{
+			name:      "azcore response error not found",
+			actualErr: &azcore.ResponseError{StatusCode: 404, ErrorCode: "ResourceNotFound"},
+			want:      true,
+		},
+		{
+			name:      "azcore response error status code doesn't match",
+			actualErr: &azcore.ResponseError{StatusCode: 403, ErrorCode: "AuthorizationFailed"},
+			want:      false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -120,6 +130,11 @@ func TestIsFederatedCredentialNotFound(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name:      "managed identity federated credential not found",
+			actualErr: func() error { return errors.Wrap(ErrFederatedCredentialNotFound, "failed to get federated credential") },
+			want:      true,
+		},
 		{
 			name: "graph error resource not found",
 			actualErr: func() error {
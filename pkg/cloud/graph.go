@@ -89,6 +89,49 @@ func (c *AzureClient) GetApplication(ctx context.Context, displayName string) (m
 	return resp.GetValue()[0], nil
 }
 
+// GetApplicationByAppID gets an application by its app ID, which is the client ID of the application.
+func (c *AzureClient) GetApplicationByAppID(ctx context.Context, appID string) (models.Applicationable, error) {
+	mlog.Debug("Getting application", "appID", appID)
+
+	appGetOptions := &applications.ApplicationsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &applications.ApplicationsRequestBuilderGetQueryParameters{
+			Filter: to.Ptr(getAppIDFilter(appID)),
+		},
+	}
+
+	resp, err := c.graphServiceClient.Applications().Get(ctx, appGetOptions)
+	if err != nil {
+		return nil, maybeExtractGraphError(err)
+	}
+
+	if len(resp.GetValue()) == 0 {
+		return nil, errors.Errorf("application with app ID '%s' not found", appID)
+	}
+	return resp.GetValue()[0], nil
+}
+
+// GetServicePrincipalByAppID gets a service principal by its app ID. The service principal
+// of a user-assigned managed identity has the client ID of the managed identity as app ID.
+func (c *AzureClient) GetServicePrincipalByAppID(ctx context.Context, appID string) (models.ServicePrincipalable, error) {
+	mlog.Debug("Getting service principal", "appID", appID)
+
+	spGetOptions := &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{
+			Filter: to.Ptr(getAppIDFilter(appID)),
+		},
+	}
+
+	resp, err := c.graphServiceClient.ServicePrincipals().Get(ctx, spGetOptions)
+	if err != nil {
+		return nil, maybeExtractGraphError(err)
+	}
+
+	if len(resp.GetValue()) == 0 {
+		return nil, errors.Errorf("service principal with app ID '%s' not found", appID)
+	}
+	return resp.GetValue()[0], nil
+}
+
 // DeleteServicePrincipal deletes a service principal.
 func (c *AzureClient) DeleteServicePrincipal(ctx context.Context, objectID string) error {
 	mlog.Debug("Deleting service principal", "objectID", objectID)
@@ -140,6 +183,32 @@ func (c *AzureClient) GetFederatedCredential(ctx context.Context, objectID, issu
 	return nil, ErrFederatedCredentialNotFound
 }
 
+// ListFederatedCredentials lists the federated credentials of an application.
+// An application has at most 20 federated credentials, so they are returned in a single page.
+func (c *AzureClient) ListFederatedCredentials(ctx context.Context, objectID string) ([]models.FederatedIdentityCredentialable, error) {
+	mlog.Debug("Listing federated credentials", "objectID", objectID)
+
+	resp, err := c.graphServiceClient.Applications().ByApplicationId(objectID).FederatedIdentityCredentials().Get(ctx, nil)
+	if err != nil {
+		return nil, maybeExtractGraphError(err)
+	}
+	return resp.GetValue(), nil
+}
+
+// UpdateFederatedCredential updates a federated credential of an application.
+func (c *AzureClient) UpdateFederatedCredential(ctx context.Context, objectID, federatedCredentialID string, fic models.FederatedIdentityCredentialable) error {
+	mlog.Debug("Updating federated credential",
+		"objectID", objectID,
+		"federatedCredentialID", federatedCredentialID,
+	)
+
+	if _, err := c.graphServiceClient.Applications().ByApplicationId(objectID).FederatedIdentityCredentials().ByFederatedIdentityCredentialId(federatedCredentialID).Patch(ctx, fic, nil); err != nil {
+		return maybeExtractGraphError(err)
+	}
+
+	return nil
+}
+
 // DeleteFederatedCredential deletes a federated credential from the cloud provider.
 func (c *AzureClient) DeleteFederatedCredential(ctx context.Context, objectID, federatedCredentialID string) error {
 	mlog.Debug("Deleting federated credential",
@@ -154,6 +223,11 @@ func getDisplayNameFilter(displayName string) string {
 	return fmt.Sprintf("displayName eq '%s'", displayName)
 }
 
+// getAppIDFilter returns a filter string for the given app ID.
+func getAppIDFilter(appID string) string {
+	return fmt.Sprintf("appId eq '%s'", appID)
+}
+
 // getSubjectFilter returns a filter string for the given subject.
 func getSubjectFilter(subject string) string {
 	return fmt.Sprintf("subject eq '%s'", subject)
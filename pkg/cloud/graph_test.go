@@ -19,3 +19,12 @@ func TestGetSubjectFilter(t *testing.T) {
 		t.Errorf("getSubjectFilter() = %v, want %v", got, want)
 	}
 }
+
+func TestGetAppIDFilter(t *testing.T) {
+	got := getAppIDFilter("test")
+	want := "appId eq 'test'"
+
+	if got != want {
+		t.Errorf("getAppIDFilter() = %v, want %v", got, want)
+	}
+}
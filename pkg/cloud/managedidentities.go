@@ -0,0 +1,134 @@
+package cloud
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/pkg/errors"
+	"monis.app/mlog"
+)
+
+// CreateUserAssignedIdentity creates a user-assigned managed identity in the resource group.
+func (c *AzureClient) CreateUserAssignedIdentity(ctx context.Context, resourceGroup, name, location string, tags map[string]*string) (armmsi.Identity, error) {
+	mlog.Debug("Creating user-assigned managed identity",
+		"resourceGroup", resourceGroup,
+		"name", name,
+		"location", location,
+	)
+
+	parameters := armmsi.Identity{
+		Location: to.Ptr(location),
+		Tags:     tags,
+	}
+	resp, err := c.userAssignedIdentitiesClient.CreateOrUpdate(ctx, resourceGroup, name, parameters, nil)
+	if err != nil {
+		return armmsi.Identity{}, err
+	}
+	return resp.Identity, nil
+}
+
+// GetUserAssignedIdentity gets a user-assigned managed identity in the resource group.
+func (c *AzureClient) GetUserAssignedIdentity(ctx context.Context, resourceGroup, name string) (armmsi.Identity, error) {
+	mlog.Debug("Getting user-assigned managed identity", "resourceGroup", resourceGroup, "name", name)
+
+	resp, err := c.userAssignedIdentitiesClient.Get(ctx, resourceGroup, name, nil)
+	if err != nil {
+		return armmsi.Identity{}, err
+	}
+	return resp.Identity, nil
+}
+
+// AddUserAssignedIdentityFederatedCredential adds a federated credential to a user-assigned managed identity.
+// The federated credential is updated if one with the same name already exists.
+func (c *AzureClient) AddUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string, fic armmsi.FederatedIdentityCredential) error {
+	mlog.Debug("Adding federated credential",
+		"resourceGroup", resourceGroup,
+		"identityName", identityName,
+		"name", name,
+	)
+
+	_, err := c.federatedIdentityCredentialsClient.CreateOrUpdate(ctx, resourceGroup, identityName, name, fic, nil)
+	return err
+}
+
+// GetUserAssignedIdentityFederatedCredential gets the federated credential of a user-assigned managed identity
+// with the issuer and subject.
+func (c *AzureClient) GetUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, issuer, subject string) (armmsi.FederatedIdentityCredential, error) {
+	mlog.Debug("Getting federated credential",
+		"resourceGroup", resourceGroup,
+		"identityName", identityName,
+		"issuer", issuer,
+		"subject", subject,
+	)
+
+	fics, err := c.ListUserAssignedIdentityFederatedCredentials(ctx, resourceGroup, identityName)
+	if err != nil {
+		return armmsi.FederatedIdentityCredential{}, err
+	}
+	for _, fic := range fics {
+		if fic.Properties == nil || fic.Properties.Issuer == nil || fic.Properties.Subject == nil {
+			continue
+		}
+		if *fic.Properties.Issuer == issuer && *fic.Properties.Subject == subject {
+			return fic, nil
+		}
+	}
+	return armmsi.FederatedIdentityCredential{}, ErrFederatedCredentialNotFound
+}
+
+// ListUserAssignedIdentityFederatedCredentials lists the federated credentials of a user-assigned managed identity.
+func (c *AzureClient) ListUserAssignedIdentityFederatedCredentials(ctx context.Context, resourceGroup, identityName string) ([]armmsi.FederatedIdentityCredential, error) {
+	return listUserAssignedIdentityFederatedCredentials(ctx, c.federatedIdentityCredentialsClient, resourceGroup, identityName)
+}
+
+// ListUserAssignedIdentityFederatedCredentialsByID lists the federated credentials of the user-assigned managed identity
+// with the resource ID, which can be in another subscription than the subscription of the client.
+func (c *AzureClient) ListUserAssignedIdentityFederatedCredentialsByID(ctx context.Context, resourceID string) ([]armmsi.FederatedIdentityCredential, error) {
+	id, err := arm.ParseResourceID(resourceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse resource ID %s", resourceID)
+	}
+
+	client := c.federatedIdentityCredentialsClient
+	if !strings.EqualFold(id.SubscriptionID, c.subscriptionID) {
+		if client, err = armmsi.NewFederatedIdentityCredentialsClient(id.SubscriptionID, c.credential, nil); err != nil {
+			return nil, errors.Wrap(err, "failed to create federated identity credentials client")
+		}
+	}
+	return listUserAssignedIdentityFederatedCredentials(ctx, client, id.ResourceGroupName, id.Name)
+}
+
+// listUserAssignedIdentityFederatedCredentials lists the federated credentials of a user-assigned managed identity with the client.
+func listUserAssignedIdentityFederatedCredentials(ctx context.Context, client *armmsi.FederatedIdentityCredentialsClient, resourceGroup, identityName string) ([]armmsi.FederatedIdentityCredential, error) {
+	mlog.Debug("Listing federated credentials", "resourceGroup", resourceGroup, "identityName", identityName)
+
+	var fics []armmsi.FederatedIdentityCredential
+	pager := client.NewListPager(resourceGroup, identityName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, fic := range page.Value {
+			if fic != nil {
+				fics = append(fics, *fic)
+			}
+		}
+	}
+	return fics, nil
+}
+
+// DeleteUserAssignedIdentityFederatedCredential deletes a federated credential from a user-assigned managed identity.
+func (c *AzureClient) DeleteUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string) error {
+	mlog.Debug("Deleting federated credential",
+		"resourceGroup", resourceGroup,
+		"identityName", identityName,
+		"name", name,
+	)
+
+	_, err := c.federatedIdentityCredentialsClient.Delete(ctx, resourceGroup, identityName, name, nil)
+	return err
+}
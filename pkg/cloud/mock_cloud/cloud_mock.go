@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	armauthorization "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	armmsi "github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/microsoftgraph/msgraph-sdk-go/models"
 )
@@ -50,6 +51,20 @@ func (mr *MockInterfaceMockRecorder) AddFederatedCredential(ctx, objectID, fic i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFederatedCredential", reflect.TypeOf((*MockInterface)(nil).AddFederatedCredential), ctx, objectID, fic)
 }
 
+// AddUserAssignedIdentityFederatedCredential mocks base method.
+func (m *MockInterface) AddUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string, fic armmsi.FederatedIdentityCredential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUserAssignedIdentityFederatedCredential", ctx, resourceGroup, identityName, name, fic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUserAssignedIdentityFederatedCredential indicates an expected call of AddUserAssignedIdentityFederatedCredential.
+func (mr *MockInterfaceMockRecorder) AddUserAssignedIdentityFederatedCredential(ctx, resourceGroup, identityName, name, fic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUserAssignedIdentityFederatedCredential", reflect.TypeOf((*MockInterface)(nil).AddUserAssignedIdentityFederatedCredential), ctx, resourceGroup, identityName, name, fic)
+}
+
 // CreateApplication mocks base method.
 func (m *MockInterface) CreateApplication(ctx context.Context, displayName string) (models.Applicationable, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +110,21 @@ func (mr *MockInterfaceMockRecorder) CreateServicePrincipal(ctx, appID, tags int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateServicePrincipal", reflect.TypeOf((*MockInterface)(nil).CreateServicePrincipal), ctx, appID, tags)
 }
 
+// CreateUserAssignedIdentity mocks base method.
+func (m *MockInterface) CreateUserAssignedIdentity(ctx context.Context, resourceGroup, name, location string, tags map[string]*string) (armmsi.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserAssignedIdentity", ctx, resourceGroup, name, location, tags)
+	ret0, _ := ret[0].(armmsi.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUserAssignedIdentity indicates an expected call of CreateUserAssignedIdentity.
+func (mr *MockInterfaceMockRecorder) CreateUserAssignedIdentity(ctx, resourceGroup, name, location, tags interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserAssignedIdentity", reflect.TypeOf((*MockInterface)(nil).CreateUserAssignedIdentity), ctx, resourceGroup, name, location, tags)
+}
+
 // DeleteApplication mocks base method.
 func (m *MockInterface) DeleteApplication(ctx context.Context, objectID string) error {
 	m.ctrl.T.Helper()
@@ -152,6 +182,20 @@ func (mr *MockInterfaceMockRecorder) DeleteServicePrincipal(ctx, objectID interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteServicePrincipal", reflect.TypeOf((*MockInterface)(nil).DeleteServicePrincipal), ctx, objectID)
 }
 
+// DeleteUserAssignedIdentityFederatedCredential mocks base method.
+func (m *MockInterface) DeleteUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserAssignedIdentityFederatedCredential", ctx, resourceGroup, identityName, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserAssignedIdentityFederatedCredential indicates an expected call of DeleteUserAssignedIdentityFederatedCredential.
+func (mr *MockInterfaceMockRecorder) DeleteUserAssignedIdentityFederatedCredential(ctx, resourceGroup, identityName, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserAssignedIdentityFederatedCredential", reflect.TypeOf((*MockInterface)(nil).DeleteUserAssignedIdentityFederatedCredential), ctx, resourceGroup, identityName, name)
+}
+
 // GetApplication mocks base method.
 func (m *MockInterface) GetApplication(ctx context.Context, displayName string) (models.Applicationable, error) {
 	m.ctrl.T.Helper()
@@ -167,6 +211,21 @@ func (mr *MockInterfaceMockRecorder) GetApplication(ctx, displayName interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplication", reflect.TypeOf((*MockInterface)(nil).GetApplication), ctx, displayName)
 }
 
+// GetApplicationByAppID mocks base method.
+func (m *MockInterface) GetApplicationByAppID(ctx context.Context, appID string) (models.Applicationable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApplicationByAppID", ctx, appID)
+	ret0, _ := ret[0].(models.Applicationable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApplicationByAppID indicates an expected call of GetApplicationByAppID.
+func (mr *MockInterfaceMockRecorder) GetApplicationByAppID(ctx, appID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplicationByAppID", reflect.TypeOf((*MockInterface)(nil).GetApplicationByAppID), ctx, appID)
+}
+
 // GetFederatedCredential mocks base method.
 func (m *MockInterface) GetFederatedCredential(ctx context.Context, objectID, issuer, subject string) (models.FederatedIdentityCredentialable, error) {
 	m.ctrl.T.Helper()
@@ -211,3 +270,127 @@ func (mr *MockInterfaceMockRecorder) GetServicePrincipal(ctx, displayName interf
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServicePrincipal", reflect.TypeOf((*MockInterface)(nil).GetServicePrincipal), ctx, displayName)
 }
+
+// GetServicePrincipalByAppID mocks base method.
+func (m *MockInterface) GetServicePrincipalByAppID(ctx context.Context, appID string) (models.ServicePrincipalable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetServicePrincipalByAppID", ctx, appID)
+	ret0, _ := ret[0].(models.ServicePrincipalable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetServicePrincipalByAppID indicates an expected call of GetServicePrincipalByAppID.
+func (mr *MockInterfaceMockRecorder) GetServicePrincipalByAppID(ctx, appID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServicePrincipalByAppID", reflect.TypeOf((*MockInterface)(nil).GetServicePrincipalByAppID), ctx, appID)
+}
+
+// GetUserAssignedIdentity mocks base method.
+func (m *MockInterface) GetUserAssignedIdentity(ctx context.Context, resourceGroup, name string) (armmsi.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAssignedIdentity", ctx, resourceGroup, name)
+	ret0, _ := ret[0].(armmsi.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAssignedIdentity indicates an expected call of GetUserAssignedIdentity.
+func (mr *MockInterfaceMockRecorder) GetUserAssignedIdentity(ctx, resourceGroup, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAssignedIdentity", reflect.TypeOf((*MockInterface)(nil).GetUserAssignedIdentity), ctx, resourceGroup, name)
+}
+
+// GetUserAssignedIdentityFederatedCredential mocks base method.
+func (m *MockInterface) GetUserAssignedIdentityFederatedCredential(ctx context.Context, resourceGroup, identityName, issuer, subject string) (armmsi.FederatedIdentityCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAssignedIdentityFederatedCredential", ctx, resourceGroup, identityName, issuer, subject)
+	ret0, _ := ret[0].(armmsi.FederatedIdentityCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAssignedIdentityFederatedCredential indicates an expected call of GetUserAssignedIdentityFederatedCredential.
+func (mr *MockInterfaceMockRecorder) GetUserAssignedIdentityFederatedCredential(ctx, resourceGroup, identityName, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAssignedIdentityFederatedCredential", reflect.TypeOf((*MockInterface)(nil).GetUserAssignedIdentityFederatedCredential), ctx, resourceGroup, identityName, issuer, subject)
+}
+
+// ListFederatedCredentials mocks base method.
+func (m *MockInterface) ListFederatedCredentials(ctx context.Context, objectID string) ([]models.FederatedIdentityCredentialable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFederatedCredentials", ctx, objectID)
+	ret0, _ := ret[0].([]models.FederatedIdentityCredentialable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFederatedCredentials indicates an expected call of ListFederatedCredentials.
+func (mr *MockInterfaceMockRecorder) ListFederatedCredentials(ctx, objectID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFederatedCredentials", reflect.TypeOf((*MockInterface)(nil).ListFederatedCredentials), ctx, objectID)
+}
+
+// ListRoleAssignments mocks base method.
+func (m *MockInterface) ListRoleAssignments(ctx context.Context, principalID string, scopes ...string) ([]armauthorization.RoleAssignment, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, principalID}
+	for _, a := range scopes {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ListRoleAssignments", varargs...)
+	ret0, _ := ret[0].([]armauthorization.RoleAssignment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRoleAssignments indicates an expected call of ListRoleAssignments.
+func (mr *MockInterfaceMockRecorder) ListRoleAssignments(ctx, principalID interface{}, scopes ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, principalID}, scopes...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRoleAssignments", reflect.TypeOf((*MockInterface)(nil).ListRoleAssignments), varargs...)
+}
+
+// ListUserAssignedIdentityFederatedCredentials mocks base method.
+func (m *MockInterface) ListUserAssignedIdentityFederatedCredentials(ctx context.Context, resourceGroup, identityName string) ([]armmsi.FederatedIdentityCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserAssignedIdentityFederatedCredentials", ctx, resourceGroup, identityName)
+	ret0, _ := ret[0].([]armmsi.FederatedIdentityCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserAssignedIdentityFederatedCredentials indicates an expected call of ListUserAssignedIdentityFederatedCredentials.
+func (mr *MockInterfaceMockRecorder) ListUserAssignedIdentityFederatedCredentials(ctx, resourceGroup, identityName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserAssignedIdentityFederatedCredentials", reflect.TypeOf((*MockInterface)(nil).ListUserAssignedIdentityFederatedCredentials), ctx, resourceGroup, identityName)
+}
+
+// ListUserAssignedIdentityFederatedCredentialsByID mocks base method.
+func (m *MockInterface) ListUserAssignedIdentityFederatedCredentialsByID(ctx context.Context, resourceID string) ([]armmsi.FederatedIdentityCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserAssignedIdentityFederatedCredentialsByID", ctx, resourceID)
+	ret0, _ := ret[0].([]armmsi.FederatedIdentityCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserAssignedIdentityFederatedCredentialsByID indicates an expected call of ListUserAssignedIdentityFederatedCredentialsByID.
+func (mr *MockInterfaceMockRecorder) ListUserAssignedIdentityFederatedCredentialsByID(ctx, resourceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserAssignedIdentityFederatedCredentialsByID", reflect.TypeOf((*MockInterface)(nil).ListUserAssignedIdentityFederatedCredentialsByID), ctx, resourceID)
+}
+
+// UpdateFederatedCredential mocks base method.
+func (m *MockInterface) UpdateFederatedCredential(ctx context.Context, objectID, federatedCredentialID string, fic models.FederatedIdentityCredentialable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateFederatedCredential", ctx, objectID, federatedCredentialID, fic)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateFederatedCredential indicates an expected call of UpdateFederatedCredential.
+func (mr *MockInterfaceMockRecorder) UpdateFederatedCredential(ctx, objectID, federatedCredentialID, fic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFederatedCredential", reflect.TypeOf((*MockInterface)(nil).UpdateFederatedCredential), ctx, objectID, federatedCredentialID, fic)
+}
@@ -2,6 +2,9 @@ package cloud
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -16,6 +19,11 @@ const (
 	roleAssignmentCreateRetryDelay = 5 * time.Second
 )
 
+// roleAssignmentNamespace is the namespace of the name-based UUIDs of the role assignments created by azwi.
+// The role assignments API version of the SDK doesn't support descriptions, so the name of a role assignment
+// is what marks it as created by azwi.
+var roleAssignmentNamespace = uuid.MustParse("f36db2b8-8ebb-4191-accb-a708d20ac1f6")
+
 // CreateRoleAssignment creates a role assignment.
 func (c *AzureClient) CreateRoleAssignment(ctx context.Context, scope, roleName, principalID string) (armauthorization.RoleAssignment, error) {
 	var result armauthorization.RoleAssignment
@@ -25,6 +33,12 @@ func (c *AzureClient) CreateRoleAssignment(ctx context.Context, scope, roleName,
 		return result, errors.Wrapf(err, "failed to get role definition id for role %s", roleName)
 	}
 
+	if roleDefinitionID.ID == nil {
+		return result, errors.Errorf("role definition %s has no id", roleName)
+	}
+	// the name marks the role assignment as created by azwi
+	name := RoleAssignmentName(scope, *roleDefinitionID.ID, principalID)
+
 	mlog.Debug("Creating role assignment",
 		"principalID", principalID,
 		"role", roleName,
@@ -41,7 +55,7 @@ func (c *AzureClient) CreateRoleAssignment(ctx context.Context, scope, roleName,
 	// Trying to create role assignment immediately after service principal is created
 	// results in "PrincipalNotFound" error.
 	for i := 0; i < roleAssignmentCreateRetryCount; i++ {
-		resp, err := c.roleAssignmentsClient.Create(ctx, scope, uuid.New().String(), parameters, nil)
+		resp, err := c.roleAssignmentsClient.Create(ctx, scope, name, parameters, nil)
 		if err == nil {
 			return resp.RoleAssignment, nil
 		}
@@ -56,6 +70,65 @@ func (c *AzureClient) CreateRoleAssignment(ctx context.Context, scope, roleName,
 	return result, err
 }
 
+// ListRoleAssignments lists the role assignments of a principal at, above or below the subscription scope.
+// Since the role assignments in other subscriptions are not listed at the subscription scope, the role
+// assignments are also listed in the subscription of each scope outside of the subscription, or at the
+// scope itself if it is not in a subscription (e.g. a management group).
+func (c *AzureClient) ListRoleAssignments(ctx context.Context, principalID string, scopes ...string) ([]armauthorization.RoleAssignment, error) {
+	mlog.Debug("Listing role assignments", "principalID", principalID)
+
+	filter := getPrincipalIDFilter(principalID)
+	pager := c.roleAssignmentsClient.NewListPager(&armauthorization.RoleAssignmentsClientListOptions{
+		Filter: &filter,
+	})
+
+	var roleAssignments []armauthorization.RoleAssignment
+	seen := make(map[string]bool)
+	add := func(ras []*armauthorization.RoleAssignment) {
+		for _, ra := range ras {
+			if ra == nil {
+				continue
+			}
+			if ra.ID != nil {
+				if seen[strings.ToLower(*ra.ID)] {
+					continue
+				}
+				seen[strings.ToLower(*ra.ID)] = true
+			}
+			roleAssignments = append(roleAssignments, *ra)
+		}
+	}
+	for pager.More() {
+		nextResult, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list role assignments")
+		}
+		add(nextResult.Value)
+	}
+
+	listed := map[string]bool{getRoleAssignmentListScope("/subscriptions/" + c.subscriptionID): true}
+	for _, scope := range scopes {
+		listScope := getRoleAssignmentListScope(scope)
+		if listed[listScope] {
+			continue
+		}
+		listed[listScope] = true
+
+		mlog.Debug("Listing role assignments", "principalID", principalID, "scope", listScope)
+		pager := c.roleAssignmentsClient.NewListForScopePager(listScope, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+			Filter: &filter,
+		})
+		for pager.More() {
+			nextResult, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to list role assignments at scope %s", listScope)
+			}
+			add(nextResult.Value)
+		}
+	}
+	return roleAssignments, nil
+}
+
 // DeleteRoleAssignment deletes a role assignment.
 func (c *AzureClient) DeleteRoleAssignment(ctx context.Context, roleAssignmentID string) (armauthorization.RoleAssignment, error) {
 	mlog.Debug("Deleting role assignment", "id", roleAssignmentID)
@@ -65,3 +138,36 @@ func (c *AzureClient) DeleteRoleAssignment(ctx context.Context, roleAssignmentID
 	}
 	return resp.RoleAssignment, nil
 }
+
+// RoleAssignmentName returns the name of the role assignment of the role definition to the principal at the scope
+// that is created by azwi. The name is a UUID derived from the scope, the GUID of the role definition and the
+// principal ID, since the ID of a role definition may or may not contain the subscription.
+func RoleAssignmentName(scope, roleDefinitionID, principalID string) string {
+	key := strings.Join([]string{
+		strings.ToLower(strings.TrimSuffix(scope, "/")),
+		strings.ToLower(path.Base(roleDefinitionID)),
+		strings.ToLower(principalID),
+	}, "|")
+	return uuid.NewSHA1(roleAssignmentNamespace, []byte(key)).String()
+}
+
+// IsCreatedByAzwi returns true if the role assignment with the ID was created by azwi for the
+// role definition, the scope and the principal
+func IsCreatedByAzwi(roleAssignmentID, roleDefinitionID, scope, principalID string) bool {
+	return strings.EqualFold(path.Base(roleAssignmentID), RoleAssignmentName(scope, roleDefinitionID, principalID))
+}
+
+// getPrincipalIDFilter returns a filter string for the given principal ID.
+func getPrincipalIDFilter(principalID string) string {
+	return fmt.Sprintf("principalId eq '%s'", principalID)
+}
+
+// getRoleAssignmentListScope returns the scope at which the role assignments of a principal at the scope
+// are listed, which is the subscription of the scope, or the scope itself if it is not in a subscription.
+func getRoleAssignmentListScope(scope string) string {
+	scope = strings.ToLower(strings.TrimSuffix(scope, "/"))
+	if parts := strings.Split(scope, "/"); len(parts) >= 3 && parts[0] == "" && parts[1] == "subscriptions" {
+		return strings.Join(parts[:3], "/")
+	}
+	return scope
+}
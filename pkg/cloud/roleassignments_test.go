@@ -0,0 +1,95 @@
+package cloud
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetPrincipalIDFilter(t *testing.T) {
+	got := getPrincipalIDFilter("test")
+	want := "principalId eq 'test'"
+
+	if got != want {
+		t.Errorf("getPrincipalIDFilter() = %v, want %v", got, want)
+	}
+}
+
+func TestGetRoleAssignmentListScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  string
+	}{
+		{
+			scope: "/subscriptions/sub",
+			want:  "/subscriptions/sub",
+		},
+		{
+			scope: "/subscriptions/SUB/resourceGroups/rg/",
+			want:  "/subscriptions/sub",
+		},
+		{
+			scope: "/providers/Microsoft.Management/managementGroups/mg",
+			want:  "/providers/microsoft.management/managementgroups/mg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			if got := getRoleAssignmentListScope(tt.scope); got != tt.want {
+				t.Errorf("getRoleAssignmentListScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleAssignmentName(t *testing.T) {
+	name := RoleAssignmentName("/subscriptions/sub/resourceGroups/rg", "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/reader", "principal-id")
+	if _, err := uuid.Parse(name); err != nil {
+		t.Fatalf("expected the name to be a UUID, got %q: %v", name, err)
+	}
+
+	tests := []struct {
+		name             string
+		scope            string
+		roleDefinitionID string
+		principalID      string
+		want             bool
+	}{
+		{
+			name:             "same role assignment",
+			scope:            "/subscriptions/sub/resourceGroups/rg",
+			roleDefinitionID: "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/reader",
+			principalID:      "principal-id",
+			want:             true,
+		},
+		{
+			name:             "role definition without subscription and scope with different casing",
+			scope:            "/subscriptions/sub/resourceGroups/RG/",
+			roleDefinitionID: "/providers/Microsoft.Authorization/roleDefinitions/reader",
+			principalID:      "principal-id",
+			want:             true,
+		},
+		{
+			name:             "different scope",
+			scope:            "/subscriptions/sub",
+			roleDefinitionID: "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/reader",
+			principalID:      "principal-id",
+		},
+		{
+			name:             "different principal",
+			scope:            "/subscriptions/sub/resourceGroups/rg",
+			roleDefinitionID: "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/reader",
+			principalID:      "other-principal-id",
+		},
+	}
+
+	id := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Authorization/roleAssignments/" + name
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCreatedByAzwi(id, tt.roleDefinitionID, tt.scope, tt.principalID); got != tt.want {
+				t.Errorf("IsCreatedByAzwi() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
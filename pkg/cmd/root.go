@@ -59,6 +59,7 @@ func NewRootCmd() *cobra.Command {
 
 	cmd.AddCommand(version.NewVersionCmd())
 	cmd.AddCommand(serviceaccount.NewServiceAccountCmd())
+	cmd.AddCommand(serviceaccount.NewApplyCmd())
 	cmd.AddCommand(jwks.NewJWKSCmd())
 	cmd.AddCommand(podidentity.NewPodIdentityCmd())
 
@@ -0,0 +1,654 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"monis.app/mlog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/auth"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/binding"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	phases "github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/create"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
+)
+
+const (
+	applyLongDescription = `Reconcile the Azure identities, federated identity credentials, role assignments and Kubernetes
+service accounts declared by WorkloadIdentityBinding manifests. The changes are printed before they are applied.
+Use --dry-run to only print the changes. With --prune, only the role assignments created by azwi are deleted.`
+)
+
+type changeAction string
+
+const (
+	changeCreate    changeAction = "create"
+	changeUpdate    changeAction = "update"
+	changeDelete    changeAction = "delete"
+	changeUnchanged changeAction = "unchanged"
+)
+
+// symbol returns the symbol of the action in the printed plan
+func (a changeAction) symbol() string {
+	switch a {
+	case changeCreate:
+		return "+"
+	case changeUpdate:
+		return "~"
+	case changeDelete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// change is a planned change to a resource of a WorkloadIdentityBinding
+type change struct {
+	action   changeAction
+	identity string
+	resource string
+	name     string
+	apply    func(ctx context.Context) error
+}
+
+// federatedCredential is a federated identity credential of an AAD application
+// or a user-assigned managed identity
+type federatedCredential struct {
+	// id is the ID of the federated identity credential of an AAD application
+	// or the name of the federated identity credential of a user-assigned managed identity
+	id        string
+	issuer    string
+	subject   string
+	audiences []string
+}
+
+// roleAssignment is a role assignment of an Azure identity
+type roleAssignment struct {
+	id               string
+	roleDefinitionID string
+	scope            string
+}
+
+// identityGroup holds the bindings that share an Azure identity
+type identityGroup struct {
+	key      string
+	data     *createData
+	bindings []*binding.WorkloadIdentityBinding
+}
+
+type applyCmd struct {
+	filenames    []string
+	prune        bool
+	dryRun       bool
+	authProvider auth.Provider
+	kubeClient   client.Client
+}
+
+// NewApplyCmd returns a new apply command
+func NewApplyCmd() *cobra.Command {
+	authProvider := auth.NewProvider()
+	applyCmd := &applyCmd{
+		authProvider: authProvider,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply WorkloadIdentityBinding manifests",
+		Long:  applyLongDescription,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// run root command pre-run to register the debug flag
+			if cmd.Root() != nil && cmd.Root().PersistentPreRunE != nil {
+				if err := cmd.Root().PersistentPreRunE(cmd.Root(), args); err != nil {
+					return err
+				}
+			}
+			return authProvider.Validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return applyCmd.run(context.Background(), cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	// auth flags are the same as the ones of the serviceaccount command
+	authProvider.AddFlags(cmd.PersistentFlags())
+
+	f := cmd.Flags()
+	f.StringSliceVarP(&applyCmd.filenames, "filename", "f", nil, "Files that contain the WorkloadIdentityBinding manifests, or - to read from stdin")
+	f.BoolVar(&applyCmd.prune, "prune", false, "Delete the federated identity credentials and the role assignments created by azwi of the declared identities that are no longer declared")
+	f.BoolVar(&applyCmd.dryRun, "dry-run", false, "Print the changes without applying them")
+	_ = cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+func (ac *applyCmd) run(ctx context.Context, stdin io.Reader, out io.Writer) error {
+	bindings, err := binding.Load(ac.filenames, stdin)
+	if err != nil {
+		return err
+	}
+	if len(bindings) == 0 {
+		return errors.Errorf("no %s found", binding.Kind)
+	}
+
+	if ac.kubeClient == nil {
+		if ac.kubeClient, err = kuberneteshelper.GetKubeClient(); err != nil {
+			return errors.Wrap(err, "failed to get kubernetes client")
+		}
+	}
+
+	changes, err := ac.plan(ctx, bindings)
+	if err != nil {
+		return errors.Wrap(err, "failed to plan changes")
+	}
+	if !printPlan(out, changes) || ac.dryRun {
+		return nil
+	}
+
+	for _, c := range changes {
+		if c.action == changeUnchanged {
+			continue
+		}
+		if err := c.apply(ctx); err != nil {
+			return errors.Wrapf(err, "failed to %s %s %s", c.action, c.resource, c.name)
+		}
+		mlog.WithValues("identity", c.identity, "name", c.name).Info(fmt.Sprintf("%s %s", c.action, c.resource))
+	}
+
+	return nil
+}
+
+// plan computes the changes that reconcile the bindings. Bindings that share an
+// Azure identity are planned together so that pruning considers all of them.
+func (ac *applyCmd) plan(ctx context.Context, bindings []binding.WorkloadIdentityBinding) ([]change, error) {
+	var groups []*identityGroup
+	byKey := make(map[string]*identityGroup)
+	for i := range bindings {
+		b := &bindings[i]
+		g, ok := byKey[b.IdentityKey()]
+		if !ok {
+			g = &identityGroup{key: b.IdentityKey(), data: ac.newCreateData(b)}
+			byKey[g.key] = g
+			groups = append(groups, g)
+		}
+		g.bindings = append(g.bindings, b)
+	}
+
+	var changes []change
+	for _, g := range groups {
+		c, err := ac.planIdentityGroup(ctx, g)
+		if err != nil {
+			return nil, errors.Wrapf(err, "identity %s", g.key)
+		}
+		changes = append(changes, c...)
+	}
+	return changes, nil
+}
+
+func (ac *applyCmd) planIdentityGroup(ctx context.Context, g *identityGroup) ([]change, error) {
+	identityChange, err := planIdentity(g)
+	if err != nil {
+		return nil, err
+	}
+	exists := identityChange.action == changeUnchanged
+	changes := []change{identityChange}
+
+	for _, b := range g.bindings {
+		c, err := ac.planServiceAccount(ctx, g, b, exists)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	c, err := ac.planFederatedCredentials(ctx, g, exists)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, c...)
+
+	c, err = ac.planRoleAssignments(ctx, g, exists)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, c...), nil
+}
+
+// planIdentity plans the creation of the AAD application and its service principal,
+// or the user-assigned managed identity, with the existing create phases.
+func planIdentity(g *identityGroup) (change, error) {
+	d := g.data
+	c := change{action: changeUnchanged, identity: g.key}
+
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		c.resource = "user-assigned managed identity"
+		c.name = fmt.Sprintf("%s/%s", d.ManagedIdentityResourceGroup(), d.ManagedIdentityName())
+		c.apply = func(ctx context.Context) error {
+			return runPhases(d, phases.NewManagedIdentityPhase())
+		}
+		if _, err := d.ManagedIdentity(); err != nil {
+			if !cloud.IsNotFound(err) {
+				return c, errors.Wrap(err, "failed to get user-assigned managed identity")
+			}
+			if d.ManagedIdentityLocation() == "" {
+				return c, errors.Errorf("user-assigned managed identity %s not found and spec.identity.location is not set", c.name)
+			}
+			c.action = changeCreate
+		}
+		return c, nil
+	}
+
+	c.resource = "aad application"
+	c.name = d.AADApplicationName()
+	c.apply = func(ctx context.Context) error {
+		return runPhases(d, phases.NewAADApplicationPhase())
+	}
+	if _, err := d.AADApplication(); err != nil {
+		if !cloud.IsNotFound(err) {
+			return c, errors.Wrap(err, "failed to get AAD application")
+		}
+		c.action = changeCreate
+		return c, nil
+	}
+	if _, err := d.ServicePrincipal(); err != nil {
+		if !cloud.IsNotFound(err) {
+			return c, errors.Wrap(err, "failed to get service principal")
+		}
+		c.action = changeCreate
+		c.resource = "service principal"
+	}
+	return c, nil
+}
+
+// planServiceAccount plans the creation or the update of the Kubernetes service account
+// with the existing service-account phase.
+func (ac *applyCmd) planServiceAccount(ctx context.Context, g *identityGroup, b *binding.WorkloadIdentityBinding, identityExists bool) (change, error) {
+	d := ac.newCreateData(b)
+	namespace, name := b.Spec.ServiceAccount.Namespace, b.Spec.ServiceAccount.Name
+	c := change{
+		action:   changeCreate,
+		identity: g.key,
+		resource: "service account",
+		name:     fmt.Sprintf("%s/%s", namespace, name),
+		apply: func(ctx context.Context) error {
+			return runPhases(d, phases.NewServiceAccountPhase())
+		},
+	}
+
+	sa, err := kuberneteshelper.GetServiceAccount(ctx, ac.kubeClient, namespace, name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return c, errors.Wrap(err, "failed to get service account")
+		}
+		return c, nil
+	}
+
+	c.action = changeUpdate
+	if identityExists {
+		c.action = changeUnchanged
+		for k, v := range kuberneteshelper.ServiceAccountAnnotations(clientID(g.data), d.AzureTenantID(), d.ServiceAccountTokenExpiration()) {
+			if sa.Annotations[k] != v {
+				c.action = changeUpdate
+			}
+		}
+	}
+	return c, nil
+}
+
+func (ac *applyCmd) planFederatedCredentials(ctx context.Context, g *identityGroup, identityExists bool) ([]change, error) {
+	d := g.data
+	var existing []federatedCredential
+	if identityExists {
+		var err error
+		if existing, err = listFederatedCredentials(ctx, d); err != nil {
+			return nil, errors.Wrap(err, "failed to list federated identity credentials")
+		}
+	}
+
+	var changes []change
+	matched := make(map[string]bool)
+	issuers := make(map[string]bool)
+	for _, b := range g.bindings {
+		issuers[b.Spec.IssuerURL] = true
+		fic := federatedCredential{
+			issuer:    b.Spec.IssuerURL,
+			subject:   b.Subject(),
+			audiences: b.Audiences(),
+		}
+		c := change{
+			action:   changeCreate,
+			identity: g.key,
+			resource: "federated identity credential",
+			name:     fmt.Sprintf("%s (issuer %s)", fic.subject, fic.issuer),
+		}
+		for _, e := range existing {
+			if e.issuer == fic.issuer && e.subject == fic.subject {
+				matched[e.id] = true
+				fic.id = e.id
+				c.action = changeUnchanged
+				if !sameAudiences(e.audiences, fic.audiences) {
+					c.action = changeUpdate
+				}
+				break
+			}
+		}
+
+		b := b
+		switch c.action {
+		case changeCreate:
+			c.apply = func(ctx context.Context) error {
+				return addFederatedCredential(ctx, d, b, fic)
+			}
+		case changeUpdate:
+			c.apply = func(ctx context.Context) error {
+				return updateFederatedCredential(ctx, d, fic)
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	if !ac.prune {
+		return changes, nil
+	}
+	// only the federated identity credentials of the declared issuers are pruned,
+	// as the identity might be federated with service accounts of other clusters
+	for _, e := range existing {
+		if matched[e.id] || !issuers[e.issuer] {
+			continue
+		}
+		e := e
+		changes = append(changes, change{
+			action:   changeDelete,
+			identity: g.key,
+			resource: "federated identity credential",
+			name:     fmt.Sprintf("%s (issuer %s)", e.subject, e.issuer),
+			apply: func(ctx context.Context) error {
+				return deleteFederatedCredential(ctx, d, e)
+			},
+		})
+	}
+	return changes, nil
+}
+
+func (ac *applyCmd) planRoleAssignments(ctx context.Context, g *identityGroup, identityExists bool) ([]change, error) {
+	d := g.data
+
+	// deduplicate the role assignments declared by the bindings of the identity
+	var (
+		declared []binding.RoleAssignment
+		scopes   []string
+	)
+	seen := make(map[string]bool)
+	for _, b := range g.bindings {
+		for _, ra := range b.Spec.RoleAssignments {
+			key := util.GetRoleAssignmentKey(ra.Role, ra.Scope)
+			if !seen[key] {
+				seen[key] = true
+				declared = append(declared, ra)
+				scopes = append(scopes, ra.Scope)
+			}
+		}
+	}
+
+	var (
+		changes  []change
+		existing []roleAssignment
+		matched  = make(map[string]bool)
+	)
+	if identityExists {
+		ras, err := d.AzureClient().ListRoleAssignments(ctx, principalID(d), scopes...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list role assignments")
+		}
+		for _, ra := range ras {
+			if ra.ID == nil || ra.Properties == nil || ra.Properties.RoleDefinitionID == nil || ra.Properties.Scope == nil {
+				continue
+			}
+			existing = append(existing, roleAssignment{
+				id:               *ra.ID,
+				roleDefinitionID: *ra.Properties.RoleDefinitionID,
+				scope:            *ra.Properties.Scope,
+			})
+		}
+	}
+
+	for _, ra := range declared {
+		ra := ra
+		c := change{
+			action:   changeCreate,
+			identity: g.key,
+			resource: "role assignment",
+			name:     fmt.Sprintf("%q on %s", ra.Role, ra.Scope),
+			apply: func(ctx context.Context) error {
+				_, err := d.AzureClient().CreateRoleAssignment(ctx, ra.Scope, ra.Role, principalID(d))
+				if err != nil && !cloud.IsRoleAssignmentExists(err) {
+					return err
+				}
+				return nil
+			},
+		}
+		if len(existing) > 0 {
+			rd, err := d.AzureClient().GetRoleDefinitionIDByName(ctx, "", ra.Role)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get role definition id for role %s", ra.Role)
+			}
+			for _, e := range existing {
+				if rd.ID != nil && util.IsSameRoleAssignment(e.roleDefinitionID, e.scope, *rd.ID, ra.Scope) {
+					matched[e.id] = true
+					c.action = changeUnchanged
+				}
+			}
+		}
+		changes = append(changes, c)
+	}
+
+	if !ac.prune {
+		return changes, nil
+	}
+	// only the role assignments created by azwi are pruned, as the identity might have been granted
+	// other roles outside of the bindings. Role assignments inherited from management groups are not pruned.
+	for _, e := range existing {
+		if matched[e.id] || !strings.HasPrefix(strings.ToLower(e.scope), "/subscriptions/") ||
+			!cloud.IsCreatedByAzwi(e.id, e.roleDefinitionID, e.scope, principalID(d)) {
+			continue
+		}
+		id := e.id
+		changes = append(changes, change{
+			action:   changeDelete,
+			identity: g.key,
+			resource: "role assignment",
+			name:     fmt.Sprintf("%s on %s", path.Base(e.roleDefinitionID), e.scope),
+			apply: func(ctx context.Context) error {
+				_, err := d.AzureClient().DeleteRoleAssignment(ctx, id)
+				if err != nil && !cloud.IsRoleAssignmentAlreadyDeleted(err) {
+					return err
+				}
+				return nil
+			},
+		})
+	}
+	return changes, nil
+}
+
+// newCreateData returns the data of the create phases for the binding.
+func (ac *applyCmd) newCreateData(b *binding.WorkloadIdentityBinding) *createData {
+	d := &createData{
+		serviceAccountName:            b.Spec.ServiceAccount.Name,
+		serviceAccountNamespace:       b.Spec.ServiceAccount.Namespace,
+		serviceAccountIssuerURL:       b.Spec.IssuerURL,
+		serviceAccountTokenExpiration: b.ServiceAccountTokenExpiration(),
+		identityType:                  b.Spec.Identity.Type,
+		authProvider:                  ac.authProvider,
+		kubeClient:                    ac.kubeClient,
+	}
+	if b.Spec.Identity.Type == options.IdentityTypeUAMI {
+		d.managedIdentityName = b.Spec.Identity.Name
+		d.managedIdentityResourceGroup = b.Spec.Identity.ResourceGroup
+		d.managedIdentityLocation = b.Spec.Identity.Location
+	} else {
+		d.aadApplicationName = b.Spec.Identity.Name
+	}
+	return d
+}
+
+// printPlan prints the changes and returns true if there is any change to apply.
+func printPlan(w io.Writer, changes []change) bool {
+	counts := make(map[changeAction]int)
+	identity := ""
+	for _, c := range changes {
+		if c.identity != identity {
+			identity = c.identity
+			fmt.Fprintf(w, "%s:\n", identity)
+		}
+		counts[c.action]++
+		fmt.Fprintf(w, "  %s %s %s\n", c.action.symbol(), c.resource, c.name)
+	}
+
+	if counts[changeCreate]+counts[changeUpdate]+counts[changeDelete] == 0 {
+		fmt.Fprintln(w, "\nNo changes.")
+		return false
+	}
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete, %d unchanged.\n",
+		counts[changeCreate], counts[changeUpdate], counts[changeDelete], counts[changeUnchanged])
+	return true
+}
+
+// runPhases runs the phases of the create workflow with the data.
+func runPhases(data *createData, p ...workflow.Phase) error {
+	runner := workflow.NewPhaseRunner()
+	runner.AppendPhases(p...)
+	return runner.Run(data)
+}
+
+// clientID returns the client ID of the AAD application or the user-assigned managed identity.
+func clientID(d *createData) string {
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		return d.ManagedIdentityClientID()
+	}
+	return d.AADApplicationClientID()
+}
+
+// principalID returns the object ID of the service principal or the principal ID of the user-assigned managed identity.
+func principalID(d *createData) string {
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		return d.ManagedIdentityPrincipalID()
+	}
+	return d.ServicePrincipalObjectID()
+}
+
+func listFederatedCredentials(ctx context.Context, d *createData) ([]federatedCredential, error) {
+	var fics []federatedCredential
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		list, err := d.AzureClient().ListUserAssignedIdentityFederatedCredentials(ctx, d.ManagedIdentityResourceGroup(), d.ManagedIdentityName())
+		if err != nil {
+			return nil, err
+		}
+		for _, fic := range list {
+			if fic.Name == nil || fic.Properties == nil || fic.Properties.Issuer == nil || fic.Properties.Subject == nil {
+				continue
+			}
+			var audiences []string
+			for _, audience := range fic.Properties.Audiences {
+				if audience != nil {
+					audiences = append(audiences, *audience)
+				}
+			}
+			fics = append(fics, federatedCredential{
+				id:        *fic.Name,
+				issuer:    *fic.Properties.Issuer,
+				subject:   *fic.Properties.Subject,
+				audiences: audiences,
+			})
+		}
+		return fics, nil
+	}
+
+	list, err := d.AzureClient().ListFederatedCredentials(ctx, d.AADApplicationObjectID())
+	if err != nil {
+		return nil, err
+	}
+	for _, fic := range list {
+		if fic.GetId() == nil || fic.GetIssuer() == nil || fic.GetSubject() == nil {
+			continue
+		}
+		fics = append(fics, federatedCredential{
+			id:        *fic.GetId(),
+			issuer:    *fic.GetIssuer(),
+			subject:   *fic.GetSubject(),
+			audiences: fic.GetAudiences(),
+		})
+	}
+	return fics, nil
+}
+
+func addFederatedCredential(ctx context.Context, d *createData, b *binding.WorkloadIdentityBinding, fic federatedCredential) error {
+	namespace, name := b.Spec.ServiceAccount.Namespace, b.Spec.ServiceAccount.Name
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		fic.id = util.GetManagedIdentityFederatedCredentialName(namespace, name, fic.issuer)
+		return updateFederatedCredential(ctx, d, fic)
+	}
+
+	gfic := models.NewFederatedIdentityCredential()
+	gfic.SetAudiences(fic.audiences)
+	gfic.SetDescription(to.Ptr(fmt.Sprintf("Federated Service Account for %s/%s", namespace, name)))
+	gfic.SetIssuer(to.Ptr(fic.issuer))
+	gfic.SetSubject(to.Ptr(fic.subject))
+	gfic.SetName(to.Ptr(util.GetFederatedCredentialName(namespace, name, fic.issuer)))
+	err := d.AzureClient().AddFederatedCredential(ctx, d.AADApplicationObjectID(), gfic)
+	if err != nil && !cloud.IsFederatedCredentialAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func updateFederatedCredential(ctx context.Context, d *createData, fic federatedCredential) error {
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		return d.AzureClient().AddUserAssignedIdentityFederatedCredential(ctx, d.ManagedIdentityResourceGroup(), d.ManagedIdentityName(), fic.id, armmsi.FederatedIdentityCredential{
+			Properties: &armmsi.FederatedIdentityCredentialProperties{
+				Audiences: to.SliceOfPtrs(fic.audiences...),
+				Issuer:    to.Ptr(fic.issuer),
+				Subject:   to.Ptr(fic.subject),
+			},
+		})
+	}
+
+	gfic := models.NewFederatedIdentityCredential()
+	gfic.SetAudiences(fic.audiences)
+	return d.AzureClient().UpdateFederatedCredential(ctx, d.AADApplicationObjectID(), fic.id, gfic)
+}
+
+func deleteFederatedCredential(ctx context.Context, d *createData, fic federatedCredential) error {
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		return d.AzureClient().DeleteUserAssignedIdentityFederatedCredential(ctx, d.ManagedIdentityResourceGroup(), d.ManagedIdentityName(), fic.id)
+	}
+	return d.AzureClient().DeleteFederatedCredential(ctx, d.AADApplicationObjectID(), fic.id)
+}
+
+// sameAudiences returns true if a and b contain the same audiences regardless of the order.
+func sameAudiences(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+package serviceaccount
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/golang/mock/gomock"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	testIssuerURL = "https://issuer.example.com/"
+	testScope     = "/subscriptions/sub/resourceGroups/rg"
+	testTenantID  = "tenant-id"
+
+	uamiBinding = `apiVersion: azwi.azure.com/v1alpha1
+kind: WorkloadIdentityBinding
+metadata:
+  name: app
+spec:
+  issuerURL: https://issuer.example.com/
+  identity:
+    type: uami
+    name: mi
+    resourceGroup: rg
+  roleAssignments:
+  - role: Reader
+    scope: /subscriptions/sub/resourceGroups/rg
+`
+	aadApplicationBinding = `apiVersion: azwi.azure.com/v1alpha1
+kind: WorkloadIdentityBinding
+metadata:
+  name: app
+spec:
+  issuerURL: https://issuer.example.com/
+  identity:
+    name: aad-application-name
+  roleAssignments:
+  - role: Reader
+    scope: /subscriptions/sub/resourceGroups/rg
+`
+)
+
+func TestApplyManagedIdentity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(testServiceAccount("old-client-id")).Build()
+	m := mock_cloud.NewMockInterface(ctrl)
+	m.EXPECT().GetUserAssignedIdentity(gomock.Any(), "rg", "mi").Return(testManagedIdentity(appID, objectID), nil).AnyTimes()
+	m.EXPECT().ListUserAssignedIdentityFederatedCredentials(gomock.Any(), "rg", "mi").Return([]armmsi.FederatedIdentityCredential{
+		testManagedIdentityFederatedCredential("fic-1", testIssuerURL, "system:serviceaccount:default:app", webhook.DefaultAudience, "api://old"),
+		testManagedIdentityFederatedCredential("fic-2", testIssuerURL, "system:serviceaccount:default:old", webhook.DefaultAudience),
+		testManagedIdentityFederatedCredential("fic-3", "https://other.example.com/", "system:serviceaccount:default:old", webhook.DefaultAudience),
+	}, nil)
+	// only the role assignment created by azwi that is no longer declared is pruned
+	createdByAzwi := "/subscriptions/sub/providers/Microsoft.Authorization/roleAssignments/" +
+		cloud.RoleAssignmentName("/subscriptions/sub", "contributor", objectID)
+	m.EXPECT().ListRoleAssignments(gomock.Any(), objectID, "/subscriptions/sub/resourceGroups/rg").Return([]armauthorization.RoleAssignment{
+		testRoleAssignment("ra-1", "reader", "/subscriptions/sub/resourceGroups/RG/"),
+		testRoleAssignment(createdByAzwi, "contributor", "/subscriptions/sub"),
+		testRoleAssignment("ra-3", "owner", "/providers/Microsoft.Management/managementGroups/mg"),
+		testRoleAssignment("ra-4", "owner", "/subscriptions/sub"),
+	}, nil)
+	m.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{
+		ID: to.Ptr("/providers/Microsoft.Authorization/roleDefinitions/reader"),
+	}, nil)
+
+	// changes
+	m.EXPECT().AddUserAssignedIdentityFederatedCredential(gomock.Any(), "rg", "mi", "fic-1", armmsi.FederatedIdentityCredential{
+		Properties: &armmsi.FederatedIdentityCredentialProperties{
+			Audiences: []*string{to.Ptr(webhook.DefaultAudience)},
+			Issuer:    to.Ptr(testIssuerURL),
+			Subject:   to.Ptr("system:serviceaccount:default:app"),
+		},
+	}).Return(nil)
+	m.EXPECT().DeleteUserAssignedIdentityFederatedCredential(gomock.Any(), "rg", "mi", "fic-2").Return(nil)
+	m.EXPECT().DeleteRoleAssignment(gomock.Any(), createdByAzwi).Return(armauthorization.RoleAssignment{}, nil)
+
+	ac := newTestApplyCmd(t, uamiBinding, m, kubeClient)
+	ac.prune = true
+	out := &bytes.Buffer{}
+	if err := ac.run(context.Background(), nil, out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	want := `uami/rg/mi:
+    user-assigned managed identity rg/mi
+  ~ service account default/app
+  ~ federated identity credential system:serviceaccount:default:app (issuer https://issuer.example.com/)
+  - federated identity credential system:serviceaccount:default:old (issuer https://issuer.example.com/)
+    role assignment "Reader" on /subscriptions/sub/resourceGroups/rg
+  - role assignment contributor on /subscriptions/sub
+
+Plan: 0 to create, 2 to update, 2 to delete, 2 unchanged.
+`
+	if out.String() != want {
+		t.Errorf("expected plan:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := kubeClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, sa); err != nil {
+		t.Fatalf("failed to get service account: %v", err)
+	}
+	if sa.Annotations[webhook.ClientIDAnnotation] != appID {
+		t.Errorf("expected service account to be updated with client id %s, got %s", appID, sa.Annotations[webhook.ClientIDAnnotation])
+	}
+}
+
+func TestApplyAADApplication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().Build()
+	m := mock_cloud.NewMockInterface(ctrl)
+	gomock.InOrder(
+		m.EXPECT().GetApplication(gomock.Any(), appName).Return(nil, errors.New("application not found")).Times(2),
+		m.EXPECT().GetApplication(gomock.Any(), appName).Return(testApplication(appID, objectID), nil).AnyTimes(),
+	)
+	gomock.InOrder(
+		m.EXPECT().GetServicePrincipal(gomock.Any(), appName).Return(nil, errors.New("service principal not found")),
+		m.EXPECT().GetServicePrincipal(gomock.Any(), appName).Return(testServicePrincipal(appID, "service-principal-object-id"), nil).AnyTimes(),
+	)
+	app := testApplication(appID, objectID)
+	app.SetDisplayName(to.Ptr(appName))
+	sp := testServicePrincipal(appID, "service-principal-object-id")
+	sp.SetDisplayName(to.Ptr(appName))
+	m.EXPECT().CreateApplication(gomock.Any(), appName).Return(app, nil)
+	m.EXPECT().CreateServicePrincipal(gomock.Any(), appID, gomock.Any()).Return(sp, nil)
+	m.EXPECT().AddFederatedCredential(gomock.Any(), objectID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, fic models.FederatedIdentityCredentialable) error {
+		if *fic.GetIssuer() != testIssuerURL || *fic.GetSubject() != "system:serviceaccount:default:app" {
+			t.Errorf("unexpected federated identity credential issuer %s and subject %s", *fic.GetIssuer(), *fic.GetSubject())
+		}
+		return nil
+	})
+	m.EXPECT().CreateRoleAssignment(gomock.Any(), testScope, "Reader", "service-principal-object-id").Return(armauthorization.RoleAssignment{}, nil)
+
+	ac := newTestApplyCmd(t, aadApplicationBinding, m, kubeClient)
+	out := &bytes.Buffer{}
+	if err := ac.run(context.Background(), nil, out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	want := `aad-application/aad-application-name:
+  + aad application aad-application-name
+  + service account default/app
+  + federated identity credential system:serviceaccount:default:app (issuer https://issuer.example.com/)
+  + role assignment "Reader" on /subscriptions/sub/resourceGroups/rg
+
+Plan: 4 to create, 0 to update, 0 to delete, 0 unchanged.
+`
+	if out.String() != want {
+		t.Errorf("expected plan:\n%s\ngot:\n%s", want, out.String())
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := kubeClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, sa); err != nil {
+		t.Fatalf("expected service account to be created: %v", err)
+	}
+	if sa.Annotations[webhook.ClientIDAnnotation] != appID {
+		t.Errorf("expected client id %s, got %s", appID, sa.Annotations[webhook.ClientIDAnnotation])
+	}
+}
+
+func TestApplyNoChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(testServiceAccount(appID)).Build()
+	m := mock_cloud.NewMockInterface(ctrl)
+	m.EXPECT().GetUserAssignedIdentity(gomock.Any(), "rg", "mi").Return(testManagedIdentity(appID, objectID), nil).AnyTimes()
+	m.EXPECT().ListUserAssignedIdentityFederatedCredentials(gomock.Any(), "rg", "mi").Return([]armmsi.FederatedIdentityCredential{
+		testManagedIdentityFederatedCredential("fic-1", testIssuerURL, "system:serviceaccount:default:app", webhook.DefaultAudience),
+	}, nil)
+	m.EXPECT().ListRoleAssignments(gomock.Any(), objectID, "/subscriptions/sub/resourceGroups/rg").Return([]armauthorization.RoleAssignment{
+		testRoleAssignment("ra-1", "reader", testScope),
+		testRoleAssignment("ra-2", "contributor", "/subscriptions/sub"),
+	}, nil)
+	m.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{
+		ID: to.Ptr("/providers/Microsoft.Authorization/roleDefinitions/reader"),
+	}, nil)
+
+	// the role assignment that is not declared is kept without --prune
+	ac := newTestApplyCmd(t, uamiBinding, m, kubeClient)
+	out := &bytes.Buffer{}
+	if err := ac.run(context.Background(), nil, out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("\nNo changes.\n")) {
+		t.Errorf("expected no changes, got:\n%s", out.String())
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().Build()
+	m := mock_cloud.NewMockInterface(ctrl)
+	m.EXPECT().GetApplication(gomock.Any(), appName).Return(nil, errors.New("application not found"))
+
+	// no changes are applied in dry-run mode
+	ac := newTestApplyCmd(t, aadApplicationBinding, m, kubeClient)
+	ac.dryRun = true
+	out := &bytes.Buffer{}
+	if err := ac.run(context.Background(), nil, out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("\nPlan: 4 to create, 0 to update, 0 to delete, 0 unchanged.\n")) {
+		t.Errorf("expected plan, got:\n%s", out.String())
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := kubeClient.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, sa); err == nil {
+		t.Errorf("expected service account not to be created")
+	}
+}
+
+func TestApplyManagedIdentityNotFoundWithoutLocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m := mock_cloud.NewMockInterface(ctrl)
+	m.EXPECT().GetUserAssignedIdentity(gomock.Any(), "rg", "mi").Return(armmsi.Identity{}, errors.New("resource not found"))
+
+	ac := newTestApplyCmd(t, uamiBinding, m, fake.NewClientBuilder().Build())
+	err := ac.run(context.Background(), nil, &bytes.Buffer{})
+	if err == nil || err.Error() != "failed to plan changes: identity uami/rg/mi: user-assigned managed identity rg/mi not found and spec.identity.location is not set" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func newTestApplyCmd(t *testing.T, manifest string, m *mock_cloud.MockInterface, kubeClient client.Client) *applyCmd {
+	path := filepath.Join(t.TempDir(), "binding.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &applyCmd{
+		filenames: []string{path},
+		authProvider: &mockAuthProvider{
+			azureClient:   m,
+			azureTenantID: testTenantID,
+		},
+		kubeClient: kubeClient,
+	}
+}
+
+func testServiceAccount(clientID string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Annotations: kuberneteshelper.ServiceAccountAnnotations(clientID, testTenantID, time.Duration(webhook.DefaultServiceAccountTokenExpiration)*time.Second),
+		},
+	}
+}
+
+func testManagedIdentityFederatedCredential(name, issuer, subject string, audiences ...string) armmsi.FederatedIdentityCredential {
+	return armmsi.FederatedIdentityCredential{
+		Name: to.Ptr(name),
+		Properties: &armmsi.FederatedIdentityCredentialProperties{
+			Audiences: to.SliceOfPtrs(audiences...),
+			Issuer:    to.Ptr(issuer),
+			Subject:   to.Ptr(subject),
+		},
+	}
+}
+
+func testRoleAssignment(id, roleDefinition, scope string) armauthorization.RoleAssignment {
+	return armauthorization.RoleAssignment{
+		ID: to.Ptr(id),
+		Properties: &armauthorization.RoleAssignmentPropertiesWithScope{
+			RoleDefinitionID: to.Ptr("/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/" + roleDefinition),
+			Scope:            to.Ptr(scope),
+		},
+	}
+}
@@ -0,0 +1,239 @@
+package binding
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	// APIVersion is the API version of the WorkloadIdentityBinding manifest
+	APIVersion = "azwi.azure.com/v1alpha1"
+	// Kind is the kind of the WorkloadIdentityBinding manifest
+	Kind = "WorkloadIdentityBinding"
+)
+
+// WorkloadIdentityBinding declares a Kubernetes service account, the Azure identity
+// that is federated with it and the role assignments of the Azure identity.
+type WorkloadIdentityBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec WorkloadIdentityBindingSpec `json:"spec"`
+}
+
+// WorkloadIdentityBindingSpec is the spec of the WorkloadIdentityBinding
+type WorkloadIdentityBindingSpec struct {
+	// ServiceAccount is the Kubernetes service account. The name and namespace default to
+	// the name and namespace of the WorkloadIdentityBinding
+	ServiceAccount ServiceAccount `json:"serviceAccount,omitempty"`
+	// IssuerURL is the URL of the service account issuer of the cluster
+	IssuerURL string `json:"issuerURL"`
+	// Identity is the Azure identity that is federated with the service account
+	Identity Identity `json:"identity,omitempty"`
+	// RoleAssignments are the role assignments of the Azure identity
+	RoleAssignments []RoleAssignment `json:"roleAssignments,omitempty"`
+	// ExtraAudiences are added to the audiences of the federated identity credential
+	// in addition to the default audience
+	ExtraAudiences []string `json:"extraAudiences,omitempty"`
+}
+
+// ServiceAccount is the Kubernetes service account of the WorkloadIdentityBinding
+type ServiceAccount struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// TokenExpiration is the expiration of the projected service account token
+	TokenExpiration *metav1.Duration `json:"tokenExpiration,omitempty"`
+}
+
+// Identity is the Azure identity of the WorkloadIdentityBinding
+type Identity struct {
+	// Type is either aad-application (default) or uami
+	Type string `json:"type,omitempty"`
+	// Name is the name of the AAD application or the user-assigned managed identity. The name
+	// of the AAD application defaults to the namespace, the name of the service account and
+	// the hash of the issuer URL
+	Name string `json:"name,omitempty"`
+	// ResourceGroup is the resource group of the user-assigned managed identity
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	// Location is the location of the user-assigned managed identity, used to create it if it doesn't exist
+	Location string `json:"location,omitempty"`
+}
+
+// RoleAssignment is a role assignment of the Azure identity
+type RoleAssignment struct {
+	Role  string `json:"role"`
+	Scope string `json:"scope"`
+}
+
+// ServiceAccountTokenExpiration returns the expiration of the projected service account token.
+func (b *WorkloadIdentityBinding) ServiceAccountTokenExpiration() time.Duration {
+	if b.Spec.ServiceAccount.TokenExpiration == nil {
+		return time.Duration(webhook.DefaultServiceAccountTokenExpiration) * time.Second
+	}
+	return b.Spec.ServiceAccount.TokenExpiration.Duration
+}
+
+// Audiences returns the audiences of the federated identity credential.
+func (b *WorkloadIdentityBinding) Audiences() []string {
+	audiences := []string{webhook.DefaultAudience}
+	for _, audience := range b.Spec.ExtraAudiences {
+		if audience != webhook.DefaultAudience {
+			audiences = append(audiences, audience)
+		}
+	}
+	return audiences
+}
+
+// Subject returns the subject of the federated identity credential.
+func (b *WorkloadIdentityBinding) Subject() string {
+	return util.GetFederatedCredentialSubject(b.Spec.ServiceAccount.Namespace, b.Spec.ServiceAccount.Name)
+}
+
+// IdentityKey returns a key that is unique for the Azure identity of the binding.
+// Bindings with the same key share the Azure identity.
+func (b *WorkloadIdentityBinding) IdentityKey() string {
+	if b.Spec.Identity.Type == options.IdentityTypeUAMI {
+		return fmt.Sprintf("%s/%s/%s", options.IdentityTypeUAMI, strings.ToLower(b.Spec.Identity.ResourceGroup), b.Spec.Identity.Name)
+	}
+	return fmt.Sprintf("%s/%s", options.IdentityTypeAADApplication, b.Spec.Identity.Name)
+}
+
+// Load reads the WorkloadIdentityBinding manifests from the files.
+// The manifests are read from stdin if the filename is "-".
+func Load(filenames []string, stdin io.Reader) ([]WorkloadIdentityBinding, error) {
+	var bindings []WorkloadIdentityBinding
+	for _, filename := range filenames {
+		var (
+			data []byte
+			err  error
+		)
+		if filename == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(filename)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", filename)
+		}
+		b, err := Parse(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", filename)
+		}
+		bindings = append(bindings, b...)
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range bindings {
+		key := fmt.Sprintf("%s/%s %s", b.Spec.ServiceAccount.Namespace, b.Spec.ServiceAccount.Name, b.Spec.IssuerURL)
+		if seen[key] {
+			return nil, errors.Errorf("service account %s/%s is declared more than once for issuer %s",
+				b.Spec.ServiceAccount.Namespace, b.Spec.ServiceAccount.Name, b.Spec.IssuerURL)
+		}
+		seen[key] = true
+	}
+	return bindings, nil
+}
+
+// Parse parses the WorkloadIdentityBinding manifests in the YAML or JSON data,
+// which may contain multiple YAML documents. The defaults are set and the bindings are validated.
+func Parse(data []byte) ([]WorkloadIdentityBinding, error) {
+	var bindings []WorkloadIdentityBinding
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read YAML document")
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		b := WorkloadIdentityBinding{}
+		if err := yaml.UnmarshalStrict(doc, &b); err != nil {
+			return nil, errors.Wrapf(err, "document %d", i)
+		}
+		if b.APIVersion != APIVersion || b.Kind != Kind {
+			return nil, errors.Errorf("document %d: expected apiVersion %s and kind %s, got %q and %q", i, APIVersion, Kind, b.APIVersion, b.Kind)
+		}
+		b.setDefaults()
+		if err := b.validate(); err != nil {
+			return nil, errors.Wrapf(err, "%s %q", Kind, b.Name)
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+func (b *WorkloadIdentityBinding) setDefaults() {
+	sa := &b.Spec.ServiceAccount
+	if sa.Name == "" {
+		sa.Name = b.Name
+	}
+	if sa.Namespace == "" {
+		sa.Namespace = b.Namespace
+	}
+	if sa.Namespace == "" {
+		sa.Namespace = "default"
+	}
+
+	identity := &b.Spec.Identity
+	if identity.Type == "" {
+		identity.Type = options.IdentityTypeAADApplication
+	}
+	if identity.Type == options.IdentityTypeAADApplication && identity.Name == "" && sa.Name != "" && b.Spec.IssuerURL != "" {
+		identity.Name = fmt.Sprintf("%s-%s-%s", sa.Namespace, sa.Name, util.GetIssuerHash(b.Spec.IssuerURL))
+	}
+}
+
+func (b *WorkloadIdentityBinding) validate() error {
+	if b.Spec.ServiceAccount.Name == "" {
+		return errors.New("spec.serviceAccount.name or metadata.name is required")
+	}
+	if b.Spec.IssuerURL == "" {
+		return errors.New("spec.issuerURL is required")
+	}
+	if expiration := b.ServiceAccountTokenExpiration(); expiration < time.Duration(webhook.MinServiceAccountTokenExpiration)*time.Second ||
+		expiration > time.Duration(webhook.MaxServiceAccountTokenExpiration)*time.Second {
+		return errors.Errorf("spec.serviceAccount.tokenExpiration %s must be between 1 hour and 24 hours", expiration)
+	}
+
+	switch identity := b.Spec.Identity; identity.Type {
+	case options.IdentityTypeAADApplication:
+		if identity.ResourceGroup != "" || identity.Location != "" {
+			return errors.Errorf("spec.identity.resourceGroup and spec.identity.location are only supported with identity type %s", options.IdentityTypeUAMI)
+		}
+	case options.IdentityTypeUAMI:
+		if identity.Name == "" {
+			return errors.New("spec.identity.name is required")
+		}
+		if identity.ResourceGroup == "" {
+			return errors.New("spec.identity.resourceGroup is required")
+		}
+	default:
+		return errors.Errorf("invalid spec.identity.type %q, must be %s or %s", identity.Type, options.IdentityTypeAADApplication, options.IdentityTypeUAMI)
+	}
+
+	for i, ra := range b.Spec.RoleAssignments {
+		if ra.Role == "" || ra.Scope == "" {
+			return errors.Errorf("spec.roleAssignments[%d]: role and scope are required", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package binding
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const testBindings = `
+apiVersion: azwi.azure.com/v1alpha1
+kind: WorkloadIdentityBinding
+metadata:
+  name: app
+  namespace: apps
+spec:
+  issuerURL: https://issuer.example.com/
+  roleAssignments:
+  - role: Storage Blob Data Reader
+    scope: /subscriptions/sub/resourceGroups/rg
+  extraAudiences:
+  - api://custom
+---
+apiVersion: azwi.azure.com/v1alpha1
+kind: WorkloadIdentityBinding
+metadata:
+  name: worker
+spec:
+  serviceAccount:
+    name: worker-sa
+    tokenExpiration: 2h
+  issuerURL: https://issuer.example.com/
+  identity:
+    type: uami
+    name: worker-identity
+    resourceGroup: RG
+    location: westus2
+`
+
+func TestParse(t *testing.T) {
+	bindings, err := Parse([]byte(testBindings))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(bindings) != 2 {
+		t.Fatalf("expected 2 bindings, got %d", len(bindings))
+	}
+
+	app := bindings[0]
+	if app.Spec.ServiceAccount.Name != "app" || app.Spec.ServiceAccount.Namespace != "apps" {
+		t.Errorf("expected service account apps/app, got %s/%s", app.Spec.ServiceAccount.Namespace, app.Spec.ServiceAccount.Name)
+	}
+	if app.Spec.Identity.Type != "aad-application" {
+		t.Errorf("expected identity type aad-application, got %s", app.Spec.Identity.Type)
+	}
+	if !strings.HasPrefix(app.Spec.Identity.Name, "apps-app-") {
+		t.Errorf("expected the AAD application name to default to the namespace, name and issuer hash, got %s", app.Spec.Identity.Name)
+	}
+	if app.ServiceAccountTokenExpiration() != time.Duration(webhook.DefaultServiceAccountTokenExpiration)*time.Second {
+		t.Errorf("expected default token expiration, got %s", app.ServiceAccountTokenExpiration())
+	}
+	if want := []string{webhook.DefaultAudience, "api://custom"}; !reflect.DeepEqual(app.Audiences(), want) {
+		t.Errorf("expected audiences %v, got %v", want, app.Audiences())
+	}
+	if app.Subject() != "system:serviceaccount:apps:app" {
+		t.Errorf("unexpected subject %s", app.Subject())
+	}
+
+	worker := bindings[1]
+	if worker.Spec.ServiceAccount.Name != "worker-sa" || worker.Spec.ServiceAccount.Namespace != "default" {
+		t.Errorf("expected service account default/worker-sa, got %s/%s", worker.Spec.ServiceAccount.Namespace, worker.Spec.ServiceAccount.Name)
+	}
+	if worker.ServiceAccountTokenExpiration() != 2*time.Hour {
+		t.Errorf("expected token expiration 2h, got %s", worker.ServiceAccountTokenExpiration())
+	}
+	if worker.IdentityKey() != "uami/rg/worker-identity" {
+		t.Errorf("expected identity key uami/rg/worker-identity, got %s", worker.IdentityKey())
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		errorMsg string
+	}{
+		{
+			name:     "unknown field",
+			spec:     "issuerURL: https://issuer\n  unknown: true",
+			errorMsg: `unknown field "unknown"`,
+		},
+		{
+			name:     "missing issuer",
+			spec:     "identity: {}",
+			errorMsg: "spec.issuerURL is required",
+		},
+		{
+			name:     "invalid identity type",
+			spec:     "issuerURL: https://issuer\n  identity:\n    type: foo",
+			errorMsg: `invalid spec.identity.type "foo"`,
+		},
+		{
+			name:     "missing managed identity resource group",
+			spec:     "issuerURL: https://issuer\n  identity:\n    type: uami\n    name: test",
+			errorMsg: "spec.identity.resourceGroup is required",
+		},
+		{
+			name:     "resource group with aad application",
+			spec:     "issuerURL: https://issuer\n  identity:\n    resourceGroup: rg",
+			errorMsg: "only supported with identity type uami",
+		},
+		{
+			name:     "token expiration out of range",
+			spec:     "issuerURL: https://issuer\n  serviceAccount:\n    tokenExpiration: 30m",
+			errorMsg: "must be between 1 hour and 24 hours",
+		},
+		{
+			name:     "role assignment without scope",
+			spec:     "issuerURL: https://issuer\n  roleAssignments:\n  - role: Reader",
+			errorMsg: "spec.roleAssignments[0]: role and scope are required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := "apiVersion: azwi.azure.com/v1alpha1\nkind: WorkloadIdentityBinding\nmetadata:\n  name: test\nspec:\n  " + test.spec
+			_, err := Parse([]byte(data))
+			if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+				t.Errorf("expected error containing %q, got %v", test.errorMsg, err)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("apiVersion: v1\nkind: ServiceAccount\n")); err == nil || !strings.Contains(err.Error(), "expected apiVersion azwi.azure.com/v1alpha1 and kind WorkloadIdentityBinding") {
+		t.Errorf("expected error for the wrong kind, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bindings.yaml")
+	if err := os.WriteFile(path, []byte(testBindings), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bindings, err := Load([]string{path}, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(bindings) != 2 {
+		t.Errorf("expected 2 bindings, got %d", len(bindings))
+	}
+
+	// the same bindings from the file and stdin are duplicates
+	_, err = Load([]string{path, "-"}, strings.NewReader(testBindings))
+	if err == nil || !strings.Contains(err.Error(), "service account apps/app is declared more than once") {
+		t.Errorf("expected duplicate error, got %v", err)
+	}
+
+	if _, err := Load([]string{filepath.Join(t.TempDir(), "missing.yaml")}, nil); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
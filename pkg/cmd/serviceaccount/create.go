@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"monis.app/mlog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -26,9 +28,22 @@ func newCreateCmd(authProvider auth.Provider) *cobra.Command {
 		authProvider: authProvider,
 	}
 
+	aadApplicationPhase := phases.NewAADApplicationPhase()
+	managedIdentityPhase := phases.NewManagedIdentityPhase()
+
 	cmd := &cobra.Command{
 		Use: "create",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// only one of the AAD application and the user-assigned
+			// managed identity is federated with the service account
+			switch data.identityType {
+			case options.IdentityTypeAADApplication:
+				createRunner.AppendSkipPhases(managedIdentityPhase)
+			case options.IdentityTypeUAMI:
+				createRunner.AppendSkipPhases(aadApplicationPhase)
+			default:
+				return options.InvalidIdentityTypeError(data.identityType)
+			}
 			return createRunner.Run(data)
 		},
 	}
@@ -45,10 +60,16 @@ func newCreateCmd(authProvider auth.Provider) *cobra.Command {
 	f.StringVar(&data.servicePrincipalObjectID, options.ServicePrincipalObjectID.Flag, "", options.ServicePrincipalObjectID.Description)
 	f.StringVar(&data.azureScope, options.AzureScope.Flag, "", options.AzureScope.Description)
 	f.StringVar(&data.azureRole, options.AzureRole.Flag, "", options.AzureRole.Description)
+	f.Var(options.NewRoleAssignmentsValue(&data.roleAssignments), options.RoleAssignments.Flag, options.RoleAssignments.Description)
+	f.StringVar(&data.identityType, options.IdentityType.Flag, options.IdentityTypeAADApplication, options.IdentityType.Description)
+	f.StringVar(&data.managedIdentityName, options.ManagedIdentityName.Flag, "", options.ManagedIdentityName.Description)
+	f.StringVar(&data.managedIdentityResourceGroup, options.ManagedIdentityResourceGroup.Flag, "", options.ManagedIdentityResourceGroup.Description)
+	f.StringVar(&data.managedIdentityLocation, options.ManagedIdentityLocation.Flag, "", options.ManagedIdentityLocation.Description)
 
 	// append phases in order
 	createRunner.AppendPhases(
-		phases.NewAADApplicationPhase(),
+		aadApplicationPhase,
+		managedIdentityPhase,
 		phases.NewServiceAccountPhase(),
 		phases.NewFederatedIdentityPhase(),
 		phases.NewRoleAssignmentPhase(),
@@ -74,7 +95,14 @@ type createData struct {
 	servicePrincipalName          string
 	azureRole                     string
 	azureScope                    string
+	roleAssignments               []options.RoleAssignment
+	identityType                  string
+	managedIdentity               *armmsi.Identity // cache
+	managedIdentityName           string
+	managedIdentityResourceGroup  string
+	managedIdentityLocation       string
 	authProvider                  auth.Provider
+	kubeClient                    client.Client
 }
 
 var _ phases.CreateData = &createData{}
@@ -193,6 +221,67 @@ func (c *createData) ServicePrincipalObjectID() string {
 	return *sp.GetId()
 }
 
+// IdentityType returns the type of the identity that is federated with the service account.
+func (c *createData) IdentityType() string {
+	return c.identityType
+}
+
+// ManagedIdentity returns the user-assigned managed identity.
+// This will return the cached value if it has been fetched.
+func (c *createData) ManagedIdentity() (armmsi.Identity, error) {
+	if c.managedIdentity == nil {
+		identity, err := c.AzureClient().GetUserAssignedIdentity(context.Background(), c.ManagedIdentityResourceGroup(), c.ManagedIdentityName())
+		if err != nil {
+			return armmsi.Identity{}, err
+		}
+		c.managedIdentity = &identity
+	}
+	return *c.managedIdentity, nil
+}
+
+// ManagedIdentityName returns the name of the user-assigned managed identity.
+func (c *createData) ManagedIdentityName() string {
+	return c.managedIdentityName
+}
+
+// ManagedIdentityResourceGroup returns the resource group of the user-assigned managed identity.
+func (c *createData) ManagedIdentityResourceGroup() string {
+	return c.managedIdentityResourceGroup
+}
+
+// ManagedIdentityLocation returns the location of the user-assigned managed identity.
+func (c *createData) ManagedIdentityLocation() string {
+	return c.managedIdentityLocation
+}
+
+// ManagedIdentityClientID returns the client ID of the user-assigned managed identity.
+// This will be used for annotating the service account.
+func (c *createData) ManagedIdentityClientID() string {
+	identity, err := c.ManagedIdentity()
+	if err == nil && (identity.Properties == nil || identity.Properties.ClientID == nil) {
+		err = errors.Errorf("user-assigned managed identity %s has no client ID", c.ManagedIdentityName())
+	}
+	if err != nil {
+		mlog.Error("failed to get user-assigned managed identity client ID. Returning an empty string", err)
+		return ""
+	}
+	return *identity.Properties.ClientID
+}
+
+// ManagedIdentityPrincipalID returns the principal ID of the user-assigned managed identity.
+// This will be used for creating the role assignment.
+func (c *createData) ManagedIdentityPrincipalID() string {
+	identity, err := c.ManagedIdentity()
+	if err == nil && (identity.Properties == nil || identity.Properties.PrincipalID == nil) {
+		err = errors.Errorf("user-assigned managed identity %s has no principal ID", c.ManagedIdentityName())
+	}
+	if err != nil {
+		mlog.Error("failed to get user-assigned managed identity principal ID. Returning an empty string", err)
+		return ""
+	}
+	return *identity.Properties.PrincipalID
+}
+
 // AzureRole returns the Azure role.
 func (c *createData) AzureRole() string {
 	return c.azureRole
@@ -203,6 +292,12 @@ func (c *createData) AzureScope() string {
 	return c.azureScope
 }
 
+// RoleAssignments returns the role assignments in addition to
+// the one of the Azure role and scope.
+func (c *createData) RoleAssignments() []options.RoleAssignment {
+	return c.roleAssignments
+}
+
 // AzureTenantID returns the Azure tenant ID.
 func (c *createData) AzureTenantID() string {
 	return c.authProvider.GetAzureTenantID()
@@ -215,5 +310,8 @@ func (c *createData) AzureClient() cloud.Interface {
 
 // KubeClient returns the Kubernetes client.
 func (c *createData) KubeClient() (client.Client, error) {
+	if c.kubeClient != nil {
+		return c.kubeClient, nil
+	}
 	return kuberneteshelper.GetKubeClient()
 }
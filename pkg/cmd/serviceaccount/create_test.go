@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/golang/mock/gomock"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/spf13/pflag"
@@ -15,12 +16,14 @@ import (
 )
 
 const (
-	serviceAccountNamespace = "service-account-namespace"
-	serviceAccountName      = "service-account-name"
-	serviceAccountIssuerURL = "service-account-issuer-url"
-	appID                   = "app-id"
-	objectID                = "object-id"
-	appName                 = "aad-application-name"
+	serviceAccountNamespace      = "service-account-namespace"
+	serviceAccountName           = "service-account-name"
+	serviceAccountIssuerURL      = "service-account-issuer-url"
+	appID                        = "app-id"
+	objectID                     = "object-id"
+	appName                      = "aad-application-name"
+	managedIdentityName          = "managed-identity-name"
+	managedIdentityResourceGroup = "managed-identity-resource-group"
 )
 
 type mockAuthProvider struct {
@@ -283,6 +286,112 @@ func TestCreateDataServicePrincipalObjectID(t *testing.T) {
 	}
 }
 
+func TestCreateDataManagedIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		createData *createData
+		expect     func(m *mock_cloud.MockInterfaceMockRecorder)
+		verify     func(t *testing.T, createData *createData)
+	}{
+		{
+			name: "random error",
+			createData: &createData{
+				managedIdentityName:          managedIdentityName,
+				managedIdentityResourceGroup: managedIdentityResourceGroup,
+			},
+			expect: func(m *mock_cloud.MockInterfaceMockRecorder) {
+				m.GetUserAssignedIdentity(gomock.Any(), managedIdentityResourceGroup, managedIdentityName).Return(armmsi.Identity{}, errors.New("random error")).Times(3)
+			},
+			verify: func(t *testing.T, createData *createData) {
+				if _, err := createData.ManagedIdentity(); err == nil {
+					t.Error("Expected ManagedIdentity() to return error")
+				}
+				if createData.ManagedIdentityClientID() != "" {
+					t.Errorf("Expected ManagedIdentityClientID() to be empty, got %s", createData.ManagedIdentityClientID())
+				}
+				if createData.ManagedIdentityPrincipalID() != "" {
+					t.Errorf("Expected ManagedIdentityPrincipalID() to be empty, got %s", createData.ManagedIdentityPrincipalID())
+				}
+			},
+		},
+		{
+			name: "no cache",
+			createData: &createData{
+				managedIdentityName:          managedIdentityName,
+				managedIdentityResourceGroup: managedIdentityResourceGroup,
+			},
+			expect: func(m *mock_cloud.MockInterfaceMockRecorder) {
+				m.GetUserAssignedIdentity(gomock.Any(), managedIdentityResourceGroup, managedIdentityName).Return(testManagedIdentity(appID, objectID), nil)
+			},
+			verify: func(t *testing.T, createData *createData) {
+				if _, err := createData.ManagedIdentity(); err != nil {
+					t.Error("Expected ManagedIdentity() to not return error")
+				}
+				if createData.ManagedIdentityClientID() != appID {
+					t.Errorf("Expected ManagedIdentityClientID() to be 'app-id', got %s", createData.ManagedIdentityClientID())
+				}
+				if createData.ManagedIdentityPrincipalID() != objectID {
+					t.Errorf("Expected ManagedIdentityPrincipalID() to be 'object-id', got %s", createData.ManagedIdentityPrincipalID())
+				}
+			},
+		},
+		{
+			name: "no properties",
+			createData: &createData{
+				managedIdentityName:          managedIdentityName,
+				managedIdentityResourceGroup: managedIdentityResourceGroup,
+				managedIdentity:              &armmsi.Identity{},
+			},
+			expect: func(m *mock_cloud.MockInterfaceMockRecorder) {},
+			verify: func(t *testing.T, createData *createData) {
+				if createData.ManagedIdentityClientID() != "" {
+					t.Errorf("Expected ManagedIdentityClientID() to be empty, got %s", createData.ManagedIdentityClientID())
+				}
+				if createData.ManagedIdentityPrincipalID() != "" {
+					t.Errorf("Expected ManagedIdentityPrincipalID() to be empty, got %s", createData.ManagedIdentityPrincipalID())
+				}
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authProvider := &mockAuthProvider{
+				azureClient: mock_cloud.NewMockInterface(ctrl),
+			}
+			test.expect(authProvider.azureClient.EXPECT())
+			test.createData.authProvider = authProvider
+			test.verify(t, test.createData)
+		})
+	}
+}
+
+func TestCreateCmdInvalidIdentityType(t *testing.T) {
+	cmd := newCreateCmd(&mockAuthProvider{})
+	cmd.SetArgs([]string{"--identity-type", "foo"})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err == nil || err.Error() != `invalid --identity-type "foo", must be aad-application or uami` {
+		t.Errorf("Expected invalid identity type error, got %v", err)
+	}
+}
+
+func TestCreateCmdDryRunFlags(t *testing.T) {
+	// all the phases of create report their plan, unlike the phases of delete
+	cmd := newCreateCmd(&mockAuthProvider{})
+	for _, flag := range []string{"dry-run", "output"} {
+		if cmd.Flag(flag) == nil {
+			t.Errorf("Expected create command to have --%s flag", flag)
+		}
+	}
+	if newDeleteCmd(&mockAuthProvider{}).Flag("dry-run") != nil {
+		t.Errorf("Expected delete command not to have --dry-run flag")
+	}
+}
+
 func TestCreateDataAzureRole(t *testing.T) {
 	createData := &createData{
 		azureRole: "azure-role",
@@ -325,3 +434,12 @@ func testServicePrincipal(appID, objectID string) models.ServicePrincipalable {
 	sp.SetId(to.Ptr(objectID))
 	return sp
 }
+
+func testManagedIdentity(clientID, principalID string) armmsi.Identity {
+	return armmsi.Identity{
+		Properties: &armmsi.UserAssignedIdentityProperties{
+			ClientID:    to.Ptr(clientID),
+			PrincipalID: to.Ptr(principalID),
+		},
+	}
+}
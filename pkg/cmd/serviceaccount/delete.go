@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"monis.app/mlog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,6 +35,14 @@ func newDeleteCmd(authProvider auth.Provider) *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "delete",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// the user-assigned managed identity is not removed by
+			// the delete command, only its federated identity credential.
+			if data.identityType != options.IdentityTypeAADApplication && data.identityType != options.IdentityTypeUAMI {
+				return options.InvalidIdentityTypeError(data.identityType)
+			}
+			if data.identityType == options.IdentityTypeUAMI {
+				deleteRunner.AppendSkipPhases(aadApplicationPhase)
+			}
 			// if we are running the AAD application delete phase, we can
 			// slightly optimize the delete command by skipping the federated-identity
 			// phase because it will get removed when the AAD application is removed.
@@ -50,7 +59,11 @@ func newDeleteCmd(authProvider auth.Provider) *cobra.Command {
 	f.StringVar(&data.serviceAccountIssuerURL, options.ServiceAccountIssuerURL.Flag, "", options.ServiceAccountIssuerURL.Description)
 	f.StringVar(&data.aadApplicationName, options.AADApplicationName.Flag, "", options.AADApplicationName.Description)
 	f.StringVar(&data.aadApplicationObjectID, options.AADApplicationObjectID.Flag, "", options.AADApplicationObjectID.Description)
-	f.StringVar(&data.roleAssignmentID, options.RoleAssignmentID.Flag, "", options.RoleAssignmentID.Description)
+	f.StringSliceVar(&data.roleAssignmentIDs, options.RoleAssignmentID.Flag, nil, options.RoleAssignmentID.Description)
+	f.Var(options.NewRoleAssignmentsValue(&data.roleAssignments), options.RoleAssignments.Flag, options.RoleAssignments.Description)
+	f.StringVar(&data.identityType, options.IdentityType.Flag, options.IdentityTypeAADApplication, options.IdentityType.Description)
+	f.StringVar(&data.managedIdentityName, options.ManagedIdentityName.Flag, "", options.ManagedIdentityName.Description)
+	f.StringVar(&data.managedIdentityResourceGroup, options.ManagedIdentityResourceGroup.Flag, "", options.ManagedIdentityResourceGroup.Description)
 
 	// append phases in order
 	deleteRunner.AppendPhases(
@@ -67,14 +80,18 @@ func newDeleteCmd(authProvider auth.Provider) *cobra.Command {
 // deleteData is an implementation of phases.DeleteData in
 // pkg/cmd/serviceaccount/phases/delete/data.go
 type deleteData struct {
-	serviceAccountName      string
-	serviceAccountNamespace string
-	serviceAccountIssuerURL string
-	aadApplication          models.Applicationable // cache
-	aadApplicationName      string
-	aadApplicationObjectID  string
-	roleAssignmentID        string
-	authProvider            auth.Provider
+	serviceAccountName           string
+	serviceAccountNamespace      string
+	serviceAccountIssuerURL      string
+	aadApplication               models.Applicationable // cache
+	aadApplicationName           string
+	aadApplicationObjectID       string
+	identityType                 string
+	managedIdentityName          string
+	managedIdentityResourceGroup string
+	roleAssignmentIDs            []string
+	roleAssignments              []options.RoleAssignment
+	authProvider                 auth.Provider
 }
 
 var _ phases.DeleteData = &deleteData{}
@@ -134,9 +151,51 @@ func (d *deleteData) AADApplicationObjectID() string {
 	return *app.GetId()
 }
 
-// AzureClient returns the Azure client.
-func (d *deleteData) RoleAssignmentID() string {
-	return d.roleAssignmentID
+// IdentityType returns the type of the identity that is federated with the service account.
+func (d *deleteData) IdentityType() string {
+	return d.identityType
+}
+
+// ManagedIdentityName returns the name of the user-assigned managed identity.
+func (d *deleteData) ManagedIdentityName() string {
+	return d.managedIdentityName
+}
+
+// ManagedIdentityResourceGroup returns the resource group of the user-assigned managed identity.
+func (d *deleteData) ManagedIdentityResourceGroup() string {
+	return d.managedIdentityResourceGroup
+}
+
+// PrincipalID returns the object ID of the service principal of the AAD application or
+// the principal ID of the user-assigned managed identity.
+func (d *deleteData) PrincipalID() (string, error) {
+	if d.IdentityType() == options.IdentityTypeUAMI {
+		identity, err := d.AzureClient().GetUserAssignedIdentity(context.Background(), d.ManagedIdentityResourceGroup(), d.ManagedIdentityName())
+		if err != nil {
+			return "", err
+		}
+		if identity.Properties == nil || identity.Properties.PrincipalID == nil {
+			return "", errors.Errorf("user-assigned managed identity %s has no principal ID", d.ManagedIdentityName())
+		}
+		return *identity.Properties.PrincipalID, nil
+	}
+
+	// the service principal has the same name as the AAD application
+	sp, err := d.AzureClient().GetServicePrincipal(context.Background(), d.AADApplicationName())
+	if err != nil {
+		return "", err
+	}
+	return *sp.GetId(), nil
+}
+
+// RoleAssignmentIDs returns the IDs of the role assignments to remove.
+func (d *deleteData) RoleAssignmentIDs() []string {
+	return d.roleAssignmentIDs
+}
+
+// RoleAssignments returns the role assignments to remove by role and scope.
+func (d *deleteData) RoleAssignments() []options.RoleAssignment {
+	return d.roleAssignments
 }
 
 // AzureClient returns the Azure client.
@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 )
 
 func TestDeleteDataServiceAccountName(t *testing.T) {
@@ -110,6 +111,59 @@ func TestDeleteDataAADApplication(t *testing.T) {
 	}
 }
 
+func TestDeleteDataPrincipalID(t *testing.T) {
+	tests := []struct {
+		name       string
+		deleteData *deleteData
+		expect     func(m *mock_cloud.MockInterfaceMockRecorder)
+		want       string
+	}{
+		{
+			name: "service principal of the AAD application",
+			deleteData: &deleteData{
+				aadApplicationName: appName,
+				identityType:       options.IdentityTypeAADApplication,
+			},
+			expect: func(m *mock_cloud.MockInterfaceMockRecorder) {
+				m.GetServicePrincipal(gomock.Any(), appName).Return(testServicePrincipal(appID, objectID), nil)
+			},
+			want: objectID,
+		},
+		{
+			name: "user-assigned managed identity",
+			deleteData: &deleteData{
+				identityType:                 options.IdentityTypeUAMI,
+				managedIdentityName:          managedIdentityName,
+				managedIdentityResourceGroup: managedIdentityResourceGroup,
+			},
+			expect: func(m *mock_cloud.MockInterfaceMockRecorder) {
+				m.GetUserAssignedIdentity(gomock.Any(), managedIdentityResourceGroup, managedIdentityName).Return(testManagedIdentity("client-id", "principal-id"), nil)
+			},
+			want: "principal-id",
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authProvider := &mockAuthProvider{
+				azureClient: mock_cloud.NewMockInterface(ctrl),
+			}
+			test.expect(authProvider.azureClient.EXPECT())
+			test.deleteData.authProvider = authProvider
+			got, err := test.deleteData.PrincipalID()
+			if err != nil {
+				t.Fatalf("Expected PrincipalID() to not return error, got %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Expected PrincipalID() to be %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
 func TestDeleteDataAADApplicationName(t *testing.T) {
 	deleteData := &deleteData{
 		aadApplicationName: appName,
@@ -135,11 +189,11 @@ func TestDeleteDataAADApplicationObjectID(t *testing.T) {
 	}
 }
 
-func TestDeleteDataRoleAssignmentID(t *testing.T) {
+func TestDeleteDataRoleAssignmentIDs(t *testing.T) {
 	deleteData := &deleteData{
-		roleAssignmentID: "role-assignment-id",
+		roleAssignmentIDs: []string{"role-assignment-id"},
 	}
-	if deleteData.RoleAssignmentID() != "role-assignment-id" {
-		t.Errorf("Expected RoleAssignmentID() to be 'role-assignment-id', got %s", deleteData.AADApplicationObjectID())
+	if ids := deleteData.RoleAssignmentIDs(); len(ids) != 1 || ids[0] != "role-assignment-id" {
+		t.Errorf("Expected RoleAssignmentIDs() to be ['role-assignment-id'], got %v", ids)
 	}
 }
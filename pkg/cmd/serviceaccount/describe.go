@@ -0,0 +1,120 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/auth"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
+)
+
+const (
+	describeLongDescription = `Show the workload identity annotations of a service account, the Azure identity that its client ID
+resolves to and the federated identity credentials of the Azure identity.`
+)
+
+type describeCmd struct {
+	inventoryOptions
+	serviceAccountName      string
+	serviceAccountNamespace string
+}
+
+func newDescribeCmd(authProvider auth.Provider) *cobra.Command {
+	describeCmd := &describeCmd{
+		inventoryOptions: inventoryOptions{
+			authProvider: authProvider,
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show the details of a service account that uses workload identity",
+		Long:  describeLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return describeCmd.run(context.Background(), cmd.OutOrStdout())
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&describeCmd.serviceAccountName, options.ServiceAccountName.Flag, "", options.ServiceAccountName.Description)
+	f.StringVar(&describeCmd.serviceAccountNamespace, options.ServiceAccountNamespace.Flag, "default", options.ServiceAccountNamespace.Description)
+	f.StringVar(&describeCmd.serviceAccountIssuerURL, options.ServiceAccountIssuerURL.Flag, "", "URL of the issuer. Discovered from the cluster if not specified")
+	f.StringVarP(&describeCmd.output, "output", "o", outputTable, fmt.Sprintf("Output format. One of: %s, %s, %s", outputTable, outputJSON, outputYAML))
+	_ = cmd.MarkFlagRequired(options.ServiceAccountName.Flag)
+
+	return cmd
+}
+
+func (dc *describeCmd) run(ctx context.Context, out io.Writer) error {
+	if err := dc.validate(); err != nil {
+		return err
+	}
+	kubeClient, err := dc.getKubeClient()
+	if err != nil {
+		return err
+	}
+
+	sa, err := kuberneteshelper.GetServiceAccount(ctx, kubeClient, dc.serviceAccountNamespace, dc.serviceAccountName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return errors.Errorf("service account %s/%s not found", dc.serviceAccountNamespace, dc.serviceAccountName)
+		}
+		return errors.Wrap(err, "failed to get service account")
+	}
+	if !isWorkloadIdentityServiceAccount(sa) {
+		return errors.Errorf("service account %s/%s does not use workload identity", dc.serviceAccountNamespace, dc.serviceAccountName)
+	}
+
+	info := newInventory(dc.authProvider.GetAzureClient(), dc.getIssuer(ctx)).describe(ctx, sa)
+	if dc.output != outputTable {
+		return printStructured(out, dc.output, info)
+	}
+	return printServiceAccountInfo(out, info)
+}
+
+// printServiceAccountInfo prints the inventory of a service account in a human-readable format
+func printServiceAccountInfo(w io.Writer, info serviceAccountInfo) error {
+	tw := newTabWriter(w)
+	fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(tw, "Namespace:\t%s\n", info.Namespace)
+	fmt.Fprintf(tw, "Client ID:\t%s\n", valueOrNone(info.ClientID))
+	fmt.Fprintf(tw, "Tenant ID:\t%s\n", valueOrNone(info.TenantID))
+	fmt.Fprintf(tw, "Token Expiration:\t%s\n", valueOrNone(info.TokenExpiration))
+	fmt.Fprintf(tw, "Issuer:\t%s\n", valueOrNone(info.Issuer))
+	if info.Identity == nil {
+		fmt.Fprintf(tw, "Identity:\t<none>\n")
+	} else {
+		fmt.Fprintf(tw, "Identity:\t%s\n", info.Identity.Type)
+		fmt.Fprintf(tw, "  Display Name:\t%s\n", info.Identity.DisplayName)
+		fmt.Fprintf(tw, "  Object ID:\t%s\n", info.Identity.ObjectID)
+		if info.Identity.ResourceID != "" {
+			fmt.Fprintf(tw, "  Resource ID:\t%s\n", info.Identity.ResourceID)
+		}
+	}
+	fmt.Fprintf(tw, "Status:\t%s\n", info.Status)
+	if info.Message != "" {
+		fmt.Fprintf(tw, "Message:\t%s\n", info.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(info.FederatedCredentials) == 0 {
+		fmt.Fprintln(w, "Federated Credentials: <none>")
+		return nil
+	}
+	fmt.Fprintln(w, "Federated Credentials:")
+	tw = newTabWriter(w)
+	fmt.Fprintln(tw, "  NAME\tISSUER\tSUBJECT\tAUDIENCES")
+	for _, fic := range info.FederatedCredentials {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", fic.Name, fic.Issuer, fic.Subject, strings.Join(fic.Audiences, ","))
+	}
+	return tw.Flush()
+}
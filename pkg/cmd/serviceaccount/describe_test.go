@@ -0,0 +1,130 @@
+package serviceaccount
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+)
+
+func newTestDescribeCmd(m *mock_cloud.MockInterface, kubeClient client.Client, namespace, name string) *describeCmd {
+	return &describeCmd{
+		inventoryOptions: inventoryOptions{
+			serviceAccountIssuerURL: testIssuerURL,
+			output:                  outputTable,
+			authProvider:            &mockAuthProvider{azureClient: m},
+			kubeClient:              kubeClient,
+		},
+		serviceAccountName:      name,
+		serviceAccountNamespace: namespace,
+	}
+}
+
+func TestDescribeRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newInventoryServiceAccount("apps", "worker", testUAMIClientID, true),
+	).Build()
+
+	m := mock_cloud.NewMockInterface(ctrl)
+	expectUAMI(m.EXPECT(), "system:serviceaccount:apps:worker")
+
+	out := &bytes.Buffer{}
+	if err := newTestDescribeCmd(m, kubeClient, "apps", "worker").run(context.Background(), out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	want := `Name:              worker
+Namespace:         apps
+Client ID:         uami-client-id
+Tenant ID:         <none>
+Token Expiration:  <none>
+Issuer:            https://issuer.example.com/
+Identity:          uami
+  Display Name:    mi
+  Object ID:       uami-object-id
+  Resource ID:     /subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/mi
+Status:            missing
+Message:           no federated identity credential with issuer https://issuer.example.com/ and subject system:serviceaccount:apps:worker
+Federated Credentials:
+  NAME    ISSUER                             SUBJECT                            AUDIENCES
+  mi-fic  https://other-issuer.example.com/  system:serviceaccount:apps:worker  api://AzureADTokenExchange
+`
+	if out.String() != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestDescribeRunStructured(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: outputJSON, want: `"status": "ok"`},
+		{output: outputYAML, want: "status: ok"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.output, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			kubeClient := fake.NewClientBuilder().WithObjects(
+				newInventoryServiceAccount("default", "app", testAppClientID, true),
+			).Build()
+
+			m := mock_cloud.NewMockInterface(ctrl)
+			expectAADApplication(m.EXPECT(), "system:serviceaccount:default:app")
+
+			dc := newTestDescribeCmd(m, kubeClient, "default", "app")
+			dc.output = test.output
+			out := &bytes.Buffer{}
+			if err := dc.run(context.Background(), out); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			if !strings.Contains(out.String(), test.want) {
+				t.Errorf("expected output to contain %q, got:\n%s", test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestDescribeRunError(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newInventoryServiceAccount("default", "default", "", false),
+	).Build()
+
+	tests := []struct {
+		name      string
+		namespace string
+		errorMsg  string
+	}{
+		{
+			name:      "app",
+			namespace: "default",
+			errorMsg:  "service account default/app not found",
+		},
+		{
+			name:      "default",
+			namespace: "default",
+			errorMsg:  "service account default/default does not use workload identity",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newTestDescribeCmd(nil, kubeClient, test.namespace, test.name).run(context.Background(), &bytes.Buffer{})
+			if err == nil || err.Error() != test.errorMsg {
+				t.Errorf("expected error %q, got %v", test.errorMsg, err)
+			}
+		})
+	}
+}
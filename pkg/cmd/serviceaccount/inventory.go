@@ -0,0 +1,343 @@
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"monis.app/mlog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/auth"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// inventoryStatus is the status of the federation of a service account
+type inventoryStatus string
+
+const (
+	// statusOK means the identity has a federated identity credential for the
+	// service account and the service account issuer of the cluster
+	statusOK inventoryStatus = "ok"
+	// statusMissing means the identity has no federated identity credential for the
+	// service account and the service account issuer of the cluster
+	statusMissing inventoryStatus = "missing"
+	// statusUnknown means the service account issuer of the cluster is unknown
+	statusUnknown inventoryStatus = "unknown"
+	// statusError means the identity of the service account could not be resolved
+	statusError inventoryStatus = "error"
+)
+
+// serviceAccountInfo is the inventory of a service account that uses workload identity
+type serviceAccountInfo struct {
+	Namespace            string                    `json:"namespace"`
+	Name                 string                    `json:"name"`
+	ClientID             string                    `json:"clientID,omitempty"`
+	TenantID             string                    `json:"tenantID,omitempty"`
+	TokenExpiration      string                    `json:"tokenExpiration,omitempty"`
+	Issuer               string                    `json:"issuer,omitempty"`
+	Identity             *identityInfo             `json:"identity,omitempty"`
+	FederatedCredentials []federatedCredentialInfo `json:"federatedCredentials,omitempty"`
+	Status               inventoryStatus           `json:"status"`
+	Message              string                    `json:"message,omitempty"`
+}
+
+// identityInfo is the Azure identity that the client ID of a service account resolves to
+type identityInfo struct {
+	// Type is either aad-application or uami
+	Type        string `json:"type"`
+	DisplayName string `json:"displayName"`
+	ObjectID    string `json:"objectID"`
+	// ResourceID is the resource ID of the user-assigned managed identity
+	ResourceID string `json:"resourceID,omitempty"`
+}
+
+// federatedCredentialInfo is a federated identity credential of an Azure identity
+type federatedCredentialInfo struct {
+	Name      string   `json:"name"`
+	Issuer    string   `json:"issuer"`
+	Subject   string   `json:"subject"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// resolvedIdentity is an Azure identity and its federated identity credentials
+type resolvedIdentity struct {
+	identity             *identityInfo
+	federatedCredentials []federatedCredentialInfo
+	err                  error
+}
+
+// inventoryOptions are the options shared by the list and describe commands
+type inventoryOptions struct {
+	serviceAccountIssuerURL string
+	output                  string
+	authProvider            auth.Provider
+	kubeClient              client.Client
+	// discoverIssuer returns the service account issuer of the cluster
+	// if --service-account-issuer-url is not specified
+	discoverIssuer func(ctx context.Context) (string, error)
+}
+
+func (o *inventoryOptions) validate() error {
+	switch o.output {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	default:
+		return errors.Errorf("invalid --output %q, must be %s, %s or %s", o.output, outputTable, outputJSON, outputYAML)
+	}
+}
+
+func (o *inventoryOptions) getKubeClient() (client.Client, error) {
+	if o.kubeClient == nil {
+		kubeClient, err := kuberneteshelper.GetKubeClient()
+		if err != nil {
+			return nil, err
+		}
+		o.kubeClient = kubeClient
+	}
+	return o.kubeClient, nil
+}
+
+// getIssuer returns the service account issuer of the cluster, or an empty string if it is unknown
+func (o *inventoryOptions) getIssuer(ctx context.Context) string {
+	if o.serviceAccountIssuerURL != "" {
+		return o.serviceAccountIssuerURL
+	}
+	discoverIssuer := o.discoverIssuer
+	if discoverIssuer == nil {
+		discoverIssuer = kuberneteshelper.GetServiceAccountIssuer
+	}
+	issuer, err := discoverIssuer(ctx)
+	if err != nil {
+		mlog.Warning("failed to discover the service account issuer of the cluster, specify --service-account-issuer-url to check the federated identity credentials", "error", err)
+		return ""
+	}
+	return issuer
+}
+
+// inventory resolves the Azure identities and federated identity credentials of service accounts
+type inventory struct {
+	azureClient cloud.Interface
+	issuer      string
+	// identities caches the resolved identities by client ID
+	identities map[string]*resolvedIdentity
+}
+
+func newInventory(azureClient cloud.Interface, issuer string) *inventory {
+	return &inventory{
+		azureClient: azureClient,
+		issuer:      issuer,
+		identities:  make(map[string]*resolvedIdentity),
+	}
+}
+
+// isWorkloadIdentityServiceAccount returns true if the service account is labelled for workload identity,
+// which is the label selector of the service accounts listed by the list command
+func isWorkloadIdentityServiceAccount(sa *corev1.ServiceAccount) bool {
+	return sa.Labels[webhook.UseWorkloadIdentityLabel] == "true"
+}
+
+// describe returns the inventory of the service account
+func (i *inventory) describe(ctx context.Context, sa *corev1.ServiceAccount) serviceAccountInfo {
+	info := serviceAccountInfo{
+		Namespace:       sa.Namespace,
+		Name:            sa.Name,
+		ClientID:        sa.Annotations[webhook.ClientIDAnnotation],
+		TenantID:        sa.Annotations[webhook.TenantIDAnnotation],
+		TokenExpiration: sa.Annotations[webhook.ServiceAccountTokenExpiryAnnotation],
+		Issuer:          i.issuer,
+	}
+	if info.ClientID == "" {
+		info.Status = statusError
+		info.Message = fmt.Sprintf("service account has no %s annotation", webhook.ClientIDAnnotation)
+		return info
+	}
+
+	resolved := i.resolve(ctx, info.ClientID)
+	if resolved.err != nil {
+		info.Status = statusError
+		info.Message = resolved.err.Error()
+		return info
+	}
+	info.Identity = resolved.identity
+	info.FederatedCredentials = resolved.federatedCredentials
+
+	subject := util.GetFederatedCredentialSubject(sa.Namespace, sa.Name)
+	switch {
+	case i.issuer == "":
+		info.Status = statusUnknown
+		info.Message = "the service account issuer of the cluster is unknown"
+	case hasFederatedCredential(info.FederatedCredentials, i.issuer, subject):
+		info.Status = statusOK
+	default:
+		info.Status = statusMissing
+		info.Message = fmt.Sprintf("no federated identity credential with issuer %s and subject %s", i.issuer, subject)
+	}
+	return info
+}
+
+// resolve resolves the client ID to an AAD application or a user-assigned managed identity
+// and lists its federated identity credentials
+func (i *inventory) resolve(ctx context.Context, clientID string) *resolvedIdentity {
+	if resolved, ok := i.identities[clientID]; ok {
+		return resolved
+	}
+	resolved := &resolvedIdentity{}
+	resolved.identity, resolved.federatedCredentials, resolved.err = i.resolveIdentity(ctx, clientID)
+	i.identities[clientID] = resolved
+	return resolved
+}
+
+func (i *inventory) resolveIdentity(ctx context.Context, clientID string) (*identityInfo, []federatedCredentialInfo, error) {
+	app, err := i.azureClient.GetApplicationByAppID(ctx, clientID)
+	if err == nil {
+		identity := &identityInfo{
+			Type:        options.IdentityTypeAADApplication,
+			DisplayName: stringValue(app.GetDisplayName()),
+			ObjectID:    stringValue(app.GetId()),
+		}
+		fics, err := i.azureClient.ListFederatedCredentials(ctx, identity.ObjectID)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to list federated identity credentials")
+		}
+		var federatedCredentials []federatedCredentialInfo
+		for _, fic := range fics {
+			federatedCredentials = append(federatedCredentials, federatedCredentialInfo{
+				Name:      stringValue(fic.GetName()),
+				Issuer:    stringValue(fic.GetIssuer()),
+				Subject:   stringValue(fic.GetSubject()),
+				Audiences: fic.GetAudiences(),
+			})
+		}
+		return identity, federatedCredentials, nil
+	}
+	if !cloud.IsNotFound(err) {
+		return nil, nil, errors.Wrap(err, "failed to get AAD application")
+	}
+
+	// the client ID is not an AAD application, it could be a user-assigned managed identity
+	sp, err := i.azureClient.GetServicePrincipalByAppID(ctx, clientID)
+	if err != nil {
+		if cloud.IsNotFound(err) {
+			return nil, nil, errors.Errorf("no AAD application or user-assigned managed identity found with client ID %s", clientID)
+		}
+		return nil, nil, errors.Wrap(err, "failed to get service principal")
+	}
+	resourceID := getManagedIdentityResourceID(sp.GetAlternativeNames())
+	if resourceID == "" {
+		return nil, nil, errors.Errorf("service principal %s is not a user-assigned managed identity", stringValue(sp.GetDisplayName()))
+	}
+	id, err := arm.ParseResourceID(resourceID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to parse resource ID %s", resourceID)
+	}
+	identity := &identityInfo{
+		Type:        options.IdentityTypeUAMI,
+		DisplayName: id.Name,
+		ObjectID:    stringValue(sp.GetId()),
+		ResourceID:  resourceID,
+	}
+	// the user-assigned managed identity can be in another subscription than the one of the client
+	fics, err := i.azureClient.ListUserAssignedIdentityFederatedCredentialsByID(ctx, resourceID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to list federated identity credentials")
+	}
+	var federatedCredentials []federatedCredentialInfo
+	for _, fic := range fics {
+		federatedCredential := federatedCredentialInfo{
+			Name: stringValue(fic.Name),
+		}
+		if fic.Properties != nil {
+			federatedCredential.Issuer = stringValue(fic.Properties.Issuer)
+			federatedCredential.Subject = stringValue(fic.Properties.Subject)
+			for _, audience := range fic.Properties.Audiences {
+				federatedCredential.Audiences = append(federatedCredential.Audiences, stringValue(audience))
+			}
+		}
+		federatedCredentials = append(federatedCredentials, federatedCredential)
+	}
+	return identity, federatedCredentials, nil
+}
+
+// getManagedIdentityResourceID returns the resource ID of the user-assigned managed identity
+// from the alternative names of its service principal
+func getManagedIdentityResourceID(alternativeNames []string) string {
+	for _, name := range alternativeNames {
+		if strings.Contains(strings.ToLower(name), "/providers/microsoft.managedidentity/userassignedidentities/") {
+			return name
+		}
+	}
+	return ""
+}
+
+func hasFederatedCredential(federatedCredentials []federatedCredentialInfo, issuer, subject string) bool {
+	for _, fic := range federatedCredentials {
+		if fic.Issuer == issuer && fic.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// sortServiceAccounts sorts the service accounts by namespace and name
+func sortServiceAccounts(sas []corev1.ServiceAccount) {
+	sort.Slice(sas, func(i, j int) bool {
+		if sas[i].Namespace != sas[j].Namespace {
+			return sas[i].Namespace < sas[j].Namespace
+		}
+		return sas[i].Name < sas[j].Name
+	})
+}
+
+// printStructured prints the value as JSON or YAML
+func printStructured(w io.Writer, output string, v interface{}) error {
+	if output == outputYAML {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// valueOrNone returns the value or <none> if it is empty
+func valueOrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// newTabWriter returns a tabwriter that aligns the columns of the table output
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+}
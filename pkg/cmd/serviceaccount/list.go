@@ -0,0 +1,93 @@
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/auth"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	listLongDescription = `List the service accounts that use workload identity, the Azure identities that their client IDs
+resolve to and the federated identity credentials of the Azure identities. The status is missing if the
+Azure identity has no federated identity credential for the service account and the service account issuer of the cluster.`
+)
+
+type listCmd struct {
+	inventoryOptions
+	serviceAccountNamespace string
+}
+
+func newListCmd(authProvider auth.Provider) *cobra.Command {
+	listCmd := &listCmd{
+		inventoryOptions: inventoryOptions{
+			authProvider: authProvider,
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the service accounts that use workload identity",
+		Long:  listLongDescription,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listCmd.run(context.Background(), cmd.OutOrStdout())
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&listCmd.serviceAccountNamespace, options.ServiceAccountNamespace.Flag, "", "Namespace of the service accounts. Defaults to all namespaces")
+	f.StringVar(&listCmd.serviceAccountIssuerURL, options.ServiceAccountIssuerURL.Flag, "", "URL of the issuer. Discovered from the cluster if not specified")
+	f.StringVarP(&listCmd.output, "output", "o", outputTable, fmt.Sprintf("Output format. One of: %s, %s, %s", outputTable, outputJSON, outputYAML))
+
+	return cmd
+}
+
+func (lc *listCmd) run(ctx context.Context, out io.Writer) error {
+	if err := lc.validate(); err != nil {
+		return err
+	}
+	kubeClient, err := lc.getKubeClient()
+	if err != nil {
+		return err
+	}
+
+	sas, err := kuberneteshelper.ListServiceAccounts(ctx, kubeClient, lc.serviceAccountNamespace, map[string]string{webhook.UseWorkloadIdentityLabel: "true"})
+	if err != nil {
+		return err
+	}
+	sortServiceAccounts(sas)
+
+	inv := newInventory(lc.authProvider.GetAzureClient(), lc.getIssuer(ctx))
+	infos := []serviceAccountInfo{}
+	for i := range sas {
+		infos = append(infos, inv.describe(ctx, &sas[i]))
+	}
+
+	if lc.output != outputTable {
+		return printStructured(out, lc.output, infos)
+	}
+	tw := newTabWriter(out)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tCLIENT-ID\tIDENTITY\tFEDERATED-CREDENTIALS\tSTATUS")
+	for _, info := range infos {
+		identity := ""
+		if info.Identity != nil {
+			identity = info.Identity.DisplayName
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			info.Namespace,
+			info.Name,
+			valueOrNone(info.ClientID),
+			valueOrNone(identity),
+			strconv.Itoa(len(info.FederatedCredentials)),
+			info.Status,
+		)
+	}
+	return tw.Flush()
+}
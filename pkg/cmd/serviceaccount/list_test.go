@@ -0,0 +1,284 @@
+package serviceaccount
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/golang/mock/gomock"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	testAppClientID     = "app-client-id"
+	testUAMIClientID    = "uami-client-id"
+	testUAMIResourceID  = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/mi"
+	testUnknownClientID = "unknown-client-id"
+)
+
+func newInventoryServiceAccount(namespace, name, clientID string, labelled bool) *corev1.ServiceAccount {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+	if labelled {
+		sa.Labels[webhook.UseWorkloadIdentityLabel] = "true"
+	}
+	if clientID != "" {
+		sa.Annotations[webhook.ClientIDAnnotation] = clientID
+	}
+	return sa
+}
+
+// expectAADApplication expects the client ID to resolve to an AAD application
+// with a federated identity credential for the subjects
+func expectAADApplication(m *mock_cloud.MockInterfaceMockRecorder, subjects ...string) {
+	app := models.NewApplication()
+	app.SetId(to.Ptr("app-object-id"))
+	app.SetDisplayName(to.Ptr("app-display-name"))
+	var fics []models.FederatedIdentityCredentialable
+	for _, subject := range subjects {
+		fic := models.NewFederatedIdentityCredential()
+		fic.SetName(to.Ptr(strings.ReplaceAll(subject, ":", "-")))
+		fic.SetIssuer(to.Ptr(testIssuerURL))
+		fic.SetSubject(to.Ptr(subject))
+		fic.SetAudiences([]string{webhook.DefaultAudience})
+		fics = append(fics, fic)
+	}
+	m.GetApplicationByAppID(gomock.Any(), testAppClientID).Return(app, nil).Times(1)
+	m.ListFederatedCredentials(gomock.Any(), "app-object-id").Return(fics, nil).Times(1)
+}
+
+// expectUAMI expects the client ID to resolve to a user-assigned managed identity
+// with a federated identity credential for the subject and another issuer
+func expectUAMI(m *mock_cloud.MockInterfaceMockRecorder, subject string) {
+	sp := models.NewServicePrincipal()
+	sp.SetId(to.Ptr("uami-object-id"))
+	sp.SetDisplayName(to.Ptr("mi"))
+	sp.SetAlternativeNames([]string{"isExplicit=True", testUAMIResourceID})
+	fic := armmsi.FederatedIdentityCredential{
+		Name: to.Ptr("mi-fic"),
+		Properties: &armmsi.FederatedIdentityCredentialProperties{
+			Issuer:    to.Ptr("https://other-issuer.example.com/"),
+			Subject:   to.Ptr(subject),
+			Audiences: []*string{to.Ptr(webhook.DefaultAudience)},
+		},
+	}
+	m.GetApplicationByAppID(gomock.Any(), testUAMIClientID).Return(nil, errors.New("application with app ID 'uami-client-id' not found")).Times(1)
+	m.GetServicePrincipalByAppID(gomock.Any(), testUAMIClientID).Return(sp, nil).Times(1)
+	m.ListUserAssignedIdentityFederatedCredentialsByID(gomock.Any(), testUAMIResourceID).Return([]armmsi.FederatedIdentityCredential{fic}, nil).Times(1)
+}
+
+func newTestListCmd(m *mock_cloud.MockInterface, kubeClient client.Client) *listCmd {
+	return &listCmd{
+		inventoryOptions: inventoryOptions{
+			serviceAccountIssuerURL: testIssuerURL,
+			output:                  outputJSON,
+			authProvider:            &mockAuthProvider{azureClient: m},
+			kubeClient:              kubeClient,
+		},
+	}
+}
+
+func TestListRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newInventoryServiceAccount("default", "app", testAppClientID, true),
+		// shares the AAD application with default/app, which is only resolved once
+		newInventoryServiceAccount("apps", "app", testAppClientID, true),
+		newInventoryServiceAccount("apps", "worker", testUAMIClientID, true),
+		newInventoryServiceAccount("apps", "unknown", testUnknownClientID, true),
+		newInventoryServiceAccount("apps", "no-client-id", "", true),
+		// service accounts are listed with a label selector, so annotated service accounts without the label are skipped
+		newInventoryServiceAccount("apps", "unlabelled", testAppClientID, false),
+		newInventoryServiceAccount("default", "default", "", false),
+	).Build()
+
+	m := mock_cloud.NewMockInterface(ctrl)
+	expectAADApplication(m.EXPECT(), "system:serviceaccount:default:app")
+	expectUAMI(m.EXPECT(), "system:serviceaccount:apps:worker")
+	m.EXPECT().GetApplicationByAppID(gomock.Any(), testUnknownClientID).Return(nil, errors.New("application with app ID 'unknown-client-id' not found"))
+	m.EXPECT().GetServicePrincipalByAppID(gomock.Any(), testUnknownClientID).Return(nil, errors.New("service principal with app ID 'unknown-client-id' not found"))
+
+	out := &bytes.Buffer{}
+	if err := newTestListCmd(m, kubeClient).run(context.Background(), out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	var infos []serviceAccountInfo
+	if err := json.Unmarshal(out.Bytes(), &infos); err != nil {
+		t.Fatalf("failed to unmarshal output: %v", err)
+	}
+	got := make(map[string]serviceAccountInfo)
+	var names []string
+	for _, info := range infos {
+		name := info.Namespace + "/" + info.Name
+		names = append(names, name)
+		got[name] = info
+	}
+	if want := []string{"apps/app", "apps/no-client-id", "apps/unknown", "apps/worker", "default/app"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected service accounts %v, got %v", want, names)
+	}
+
+	tests := []struct {
+		name         string
+		status       inventoryStatus
+		identityType string
+		message      string
+	}{
+		{name: "default/app", status: statusOK, identityType: "aad-application"},
+		{name: "apps/app", status: statusMissing, identityType: "aad-application", message: "no federated identity credential with issuer https://issuer.example.com/ and subject system:serviceaccount:apps:app"},
+		{name: "apps/worker", status: statusMissing, identityType: "uami"},
+		{name: "apps/unknown", status: statusError, message: "no AAD application or user-assigned managed identity found with client ID unknown-client-id"},
+		{name: "apps/no-client-id", status: statusError, message: "service account has no azure.workload.identity/client-id annotation"},
+	}
+	for _, test := range tests {
+		info := got[test.name]
+		if info.Status != test.status {
+			t.Errorf("%s: expected status %s, got %s", test.name, test.status, info.Status)
+		}
+		if test.message != "" && info.Message != test.message {
+			t.Errorf("%s: expected message %q, got %q", test.name, test.message, info.Message)
+		}
+		if test.identityType == "" {
+			if info.Identity != nil {
+				t.Errorf("%s: expected no identity, got %+v", test.name, info.Identity)
+			}
+			continue
+		}
+		if info.Identity == nil || info.Identity.Type != test.identityType {
+			t.Errorf("%s: expected identity type %s, got %+v", test.name, test.identityType, info.Identity)
+		}
+	}
+
+	worker := got["apps/worker"]
+	if worker.Identity.ResourceID != testUAMIResourceID || worker.Identity.DisplayName != "mi" {
+		t.Errorf("unexpected user-assigned managed identity %+v", worker.Identity)
+	}
+	if len(worker.FederatedCredentials) != 1 || worker.FederatedCredentials[0].Issuer != "https://other-issuer.example.com/" {
+		t.Errorf("unexpected federated credentials %+v", worker.FederatedCredentials)
+	}
+}
+
+func TestListRunNamespace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newInventoryServiceAccount("default", "app", testAppClientID, true),
+		newInventoryServiceAccount("apps", "worker", testUAMIClientID, true),
+	).Build()
+
+	m := mock_cloud.NewMockInterface(ctrl)
+	expectAADApplication(m.EXPECT(), "system:serviceaccount:default:app")
+
+	lc := newTestListCmd(m, kubeClient)
+	lc.serviceAccountNamespace = "default"
+	lc.output = outputTable
+	out := &bytes.Buffer{}
+	if err := lc.run(context.Background(), out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	want := "NAMESPACE  NAME  CLIENT-ID      IDENTITY          FEDERATED-CREDENTIALS  STATUS\n" +
+		"default    app   app-client-id  app-display-name  1                      ok\n"
+	if out.String() != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func TestListRunIssuerUnknown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newInventoryServiceAccount("default", "app", testAppClientID, true),
+	).Build()
+
+	m := mock_cloud.NewMockInterface(ctrl)
+	expectAADApplication(m.EXPECT(), "system:serviceaccount:default:app")
+
+	lc := newTestListCmd(m, kubeClient)
+	lc.serviceAccountIssuerURL = ""
+	lc.discoverIssuer = func(ctx context.Context) (string, error) {
+		return "", errors.New("forbidden")
+	}
+	lc.output = outputYAML
+	out := &bytes.Buffer{}
+	if err := lc.run(context.Background(), out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "status: unknown") {
+		t.Errorf("expected status unknown, got:\n%s", out.String())
+	}
+}
+
+func TestListRunInvalidOutput(t *testing.T) {
+	lc := newTestListCmd(nil, fake.NewClientBuilder().Build())
+	lc.output = "xml"
+	err := lc.run(context.Background(), &bytes.Buffer{})
+	if err == nil || err.Error() != `invalid --output "xml", must be table, json or yaml` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestListRunEmpty(t *testing.T) {
+	lc := newTestListCmd(nil, fake.NewClientBuilder().Build())
+	out := &bytes.Buffer{}
+	if err := lc.run(context.Background(), out); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("expected an empty list, got %q", out.String())
+	}
+}
+
+func TestGetManagedIdentityResourceID(t *testing.T) {
+	tests := []struct {
+		name             string
+		alternativeNames []string
+		want             string
+	}{
+		{
+			name:             "user-assigned managed identity",
+			alternativeNames: []string{"isExplicit=True", testUAMIResourceID},
+			want:             testUAMIResourceID,
+		},
+		{
+			name:             "lower case resource ID",
+			alternativeNames: []string{strings.ToLower(testUAMIResourceID)},
+			want:             strings.ToLower(testUAMIResourceID),
+		},
+		{
+			name:             "not a managed identity",
+			alternativeNames: []string{"api://app"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := getManagedIdentityResourceID(test.alternativeNames); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
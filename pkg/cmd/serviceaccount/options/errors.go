@@ -17,3 +17,8 @@ func OneOfFlagsIsRequiredError(names ...string) error {
 	flags := fmt.Sprintf("--%s", strings.Join(names, " or --"))
 	return errors.Errorf("%s is required", flags)
 }
+
+// InvalidIdentityTypeError is returned when the identity type is not supported
+func InvalidIdentityTypeError(identityType string) error {
+	return errors.Errorf("invalid --%s %q, must be %s or %s", IdentityType.Flag, identityType, IdentityTypeAADApplication, IdentityTypeUAMI)
+}
@@ -41,3 +41,10 @@ func TestOneOfFlagsIsRequiredError(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidIdentityTypeError(t *testing.T) {
+	want := `invalid --identity-type "msi", must be aad-application or uami`
+	if err := InvalidIdentityTypeError("msi"); err.Error() != want {
+		t.Errorf("InvalidIdentityTypeError() = %v, want %v", err, want)
+	}
+}
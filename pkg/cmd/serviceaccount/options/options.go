@@ -1,5 +1,7 @@
 package options
 
+import "fmt"
+
 type option struct {
 	Flag        string
 	Description string
@@ -61,9 +63,41 @@ var (
 		Flag:        "azure-role",
 		Description: "Role of the AAD application (see all available roles at https://docs.microsoft.com/en-us/azure/role-based-access-control/built-in-roles)",
 	}
-	// RoleAssignmentID flag sets the Azure role assignment ID
+	// RoleAssignmentID flag sets the Azure role assignment IDs
 	RoleAssignmentID = option{
 		Flag:        "role-assignment-id",
-		Description: "Azure role assignment ID",
+		Description: "Azure role assignment ID. Can be specified multiple times",
+	}
+	// RoleAssignments flag adds role assignments in addition to the one of --azure-role and --azure-scope
+	RoleAssignments = option{
+		Flag:        "role-assignment",
+		Description: "Role assignment in the format role=<role>,scope=<scope>. Can be specified multiple times",
+	}
+	// IdentityType flag sets the type of the identity that is federated with the service account
+	IdentityType = option{
+		Flag:        "identity-type",
+		Description: fmt.Sprintf("Type of the identity that is federated with the service account, either %s or %s (user-assigned managed identity)", IdentityTypeAADApplication, IdentityTypeUAMI),
+	}
+	// ManagedIdentityName flag sets the user-assigned managed identity name
+	ManagedIdentityName = option{
+		Flag:        "managed-identity-name",
+		Description: "Name of the user-assigned managed identity. Required if the identity type is uami",
 	}
+	// ManagedIdentityResourceGroup flag sets the resource group of the user-assigned managed identity
+	ManagedIdentityResourceGroup = option{
+		Flag:        "managed-identity-resource-group",
+		Description: "Resource group of the user-assigned managed identity. Required if the identity type is uami",
+	}
+	// ManagedIdentityLocation flag sets the location of the user-assigned managed identity
+	ManagedIdentityLocation = option{
+		Flag:        "managed-identity-location",
+		Description: "Location of the user-assigned managed identity. Required if the identity doesn't exist and is created",
+	}
+)
+
+const (
+	// IdentityTypeAADApplication federates the service account with an AAD application through Microsoft Graph
+	IdentityTypeAADApplication = "aad-application"
+	// IdentityTypeUAMI federates the service account with a user-assigned managed identity through Azure Resource Manager
+	IdentityTypeUAMI = "uami"
 )
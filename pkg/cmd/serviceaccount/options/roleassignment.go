@@ -0,0 +1,80 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// RoleAssignment is a role assignment of the identity that is federated with the service account
+type RoleAssignment struct {
+	Role  string
+	Scope string
+}
+
+// String returns the role assignment in the format of the --role-assignment flag
+func (r RoleAssignment) String() string {
+	return fmt.Sprintf("role=%s,scope=%s", r.Role, r.Scope)
+}
+
+// ParseRoleAssignment parses a role assignment in the format role=<role>,scope=<scope>
+func ParseRoleAssignment(s string) (RoleAssignment, error) {
+	ra := RoleAssignment{}
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return RoleAssignment{}, errors.Errorf("invalid role assignment %q, must be in the format role=<role>,scope=<scope>", s)
+		}
+		switch strings.TrimSpace(key) {
+		case "role":
+			ra.Role = strings.TrimSpace(value)
+		case "scope":
+			ra.Scope = strings.TrimSpace(value)
+		default:
+			return RoleAssignment{}, errors.Errorf("invalid key %q in role assignment %q, must be role or scope", key, s)
+		}
+	}
+	if ra.Role == "" || ra.Scope == "" {
+		return RoleAssignment{}, errors.Errorf("invalid role assignment %q, role and scope are required", s)
+	}
+	return ra, nil
+}
+
+// roleAssignmentsValue is a pflag.Value that appends a role assignment every time the flag is set
+type roleAssignmentsValue struct {
+	value *[]RoleAssignment
+}
+
+var _ pflag.Value = &roleAssignmentsValue{}
+
+// NewRoleAssignmentsValue returns a pflag.Value for a repeatable role assignment flag
+func NewRoleAssignmentsValue(p *[]RoleAssignment) pflag.Value {
+	return &roleAssignmentsValue{value: p}
+}
+
+func (v *roleAssignmentsValue) Set(s string) error {
+	ra, err := ParseRoleAssignment(s)
+	if err != nil {
+		return err
+	}
+	*v.value = append(*v.value, ra)
+	return nil
+}
+
+func (v *roleAssignmentsValue) String() string {
+	// an empty string is not printed as the default value of the flag
+	if v.value == nil || len(*v.value) == 0 {
+		return ""
+	}
+	values := make([]string, 0, len(*v.value))
+	for _, ra := range *v.value {
+		values = append(values, ra.String())
+	}
+	return "[" + strings.Join(values, " ") + "]"
+}
+
+func (v *roleAssignmentsValue) Type() string {
+	return "roleAssignment"
+}
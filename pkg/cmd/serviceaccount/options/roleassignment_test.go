@@ -0,0 +1,86 @@
+package options
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestParseRoleAssignment(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expect   RoleAssignment
+		errorMsg string
+	}{
+		{
+			name:   "role and scope",
+			value:  "role=Storage Blob Data Reader,scope=/subscriptions/sub/resourceGroups/rg",
+			expect: RoleAssignment{Role: "Storage Blob Data Reader", Scope: "/subscriptions/sub/resourceGroups/rg"},
+		},
+		{
+			name:   "scope before role with spaces",
+			value:  "scope= /subscriptions/sub , role=AcrPull",
+			expect: RoleAssignment{Role: "AcrPull", Scope: "/subscriptions/sub"},
+		},
+		{
+			name:     "missing scope",
+			value:    "role=AcrPull",
+			errorMsg: `invalid role assignment "role=AcrPull", role and scope are required`,
+		},
+		{
+			name:     "unknown key",
+			value:    "role=AcrPull,scope=/subscriptions/sub,principal=foo",
+			errorMsg: `invalid key "principal" in role assignment "role=AcrPull,scope=/subscriptions/sub,principal=foo", must be role or scope`,
+		},
+		{
+			name:     "not a key value pair",
+			value:    "AcrPull",
+			errorMsg: `invalid role assignment "AcrPull", must be in the format role=<role>,scope=<scope>`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ra, err := ParseRoleAssignment(test.value)
+			if test.errorMsg != "" {
+				if err == nil || err.Error() != test.errorMsg {
+					t.Errorf("ParseRoleAssignment() error = %v, want %v", err, test.errorMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRoleAssignment() error = %v", err)
+			}
+			if ra != test.expect {
+				t.Errorf("ParseRoleAssignment() = %+v, want %+v", ra, test.expect)
+			}
+		})
+	}
+}
+
+func TestRoleAssignmentsValue(t *testing.T) {
+	var roleAssignments []RoleAssignment
+	f := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	f.Var(NewRoleAssignmentsValue(&roleAssignments), RoleAssignments.Flag, RoleAssignments.Description)
+
+	err := f.Parse([]string{
+		"--role-assignment", "role=Key Vault Secrets User,scope=/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv",
+		"--role-assignment", "role=AcrPull,scope=/subscriptions/sub",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	expect := []RoleAssignment{
+		{Role: "Key Vault Secrets User", Scope: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"},
+		{Role: "AcrPull", Scope: "/subscriptions/sub"},
+	}
+	if !reflect.DeepEqual(roleAssignments, expect) {
+		t.Errorf("expected role assignments %+v, got %+v", expect, roleAssignments)
+	}
+
+	if err := f.Parse([]string{"--role-assignment", "AcrPull"}); err == nil {
+		t.Errorf("expected error for an invalid role assignment")
+	}
+}
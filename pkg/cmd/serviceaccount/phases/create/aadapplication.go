@@ -29,6 +29,7 @@ func NewAADApplicationPhase() workflow.Phase {
 		Description: "Create Azure Active Directory (AAD) application and its underlying service principal",
 		PreRun:      p.prerun,
 		Run:         p.run,
+		Plan:        p.plan,
 		Flags:       []string{options.AADApplicationName.Flag},
 	}
 }
@@ -96,3 +97,45 @@ func (p *aadApplicationPhase) run(ctx context.Context, data workflow.RunData) er
 
 	return nil
 }
+
+func (p *aadApplicationPhase) plan(ctx context.Context, data workflow.RunData) ([]workflow.PlannedAction, error) {
+	createData := data.(CreateData)
+
+	app, err := createData.AADApplication()
+	if err != nil {
+		if !cloud.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get AAD application")
+		}
+		return []workflow.PlannedAction{
+			{Phase: aadApplicationPhaseName, Action: workflow.ActionCreate, Resource: "AAD application", Name: createData.AADApplicationName()},
+			{Phase: aadApplicationPhaseName, Action: workflow.ActionCreate, Resource: "service principal", Name: createData.AADApplicationName()},
+		}, nil
+	}
+	actions := []workflow.PlannedAction{{
+		Phase:    aadApplicationPhaseName,
+		Action:   workflow.ActionSkip,
+		Resource: "AAD application",
+		Name:     createData.AADApplicationName(),
+		Reason:   fmt.Sprintf("already exists with client ID %s", *app.GetAppId()),
+	}}
+
+	sp, err := createData.ServicePrincipal()
+	if err != nil {
+		if !cloud.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get service principal")
+		}
+		return append(actions, workflow.PlannedAction{
+			Phase:    aadApplicationPhaseName,
+			Action:   workflow.ActionCreate,
+			Resource: "service principal",
+			Name:     createData.ServicePrincipalName(),
+		}), nil
+	}
+	return append(actions, workflow.PlannedAction{
+		Phase:    aadApplicationPhaseName,
+		Action:   workflow.ActionSkip,
+		Resource: "service principal",
+		Name:     createData.ServicePrincipalName(),
+		Reason:   fmt.Sprintf("already exists with object ID %s", *sp.GetId()),
+	}), nil
+}
@@ -2,6 +2,7 @@ package phases
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -95,3 +96,62 @@ func testServicePrincipal(appID, objectID, displayName string) models.ServicePri
 	sp.SetDisplayName(to.Ptr(displayName))
 	return sp
 }
+
+func TestAADApplicationPlan(t *testing.T) {
+	phase := NewAADApplicationPhase()
+
+	tests := []struct {
+		name   string
+		data   *mockCreateData
+		expect []workflow.PlannedAction
+	}{
+		{
+			name: "AAD application doesn't exist",
+			data: &mockCreateData{aadApplicationName: "aad-application"},
+			expect: []workflow.PlannedAction{
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionCreate, Resource: "AAD application", Name: "aad-application"},
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionCreate, Resource: "service principal", Name: "aad-application"},
+			},
+		},
+		{
+			name: "service principal doesn't exist",
+			data: &mockCreateData{
+				aadApplicationName: "aad-application",
+				aadApplication:     testApplication("client-id", "object-id", "aad-application"),
+			},
+			expect: []workflow.PlannedAction{
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionSkip, Resource: "AAD application", Name: "aad-application", Reason: "already exists with client ID client-id"},
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionCreate, Resource: "service principal", Name: "aad-application"},
+			},
+		},
+		{
+			name: "AAD application and service principal exist",
+			data: &mockCreateData{
+				aadApplicationName: "aad-application",
+				aadApplication:     testApplication("client-id", "object-id", "aad-application"),
+				servicePrincipal:   testServicePrincipal("client-id", "sp-object-id", "aad-application"),
+			},
+			expect: []workflow.PlannedAction{
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionSkip, Resource: "AAD application", Name: "aad-application", Reason: "already exists with client ID client-id"},
+				{Phase: aadApplicationPhaseName, Action: workflow.ActionSkip, Resource: "service principal", Name: "aad-application", Reason: "already exists with object ID sp-object-id"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// no call is expected to the azure client in dry-run mode
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			test.data.azureClient = mock_cloud.NewMockInterface(ctrl)
+
+			plan, err := phase.Plan(context.Background(), test.data)
+			if err != nil {
+				t.Fatalf("expected no error but got: %s", err.Error())
+			}
+			if !reflect.DeepEqual(plan, test.expect) {
+				t.Errorf("expected plan %+v, got %+v", test.expect, plan)
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package phases
 import (
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 )
 
 // CreateData is the interface to use for create phase.
@@ -50,12 +52,42 @@ type CreateData interface {
 	// This will be used for creating or removing the role assignment.
 	ServicePrincipalObjectID() string
 
+	// IdentityType returns the type of the identity that is federated with the service account,
+	// either options.IdentityTypeAADApplication or options.IdentityTypeUAMI.
+	IdentityType() string
+
+	// ManagedIdentity returns the user-assigned managed identity.
+	// This will return the cached value if it has been fetched.
+	ManagedIdentity() (armmsi.Identity, error)
+
+	// ManagedIdentityName returns the name of the user-assigned managed identity.
+	ManagedIdentityName() string
+
+	// ManagedIdentityResourceGroup returns the resource group of the user-assigned managed identity.
+	ManagedIdentityResourceGroup() string
+
+	// ManagedIdentityLocation returns the location of the user-assigned managed identity.
+	// This will be used for creating the user-assigned managed identity if it doesn't exist.
+	ManagedIdentityLocation() string
+
+	// ManagedIdentityClientID returns the client ID of the user-assigned managed identity.
+	// This will be used for annotating the service account.
+	ManagedIdentityClientID() string
+
+	// ManagedIdentityPrincipalID returns the principal ID of the user-assigned managed identity.
+	// This will be used for creating the role assignment.
+	ManagedIdentityPrincipalID() string
+
 	// AzureRole returns the Azure role.
 	AzureRole() string
 
 	// AzureScope returns the Azure scope.
 	AzureScope() string
 
+	// RoleAssignments returns the role assignments in addition to
+	// the one of the Azure role and scope.
+	RoleAssignments() []options.RoleAssignment
+
 	// AzureTenantID returns the Azure tenant ID.
 	AzureTenantID() string
 
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/pkg/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 )
 
@@ -26,6 +28,12 @@ type mockCreateData struct {
 	servicePrincipalName          string
 	azureRole                     string
 	azureScope                    string
+	roleAssignments               []options.RoleAssignment
+	identityType                  string
+	managedIdentity               *armmsi.Identity
+	managedIdentityName           string
+	managedIdentityResourceGroup  string
+	managedIdentityLocation       string
 	azureTenantID                 string
 	azureClient                   cloud.Interface
 	kubeClient                    client.Client
@@ -89,6 +97,43 @@ func (c *mockCreateData) ServicePrincipalObjectID() string {
 	return c.servicePrincipalObjectID
 }
 
+func (c *mockCreateData) IdentityType() string {
+	return c.identityType
+}
+
+func (c *mockCreateData) ManagedIdentity() (armmsi.Identity, error) {
+	if c.managedIdentity == nil {
+		return armmsi.Identity{}, errors.New("not found")
+	}
+	return *c.managedIdentity, nil
+}
+
+func (c *mockCreateData) ManagedIdentityName() string {
+	return c.managedIdentityName
+}
+
+func (c *mockCreateData) ManagedIdentityResourceGroup() string {
+	return c.managedIdentityResourceGroup
+}
+
+func (c *mockCreateData) ManagedIdentityLocation() string {
+	return c.managedIdentityLocation
+}
+
+func (c *mockCreateData) ManagedIdentityClientID() string {
+	if c.managedIdentity == nil {
+		return ""
+	}
+	return *c.managedIdentity.Properties.ClientID
+}
+
+func (c *mockCreateData) ManagedIdentityPrincipalID() string {
+	if c.managedIdentity == nil {
+		return ""
+	}
+	return *c.managedIdentity.Properties.PrincipalID
+}
+
 func (c *mockCreateData) AzureRole() string {
 	return c.azureRole
 }
@@ -97,6 +142,10 @@ func (c *mockCreateData) AzureScope() string {
 	return c.azureScope
 }
 
+func (c *mockCreateData) RoleAssignments() []options.RoleAssignment {
+	return c.roleAssignments
+}
+
 func (c *mockCreateData) AzureTenantID() string {
 	return c.azureTenantID
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/pkg/errors"
 	"monis.app/mlog"
@@ -29,15 +30,19 @@ func NewFederatedIdentityPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:        federatedIdentityPhaseName,
 		Aliases:     []string{"fi"},
-		Description: "Create federated identity credential between the AAD application and the Kubernetes service account",
+		Description: "Create federated identity credential between the AAD application or user-assigned managed identity and the Kubernetes service account",
 		PreRun:      p.prerun,
 		Run:         p.run,
+		Plan:        p.plan,
 		Flags: []string{
 			options.ServiceAccountNamespace.Flag,
 			options.ServiceAccountName.Flag,
 			options.ServiceAccountIssuerURL.Flag,
 			options.AADApplicationName.Flag,
 			options.AADApplicationObjectID.Flag,
+			options.IdentityType.Flag,
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
 		},
 	}
 }
@@ -57,6 +62,14 @@ func (p *federatedIdentityPhase) prerun(data workflow.RunData) error {
 	if createData.ServiceAccountIssuerURL() == "" {
 		return options.FlagIsRequiredError(options.ServiceAccountIssuerURL.Flag)
 	}
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		if createData.ManagedIdentityName() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityName.Flag)
+		}
+		if createData.ManagedIdentityResourceGroup() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityResourceGroup.Flag)
+		}
+	}
 
 	return nil
 }
@@ -70,6 +83,10 @@ func (p *federatedIdentityPhase) run(ctx context.Context, data workflow.RunData)
 	description := fmt.Sprintf("Federated Service Account for %s/%s", serviceAccountNamespace, serviceAccountName)
 	audiences := []string{webhook.DefaultAudience}
 
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		return p.addManagedIdentityFederatedCredential(ctx, createData, subject, audiences)
+	}
+
 	objectID := createData.AADApplicationObjectID()
 	fic := models.NewFederatedIdentityCredential()
 	fic.SetAudiences(audiences)
@@ -97,3 +114,82 @@ func (p *federatedIdentityPhase) run(ctx context.Context, data workflow.RunData)
 
 	return nil
 }
+
+// addManagedIdentityFederatedCredential adds the federated identity credential to the user-assigned managed identity.
+// The federated identity credential is updated if it has been previously created.
+func (p *federatedIdentityPhase) addManagedIdentityFederatedCredential(ctx context.Context, createData CreateData, subject string, audiences []string) error {
+	name := util.GetManagedIdentityFederatedCredentialName(createData.ServiceAccountNamespace(), createData.ServiceAccountName(), createData.ServiceAccountIssuerURL())
+	fic := armmsi.FederatedIdentityCredential{
+		Properties: &armmsi.FederatedIdentityCredentialProperties{
+			Audiences: to.SliceOfPtrs(audiences...),
+			Issuer:    to.Ptr(createData.ServiceAccountIssuerURL()),
+			Subject:   to.Ptr(subject),
+		},
+	}
+
+	err := createData.AzureClient().AddUserAssignedIdentityFederatedCredential(ctx, createData.ManagedIdentityResourceGroup(), createData.ManagedIdentityName(), name, fic)
+	if err != nil {
+		return errors.Wrap(err, "failed to add federated credential")
+	}
+
+	mlog.WithValues(
+		"managedIdentityName", createData.ManagedIdentityName(),
+		"subject", subject,
+	).WithName(federatedIdentityPhaseName).Info("added federated credential")
+
+	return nil
+}
+
+func (p *federatedIdentityPhase) plan(ctx context.Context, data workflow.RunData) ([]workflow.PlannedAction, error) {
+	createData := data.(CreateData)
+
+	issuer := createData.ServiceAccountIssuerURL()
+	subject := util.GetFederatedCredentialSubject(createData.ServiceAccountNamespace(), createData.ServiceAccountName())
+	action := workflow.PlannedAction{
+		Phase:    federatedIdentityPhaseName,
+		Action:   workflow.ActionCreate,
+		Resource: "federated identity credential",
+		Name:     fmt.Sprintf("%s (issuer %s)", subject, issuer),
+	}
+
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		if _, err := createData.ManagedIdentity(); err != nil {
+			if !cloud.IsNotFound(err) {
+				return nil, errors.Wrap(err, "failed to get user-assigned managed identity")
+			}
+			action.Reason = "user-assigned managed identity is yet to be created"
+			return []workflow.PlannedAction{action}, nil
+		}
+		fic, err := createData.AzureClient().GetUserAssignedIdentityFederatedCredential(ctx, createData.ManagedIdentityResourceGroup(), createData.ManagedIdentityName(), issuer, subject)
+		if err != nil {
+			if !cloud.IsFederatedCredentialNotFound(err) {
+				return nil, errors.Wrap(err, "failed to get federated credential")
+			}
+			return []workflow.PlannedAction{action}, nil
+		}
+		// the federated credential of a user-assigned managed identity is updated if it already exists
+		action.Action = workflow.ActionUpdate
+		if fic.Properties != nil && len(fic.Properties.Audiences) == 1 && fic.Properties.Audiences[0] != nil && *fic.Properties.Audiences[0] == webhook.DefaultAudience {
+			action.Action = workflow.ActionSkip
+			action.Reason = "already exists"
+		}
+		return []workflow.PlannedAction{action}, nil
+	}
+
+	if _, err := createData.AADApplication(); err != nil {
+		if !cloud.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get AAD application")
+		}
+		action.Reason = "AAD application is yet to be created"
+		return []workflow.PlannedAction{action}, nil
+	}
+	if _, err := createData.AzureClient().GetFederatedCredential(ctx, createData.AADApplicationObjectID(), issuer, subject); err != nil {
+		if !cloud.IsFederatedCredentialNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get federated credential")
+		}
+		return []workflow.PlannedAction{action}, nil
+	}
+	action.Action = workflow.ActionSkip
+	action.Reason = "already exists"
+	return []workflow.PlannedAction{action}, nil
+}
@@ -6,12 +6,14 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/golang/mock/gomock"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
 	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 	"github.com/Azure/azure-workload-identity/pkg/webhook"
@@ -49,6 +51,20 @@ func TestFederatedIdentityPreRun(t *testing.T) {
 			data:     &mockCreateData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test"},
 			errorMsg: "",
 		},
+		{
+			name:     "missing --managed-identity-name",
+			data:     &mockCreateData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI},
+			errorMsg: "--managed-identity-name is required",
+		},
+		{
+			name:     "missing --managed-identity-resource-group",
+			data:     &mockCreateData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI, managedIdentityName: "test"},
+			errorMsg: "--managed-identity-resource-group is required",
+		},
+		{
+			name: "valid managed identity data",
+			data: &mockCreateData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI, managedIdentityName: "test", managedIdentityResourceGroup: "test"},
+		},
 	}
 
 	for _, test := range tests {
@@ -103,3 +119,123 @@ func TestFederatedIdentityRun(t *testing.T) {
 		t.Errorf("expected no error but got: %s", err.Error())
 	}
 }
+
+func TestFederatedIdentityRunManagedIdentity(t *testing.T) {
+	phase := NewFederatedIdentityPhase()
+	data := &mockCreateData{
+		serviceAccountNamespace:      "service-account-namespace",
+		serviceAccountName:           "service-account-name",
+		serviceAccountIssuerURL:      "service-account-issuer-url",
+		identityType:                 options.IdentityTypeUAMI,
+		managedIdentityName:          "managed-identity-name",
+		managedIdentityResourceGroup: "managed-identity-resource-group",
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fic := armmsi.FederatedIdentityCredential{
+		Properties: &armmsi.FederatedIdentityCredentialProperties{
+			Audiences: []*string{to.Ptr(webhook.DefaultAudience)},
+			Issuer:    to.Ptr(data.serviceAccountIssuerURL),
+			Subject:   to.Ptr(util.GetFederatedCredentialSubject(data.serviceAccountNamespace, data.serviceAccountName)),
+		},
+	}
+	name := util.GetManagedIdentityFederatedCredentialName(data.serviceAccountNamespace, data.serviceAccountName, data.serviceAccountIssuerURL)
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().AddUserAssignedIdentityFederatedCredential(gomock.Any(), "managed-identity-resource-group", "managed-identity-name", name, fic).Return(nil)
+	data.azureClient = mockAzureClient
+
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+}
+
+func TestFederatedIdentityPlan(t *testing.T) {
+	phase := NewFederatedIdentityPhase()
+	identity := testManagedIdentity("client-id", "principal-id")
+	subject := util.GetFederatedCredentialSubject("service-account-namespace", "service-account-name")
+	name := fmt.Sprintf("%s (issuer service-account-issuer-url)", subject)
+
+	tests := []struct {
+		name   string
+		data   *mockCreateData
+		setup  func(m *mock_cloud.MockInterface)
+		expect workflow.PlannedAction
+	}{
+		{
+			name:   "AAD application doesn't exist",
+			data:   &mockCreateData{},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate, Reason: "AAD application is yet to be created"},
+		},
+		{
+			name: "federated credential doesn't exist",
+			data: &mockCreateData{aadApplication: testApplication("client-id", "object-id", "test"), aadApplicationObjectID: "object-id"},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().GetFederatedCredential(gomock.Any(), "object-id", "service-account-issuer-url", subject).Return(nil, cloud.ErrFederatedCredentialNotFound)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate},
+		},
+		{
+			name: "federated credential exists",
+			data: &mockCreateData{aadApplication: testApplication("client-id", "object-id", "test"), aadApplicationObjectID: "object-id"},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().GetFederatedCredential(gomock.Any(), "object-id", "service-account-issuer-url", subject).Return(models.NewFederatedIdentityCredential(), nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionSkip, Reason: "already exists"},
+		},
+		{
+			name:   "managed identity doesn't exist",
+			data:   &mockCreateData{identityType: options.IdentityTypeUAMI},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate, Reason: "user-assigned managed identity is yet to be created"},
+		},
+		{
+			name: "federated credential of managed identity has a different audience",
+			data: &mockCreateData{identityType: options.IdentityTypeUAMI, managedIdentity: &identity, managedIdentityName: "identity", managedIdentityResourceGroup: "rg"},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().GetUserAssignedIdentityFederatedCredential(gomock.Any(), "rg", "identity", "service-account-issuer-url", subject).Return(armmsi.FederatedIdentityCredential{
+					Properties: &armmsi.FederatedIdentityCredentialProperties{Audiences: []*string{to.Ptr("api://custom")}},
+				}, nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionUpdate},
+		},
+		{
+			name: "federated credential of managed identity exists",
+			data: &mockCreateData{identityType: options.IdentityTypeUAMI, managedIdentity: &identity, managedIdentityName: "identity", managedIdentityResourceGroup: "rg"},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().GetUserAssignedIdentityFederatedCredential(gomock.Any(), "rg", "identity", "service-account-issuer-url", subject).Return(armmsi.FederatedIdentityCredential{
+					Properties: &armmsi.FederatedIdentityCredentialProperties{Audiences: []*string{to.Ptr(webhook.DefaultAudience)}},
+				}, nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionSkip, Reason: "already exists"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+			if test.setup != nil {
+				test.setup(mockAzureClient)
+			}
+			test.data.azureClient = mockAzureClient
+			test.data.serviceAccountNamespace = "service-account-namespace"
+			test.data.serviceAccountName = "service-account-name"
+			test.data.serviceAccountIssuerURL = "service-account-issuer-url"
+
+			plan, err := phase.Plan(context.Background(), test.data)
+			if err != nil {
+				t.Fatalf("expected no error but got: %s", err.Error())
+			}
+			test.expect.Phase = federatedIdentityPhaseName
+			test.expect.Resource = "federated identity credential"
+			test.expect.Name = name
+			if len(plan) != 1 || plan[0] != test.expect {
+				t.Errorf("expected plan %+v, got %+v", test.expect, plan)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package phases
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/pkg/errors"
+	"monis.app/mlog"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+	"github.com/Azure/azure-workload-identity/pkg/version"
+)
+
+const (
+	managedIdentityPhaseName = "managed-identity"
+)
+
+type managedIdentityPhase struct {
+}
+
+// NewManagedIdentityPhase creates a new phase to create a user-assigned managed identity
+func NewManagedIdentityPhase() workflow.Phase {
+	p := &managedIdentityPhase{}
+	return workflow.Phase{
+		Name:        managedIdentityPhaseName,
+		Aliases:     []string{"mi"},
+		Description: "Create user-assigned managed identity if it doesn't exist",
+		PreRun:      p.prerun,
+		Run:         p.run,
+		Plan:        p.plan,
+		Flags: []string{
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
+			options.ManagedIdentityLocation.Flag,
+		},
+	}
+}
+
+func (p *managedIdentityPhase) prerun(data workflow.RunData) error {
+	createData, ok := data.(CreateData)
+	if !ok {
+		return errors.Errorf("invalid data type %T", data)
+	}
+
+	if createData.ManagedIdentityName() == "" {
+		return options.FlagIsRequiredError(options.ManagedIdentityName.Flag)
+	}
+	if createData.ManagedIdentityResourceGroup() == "" {
+		return options.FlagIsRequiredError(options.ManagedIdentityResourceGroup.Flag)
+	}
+
+	return nil
+}
+
+func (p *managedIdentityPhase) run(ctx context.Context, data workflow.RunData) error {
+	createData := data.(CreateData)
+
+	// Check if the managed identity already exists
+	identity, err := createData.ManagedIdentity()
+	if err != nil {
+		if !cloud.IsNotFound(err) {
+			return errors.Wrap(err, "failed to get user-assigned managed identity")
+		}
+
+		// create the managed identity as it doesn't exist
+		if createData.ManagedIdentityLocation() == "" {
+			return errors.Wrapf(options.FlagIsRequiredError(options.ManagedIdentityLocation.Flag),
+				"user-assigned managed identity %s not found", createData.ManagedIdentityName())
+		}
+		tags := map[string]*string{
+			"azwi-version": to.Ptr(fmt.Sprintf("%s, commit: %s", version.BuildVersion, version.Vcs)),
+		}
+		identity, err = createData.AzureClient().CreateUserAssignedIdentity(ctx, createData.ManagedIdentityResourceGroup(),
+			createData.ManagedIdentityName(), createData.ManagedIdentityLocation(), tags)
+		if err != nil {
+			return errors.Wrap(err, "failed to create user-assigned managed identity")
+		}
+	}
+	if identity.Properties == nil || identity.Properties.ClientID == nil || identity.Properties.PrincipalID == nil {
+		return errors.Errorf("user-assigned managed identity %s has no client ID or principal ID", createData.ManagedIdentityName())
+	}
+
+	mlog.WithValues(
+		"name", createData.ManagedIdentityName(),
+		"resourceGroup", createData.ManagedIdentityResourceGroup(),
+		"clientID", *identity.Properties.ClientID,
+		"principalID", *identity.Properties.PrincipalID,
+	).WithName(managedIdentityPhaseName).Info("created user-assigned managed identity")
+
+	return nil
+}
+
+func (p *managedIdentityPhase) plan(ctx context.Context, data workflow.RunData) ([]workflow.PlannedAction, error) {
+	createData := data.(CreateData)
+
+	action := workflow.PlannedAction{
+		Phase:    managedIdentityPhaseName,
+		Resource: "user-assigned managed identity",
+		Name:     createData.ManagedIdentityName(),
+	}
+	identity, err := createData.ManagedIdentity()
+	if err != nil {
+		if !cloud.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get user-assigned managed identity")
+		}
+		if createData.ManagedIdentityLocation() == "" {
+			return nil, errors.Wrapf(options.FlagIsRequiredError(options.ManagedIdentityLocation.Flag),
+				"user-assigned managed identity %s not found", createData.ManagedIdentityName())
+		}
+		action.Action = workflow.ActionCreate
+		action.Reason = fmt.Sprintf("in resource group %s and location %s", createData.ManagedIdentityResourceGroup(), createData.ManagedIdentityLocation())
+		return []workflow.PlannedAction{action}, nil
+	}
+
+	action.Action = workflow.ActionSkip
+	action.Reason = "already exists"
+	if identity.Properties != nil && identity.Properties.ClientID != nil {
+		action.Reason = fmt.Sprintf("already exists with client ID %s", *identity.Properties.ClientID)
+	}
+	return []workflow.PlannedAction{action}, nil
+}
@@ -0,0 +1,180 @@
+package phases
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/golang/mock/gomock"
+
+	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+)
+
+func TestManagedIdentityPreRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		errorMsg string
+	}{
+		{
+			name:     "invalid data type",
+			data:     "test",
+			errorMsg: "invalid data type string",
+		},
+		{
+			name:     "missing --managed-identity-name",
+			data:     &mockCreateData{},
+			errorMsg: "--managed-identity-name is required",
+		},
+		{
+			name:     "missing --managed-identity-resource-group",
+			data:     &mockCreateData{managedIdentityName: "test"},
+			errorMsg: "--managed-identity-resource-group is required",
+		},
+		{
+			name: "valid data",
+			data: &mockCreateData{managedIdentityName: "test", managedIdentityResourceGroup: "test"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewManagedIdentityPhase().PreRun(test.data)
+			if err == nil {
+				if test.errorMsg != "" {
+					t.Errorf("expected error but got nil")
+				}
+			} else if err.Error() != test.errorMsg {
+				t.Errorf("expected error message: %s, but got: %s", test.errorMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestManagedIdentityRun(t *testing.T) {
+	phase := NewManagedIdentityPhase()
+	data := &mockCreateData{
+		identityType:                 options.IdentityTypeUAMI,
+		managedIdentityName:          "managed-identity-name",
+		managedIdentityResourceGroup: "managed-identity-resource-group",
+		managedIdentityLocation:      "westus2",
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().CreateUserAssignedIdentity(gomock.Any(), "managed-identity-resource-group", "managed-identity-name", "westus2", map[string]*string{
+		"azwi-version": to.Ptr(", commit: "),
+	}).Return(testManagedIdentity("client-id", "principal-id"), nil)
+	data.azureClient = mockAzureClient
+
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+
+	// Test for scenario where the managed identity doesn't exist and no location is specified
+	data.managedIdentityLocation = ""
+	err := phase.Run(context.Background(), data)
+	if err == nil || err.Error() != "user-assigned managed identity managed-identity-name not found: --managed-identity-location is required" {
+		t.Errorf("expected location to be required but got: %v", err)
+	}
+
+	// Test for scenario where the managed identity already exists
+	identity := testManagedIdentity("client-id", "principal-id")
+	data.managedIdentity = &identity
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+}
+
+func TestManagedIdentityRunError(t *testing.T) {
+	phase := NewManagedIdentityPhase()
+	data := &mockCreateData{
+		managedIdentityName:          "managed-identity-name",
+		managedIdentityResourceGroup: "managed-identity-resource-group",
+		managedIdentityLocation:      "westus2",
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().CreateUserAssignedIdentity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(armmsi.Identity{}, &azcore.ResponseError{StatusCode: http.StatusForbidden})
+	data.azureClient = mockAzureClient
+
+	if err := phase.Run(context.Background(), data); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+func testManagedIdentity(clientID, principalID string) armmsi.Identity {
+	return armmsi.Identity{
+		Location: to.Ptr("westus2"),
+		Properties: &armmsi.UserAssignedIdentityProperties{
+			ClientID:    to.Ptr(clientID),
+			PrincipalID: to.Ptr(principalID),
+		},
+	}
+}
+
+func TestManagedIdentityPlan(t *testing.T) {
+	phase := NewManagedIdentityPhase()
+	identity := testManagedIdentity("client-id", "principal-id")
+
+	tests := []struct {
+		name     string
+		data     *mockCreateData
+		expect   []workflow.PlannedAction
+		errorMsg string
+	}{
+		{
+			name: "managed identity doesn't exist",
+			data: &mockCreateData{managedIdentityName: "identity", managedIdentityResourceGroup: "rg", managedIdentityLocation: "westus2"},
+			expect: []workflow.PlannedAction{
+				{Phase: managedIdentityPhaseName, Action: workflow.ActionCreate, Resource: "user-assigned managed identity", Name: "identity", Reason: "in resource group rg and location westus2"},
+			},
+		},
+		{
+			name:     "managed identity doesn't exist without location",
+			data:     &mockCreateData{managedIdentityName: "identity", managedIdentityResourceGroup: "rg"},
+			errorMsg: "user-assigned managed identity identity not found: --managed-identity-location is required",
+		},
+		{
+			name: "managed identity exists",
+			data: &mockCreateData{managedIdentityName: "identity", managedIdentityResourceGroup: "rg", managedIdentity: &identity},
+			expect: []workflow.PlannedAction{
+				{Phase: managedIdentityPhaseName, Action: workflow.ActionSkip, Resource: "user-assigned managed identity", Name: "identity", Reason: "already exists with client ID client-id"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			test.data.azureClient = mock_cloud.NewMockInterface(ctrl)
+
+			plan, err := phase.Plan(context.Background(), test.data)
+			if test.errorMsg != "" {
+				if err == nil || err.Error() != test.errorMsg {
+					t.Errorf("expected error message: %s, but got: %v", test.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %s", err.Error())
+			}
+			if !reflect.DeepEqual(plan, test.expect) {
+				t.Errorf("expected plan %+v, got %+v", test.expect, plan)
+			}
+		})
+	}
+}
@@ -2,17 +2,24 @@ package phases
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"monis.app/mlog"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 )
 
 const (
 	roleAssignmentPhaseName = "role-assignment"
+
+	// maxConcurrentRoleAssignments is the maximum number of role assignments that are created concurrently
+	maxConcurrentRoleAssignments = 4
 )
 
 type roleAssignmentPhase struct {
@@ -24,14 +31,19 @@ func NewRoleAssignmentPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:        roleAssignmentPhaseName,
 		Aliases:     []string{"ra"},
-		Description: "Create role assignment between the AAD application and the Azure cloud resource",
+		Description: "Create role assignments between the AAD application or user-assigned managed identity and the Azure cloud resources",
 		PreRun:      p.prerun,
 		Run:         p.run,
+		Plan:        p.plan,
 		Flags: []string{
 			options.AzureScope.Flag,
 			options.AzureRole.Flag,
+			options.RoleAssignments.Flag,
 			options.ServicePrincipalName.Flag,
 			options.ServicePrincipalObjectID.Flag,
+			options.IdentityType.Flag,
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
 		},
 	}
 }
@@ -42,13 +54,23 @@ func (p *roleAssignmentPhase) prerun(data workflow.RunData) error {
 		return errors.Errorf("invalid data type %T", data)
 	}
 
-	if createData.AzureScope() == "" {
-		return options.FlagIsRequiredError(options.AzureScope.Flag)
-	}
-	if createData.AzureRole() == "" {
-		return options.FlagIsRequiredError(options.AzureRole.Flag)
+	// --azure-role and --azure-scope are optional if --role-assignment is specified
+	if createData.AzureScope() != "" || createData.AzureRole() != "" || len(createData.RoleAssignments()) == 0 {
+		if createData.AzureScope() == "" {
+			return options.FlagIsRequiredError(options.AzureScope.Flag)
+		}
+		if createData.AzureRole() == "" {
+			return options.FlagIsRequiredError(options.AzureRole.Flag)
+		}
 	}
-	if createData.ServicePrincipalName() == "" && createData.ServicePrincipalObjectID() == "" {
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		if createData.ManagedIdentityName() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityName.Flag)
+		}
+		if createData.ManagedIdentityResourceGroup() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityResourceGroup.Flag)
+		}
+	} else if createData.ServicePrincipalName() == "" && createData.ServicePrincipalObjectID() == "" {
 		return options.OneOfFlagsIsRequiredError(options.ServicePrincipalName.Flag, options.ServicePrincipalObjectID.Flag)
 	}
 
@@ -58,27 +80,166 @@ func (p *roleAssignmentPhase) prerun(data workflow.RunData) error {
 func (p *roleAssignmentPhase) run(ctx context.Context, data workflow.RunData) error {
 	createData := data.(CreateData)
 
-	// create the role assignment using object id of the service principal
-	ra, err := createData.AzureClient().CreateRoleAssignment(ctx, createData.AzureScope(), createData.AzureRole(), createData.ServicePrincipalObjectID())
+	// create the role assignments using object id of the service principal,
+	// which is the principal id of the user-assigned managed identity
+	var principalID string
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		principalID = createData.ManagedIdentityPrincipalID()
+	} else {
+		principalID = createData.ServicePrincipalObjectID()
+	}
+
+	roleAssignments := getRoleAssignments(createData)
+	existing := make([]bool, len(roleAssignments))
+	errs := make([]error, len(roleAssignments))
+
+	g := errgroup.Group{}
+	g.SetLimit(maxConcurrentRoleAssignments)
+	for i, roleAssignment := range roleAssignments {
+		i, roleAssignment := i, roleAssignment
+		g.Go(func() error {
+			l := mlog.WithValues(
+				"scope", roleAssignment.Scope,
+				"role", roleAssignment.Role,
+				"servicePrincipalObjectID", principalID,
+			).WithName(roleAssignmentPhaseName)
+
+			ra, err := createData.AzureClient().CreateRoleAssignment(ctx, roleAssignment.Scope, roleAssignment.Role, principalID)
+			if err != nil {
+				if !cloud.IsRoleAssignmentExists(err) {
+					errs[i] = errors.Wrapf(err, "failed to create role assignment %s", roleAssignment)
+					return nil
+				}
+				existing[i] = true
+				l.Debug("role assignment has previously been created")
+				return nil
+			}
+			if ra.ID != nil {
+				l = l.WithValues("roleAssignmentID", *ra.ID)
+			}
+			l.Info("created role assignment")
+			return nil
+		})
+	}
+	// the errors are collected per role assignment so that a failure doesn't stop the others
+	_ = g.Wait()
+
+	created, previouslyCreated := 0, 0
+	for i := range roleAssignments {
+		switch {
+		case errs[i] != nil:
+		case existing[i]:
+			previouslyCreated++
+		default:
+			created++
+		}
+	}
+	mlog.WithValues(
+		"created", created,
+		"previouslyCreated", previouslyCreated,
+		"failed", len(roleAssignments)-created-previouslyCreated,
+	).WithName(roleAssignmentPhaseName).Info("role assignments summary")
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func (p *roleAssignmentPhase) plan(ctx context.Context, data workflow.RunData) ([]workflow.PlannedAction, error) {
+	createData := data.(CreateData)
+
+	roleAssignments := getRoleAssignments(createData)
+	actions := make([]workflow.PlannedAction, 0, len(roleAssignments))
+	for _, roleAssignment := range roleAssignments {
+		actions = append(actions, workflow.PlannedAction{
+			Phase:    roleAssignmentPhaseName,
+			Action:   workflow.ActionCreate,
+			Resource: "role assignment",
+			Name:     fmt.Sprintf("%q on %s", roleAssignment.Role, roleAssignment.Scope),
+		})
+	}
+
+	var principalID string
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		if _, err := createData.ManagedIdentity(); err != nil {
+			if !cloud.IsNotFound(err) {
+				return nil, errors.Wrap(err, "failed to get user-assigned managed identity")
+			}
+			return withReason(actions, "user-assigned managed identity is yet to be created"), nil
+		}
+		principalID = createData.ManagedIdentityPrincipalID()
+	} else {
+		if _, err := createData.ServicePrincipal(); err != nil {
+			if !cloud.IsNotFound(err) {
+				return nil, errors.Wrap(err, "failed to get service principal")
+			}
+			return withReason(actions, "service principal is yet to be created"), nil
+		}
+		principalID = createData.ServicePrincipalObjectID()
+	}
+
+	scopes := make([]string, 0, len(roleAssignments))
+	for _, roleAssignment := range roleAssignments {
+		scopes = append(scopes, roleAssignment.Scope)
+	}
+	ras, err := createData.AzureClient().ListRoleAssignments(ctx, principalID, scopes...)
 	if err != nil {
-		if cloud.IsRoleAssignmentExists(err) {
-			mlog.WithValues(
-				"scope", createData.AzureScope(),
-				"role", createData.AzureRole(),
-				"servicePrincipalObjectID", createData.ServicePrincipalObjectID(),
-				"roleAssignmentID", ra.ID,
-			).WithName(roleAssignmentPhaseName).Debug("role assignment has previously been created")
-		} else {
-			return errors.Wrap(err, "failed to create role assignment")
+		return nil, errors.Wrap(err, "failed to list role assignments")
+	}
+	if len(ras) == 0 {
+		return actions, nil
+	}
+	roleDefinitionIDs := make(map[string]string)
+	for i, roleAssignment := range roleAssignments {
+		roleDefinitionID, ok := roleDefinitionIDs[roleAssignment.Role]
+		if !ok {
+			rd, err := createData.AzureClient().GetRoleDefinitionIDByName(ctx, "", roleAssignment.Role)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get role definition id for role %s", roleAssignment.Role)
+			}
+			if rd.ID != nil {
+				roleDefinitionID = *rd.ID
+			}
+			roleDefinitionIDs[roleAssignment.Role] = roleDefinitionID
+		}
+		for _, ra := range ras {
+			if roleDefinitionID == "" || ra.Properties == nil || ra.Properties.RoleDefinitionID == nil || ra.Properties.Scope == nil {
+				continue
+			}
+			if util.IsSameRoleAssignment(*ra.Properties.RoleDefinitionID, *ra.Properties.Scope, roleDefinitionID, roleAssignment.Scope) {
+				actions[i].Action = workflow.ActionSkip
+				actions[i].Reason = "already exists"
+				break
+			}
 		}
 	}
+	return actions, nil
+}
 
-	mlog.WithValues(
-		"scope", createData.AzureScope(),
-		"role", createData.AzureRole(),
-		"servicePrincipalObjectID", createData.ServicePrincipalObjectID(),
-		"roleAssignmentID", ra.ID,
-	).WithName(roleAssignmentPhaseName).Info("created role assignment")
+// getRoleAssignments returns the role assignment of the Azure role and scope followed by
+// the additional role assignments, without the duplicates.
+func getRoleAssignments(createData CreateData) []options.RoleAssignment {
+	var roleAssignments []options.RoleAssignment
+	if createData.AzureRole() != "" && createData.AzureScope() != "" {
+		roleAssignments = append(roleAssignments, options.RoleAssignment{Role: createData.AzureRole(), Scope: createData.AzureScope()})
+	}
+	roleAssignments = append(roleAssignments, createData.RoleAssignments()...)
 
-	return nil
+	seen := make(map[string]bool)
+	deduplicated := make([]options.RoleAssignment, 0, len(roleAssignments))
+	for _, ra := range roleAssignments {
+		key := util.GetRoleAssignmentKey(ra.Role, ra.Scope)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduplicated = append(deduplicated, ra)
+	}
+	return deduplicated
+}
+
+// withReason sets the reason of all the planned actions.
+func withReason(actions []workflow.PlannedAction, reason string) []workflow.PlannedAction {
+	for i := range actions {
+		actions[i].Reason = reason
+	}
+	return actions
 }
@@ -9,8 +9,10 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
 	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
 )
 
@@ -61,6 +63,24 @@ func TestRoleAssignmentPreRun(t *testing.T) {
 			phase: NewAADApplicationPhase(),
 			data:  &mockCreateData{azureScope: "test", azureRole: "test", aadApplicationName: "test"},
 		},
+		{
+			name:     "missing --managed-identity-name",
+			data:     &mockCreateData{azureScope: "test", azureRole: "test", identityType: options.IdentityTypeUAMI},
+			errorMsg: "--managed-identity-name is required",
+		},
+		{
+			name:     "missing --azure-role with --role-assignment",
+			data:     &mockCreateData{azureScope: "test", roleAssignments: []options.RoleAssignment{{Role: "test", Scope: "test"}}, servicePrincipalName: "test"},
+			errorMsg: "--azure-role is required",
+		},
+		{
+			name: "valid data with --role-assignment only",
+			data: &mockCreateData{roleAssignments: []options.RoleAssignment{{Role: "test", Scope: "test"}}, servicePrincipalName: "test"},
+		},
+		{
+			name: "valid managed identity data",
+			data: &mockCreateData{azureScope: "test", azureRole: "test", identityType: options.IdentityTypeUAMI, managedIdentityName: "test", managedIdentityResourceGroup: "test"},
+		},
 	}
 
 	for _, test := range tests {
@@ -106,3 +126,191 @@ func TestRoleAssignmentRun(t *testing.T) {
 		t.Errorf("expected no error but got: %s", err.Error())
 	}
 }
+
+func TestRoleAssignmentRunMultiple(t *testing.T) {
+	phase := NewRoleAssignmentPhase()
+	data := &mockCreateData{
+		azureRole:                "Key Vault Secrets User",
+		azureScope:               "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv",
+		servicePrincipalObjectID: "service-principal-object-id",
+		roleAssignments: []options.RoleAssignment{
+			{Role: "Storage Blob Data Reader", Scope: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/sa"},
+			{Role: "AcrPull", Scope: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerRegistry/registries/acr"},
+			{Role: "Reader", Scope: "/subscriptions/sub"},
+			// duplicate of --azure-role and --azure-scope
+			{Role: "Key Vault Secrets User", Scope: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv/"},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().CreateRoleAssignment(gomock.Any(), data.azureScope, data.azureRole, data.servicePrincipalObjectID).Return(armauthorization.RoleAssignment{
+		ID: to.Ptr("id"),
+	}, nil)
+	mockAzureClient.EXPECT().CreateRoleAssignment(gomock.Any(), data.roleAssignments[0].Scope, "Storage Blob Data Reader", data.servicePrincipalObjectID).Return(armauthorization.RoleAssignment{},
+		&azcore.ResponseError{StatusCode: http.StatusConflict})
+	mockAzureClient.EXPECT().CreateRoleAssignment(gomock.Any(), data.roleAssignments[1].Scope, "AcrPull", data.servicePrincipalObjectID).Return(armauthorization.RoleAssignment{},
+		errors.New("random error"))
+	mockAzureClient.EXPECT().CreateRoleAssignment(gomock.Any(), "/subscriptions/sub", "Reader", data.servicePrincipalObjectID).Return(armauthorization.RoleAssignment{
+		ID: to.Ptr("id"),
+	}, nil)
+	data.azureClient = mockAzureClient
+
+	// the failure of one role assignment doesn't prevent the others from being created
+	err := phase.Run(context.Background(), data)
+	expected := "failed to create role assignment role=AcrPull,scope=/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerRegistry/registries/acr: random error"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q but got: %v", expected, err)
+	}
+}
+
+func TestRoleAssignmentRunManagedIdentity(t *testing.T) {
+	phase := NewRoleAssignmentPhase()
+	identity := testManagedIdentity("client-id", "principal-id")
+	data := &mockCreateData{
+		azureRole:       "azure-role",
+		azureScope:      "azure-scope",
+		identityType:    options.IdentityTypeUAMI,
+		managedIdentity: &identity,
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().CreateRoleAssignment(context.Background(), data.azureScope, data.azureRole, "principal-id").Return(armauthorization.RoleAssignment{
+		ID: to.Ptr("id"),
+	}, nil)
+	data.azureClient = mockAzureClient
+
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+}
+
+func TestRoleAssignmentPlan(t *testing.T) {
+	phase := NewRoleAssignmentPhase()
+	identity := testManagedIdentity("client-id", "principal-id")
+	roleDefinitionID := "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7"
+	roleAssignment := func(roleDefinitionID, scope string) armauthorization.RoleAssignment {
+		return armauthorization.RoleAssignment{
+			ID: to.Ptr("id"),
+			Properties: &armauthorization.RoleAssignmentPropertiesWithScope{
+				RoleDefinitionID: to.Ptr(roleDefinitionID),
+				Scope:            to.Ptr(scope),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		data   *mockCreateData
+		setup  func(m *mock_cloud.MockInterface)
+		expect workflow.PlannedAction
+	}{
+		{
+			name:   "service principal doesn't exist",
+			data:   &mockCreateData{},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate, Reason: "service principal is yet to be created"},
+		},
+		{
+			name:   "managed identity doesn't exist",
+			data:   &mockCreateData{identityType: options.IdentityTypeUAMI},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate, Reason: "user-assigned managed identity is yet to be created"},
+		},
+		{
+			name: "no role assignment",
+			data: &mockCreateData{servicePrincipal: testServicePrincipal("client-id", "sp-object-id", "test"), servicePrincipalObjectID: "sp-object-id"},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().ListRoleAssignments(gomock.Any(), "sp-object-id", "/subscriptions/sub/resourceGroups/rg").Return(nil, nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate},
+		},
+		{
+			name: "role assignment on another scope",
+			data: &mockCreateData{identityType: options.IdentityTypeUAMI, managedIdentity: &identity},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().ListRoleAssignments(gomock.Any(), "principal-id", "/subscriptions/sub/resourceGroups/rg").Return([]armauthorization.RoleAssignment{
+					roleAssignment(roleDefinitionID, "/subscriptions/sub"),
+				}, nil)
+				m.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{ID: to.Ptr(roleDefinitionID)}, nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionCreate},
+		},
+		{
+			name: "role assignment exists",
+			data: &mockCreateData{identityType: options.IdentityTypeUAMI, managedIdentity: &identity},
+			setup: func(m *mock_cloud.MockInterface) {
+				m.EXPECT().ListRoleAssignments(gomock.Any(), "principal-id", "/subscriptions/sub/resourceGroups/rg").Return([]armauthorization.RoleAssignment{
+					roleAssignment("/subscriptions/sub"+roleDefinitionID, "/subscriptions/sub/resourceGroups/RG"),
+				}, nil)
+				m.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{ID: to.Ptr(roleDefinitionID)}, nil)
+			},
+			expect: workflow.PlannedAction{Action: workflow.ActionSkip, Reason: "already exists"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+			if test.setup != nil {
+				test.setup(mockAzureClient)
+			}
+			test.data.azureClient = mockAzureClient
+			test.data.azureRole = "Reader"
+			test.data.azureScope = "/subscriptions/sub/resourceGroups/rg"
+
+			plan, err := phase.Plan(context.Background(), test.data)
+			if err != nil {
+				t.Fatalf("expected no error but got: %s", err.Error())
+			}
+			test.expect.Phase = roleAssignmentPhaseName
+			test.expect.Resource = "role assignment"
+			test.expect.Name = `"Reader" on /subscriptions/sub/resourceGroups/rg`
+			if len(plan) != 1 || plan[0] != test.expect {
+				t.Errorf("expected plan %+v, got %+v", test.expect, plan)
+			}
+		})
+	}
+}
+
+func TestRoleAssignmentPlanMultiple(t *testing.T) {
+	phase := NewRoleAssignmentPhase()
+	readerID := "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7"
+	data := &mockCreateData{
+		servicePrincipal:         testServicePrincipal("client-id", "sp-object-id", "test"),
+		servicePrincipalObjectID: "sp-object-id",
+		roleAssignments: []options.RoleAssignment{
+			{Role: "Reader", Scope: "/subscriptions/sub"},
+			{Role: "Reader", Scope: "/subscriptions/sub/resourceGroups/rg"},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().ListRoleAssignments(gomock.Any(), "sp-object-id", "/subscriptions/sub", "/subscriptions/sub/resourceGroups/rg").Return([]armauthorization.RoleAssignment{{
+		ID: to.Ptr("id"),
+		Properties: &armauthorization.RoleAssignmentPropertiesWithScope{
+			RoleDefinitionID: to.Ptr(readerID),
+			Scope:            to.Ptr("/subscriptions/sub"),
+		},
+	}}, nil)
+	// the role definition is looked up once per role
+	mockAzureClient.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{ID: to.Ptr(readerID)}, nil)
+	data.azureClient = mockAzureClient
+
+	plan, err := phase.Plan(context.Background(), data)
+	if err != nil {
+		t.Fatalf("expected no error but got: %s", err.Error())
+	}
+	if len(plan) != 2 || plan[0].Action != workflow.ActionSkip || plan[1].Action != workflow.ActionCreate {
+		t.Errorf("expected to skip the first role assignment and create the second, got %+v", plan)
+	}
+}
@@ -2,9 +2,11 @@ package phases
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"monis.app/mlog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -31,12 +33,16 @@ func NewServiceAccountPhase() workflow.Phase {
 		Description: "Create Kubernetes service account in the current KUBECONFIG context and add azure-workload-identity labels and annotations to it",
 		PreRun:      p.prerun,
 		Run:         p.run,
+		Plan:        p.plan,
 		Flags: []string{
 			options.ServiceAccountNamespace.Flag,
 			options.ServiceAccountName.Flag,
 			options.ServiceAccountTokenExpiration.Flag,
 			options.AADApplicationName.Flag,
 			options.AADApplicationClientID.Flag,
+			options.IdentityType.Flag,
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
 		},
 	}
 }
@@ -74,13 +80,20 @@ func (p *serviceAccountPhase) prerun(data workflow.RunData) error {
 func (p *serviceAccountPhase) run(ctx context.Context, data workflow.RunData) error {
 	createData := data.(CreateData)
 
+	var clientID string
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		clientID = createData.ManagedIdentityClientID()
+	} else {
+		clientID = createData.AADApplicationClientID()
+	}
+
 	// TODO(aramase) make the update behavior configurable. If the service account already exists, fail if --overwrite is not specified
 	err := kuberneteshelper.CreateOrUpdateServiceAccount(
 		ctx,
 		p.kubeClient,
 		createData.ServiceAccountNamespace(),
 		createData.ServiceAccountName(),
-		createData.AADApplicationClientID(),
+		clientID,
 		createData.AzureTenantID(),
 		createData.ServiceAccountTokenExpiration(),
 	)
@@ -95,3 +108,47 @@ func (p *serviceAccountPhase) run(ctx context.Context, data workflow.RunData) er
 
 	return nil
 }
+
+func (p *serviceAccountPhase) plan(ctx context.Context, data workflow.RunData) ([]workflow.PlannedAction, error) {
+	createData := data.(CreateData)
+
+	action := workflow.PlannedAction{
+		Phase:    serviceAccountPhaseName,
+		Resource: "service account",
+		Name:     fmt.Sprintf("%s/%s", createData.ServiceAccountNamespace(), createData.ServiceAccountName()),
+	}
+	sa, err := kuberneteshelper.GetServiceAccount(ctx, p.kubeClient, createData.ServiceAccountNamespace(), createData.ServiceAccountName())
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, errors.Wrap(err, "failed to get kubernetes service account")
+		}
+		action.Action = workflow.ActionCreate
+		return []workflow.PlannedAction{action}, nil
+	}
+
+	// the client ID is unknown if the identity is yet to be created
+	var clientID string
+	if createData.IdentityType() == options.IdentityTypeUAMI {
+		if identity, err := createData.ManagedIdentity(); err == nil && identity.Properties != nil && identity.Properties.ClientID != nil {
+			clientID = *identity.Properties.ClientID
+		}
+	} else if _, err := createData.AADApplication(); err == nil {
+		clientID = createData.AADApplicationClientID()
+	}
+
+	action.Action = workflow.ActionUpdate
+	if clientID != "" {
+		// only the annotations managed by azwi are compared, other annotations are left untouched
+		upToDate := true
+		for k, v := range kuberneteshelper.ServiceAccountAnnotations(clientID, createData.AzureTenantID(), createData.ServiceAccountTokenExpiration()) {
+			if sa.Annotations[k] != v {
+				upToDate = false
+			}
+		}
+		if upToDate {
+			action.Action = workflow.ActionSkip
+			action.Reason = "already up to date"
+		}
+	}
+	return []workflow.PlannedAction{action}, nil
+}
@@ -5,11 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+	"github.com/Azure/azure-workload-identity/pkg/kuberneteshelper"
 	"github.com/Azure/azure-workload-identity/pkg/webhook"
 )
 
@@ -123,3 +127,126 @@ func TestServiceAccountRun(t *testing.T) {
 		t.Errorf("expected service account to have token expiration label but got: %s", sa.Labels[webhook.ServiceAccountTokenExpiryAnnotation])
 	}
 }
+
+func TestServiceAccountRunManagedIdentity(t *testing.T) {
+	phase := NewServiceAccountPhase()
+	kubeClient := fake.NewClientBuilder().Build()
+	identity := testManagedIdentity("managed-identity-client-id", "principal-id")
+	data := &mockCreateData{
+		serviceAccountNamespace:       "service-account-namespace",
+		serviceAccountName:            "service-account-name",
+		serviceAccountTokenExpiration: 2 * time.Hour,
+		aadApplicationClientID:        "aad-application-client-id",
+		identityType:                  options.IdentityTypeUAMI,
+		managedIdentity:               &identity,
+		azureTenantID:                 "azure-tenant-id",
+		kubeClient:                    kubeClient,
+	}
+
+	if err := phase.PreRun(data); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+	sa := &corev1.ServiceAccount{}
+	if err := kubeClient.Get(context.TODO(), types.NamespacedName{Name: "service-account-name", Namespace: "service-account-namespace"}, sa); err != nil {
+		t.Errorf("expected service account to be created")
+	}
+	if sa.Annotations[webhook.ClientIDAnnotation] != "managed-identity-client-id" {
+		t.Errorf("expected service account to have the client id of the managed identity but got: %s", sa.Annotations[webhook.ClientIDAnnotation])
+	}
+}
+
+func TestServiceAccountPlan(t *testing.T) {
+	identity := testManagedIdentity("client-id", "principal-id")
+	existing := func(clientID string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "service-account-name",
+				Namespace:   "service-account-namespace",
+				Annotations: kuberneteshelper.ServiceAccountAnnotations(clientID, "azure-tenant-id", 2*time.Hour),
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		serviceAccount *corev1.ServiceAccount
+		identity       *armmsi.Identity
+		expect         workflow.Action
+	}{
+		{
+			name:   "service account doesn't exist",
+			expect: workflow.ActionCreate,
+		},
+		{
+			name:           "service account is up to date",
+			serviceAccount: existing("client-id"),
+			identity:       &identity,
+			expect:         workflow.ActionSkip,
+		},
+		{
+			name: "service account has other annotations",
+			serviceAccount: func() *corev1.ServiceAccount {
+				sa := existing("client-id")
+				sa.Annotations["kubectl.kubernetes.io/last-applied-configuration"] = "{}"
+				return sa
+			}(),
+			identity: &identity,
+			expect:   workflow.ActionSkip,
+		},
+		{
+			name:           "service account has a different client ID",
+			serviceAccount: existing("other-client-id"),
+			identity:       &identity,
+			expect:         workflow.ActionUpdate,
+		},
+		{
+			name:           "managed identity doesn't exist",
+			serviceAccount: existing(""),
+			expect:         workflow.ActionUpdate,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			phase := NewServiceAccountPhase()
+			builder := fake.NewClientBuilder()
+			if test.serviceAccount != nil {
+				builder = builder.WithObjects(test.serviceAccount)
+			}
+			kubeClient := builder.Build()
+			data := &mockCreateData{
+				serviceAccountNamespace:       "service-account-namespace",
+				serviceAccountName:            "service-account-name",
+				serviceAccountTokenExpiration: 2 * time.Hour,
+				identityType:                  options.IdentityTypeUAMI,
+				managedIdentity:               test.identity,
+				azureTenantID:                 "azure-tenant-id",
+				kubeClient:                    kubeClient,
+			}
+
+			if err := phase.PreRun(data); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			plan, err := phase.Plan(context.Background(), data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if len(plan) != 1 || plan[0].Action != test.expect || plan[0].Name != "service-account-namespace/service-account-name" {
+				t.Errorf("expected %s service-account-namespace/service-account-name, got %+v", test.expect, plan)
+			}
+
+			// the service account is not modified in dry-run mode
+			sa := &corev1.ServiceAccount{}
+			err = kubeClient.Get(context.TODO(), types.NamespacedName{Name: "service-account-name", Namespace: "service-account-namespace"}, sa)
+			if test.serviceAccount == nil && err == nil {
+				t.Errorf("expected service account not to be created")
+			}
+			if test.serviceAccount != nil && sa.Annotations[webhook.ClientIDAnnotation] != test.serviceAccount.Annotations[webhook.ClientIDAnnotation] {
+				t.Errorf("expected service account not to be updated")
+			}
+		})
+	}
+}
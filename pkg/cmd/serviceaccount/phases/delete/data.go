@@ -5,6 +5,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 )
 
 // DeleteData is the interface to use for create phase.
@@ -30,8 +31,25 @@ type DeleteData interface {
 	// This will be used for creating or removing the federated identity credential.
 	AADApplicationObjectID() string
 
-	// RoleDefinitionID returns the role definition ID.
-	RoleAssignmentID() string
+	// IdentityType returns the type of the identity, either an AAD application or a user-assigned managed identity.
+	IdentityType() string
+
+	// ManagedIdentityName returns the name of the user-assigned managed identity.
+	ManagedIdentityName() string
+
+	// ManagedIdentityResourceGroup returns the resource group of the user-assigned managed identity.
+	ManagedIdentityResourceGroup() string
+
+	// PrincipalID returns the object ID of the service principal of the AAD application or
+	// the principal ID of the user-assigned managed identity.
+	// This will be used for finding the role assignments to remove.
+	PrincipalID() (string, error)
+
+	// RoleAssignmentIDs returns the IDs of the role assignments to remove.
+	RoleAssignmentIDs() []string
+
+	// RoleAssignments returns the role assignments to remove by role and scope.
+	RoleAssignments() []options.RoleAssignment
 
 	// AzureClient returns the Azure client.
 	AzureClient() cloud.Interface
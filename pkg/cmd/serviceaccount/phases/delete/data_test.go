@@ -8,19 +8,25 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 )
 
 type mockDeleteData struct {
-	serviceAccountName      string
-	serviceAccountNamespace string
-	serviceAccountIssuerURL string
-	aadApplication          models.Applicationable // cache
-	aadApplicationName      string
-	aadApplicationObjectID  string
-	roleAssignmentID        string
-	azureClient             cloud.Interface
-	kubeClient              client.Client
+	serviceAccountName           string
+	serviceAccountNamespace      string
+	serviceAccountIssuerURL      string
+	aadApplication               models.Applicationable // cache
+	aadApplicationName           string
+	aadApplicationObjectID       string
+	identityType                 string
+	managedIdentityName          string
+	managedIdentityResourceGroup string
+	principalID                  string
+	roleAssignmentIDs            []string
+	roleAssignments              []options.RoleAssignment
+	azureClient                  cloud.Interface
+	kubeClient                   client.Client
 }
 
 var _ DeleteData = &mockDeleteData{}
@@ -55,8 +61,31 @@ func (d *mockDeleteData) AADApplicationObjectID() string {
 	return d.aadApplicationObjectID
 }
 
-func (d *mockDeleteData) RoleAssignmentID() string {
-	return d.roleAssignmentID
+func (d *mockDeleteData) IdentityType() string {
+	return d.identityType
+}
+
+func (d *mockDeleteData) ManagedIdentityName() string {
+	return d.managedIdentityName
+}
+
+func (d *mockDeleteData) ManagedIdentityResourceGroup() string {
+	return d.managedIdentityResourceGroup
+}
+
+func (d *mockDeleteData) PrincipalID() (string, error) {
+	if d.principalID == "" {
+		return "", errors.New("not found")
+	}
+	return d.principalID, nil
+}
+
+func (d *mockDeleteData) RoleAssignmentIDs() []string {
+	return d.roleAssignmentIDs
+}
+
+func (d *mockDeleteData) RoleAssignments() []options.RoleAssignment {
+	return d.roleAssignments
 }
 
 func (d *mockDeleteData) AzureClient() cloud.Interface {
@@ -25,7 +25,7 @@ func NewFederatedIdentityPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:        federatedIdentityPhaseName,
 		Aliases:     []string{"fi"},
-		Description: "Delete federated identity credential for the AAD application and the Kubernetes service account",
+		Description: "Delete federated identity credential for the AAD application or the user-assigned managed identity and the Kubernetes service account",
 		PreRun:      p.prerun,
 		Run:         p.run,
 		Flags: []string{
@@ -34,6 +34,9 @@ func NewFederatedIdentityPhase() workflow.Phase {
 			options.ServiceAccountIssuerURL.Flag,
 			options.AADApplicationName.Flag,
 			options.AADApplicationObjectID.Flag,
+			options.IdentityType.Flag,
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
 		},
 	}
 }
@@ -53,6 +56,14 @@ func (p *federatedIdentityPhase) prerun(data workflow.RunData) error {
 	if deleteData.ServiceAccountIssuerURL() == "" {
 		return options.FlagIsRequiredError(options.ServiceAccountIssuerURL.Flag)
 	}
+	if deleteData.IdentityType() == options.IdentityTypeUAMI {
+		if deleteData.ManagedIdentityName() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityName.Flag)
+		}
+		if deleteData.ManagedIdentityResourceGroup() == "" {
+			return options.FlagIsRequiredError(options.ManagedIdentityResourceGroup.Flag)
+		}
+	}
 
 	return nil
 }
@@ -65,6 +76,9 @@ func (p *federatedIdentityPhase) run(ctx context.Context, data workflow.RunData)
 		"subject", subject,
 		"issuerURL", deleteData.ServiceAccountIssuerURL(),
 	).WithName(federatedIdentityPhaseName)
+	if deleteData.IdentityType() == options.IdentityTypeUAMI {
+		return p.deleteManagedIdentityFederatedCredential(ctx, deleteData, subject, l)
+	}
 	if fic, err := deleteData.AzureClient().GetFederatedCredential(ctx, deleteData.AADApplicationObjectID(), deleteData.ServiceAccountIssuerURL(), subject); err != nil {
 		if !cloud.IsFederatedCredentialNotFound(err) {
 			return errors.Wrap(err, "failed to get federated identity credential")
@@ -79,3 +93,24 @@ func (p *federatedIdentityPhase) run(ctx context.Context, data workflow.RunData)
 
 	return nil
 }
+
+func (p *federatedIdentityPhase) deleteManagedIdentityFederatedCredential(ctx context.Context, deleteData DeleteData, subject string, l mlog.Logger) error {
+	resourceGroup, identityName := deleteData.ManagedIdentityResourceGroup(), deleteData.ManagedIdentityName()
+	fic, err := deleteData.AzureClient().GetUserAssignedIdentityFederatedCredential(ctx, resourceGroup, identityName, deleteData.ServiceAccountIssuerURL(), subject)
+	if err != nil {
+		if !cloud.IsFederatedCredentialNotFound(err) && !cloud.IsNotFound(err) {
+			return errors.Wrap(err, "failed to get federated identity credential")
+		}
+		l.Warning("federated identity credential not found")
+		return nil
+	}
+	if fic.Name == nil {
+		return errors.New("federated identity credential has no name")
+	}
+	if err = deleteData.AzureClient().DeleteUserAssignedIdentityFederatedCredential(ctx, resourceGroup, identityName, *fic.Name); err != nil {
+		return errors.Wrap(err, "failed to delete federated identity credential")
+	}
+	l.Info("deleted federated identity credential")
+
+	return nil
+}
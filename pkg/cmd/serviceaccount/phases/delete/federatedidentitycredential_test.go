@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
 	"github.com/golang/mock/gomock"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
 	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 )
@@ -48,6 +50,20 @@ func TestFederatedIdentityPreRun(t *testing.T) {
 			data:     &mockDeleteData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test"},
 			errorMsg: "",
 		},
+		{
+			name:     "missing --managed-identity-name",
+			data:     &mockDeleteData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI},
+			errorMsg: "--managed-identity-name is required",
+		},
+		{
+			name:     "missing --managed-identity-resource-group",
+			data:     &mockDeleteData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI, managedIdentityName: "test"},
+			errorMsg: "--managed-identity-resource-group is required",
+		},
+		{
+			name: "valid managed identity data",
+			data: &mockDeleteData{serviceAccountNamespace: "test", serviceAccountName: "test", serviceAccountIssuerURL: "test", identityType: options.IdentityTypeUAMI, managedIdentityName: "test", managedIdentityResourceGroup: "test"},
+		},
 	}
 
 	for _, test := range tests {
@@ -122,3 +138,46 @@ func TestFederatedIdentityRun(t *testing.T) {
 		t.Errorf("expected no error but got: %s", err.Error())
 	}
 }
+
+func TestFederatedIdentityRunManagedIdentity(t *testing.T) {
+	phase := NewFederatedIdentityPhase()
+	data := &mockDeleteData{
+		serviceAccountNamespace:      "service-account-namespace",
+		serviceAccountName:           "service-account-name",
+		serviceAccountIssuerURL:      "service-account-issuer-url",
+		identityType:                 options.IdentityTypeUAMI,
+		managedIdentityName:          "managed-identity-name",
+		managedIdentityResourceGroup: "managed-identity-resource-group",
+	}
+	subject := util.GetFederatedCredentialSubject(data.serviceAccountNamespace, data.serviceAccountName)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().GetUserAssignedIdentityFederatedCredential(
+		gomock.Any(),
+		"managed-identity-resource-group",
+		"managed-identity-name",
+		data.serviceAccountIssuerURL,
+		subject,
+	).Return(armmsi.FederatedIdentityCredential{Name: to.Ptr("federated-identity-credential-name")}, nil)
+	mockAzureClient.EXPECT().DeleteUserAssignedIdentityFederatedCredential(gomock.Any(), "managed-identity-resource-group", "managed-identity-name", "federated-identity-credential-name").Return(nil)
+	data.azureClient = mockAzureClient
+
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+
+	// Test for scenario where federated credential is not found
+	mockAzureClient.EXPECT().GetUserAssignedIdentityFederatedCredential(
+		gomock.Any(),
+		"managed-identity-resource-group",
+		"managed-identity-name",
+		data.serviceAccountIssuerURL,
+		subject,
+	).Return(armmsi.FederatedIdentityCredential{}, cloud.ErrFederatedCredentialNotFound)
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+}
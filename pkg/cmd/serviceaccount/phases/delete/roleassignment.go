@@ -4,11 +4,13 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"monis.app/mlog"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/util"
 )
 
 const (
@@ -24,10 +26,17 @@ func NewRoleAssignmentPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:        roleAssignmentPhaseName,
 		Aliases:     []string{"ra"},
-		Description: "Delete the role assignment between the AAD application and the Azure cloud resource",
+		Description: "Delete the role assignments between the AAD application or user-assigned managed identity and the Azure cloud resources",
 		PreRun:      p.prerun,
 		Run:         p.run,
-		Flags:       []string{options.RoleAssignmentID.Flag},
+		Flags: []string{
+			options.RoleAssignmentID.Flag,
+			options.RoleAssignments.Flag,
+			options.AADApplicationName.Flag,
+			options.IdentityType.Flag,
+			options.ManagedIdentityName.Flag,
+			options.ManagedIdentityResourceGroup.Flag,
+		},
 	}
 }
 
@@ -37,8 +46,21 @@ func (p *roleAssignmentPhase) prerun(data workflow.RunData) error {
 		return errors.Errorf("invalid data type %T", data)
 	}
 
-	if deleteData.RoleAssignmentID() == "" {
-		return options.FlagIsRequiredError(options.RoleAssignmentID.Flag)
+	if len(deleteData.RoleAssignmentIDs()) == 0 && len(deleteData.RoleAssignments()) == 0 {
+		return options.OneOfFlagsIsRequiredError(options.RoleAssignmentID.Flag, options.RoleAssignments.Flag)
+	}
+	// the role assignments are looked up by the principal of the identity
+	if len(deleteData.RoleAssignments()) > 0 {
+		if deleteData.IdentityType() == options.IdentityTypeUAMI {
+			if deleteData.ManagedIdentityName() == "" {
+				return options.FlagIsRequiredError(options.ManagedIdentityName.Flag)
+			}
+			if deleteData.ManagedIdentityResourceGroup() == "" {
+				return options.FlagIsRequiredError(options.ManagedIdentityResourceGroup.Flag)
+			}
+		} else if deleteData.AADApplicationName() == "" {
+			return options.FlagIsRequiredError(options.AADApplicationName.Flag)
+		}
 	}
 
 	return nil
@@ -47,19 +69,76 @@ func (p *roleAssignmentPhase) prerun(data workflow.RunData) error {
 func (p *roleAssignmentPhase) run(ctx context.Context, data workflow.RunData) error {
 	deleteData := data.(DeleteData)
 
-	// TODO(aramase): consider supporting deletion of role assignment with scope, role and application id
-	// delete the role assignment
-	l := mlog.WithValues(
-		"roleAssignmentID", deleteData.RoleAssignmentID(),
-	).WithName(roleAssignmentPhaseName)
-	if _, err := deleteData.AzureClient().DeleteRoleAssignment(ctx, deleteData.RoleAssignmentID()); err != nil {
-		if !cloud.IsRoleAssignmentAlreadyDeleted(err) {
-			return errors.Wrap(err, "failed to delete role assignment")
+	roleAssignmentIDs := append([]string{}, deleteData.RoleAssignmentIDs()...)
+	if len(deleteData.RoleAssignments()) > 0 {
+		ids, err := p.getRoleAssignmentIDs(ctx, deleteData)
+		if err != nil {
+			return err
 		}
-		l.Warning("role assignment not found")
-	} else {
-		l.Info("deleted role assignment")
+		roleAssignmentIDs = append(roleAssignmentIDs, ids...)
 	}
 
-	return nil
+	// the errors are collected so that a failure doesn't stop the deletion of the other role assignments
+	var errs []error
+	for _, id := range roleAssignmentIDs {
+		l := mlog.WithValues(
+			"roleAssignmentID", id,
+		).WithName(roleAssignmentPhaseName)
+		if _, err := deleteData.AzureClient().DeleteRoleAssignment(ctx, id); err != nil {
+			if !cloud.IsRoleAssignmentAlreadyDeleted(err) {
+				errs = append(errs, errors.Wrapf(err, "failed to delete role assignment %s", id))
+				continue
+			}
+			l.Warning("role assignment not found")
+		} else {
+			l.Info("deleted role assignment")
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getRoleAssignmentIDs returns the IDs of the role assignments of the principal of the identity
+// that match the role and scope of the role assignments to remove.
+func (p *roleAssignmentPhase) getRoleAssignmentIDs(ctx context.Context, deleteData DeleteData) ([]string, error) {
+	principalID, err := deleteData.PrincipalID()
+	if err != nil {
+		if cloud.IsNotFound(err) {
+			mlog.WithName(roleAssignmentPhaseName).Warning("identity not found, skipping the removal of the role assignments")
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to get the principal ID of the identity")
+	}
+
+	ras, err := deleteData.AzureClient().ListRoleAssignments(ctx, principalID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list role assignments")
+	}
+
+	var ids []string
+	for _, roleAssignment := range deleteData.RoleAssignments() {
+		rd, err := deleteData.AzureClient().GetRoleDefinitionIDByName(ctx, "", roleAssignment.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get role definition id for role %s", roleAssignment.Role)
+		}
+
+		found := false
+		for _, ra := range ras {
+			if rd.ID == nil || ra.ID == nil || ra.Properties == nil || ra.Properties.RoleDefinitionID == nil || ra.Properties.Scope == nil {
+				continue
+			}
+			if util.IsSameRoleAssignment(*ra.Properties.RoleDefinitionID, *ra.Properties.Scope, *rd.ID, roleAssignment.Scope) {
+				ids = append(ids, *ra.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			mlog.WithValues(
+				"role", roleAssignment.Role,
+				"scope", roleAssignment.Scope,
+			).WithName(roleAssignmentPhaseName).Warning("role assignment not found")
+		}
+	}
+	return ids, nil
 }
@@ -6,11 +6,13 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 
 	"github.com/Azure/azure-workload-identity/pkg/cloud/mock_cloud"
+	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/options"
 	"github.com/Azure/azure-workload-identity/pkg/cmd/serviceaccount/phases/workflow"
 )
 
@@ -29,13 +31,27 @@ func TestRoleAssignmentPreRun(t *testing.T) {
 		{
 			name:     "missing --role-assignment-id",
 			data:     &mockDeleteData{},
-			errorMsg: "--role-assignment-id is required",
+			errorMsg: "--role-assignment-id or --role-assignment is required",
 		},
 		{
 			name:     "valid data",
-			data:     &mockDeleteData{roleAssignmentID: "test"},
+			data:     &mockDeleteData{roleAssignmentIDs: []string{"test"}},
 			errorMsg: "",
 		},
+		{
+			name:     "missing --aad-application-name with --role-assignment",
+			data:     &mockDeleteData{roleAssignments: []options.RoleAssignment{{Role: "test", Scope: "test"}}},
+			errorMsg: "--aad-application-name is required",
+		},
+		{
+			name:     "missing --managed-identity-resource-group with --role-assignment",
+			data:     &mockDeleteData{roleAssignments: []options.RoleAssignment{{Role: "test", Scope: "test"}}, identityType: options.IdentityTypeUAMI, managedIdentityName: "test"},
+			errorMsg: "--managed-identity-resource-group is required",
+		},
+		{
+			name: "valid data with --role-assignment",
+			data: &mockDeleteData{roleAssignments: []options.RoleAssignment{{Role: "test", Scope: "test"}}, aadApplicationName: "test"},
+		},
 	}
 
 	for _, test := range tests {
@@ -55,14 +71,14 @@ func TestRoleAssignmentPreRun(t *testing.T) {
 func TestRoleAssignmentRun(t *testing.T) {
 	phase := NewRoleAssignmentPhase()
 	data := &mockDeleteData{
-		roleAssignmentID: "test",
+		roleAssignmentIDs: []string{"test"},
 	}
 
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
-	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), data.roleAssignmentID).Return(armauthorization.RoleAssignment{}, nil)
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "test").Return(armauthorization.RoleAssignment{}, nil)
 	data.azureClient = mockAzureClient
 
 	if err := phase.Run(context.Background(), data); err != nil {
@@ -70,13 +86,68 @@ func TestRoleAssignmentRun(t *testing.T) {
 	}
 
 	// Test for scenario where it failed to delete role assignment
-	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), data.roleAssignmentID).Return(armauthorization.RoleAssignment{}, errors.New("random error"))
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "test").Return(armauthorization.RoleAssignment{}, errors.New("random error"))
 	if err := phase.Run(context.Background(), data); err == nil {
 		t.Errorf("expected error but got nil")
 	}
 
 	// Test for scenario where role assignment is not found
-	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), data.roleAssignmentID).Return(armauthorization.RoleAssignment{}, &azcore.ResponseError{StatusCode: http.StatusNoContent})
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "test").Return(armauthorization.RoleAssignment{}, &azcore.ResponseError{StatusCode: http.StatusNoContent})
+	if err := phase.Run(context.Background(), data); err != nil {
+		t.Errorf("expected no error but got: %s", err.Error())
+	}
+}
+
+func TestRoleAssignmentRunMultiple(t *testing.T) {
+	phase := NewRoleAssignmentPhase()
+	readerID := "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7"
+	acrPullID := "/providers/Microsoft.Authorization/roleDefinitions/7f951dda-4ed3-4680-a7ca-43fe172d538d"
+	data := &mockDeleteData{
+		principalID:       "principal-id",
+		roleAssignmentIDs: []string{"id-1"},
+		roleAssignments: []options.RoleAssignment{
+			{Role: "Reader", Scope: "/subscriptions/sub/resourceGroups/rg"},
+			{Role: "AcrPull", Scope: "/subscriptions/sub"},
+			// not found, which is not an error
+			{Role: "Reader", Scope: "/subscriptions/other"},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAzureClient := mock_cloud.NewMockInterface(ctrl)
+	mockAzureClient.EXPECT().ListRoleAssignments(gomock.Any(), "principal-id").Return([]armauthorization.RoleAssignment{
+		{
+			ID: to.Ptr("id-2"),
+			Properties: &armauthorization.RoleAssignmentPropertiesWithScope{
+				RoleDefinitionID: to.Ptr("/subscriptions/sub" + readerID),
+				Scope:            to.Ptr("/subscriptions/sub/resourceGroups/RG"),
+			},
+		},
+		{
+			ID: to.Ptr("id-3"),
+			Properties: &armauthorization.RoleAssignmentPropertiesWithScope{
+				RoleDefinitionID: to.Ptr("/subscriptions/sub" + acrPullID),
+				Scope:            to.Ptr("/subscriptions/sub"),
+			},
+		},
+	}, nil)
+	mockAzureClient.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "Reader").Return(armauthorization.RoleDefinition{ID: to.Ptr(readerID)}, nil).Times(2)
+	mockAzureClient.EXPECT().GetRoleDefinitionIDByName(gomock.Any(), "", "AcrPull").Return(armauthorization.RoleDefinition{ID: to.Ptr(acrPullID)}, nil)
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "id-1").Return(armauthorization.RoleAssignment{}, errors.New("random error"))
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "id-2").Return(armauthorization.RoleAssignment{}, nil)
+	mockAzureClient.EXPECT().DeleteRoleAssignment(gomock.Any(), "id-3").Return(armauthorization.RoleAssignment{}, nil)
+	data.azureClient = mockAzureClient
+
+	// the failure to delete a role assignment doesn't stop the deletion of the others
+	if err := phase.Run(context.Background(), data); err == nil || err.Error() != "failed to delete role assignment id-1: random error" {
+		t.Errorf("expected error for id-1 but got: %v", err)
+	}
+
+	// the role assignments are not looked up if the identity doesn't exist
+	data.principalID = ""
+	data.roleAssignmentIDs = nil
 	if err := phase.Run(context.Background(), data); err != nil {
 		t.Errorf("expected no error but got: %s", err.Error())
 	}
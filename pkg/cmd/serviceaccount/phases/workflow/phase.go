@@ -21,6 +21,10 @@ type Phase struct {
 	// Run is the function to run the phase
 	Run func(ctx context.Context, data RunData) error
 
+	// Plan is the function to report what the phase would do without making
+	// any change. It is run instead of Run in dry-run mode
+	Plan func(ctx context.Context, data RunData) ([]PlannedAction, error)
+
 	// Flags is the list of flags to add to the command
 	// when it is run as an individual phase
 	Flags []string
@@ -0,0 +1,60 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Action is the action that a phase would take on a resource
+type Action string
+
+const (
+	// ActionCreate means the resource would be created
+	ActionCreate Action = "create"
+	// ActionUpdate means the resource would be updated
+	ActionUpdate Action = "update"
+	// ActionSkip means the resource would be left as is
+	ActionSkip Action = "skip"
+)
+
+const (
+	// OutputTable prints the plan as a table
+	OutputTable = "table"
+	// OutputJSON prints the plan as JSON
+	OutputJSON = "json"
+)
+
+// PlannedAction is an action that a phase would take in dry-run mode
+type PlannedAction struct {
+	Phase    string `json:"phase"`
+	Action   Action `json:"action"`
+	Resource string `json:"resource"`
+	Name     string `json:"name,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PrintPlan prints the planned actions in the output format
+func PrintPlan(w io.Writer, output string, plan []PlannedAction) error {
+	switch output {
+	case OutputJSON:
+		if plan == nil {
+			plan = []PlannedAction{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	case OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "PHASE\tACTION\tRESOURCE\tNAME\tREASON")
+		for _, a := range plan {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", a.Phase, a.Action, a.Resource, a.Name, a.Reason)
+		}
+		return tw.Flush()
+	default:
+		return errors.Errorf("invalid output format %q, must be %s or %s", output, OutputTable, OutputJSON)
+	}
+}
@@ -0,0 +1,80 @@
+package workflow
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintPlan(t *testing.T) {
+	plan := []PlannedAction{
+		{Phase: "aad-application", Action: ActionSkip, Resource: "AAD application", Name: "app", Reason: "already exists"},
+		{Phase: "service-account", Action: ActionUpdate, Resource: "service account", Name: "default/sa"},
+	}
+
+	tests := []struct {
+		name     string
+		output   string
+		plan     []PlannedAction
+		expected string
+		errorMsg string
+	}{
+		{
+			name:   "table",
+			output: OutputTable,
+			plan:   plan,
+			expected: "PHASE            ACTION  RESOURCE         NAME        REASON\n" +
+				"aad-application  skip    AAD application  app         already exists\n" +
+				"service-account  update  service account  default/sa  \n",
+		},
+		{
+			name:   "json",
+			output: OutputJSON,
+			plan:   plan,
+			expected: `[
+  {
+    "phase": "aad-application",
+    "action": "skip",
+    "resource": "AAD application",
+    "name": "app",
+    "reason": "already exists"
+  },
+  {
+    "phase": "service-account",
+    "action": "update",
+    "resource": "service account",
+    "name": "default/sa"
+  }
+]
+`,
+		},
+		{
+			name:     "empty json",
+			output:   OutputJSON,
+			expected: "[]\n",
+		},
+		{
+			name:     "invalid output",
+			output:   "yaml",
+			errorMsg: `invalid output format "yaml", must be table or json`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := PrintPlan(&out, test.output, test.plan)
+			if test.errorMsg != "" {
+				if err == nil || err.Error() != test.errorMsg {
+					t.Errorf("expected error %q, got %v", test.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected output to be %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
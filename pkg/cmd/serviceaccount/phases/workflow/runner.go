@@ -3,6 +3,8 @@ package workflow
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -28,7 +30,8 @@ type Runner interface {
 	// BindToCommand alters the command's help text and flags to include the phase's flags
 	BindToCommand(cmd *cobra.Command, data RunData)
 
-	// Run runs the phases except the ones specified in skipPhases
+	// Run runs the phases except the ones specified in skipPhases.
+	// In dry-run mode, the plan of the phases is printed instead
 	Run(data RunData) error
 }
 
@@ -36,8 +39,20 @@ type Runner interface {
 type runner struct {
 	skipPhases []string
 	phases     []Phase
+
+	// dryRun reports the plan of the phases instead of running them
+	dryRun bool
+	// output is the output format of the plan
+	output string
+	// out is where the plan is written, defaults to os.Stdout
+	out io.Writer
 }
 
+const (
+	dryRunFlag = "dry-run"
+	outputFlag = "output"
+)
+
 var _ Runner = &runner{}
 
 // NewRunner returns a new instance of the runner
@@ -93,6 +108,18 @@ func (r *runner) BindToCommand(cmd *cobra.Command, data RunData) {
 	// common flags between commands
 	cmd.Flags().StringSliceVar(&r.skipPhases, "skip-phases", []string{}, "List of phases to skip")
 
+	// dry-run is only supported if all the phases can report their plan
+	dryRunSupported := true
+	for _, phase := range r.phases {
+		if phase.Plan == nil {
+			dryRunSupported = false
+		}
+	}
+	if dryRunSupported {
+		cmd.Flags().BoolVar(&r.dryRun, dryRunFlag, false, "Print the actions of the phases without making any changes")
+		cmd.Flags().StringVarP(&r.output, outputFlag, "o", OutputTable, fmt.Sprintf("Output format of --%s. One of: %s, %s", dryRunFlag, OutputTable, OutputJSON))
+	}
+
 	// add the phase command, enabling the user to specify the phase to run
 	phaseCmd := &cobra.Command{
 		Use:   "phase",
@@ -114,19 +141,34 @@ func (r *runner) BindToCommand(cmd *cobra.Command, data RunData) {
 			},
 		}
 		inheritsFlags(cmd.Flags(), subcommand.Flags(), p.Flags)
+		if dryRunSupported {
+			inheritsFlags(cmd.Flags(), subcommand.Flags(), []string{dryRunFlag, outputFlag})
+		}
 		phaseCmd.AddCommand(subcommand)
 	}
 
 	cmd.AddCommand(phaseCmd)
 }
 
-// Run runs the phases except the ones specified in skipPhases
+// Run runs the phases except the ones specified in skipPhases.
+// In dry-run mode, the plan of the phases is printed instead
 func (r *runner) Run(data RunData) error {
 	skipPhases, err := r.computeSkipPhases()
 	if err != nil {
 		return errors.Wrap(err, "failed to compute skip phases")
 	}
 
+	if r.dryRun {
+		if r.output != OutputTable && r.output != OutputJSON {
+			return errors.Errorf("invalid --%s %q, must be %s or %s", outputFlag, r.output, OutputTable, OutputJSON)
+		}
+		for _, phase := range r.phases {
+			if phase.Plan == nil {
+				return errors.Errorf("phase %s does not support --%s", phase.Name, dryRunFlag)
+			}
+		}
+	}
+
 	filtered := []Phase{}
 	for _, phase := range r.phases {
 		if skipPhases[phase.Name] {
@@ -143,6 +185,27 @@ func (r *runner) Run(data RunData) error {
 		}
 	}
 
+	if r.dryRun {
+		var plan []PlannedAction
+		for _, phase := range r.phases {
+			if skipPhases[phase.Name] {
+				plan = append(plan, PlannedAction{Phase: phase.Name, Action: ActionSkip, Reason: "phase is skipped"})
+				continue
+			}
+			actions, err := phase.Plan(context.Background(), data)
+			if err != nil {
+				return errors.Wrapf(err, "failed to plan phase %s", phase.Name)
+			}
+			plan = append(plan, actions...)
+		}
+
+		out := r.out
+		if out == nil {
+			out = os.Stdout
+		}
+		return PrintPlan(out, r.output, plan)
+	}
+
 	for _, phase := range filtered {
 		if err := phase.Run(context.Background(), data); err != nil {
 			return errors.Wrapf(err, "failed to run phase %s", phase.Name)
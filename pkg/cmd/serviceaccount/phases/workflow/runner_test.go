@@ -1,6 +1,7 @@
 package workflow
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
@@ -140,6 +141,65 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRunDryRun(t *testing.T) {
+	preRun := false
+	r := &runner{
+		phases: []Phase{
+			{
+				Name: "phase-1",
+				PreRun: func(data RunData) error {
+					preRun = true
+					return nil
+				},
+				Run: func(ctx context.Context, data RunData) error {
+					return errors.Errorf("expected phase-1 not to run in dry-run mode")
+				},
+				Plan: func(ctx context.Context, data RunData) ([]PlannedAction, error) {
+					return []PlannedAction{{Phase: "phase-1", Action: ActionCreate, Resource: "resource", Name: "name"}}, nil
+				},
+			},
+			{
+				Name: "phase-2",
+				PreRun: func(data RunData) error {
+					return errors.Errorf("expected phase-2 to be skipped")
+				},
+				Plan: func(ctx context.Context, data RunData) ([]PlannedAction, error) {
+					return nil, errors.Errorf("expected phase-2 to be skipped")
+				},
+			},
+		},
+		skipPhases: []string{"phase-2"},
+		dryRun:     true,
+		output:     OutputTable,
+	}
+
+	var out bytes.Buffer
+	r.out = &out
+	if err := r.Run(nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !preRun {
+		t.Errorf("expected the pre-run of phase-1 to run in dry-run mode")
+	}
+	expected := "PHASE    ACTION  RESOURCE  NAME  REASON\n" +
+		"phase-1  create  resource  name  \n" +
+		"phase-2  skip                    phase is skipped\n"
+	if out.String() != expected {
+		t.Errorf("expected output to be %q, got %q", expected, out.String())
+	}
+
+	r.output = "yaml"
+	if err := r.Run(nil); err == nil || err.Error() != `invalid --output "yaml", must be table or json` {
+		t.Errorf("expected invalid output error, got %v", err)
+	}
+
+	r.output = OutputTable
+	r.phases = append(r.phases, Phase{Name: "phase-3", PreRun: func(data RunData) error { return nil }})
+	if err := r.Run(nil); err == nil || err.Error() != "phase phase-3 does not support --dry-run" {
+		t.Errorf("expected unsupported dry-run error, got %v", err)
+	}
+}
+
 func TestBindToCommand(t *testing.T) {
 	cmd := &cobra.Command{
 		Use: "test",
@@ -165,6 +225,36 @@ func TestBindToCommand(t *testing.T) {
 	if cmd.Flag("skip-phases") == nil {
 		t.Errorf("expected --skip-phases flag to be added")
 	}
+	if cmd.Flag("dry-run") != nil {
+		t.Errorf("expected --dry-run flag not to be added as the phases don't support it")
+	}
+}
+
+func TestBindToCommandDryRun(t *testing.T) {
+	cmd := &cobra.Command{
+		Use: "test",
+	}
+	r := &runner{}
+	r.AppendPhases(Phase{
+		Name: "phase-1",
+		Plan: func(ctx context.Context, data RunData) ([]PlannedAction, error) {
+			return nil, nil
+		},
+	})
+
+	r.BindToCommand(cmd, nil)
+	for _, flag := range []string{"dry-run", "output"} {
+		if cmd.Flag(flag) == nil {
+			t.Errorf("expected --%s flag to be added", flag)
+		}
+	}
+	phaseCmd, _, err := cmd.Find([]string{"phase", "phase-1"})
+	if err != nil {
+		t.Fatalf("expected phase-1 subcommand, got %v", err)
+	}
+	if phaseCmd.Flag("dry-run") == nil {
+		t.Errorf("expected --dry-run flag to be inherited by the phase subcommand")
+	}
 }
 
 func TestComputeSkipPhases(t *testing.T) {
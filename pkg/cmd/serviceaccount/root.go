@@ -33,6 +33,8 @@ func NewServiceAccountCmd() *cobra.Command {
 
 	serviceAccountCmd.AddCommand(newCreateCmd(authProvider))
 	serviceAccountCmd.AddCommand(newDeleteCmd(authProvider))
+	serviceAccountCmd.AddCommand(newListCmd(authProvider))
+	serviceAccountCmd.AddCommand(newDescribeCmd(authProvider))
 
 	return serviceAccountCmd
 }
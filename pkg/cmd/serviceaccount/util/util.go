@@ -3,7 +3,10 @@ package util
 import (
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"path"
+	"strings"
 )
 
 // GetIssuerHash returns a hash of the issuer URL
@@ -21,7 +24,36 @@ func GetFederatedCredentialName(namespace, name, issuerURL string) string {
 	return base64.URLEncoding.EncodeToString(h.Sum(nil))
 }
 
+// GetManagedIdentityFederatedCredentialName returns a hex encoded hash of the service account
+// namespace, name, and issuer URL. Unlike GetFederatedCredentialName, the name only contains
+// the characters that are allowed in the name of a federated credential of a managed identity.
+func GetManagedIdentityFederatedCredentialName(namespace, name, issuerURL string) string {
+	h := sha256.New()
+	h.Write([]byte(fmt.Sprintf("%s-%s-%s", namespace, name, issuerURL)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // GetFederatedCredentialSubject returns the subject of the federated credential
 func GetFederatedCredentialSubject(namespace, name string) string {
 	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)
 }
+
+// NormalizeScope returns the scope without the trailing slash in lower case,
+// as the scopes of Azure resources are case-insensitive
+func NormalizeScope(scope string) string {
+	return strings.ToLower(strings.TrimSuffix(scope, "/"))
+}
+
+// GetRoleAssignmentKey returns the key of the role assignment of the role at the scope, which is the same
+// for the role assignments that only differ in the case of the role or the scope, to deduplicate them
+func GetRoleAssignmentKey(role, scope string) string {
+	return strings.ToLower(role) + " " + NormalizeScope(scope)
+}
+
+// IsSameRoleAssignment returns true if the role definitions and the scopes are the same.
+// The role definitions are compared by their GUID as the ID of a role definition
+// may or may not contain the subscription
+func IsSameRoleAssignment(roleDefinitionID, scope, otherRoleDefinitionID, otherScope string) bool {
+	return strings.EqualFold(path.Base(roleDefinitionID), path.Base(otherRoleDefinitionID)) &&
+		NormalizeScope(scope) == NormalizeScope(otherScope)
+}
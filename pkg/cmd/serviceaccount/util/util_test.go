@@ -64,6 +64,14 @@ func TestGetFederatedCredentialName(t *testing.T) {
 	}
 }
 
+func TestGetManagedIdentityFederatedCredentialName(t *testing.T) {
+	want := "e45af1feae4fa5e3f4f5c5d67e46c357008e83921546698a137054293e213f82"
+	got := GetManagedIdentityFederatedCredentialName("oidc", "pod-identity-sa", "https://test.blob.core.windows.net/oidc-test/")
+	if got != want {
+		t.Errorf("GetManagedIdentityFederatedCredentialName() = %s, want %s", got, want)
+	}
+}
+
 func TestGetFederatedCredentialSubject(t *testing.T) {
 	want := "system:serviceaccount:oidc:pod-identity-sa"
 	got := GetFederatedCredentialSubject("oidc", "pod-identity-sa")
@@ -71,3 +79,56 @@ func TestGetFederatedCredentialSubject(t *testing.T) {
 		t.Errorf("GetFederatedCredentialSubject() = %s, want %s", got, want)
 	}
 }
+
+func TestGetRoleAssignmentKey(t *testing.T) {
+	if GetRoleAssignmentKey("Reader", "/subscriptions/sub/resourceGroups/RG/") != GetRoleAssignmentKey("reader", "/subscriptions/sub/resourcegroups/rg") {
+		t.Errorf("expected the role assignments with different casing to have the same key")
+	}
+	if GetRoleAssignmentKey("Reader", "/subscriptions/sub") == GetRoleAssignmentKey("Reader", "/subscriptions/sub/resourceGroups/rg") {
+		t.Errorf("expected the role assignments at different scopes to have different keys")
+	}
+}
+
+func TestIsSameRoleAssignment(t *testing.T) {
+	tests := []struct {
+		name                  string
+		roleDefinitionID      string
+		scope                 string
+		otherRoleDefinitionID string
+		otherScope            string
+		want                  bool
+	}{
+		{
+			name:                  "role definition with and without subscription",
+			roleDefinitionID:      "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+			scope:                 "/subscriptions/sub/resourceGroups/RG/",
+			otherRoleDefinitionID: "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+			otherScope:            "/subscriptions/sub/resourcegroups/rg",
+			want:                  true,
+		},
+		{
+			name:                  "different role definition",
+			roleDefinitionID:      "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+			scope:                 "/subscriptions/sub",
+			otherRoleDefinitionID: "/providers/Microsoft.Authorization/roleDefinitions/b24988ac-6180-42a0-ab88-20f7382dd24c",
+			otherScope:            "/subscriptions/sub",
+			want:                  false,
+		},
+		{
+			name:                  "different scope",
+			roleDefinitionID:      "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+			scope:                 "/subscriptions/sub",
+			otherRoleDefinitionID: "/providers/Microsoft.Authorization/roleDefinitions/acdd72a7-3385-48ef-bd42-f606fba81ae7",
+			otherScope:            "/subscriptions/sub/resourceGroups/rg",
+			want:                  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSameRoleAssignment(tt.roleDefinitionID, tt.scope, tt.otherRoleDefinitionID, tt.otherScope); got != tt.want {
+				t.Errorf("IsSameRoleAssignment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -16,6 +19,20 @@ type Config struct {
 	TenantID       string `envconfig:"AZURE_TENANT_ID" required:"true"`
 	ProxyImage     string `envconfig:"PROXY_IMAGE"`
 	ProxyInitImage string `envconfig:"PROXY_INIT_IMAGE"`
+	// ProxyCPURequest, ProxyCPULimit, ProxyMemoryRequest and ProxyMemoryLimit are the default
+	// resources of the proxy sidecar and init containers. Empty values are not set.
+	ProxyCPURequest    string `envconfig:"PROXY_CPU_REQUEST"`
+	ProxyCPULimit      string `envconfig:"PROXY_CPU_LIMIT"`
+	ProxyMemoryRequest string `envconfig:"PROXY_MEMORY_REQUEST"`
+	ProxyMemoryLimit   string `envconfig:"PROXY_MEMORY_LIMIT"`
+	// ProxyImagePullPolicy is the default image pull policy of the proxy sidecar and init containers
+	ProxyImagePullPolicy string `envconfig:"PROXY_IMAGE_PULL_POLICY"`
+	// ProxyImagePullSecrets are the names of the secrets that are added to the image pull secrets
+	// of pods with the proxy sidecar, for private mirrors of the proxy images
+	ProxyImagePullSecrets []string `envconfig:"PROXY_IMAGE_PULL_SECRETS"`
+	// ProxyMetadataIPv6 is the IPv6 address of the metadata endpoint. The proxy init container only
+	// redirects the IPv6 traffic to the metadata endpoint to the proxy sidecar if it's set.
+	ProxyMetadataIPv6 string `envconfig:"PROXY_METADATA_IPV6"`
 
 	AzureKubernetesTokenProxy string `envconfig:"AZURE_KUBERNETES_TOKEN_PROXY"`
 
@@ -26,6 +43,10 @@ type Config struct {
 	AzureKubernetesCAConfigMapName    string           `envconfig:"AZURE_KUBERNETES_CA_CONFIGMAP_NAME"`
 	AzureKubernetesCACTBSignerName    string           `envconfig:"AZURE_KUBERNETES_CA_CTB_SIGNER_NAME"`
 	AzureKubernetesCACTBLabelSelector LabelSelectorPtr `envconfig:"AZURE_KUBERNETES_CA_CTB_LABEL_SELECTOR"`
+
+	// ServiceAccountTokenExpiration is the default expiration in seconds for the projected service account token.
+	// It is only set through the WorkloadIdentityConfig. Zero means the webhook default is used.
+	ServiceAccountTokenExpiration int64 `ignored:"true"`
 }
 
 // ParseConfig parses the configuration from env variables
@@ -48,6 +69,60 @@ func validateConfig(c *Config) error {
 		return errors.New("AZURE_TENANT_ID is required")
 	}
 
+	if err := validateProxyConfig(c); err != nil {
+		return err
+	}
+	return validateCustomTokenEndpointConfig(c)
+}
+
+// validateProxyConfig validates the resources and image pull policy of the proxy containers
+func validateProxyConfig(c *Config) error {
+	quantities := map[string]resource.Quantity{}
+	for _, q := range []struct {
+		name  string
+		value string
+	}{
+		{"PROXY_CPU_REQUEST", c.ProxyCPURequest},
+		{"PROXY_CPU_LIMIT", c.ProxyCPULimit},
+		{"PROXY_MEMORY_REQUEST", c.ProxyMemoryRequest},
+		{"PROXY_MEMORY_LIMIT", c.ProxyMemoryLimit},
+	} {
+		if len(q.value) == 0 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(q.value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s %q", q.name, q.value)
+		}
+		quantities[q.name] = quantity
+	}
+	for _, r := range []struct{ request, limit string }{
+		{"PROXY_CPU_REQUEST", "PROXY_CPU_LIMIT"},
+		{"PROXY_MEMORY_REQUEST", "PROXY_MEMORY_LIMIT"},
+	} {
+		request, hasRequest := quantities[r.request]
+		limit, hasLimit := quantities[r.limit]
+		if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			return errors.Errorf("%s must be less than or equal to %s", r.request, r.limit)
+		}
+	}
+
+	switch corev1.PullPolicy(c.ProxyImagePullPolicy) {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return errors.Errorf("invalid PROXY_IMAGE_PULL_POLICY %q, must be %s, %s or %s", c.ProxyImagePullPolicy, corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever)
+	}
+
+	if len(c.ProxyMetadataIPv6) > 0 {
+		if ip := net.ParseIP(c.ProxyMetadataIPv6); ip == nil || ip.To4() != nil {
+			return errors.Errorf("invalid PROXY_METADATA_IPV6 %q, must be an IPv6 address", c.ProxyMetadataIPv6)
+		}
+	}
+	return nil
+}
+
+// validateCustomTokenEndpointConfig validates the custom token endpoint configuration
+func validateCustomTokenEndpointConfig(c *Config) error {
 	// ca data, configmap name and signer name are mutually exclusive
 	values := []string{
 		c.AzureKubernetesCAData,
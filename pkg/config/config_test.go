@@ -200,6 +200,66 @@ func TestParseConfig(t *testing.T) {
 	}
 }
 
+func TestValidateProxyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{
+			name:   "no proxy config",
+			config: &Config{},
+		},
+		{
+			name: "valid proxy config",
+			config: &Config{
+				ProxyCPURequest:      "10m",
+				ProxyCPULimit:        "0.1",
+				ProxyMemoryRequest:   "64Mi",
+				ProxyMemoryLimit:     "64Mi",
+				ProxyImagePullPolicy: "Never",
+			},
+		},
+		{
+			name:    "invalid quantity",
+			config:  &Config{ProxyMemoryLimit: "64MB"},
+			wantErr: `invalid PROXY_MEMORY_LIMIT "64MB": quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`,
+		},
+		{
+			name:    "request greater than limit",
+			config:  &Config{ProxyMemoryRequest: "128Mi", ProxyMemoryLimit: "64Mi"},
+			wantErr: "PROXY_MEMORY_REQUEST must be less than or equal to PROXY_MEMORY_LIMIT",
+		},
+		{
+			name:    "invalid image pull policy",
+			config:  &Config{ProxyImagePullPolicy: "always"},
+			wantErr: `invalid PROXY_IMAGE_PULL_POLICY "always", must be Always, IfNotPresent or Never`,
+		},
+		{
+			name:   "metadata IPv6",
+			config: &Config{ProxyMetadataIPv6: "fd00:ec2::254"},
+		},
+		{
+			name:    "metadata IPv6 is an IPv4 address",
+			config:  &Config{ProxyMetadataIPv6: "169.254.169.254"},
+			wantErr: `invalid PROXY_METADATA_IPV6 "169.254.169.254", must be an IPv6 address`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProxyConfig(tt.config)
+			if len(tt.wantErr) > 0 {
+				if err == nil || tt.wantErr != err.Error() {
+					t.Fatalf("validateProxyConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("validateProxyConfig() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
 func setEnvIfNotEmpty(t *testing.T, key, value string) {
 	t.Helper()
 
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// WorkloadIdentityConfig is the cluster-wide webhook policy read from a watched ConfigMap.
+// Fields that are set take precedence over the configuration parsed from env variables.
+type WorkloadIdentityConfig struct {
+	// TenantID is the default tenant ID used when the service account is not annotated with a tenant ID
+	TenantID string `json:"tenantID,omitempty"`
+	// ServiceAccountTokenExpiration is the default expiration in seconds for the projected service account token
+	ServiceAccountTokenExpiration int64  `json:"serviceAccountTokenExpiration,omitempty"`
+	ProxyImage                    string `json:"proxyImage,omitempty"`
+	ProxyInitImage                string `json:"proxyInitImage,omitempty"`
+	// ProxyResources are the default resources of the proxy sidecar and init containers
+	ProxyResources        *ProxyResourcesConfig `json:"proxyResources,omitempty"`
+	ProxyImagePullPolicy  string                `json:"proxyImagePullPolicy,omitempty"`
+	ProxyImagePullSecrets []string              `json:"proxyImagePullSecrets,omitempty"`
+	// CustomTokenEndpoint replaces all of the custom token endpoint settings parsed from env variables when set
+	CustomTokenEndpoint *CustomTokenEndpointConfig `json:"customTokenEndpoint,omitempty"`
+	// Namespaces holds the namespace level overrides keyed by namespace name
+	Namespaces map[string]NamespaceConfig `json:"namespaces,omitempty"`
+}
+
+// ProxyResourcesConfig holds the resources of the proxy containers of the WorkloadIdentityConfig
+type ProxyResourcesConfig struct {
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	CPULimit      string `json:"cpuLimit,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+}
+
+// CustomTokenEndpointConfig holds the custom token endpoint settings of the WorkloadIdentityConfig
+type CustomTokenEndpointConfig struct {
+	AzureKubernetesTokenProxy         string                `json:"azureKubernetesTokenProxy,omitempty"`
+	AzureKubernetesSNIName            string                `json:"azureKubernetesSNIName,omitempty"`
+	AzureKubernetesCAData             string                `json:"azureKubernetesCAData,omitempty"`
+	AzureKubernetesCAConfigMapName    string                `json:"azureKubernetesCAConfigMapName,omitempty"`
+	AzureKubernetesCACTBSignerName    string                `json:"azureKubernetesCACTBSignerName,omitempty"`
+	AzureKubernetesCACTBLabelSelector *metav1.LabelSelector `json:"azureKubernetesCACTBLabelSelector,omitempty"`
+}
+
+// NamespaceConfig holds the overrides for pods in a namespace
+type NamespaceConfig struct {
+	TenantID                      string `json:"tenantID,omitempty"`
+	ServiceAccountTokenExpiration int64  `json:"serviceAccountTokenExpiration,omitempty"`
+}
+
+// ParseWorkloadIdentityConfig parses the WorkloadIdentityConfig from YAML or JSON data
+func ParseWorkloadIdentityConfig(data []byte) (*WorkloadIdentityConfig, error) {
+	wic := new(WorkloadIdentityConfig)
+	if err := yaml.UnmarshalStrict(data, wic); err != nil {
+		return nil, errors.Wrap(err, "failed to parse workload identity config")
+	}
+
+	// validate the proxy settings the same way as the env variables
+	if err := validateProxyConfig((&Config{}).Apply(wic, "")); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+	if cte := wic.CustomTokenEndpoint; cte != nil {
+		// validate the custom token endpoint settings the same way as the env variables
+		if err := validateCustomTokenEndpointConfig(&Config{
+			AzureKubernetesCAData:             cte.AzureKubernetesCAData,
+			AzureKubernetesCAConfigMapName:    cte.AzureKubernetesCAConfigMapName,
+			AzureKubernetesCACTBSignerName:    cte.AzureKubernetesCACTBSignerName,
+			AzureKubernetesCACTBLabelSelector: LabelSelectorPtr{Value: cte.AzureKubernetesCACTBLabelSelector},
+		}); err != nil {
+			return nil, errors.Wrap(err, "invalid custom token endpoint config")
+		}
+	}
+	return wic, nil
+}
+
+// Apply returns a copy of the configuration with the WorkloadIdentityConfig
+// and its overrides for the namespace applied. The receiver is not modified.
+func (c *Config) Apply(wic *WorkloadIdentityConfig, namespace string) *Config {
+	applied := *c
+	if wic == nil {
+		return &applied
+	}
+
+	if len(wic.TenantID) > 0 {
+		applied.TenantID = wic.TenantID
+	}
+	if wic.ServiceAccountTokenExpiration > 0 {
+		applied.ServiceAccountTokenExpiration = wic.ServiceAccountTokenExpiration
+	}
+	if len(wic.ProxyImage) > 0 {
+		applied.ProxyImage = wic.ProxyImage
+	}
+	if len(wic.ProxyInitImage) > 0 {
+		applied.ProxyInitImage = wic.ProxyInitImage
+	}
+	if r := wic.ProxyResources; r != nil {
+		for _, v := range []struct {
+			value string
+			field *string
+		}{
+			{r.CPURequest, &applied.ProxyCPURequest},
+			{r.CPULimit, &applied.ProxyCPULimit},
+			{r.MemoryRequest, &applied.ProxyMemoryRequest},
+			{r.MemoryLimit, &applied.ProxyMemoryLimit},
+		} {
+			if len(v.value) > 0 {
+				*v.field = v.value
+			}
+		}
+	}
+	if len(wic.ProxyImagePullPolicy) > 0 {
+		applied.ProxyImagePullPolicy = wic.ProxyImagePullPolicy
+	}
+	if len(wic.ProxyImagePullSecrets) > 0 {
+		applied.ProxyImagePullSecrets = wic.ProxyImagePullSecrets
+	}
+	if cte := wic.CustomTokenEndpoint; cte != nil {
+		applied.AzureKubernetesTokenProxy = cte.AzureKubernetesTokenProxy
+		applied.AzureKubernetesSNIName = cte.AzureKubernetesSNIName
+		applied.AzureKubernetesCAData = cte.AzureKubernetesCAData
+		applied.AzureKubernetesCAConfigMapName = cte.AzureKubernetesCAConfigMapName
+		applied.AzureKubernetesCACTBSignerName = cte.AzureKubernetesCACTBSignerName
+		applied.AzureKubernetesCACTBLabelSelector = LabelSelectorPtr{Value: cte.AzureKubernetesCACTBLabelSelector}
+	}
+	if ns, ok := wic.Namespaces[namespace]; ok {
+		if len(ns.TenantID) > 0 {
+			applied.TenantID = ns.TenantID
+		}
+		if ns.ServiceAccountTokenExpiration > 0 {
+			applied.ServiceAccountTokenExpiration = ns.ServiceAccountTokenExpiration
+		}
+	}
+	return &applied
+}
+
+// PolicyStore holds the current WorkloadIdentityConfig and is safe for concurrent use.
+// A nil PolicyStore behaves like an empty store.
+type PolicyStore struct {
+	wic atomic.Pointer[WorkloadIdentityConfig]
+}
+
+// Load returns the current WorkloadIdentityConfig or nil if none is set
+func (s *PolicyStore) Load() *WorkloadIdentityConfig {
+	if s == nil {
+		return nil
+	}
+	return s.wic.Load()
+}
+
+// Store replaces the current WorkloadIdentityConfig. Storing nil resets the policy.
+func (s *PolicyStore) Store(wic *WorkloadIdentityConfig) {
+	s.wic.Store(wic)
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseWorkloadIdentityConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		wantWIC *WorkloadIdentityConfig
+	}{
+		{
+			name:    "empty config",
+			data:    "",
+			wantWIC: &WorkloadIdentityConfig{},
+		},
+		{
+			name: "full config",
+			data: `
+tenantID: tenant-id
+serviceAccountTokenExpiration: 7200
+proxyImage: proxy:v1
+proxyInitImage: proxy-init:v1
+proxyResources:
+  cpuRequest: 10m
+  memoryLimit: 128Mi
+proxyImagePullPolicy: Always
+proxyImagePullSecrets:
+- mirror
+customTokenEndpoint:
+  azureKubernetesTokenProxy: https://token-proxy
+  azureKubernetesCACTBSignerName: ctb-signer
+  azureKubernetesCACTBLabelSelector:
+    matchLabels:
+      app: nginx
+namespaces:
+  team-a:
+    tenantID: tenant-a
+    serviceAccountTokenExpiration: 3600
+`,
+			wantWIC: &WorkloadIdentityConfig{
+				TenantID:                      "tenant-id",
+				ServiceAccountTokenExpiration: 7200,
+				ProxyImage:                    "proxy:v1",
+				ProxyInitImage:                "proxy-init:v1",
+				ProxyResources:                &ProxyResourcesConfig{CPURequest: "10m", MemoryLimit: "128Mi"},
+				ProxyImagePullPolicy:          "Always",
+				ProxyImagePullSecrets:         []string{"mirror"},
+				CustomTokenEndpoint: &CustomTokenEndpointConfig{
+					AzureKubernetesTokenProxy:      "https://token-proxy",
+					AzureKubernetesCACTBSignerName: "ctb-signer",
+					AzureKubernetesCACTBLabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "nginx"},
+					},
+				},
+				Namespaces: map[string]NamespaceConfig{
+					"team-a": {TenantID: "tenant-a", ServiceAccountTokenExpiration: 3600},
+				},
+			},
+		},
+		{
+			name:    "unknown field",
+			data:    "audience: api://AzureADTokenExchange",
+			wantErr: `failed to parse workload identity config`,
+		},
+		{
+			name: "ca data and configmap name mutually exclusive",
+			data: `
+customTokenEndpoint:
+  azureKubernetesCAData: ca-data
+  azureKubernetesCAConfigMapName: ca-configmap
+`,
+			wantErr: "invalid custom token endpoint config: only one of AZURE_KUBERNETES_CA_DATA, AZURE_KUBERNETES_CA_CONFIGMAP_NAME or AZURE_KUBERNETES_CA_CTB_SIGNER_NAME can be set",
+		},
+		{
+			name: "invalid proxy resources",
+			data: `
+proxyResources:
+  cpuRequest: 200m
+  cpuLimit: 100m
+`,
+			wantErr: "invalid proxy config: PROXY_CPU_REQUEST must be less than or equal to PROXY_CPU_LIMIT",
+		},
+		{
+			name:    "invalid proxy image pull policy",
+			data:    "proxyImagePullPolicy: Sometimes",
+			wantErr: `invalid proxy config: invalid PROXY_IMAGE_PULL_POLICY "Sometimes"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wic, err := ParseWorkloadIdentityConfig([]byte(tt.data))
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseWorkloadIdentityConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWorkloadIdentityConfig() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(wic, tt.wantWIC) {
+				t.Errorf("ParseWorkloadIdentityConfig() got = %+v, want %+v", wic, tt.wantWIC)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	base := &Config{
+		Cloud:                          "AzurePublicCloud",
+		TenantID:                       "tenant-id",
+		ProxyImage:                     "proxy:v0",
+		ProxyCPURequest:                "10m",
+		ProxyMemoryLimit:               "64Mi",
+		AzureKubernetesTokenProxy:      "https://token-proxy",
+		AzureKubernetesCAConfigMapName: "ca-configmap",
+	}
+	wic := &WorkloadIdentityConfig{
+		TenantID:                      "policy-tenant-id",
+		ServiceAccountTokenExpiration: 7200,
+		ProxyImage:                    "proxy:v1",
+		ProxyResources:                &ProxyResourcesConfig{CPULimit: "100m", MemoryLimit: "128Mi"},
+		ProxyImagePullPolicy:          "Always",
+		ProxyImagePullSecrets:         []string{"mirror"},
+		CustomTokenEndpoint: &CustomTokenEndpointConfig{
+			AzureKubernetesTokenProxy: "https://other-token-proxy",
+			AzureKubernetesCAData:     "ca-data",
+		},
+		Namespaces: map[string]NamespaceConfig{
+			"team-a": {TenantID: "tenant-a"},
+			"team-b": {ServiceAccountTokenExpiration: 3600},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		wic        *WorkloadIdentityConfig
+		namespace  string
+		wantConfig *Config
+	}{
+		{
+			name:       "no policy",
+			wic:        nil,
+			namespace:  "default",
+			wantConfig: base,
+		},
+		{
+			name:      "policy defaults",
+			wic:       wic,
+			namespace: "default",
+			wantConfig: &Config{
+				Cloud:                         "AzurePublicCloud",
+				TenantID:                      "policy-tenant-id",
+				ServiceAccountTokenExpiration: 7200,
+				ProxyImage:                    "proxy:v1",
+				ProxyCPURequest:               "10m",
+				ProxyCPULimit:                 "100m",
+				ProxyMemoryLimit:              "128Mi",
+				ProxyImagePullPolicy:          "Always",
+				ProxyImagePullSecrets:         []string{"mirror"},
+				AzureKubernetesTokenProxy:     "https://other-token-proxy",
+				AzureKubernetesCAData:         "ca-data",
+			},
+		},
+		{
+			name:      "namespace tenant id override",
+			wic:       wic,
+			namespace: "team-a",
+			wantConfig: &Config{
+				Cloud:                         "AzurePublicCloud",
+				TenantID:                      "tenant-a",
+				ServiceAccountTokenExpiration: 7200,
+				ProxyImage:                    "proxy:v1",
+				ProxyCPURequest:               "10m",
+				ProxyCPULimit:                 "100m",
+				ProxyMemoryLimit:              "128Mi",
+				ProxyImagePullPolicy:          "Always",
+				ProxyImagePullSecrets:         []string{"mirror"},
+				AzureKubernetesTokenProxy:     "https://other-token-proxy",
+				AzureKubernetesCAData:         "ca-data",
+			},
+		},
+		{
+			name:      "namespace token expiration override",
+			wic:       wic,
+			namespace: "team-b",
+			wantConfig: &Config{
+				Cloud:                         "AzurePublicCloud",
+				TenantID:                      "policy-tenant-id",
+				ServiceAccountTokenExpiration: 3600,
+				ProxyImage:                    "proxy:v1",
+				ProxyCPURequest:               "10m",
+				ProxyCPULimit:                 "100m",
+				ProxyMemoryLimit:              "128Mi",
+				ProxyImagePullPolicy:          "Always",
+				ProxyImagePullSecrets:         []string{"mirror"},
+				AzureKubernetesTokenProxy:     "https://other-token-proxy",
+				AzureKubernetesCAData:         "ca-data",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base.Apply(tt.wic, tt.namespace)
+			if !reflect.DeepEqual(got, tt.wantConfig) {
+				t.Errorf("Apply() got = %+v, want %+v", got, tt.wantConfig)
+			}
+			if got == base {
+				t.Errorf("Apply() returned the receiver, want a copy")
+			}
+		})
+	}
+}
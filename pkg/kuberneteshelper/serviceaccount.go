@@ -2,12 +2,14 @@ package kuberneteshelper
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/Azure/azure-workload-identity/pkg/webhook"
@@ -18,20 +20,12 @@ import (
 func CreateOrUpdateServiceAccount(ctx context.Context, kubeClient client.Client, namespace, name, clientID, tenantID string, tokenExpiration time.Duration) error {
 	sa := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-			Annotations: map[string]string{
-				webhook.ClientIDAnnotation: clientID,
-				webhook.TenantIDAnnotation: tenantID,
-			},
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: ServiceAccountAnnotations(clientID, tenantID, tokenExpiration),
 		},
 	}
 
-	if tokenExpiration != time.Duration(webhook.DefaultServiceAccountTokenExpiration)*time.Second {
-		// Round to the nearest second before converting to a string
-		sa.ObjectMeta.Annotations[webhook.ServiceAccountTokenExpiryAnnotation] = fmt.Sprintf("%.0f", tokenExpiration.Round(time.Second).Seconds())
-	}
-
 	err := kubeClient.Create(ctx, sa)
 	if apierrors.IsAlreadyExists(err) {
 		err = kubeClient.Update(ctx, sa)
@@ -39,6 +33,20 @@ func CreateOrUpdateServiceAccount(ctx context.Context, kubeClient client.Client,
 	return err
 }
 
+// ServiceAccountAnnotations returns the azure-workload-identity annotations of a ServiceAccount
+func ServiceAccountAnnotations(clientID, tenantID string, tokenExpiration time.Duration) map[string]string {
+	annotations := map[string]string{
+		webhook.ClientIDAnnotation: clientID,
+		webhook.TenantIDAnnotation: tenantID,
+	}
+
+	if tokenExpiration != time.Duration(webhook.DefaultServiceAccountTokenExpiration)*time.Second {
+		// Round to the nearest second before converting to a string
+		annotations[webhook.ServiceAccountTokenExpiryAnnotation] = fmt.Sprintf("%.0f", tokenExpiration.Round(time.Second).Seconds())
+	}
+	return annotations
+}
+
 // Delete ServiceAccount in the cluster
 func DeleteServiceAccount(ctx context.Context, kubeClient client.Client, namespace, name string) error {
 	sa := &corev1.ServiceAccount{}
@@ -54,3 +62,38 @@ func GetServiceAccount(ctx context.Context, kubeClient client.Client, namespace,
 	err := kubeClient.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, sa)
 	return sa, err
 }
+
+// ListServiceAccounts returns the ServiceAccounts that match the given label selector in the namespace,
+// or in all namespaces if the namespace is empty
+func ListServiceAccounts(ctx context.Context, kubeClient client.Client, namespace string, labels map[string]string) ([]corev1.ServiceAccount, error) {
+	saList := &corev1.ServiceAccountList{}
+	if err := kubeClient.List(ctx, saList, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, err
+	}
+	return saList.Items, nil
+}
+
+// GetServiceAccountIssuer returns the issuer of the service account tokens of the cluster
+// from the OpenID Connect discovery document served by the API server
+func GetServiceAccountIssuer(ctx context.Context) (string, error) {
+	kubeConfig, err := GetKubeConfig()
+	if err != nil {
+		return "", err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := discoveryClient.RESTClient().Get().AbsPath("/.well-known/openid-configuration").DoRaw(ctx)
+	if err != nil {
+		return "", err
+	}
+	openIDConfig := struct {
+		Issuer string `json:"issuer"`
+	}{}
+	if err := json.Unmarshal(data, &openIDConfig); err != nil {
+		return "", err
+	}
+	return openIDConfig.Issuer, nil
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	// appServiceAPIVersion is the api-version of the App Service managed identity endpoint
+	// that uses the IDENTITY_ENDPOINT and IDENTITY_HEADER environment variables
+	appServiceAPIVersion = "2019-08-01"
+	// appServiceLegacyAPIVersion is the api-version of the App Service managed identity endpoint
+	// that uses the MSI_ENDPOINT and MSI_SECRET environment variables
+	appServiceLegacyAPIVersion = "2017-09-01"
+
+	// identityHeader is the request header that contains IDENTITY_HEADER
+	identityHeader = "X-IDENTITY-HEADER"
+	// msiSecretHeader is the request header that contains MSI_SECRET
+	msiSecretHeader = "secret"
+
+	// appServiceLegacyExpiresOnFormat is the format of expires_on in the response of api-version 2017-09-01
+	appServiceLegacyExpiresOnFormat = "01/02/2006 15:04:05 -07:00"
+)
+
+// appServiceToken is the token response of the App Service managed identity endpoint
+type appServiceToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresOn   string `json:"expires_on"`
+	Resource    string `json:"resource"`
+	Type        string `json:"token_type"`
+	ClientID    string `json:"client_id"`
+}
+
+// appServiceError is the error response of the App Service managed identity endpoint
+type appServiceError struct {
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// registerAppServiceRoutes adds the App Service managed identity endpoint to the router.
+// Requests to the endpoint must have the IDENTITY_HEADER or MSI_SECRET header.
+func (p *proxy) registerAppServiceRoutes(rtr *mux.Router) {
+	appService := rtr.PathPrefix(webhook.AppServiceTokenPath).Subrouter()
+	appService.Use(p.verifyAppServiceSecret)
+	appService.NewRoute().HandlerFunc(p.appServiceHandler)
+}
+
+// verifyAppServiceSecret rejects the requests that don't have the secret header of the api-version
+func (p *proxy) verifyAppServiceSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := identityHeader
+		if r.URL.Query().Get("api-version") == appServiceLegacyAPIVersion {
+			header = msiSecretHeader
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(header)), []byte(p.identityHeader)) != 1 {
+			p.logger.Info("rejected App Service token request with missing or invalid secret header", "method", r.Method, "uri", r.RequestURI, "header", header)
+			reportTokenRequest(r.Context(), outcomeUnauthorized, r.URL.Query().Get("resource"), 0)
+			writeAppServiceError(w, http.StatusUnauthorized, "The "+header+" header is missing or invalid")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *proxy) appServiceHandler(w http.ResponseWriter, r *http.Request) {
+	p.logger.Info("received App Service token request", "method", r.Method, "uri", r.RequestURI)
+	w.Header().Set("Server", userAgent)
+	req := parseAppServiceTokenRequest(r)
+
+	timeStart := time.Now()
+	outcome := outcomeBadRequest
+	defer func() {
+		reportTokenRequest(r.Context(), outcome, req.resource, time.Since(timeStart))
+	}()
+
+	if req.apiVersion != appServiceAPIVersion && req.apiVersion != appServiceLegacyAPIVersion {
+		writeAppServiceError(w, http.StatusBadRequest, "Invalid api-version "+req.apiVersion+", the supported api-versions are "+appServiceAPIVersion+" and "+appServiceLegacyAPIVersion)
+		return
+	}
+	if req.resource == "" {
+		writeAppServiceError(w, http.StatusBadRequest, descResourceMissing)
+		return
+	}
+	clientID, err := p.resolveClientID(req)
+	if err != nil {
+		writeAppServiceError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	outcome = outcomeError
+	cred, err := p.getOrCreateCred(r.Context(), clientID, p.tenantID)
+	if err != nil {
+		p.logger.Error("failed to get or create credential", err)
+		writeAppServiceError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	token, err := p.doTokenRequest(r.Context(), clientID, req.resource, "", cred)
+	if err != nil {
+		p.logger.Error("failed to get token", err)
+		writeAppServiceError(w, tokenErrorStatusCode(err), err.Error())
+		return
+	}
+	expiresOn := token.ExpiresOn
+	if req.apiVersion == appServiceLegacyAPIVersion {
+		if expiresOn, err = formatLegacyExpiresOn(token.ExpiresOn); err != nil {
+			p.logger.Error("failed to format expires_on", err)
+			writeAppServiceError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	outcome = outcomeSuccess
+	p.logger.Info("successfully acquired token", "method", r.Method, "uri", r.RequestURI)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(appServiceToken{
+		AccessToken: token.AccessToken,
+		ExpiresOn:   expiresOn,
+		Resource:    token.Resource,
+		Type:        token.Type,
+		ClientID:    clientID,
+	}); err != nil {
+		p.logger.Error("failed to encode token", err)
+	}
+}
+
+// parseAppServiceTokenRequest parses the token request of the App Service managed identity endpoint
+func parseAppServiceTokenRequest(r *http.Request) tokenRequest {
+	var req tokenRequest
+	if r.URL != nil {
+		query := r.URL.Query()
+		req.clientID = query.Get("client_id")
+		// api-version 2017-09-01 uses clientid
+		if req.clientID == "" {
+			req.clientID = query.Get("clientid")
+		}
+		req.objectID = query.Get("object_id")
+		// principal_id is an alias of object_id
+		if req.objectID == "" {
+			req.objectID = query.Get("principal_id")
+		}
+		req.resourceID = query.Get("mi_res_id")
+		req.resource = query.Get("resource")
+		req.apiVersion = query.Get("api-version")
+	}
+	return req
+}
+
+// formatLegacyExpiresOn converts expires_on in unix time to the format of api-version 2017-09-01
+func formatLegacyExpiresOn(expiresOn string) (string, error) {
+	sec, err := strconv.ParseInt(expiresOn, 10, 64)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse expires_on %s", expiresOn)
+	}
+	return time.Unix(sec, 0).UTC().Format(appServiceLegacyExpiresOnFormat), nil
+}
+
+// writeAppServiceError writes an App Service error response with the status code
+func writeAppServiceError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(appServiceError{StatusCode: statusCode, Message: message})
+}
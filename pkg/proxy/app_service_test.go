@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/gorilla/mux"
+	"monis.app/mlog"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+func TestProxy_AppServiceHandler(t *testing.T) {
+	const (
+		tenantID = "00000000-0000-0000-0000-000000000000"
+		secret   = "secret"
+	)
+	t.Setenv(webhook.AzureFederatedTokenFileEnvVar, "/var/run/secrets/azure/tokens/azure-identity-token")
+	t.Setenv(webhook.AzureClientIDEnvVar, "env_client_id")
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresOn := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+	tokenCache := NewTokenCache(mlog.New())
+	tokenCache.now = func() time.Time { return expiresOn.Add(-time.Hour) }
+	for _, clientID := range []string{"client_id", "env_client_id"} {
+		tokenCache.entries[tokenCacheKey{clientID: clientID, tenantID: tenantID, scope: "https://vault.azure.net/.default"}] = &cachedToken{
+			token: azcore.AccessToken{Token: "token_" + clientID, ExpiresOn: expiresOn},
+		}
+	}
+	identities, err := ParseIdentityMap([]byte(`[{"clientID": "client_id", "objectID": "object_id"}]`))
+	if err != nil {
+		t.Fatalf("failed to parse identity map: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		header             string
+		value              string
+		expectedStatusCode int
+		expectedToken      *appServiceToken
+		expectedMessage    string
+	}{
+		{
+			name:               "identity header is missing",
+			path:               "/msi/token?api-version=2019-08-01&resource=https://vault.azure.net",
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedMessage:    "The X-IDENTITY-HEADER header is missing or invalid",
+		},
+		{
+			name:               "identity header is invalid",
+			path:               "/msi/token?api-version=2019-08-01&resource=https://vault.azure.net",
+			header:             identityHeader,
+			value:              "invalid",
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedMessage:    "The X-IDENTITY-HEADER header is missing or invalid",
+		},
+		{
+			name:               "identity header used with api-version 2017-09-01",
+			path:               "/msi/token?api-version=2017-09-01&resource=https://vault.azure.net",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedMessage:    "The secret header is missing or invalid",
+		},
+		{
+			name:               "invalid api-version",
+			path:               "/msi/token?api-version=2018-02-01&resource=https://vault.azure.net",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "Invalid api-version 2018-02-01, the supported api-versions are 2019-08-01 and 2017-09-01",
+		},
+		{
+			name:               "resource is missing",
+			path:               "/msi/token?api-version=2019-08-01",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    descResourceMissing,
+		},
+		{
+			name:               "principal_id not in identity map",
+			path:               "/msi/token?api-version=2019-08-01&resource=https://vault.azure.net&principal_id=principal_id",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    descIdentityNotFound,
+		},
+		{
+			name:               "token for AZURE_CLIENT_ID",
+			path:               "/msi/token/?api-version=2019-08-01&resource=https://vault.azure.net",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusOK,
+			expectedToken: &appServiceToken{
+				AccessToken: "token_env_client_id",
+				ExpiresOn:   "1704070800",
+				Resource:    "https://vault.azure.net",
+				Type:        "Bearer",
+				ClientID:    "env_client_id",
+			},
+		},
+		{
+			name:               "token for object_id",
+			path:               "/msi/token?api-version=2019-08-01&resource=https://vault.azure.net&object_id=object_id",
+			header:             identityHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusOK,
+			expectedToken: &appServiceToken{
+				AccessToken: "token_client_id",
+				ExpiresOn:   "1704070800",
+				Resource:    "https://vault.azure.net",
+				Type:        "Bearer",
+				ClientID:    "client_id",
+			},
+		},
+		{
+			name:               "token for clientid with api-version 2017-09-01",
+			path:               "/msi/token?api-version=2017-09-01&resource=https://vault.azure.net&clientid=client_id",
+			header:             msiSecretHeader,
+			value:              secret,
+			expectedStatusCode: http.StatusOK,
+			expectedToken: &appServiceToken{
+				AccessToken: "token_client_id",
+				ExpiresOn:   "01/01/2024 01:00:00 +00:00",
+				Resource:    "https://vault.azure.net",
+				Type:        "Bearer",
+				ClientID:    "client_id",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &proxy{
+				tenantID:       tenantID,
+				logger:         mlog.New(),
+				credCache:      CreateWICredCache(),
+				tokenCache:     tokenCache,
+				identities:     identities,
+				identityHeader: secret,
+			}
+			rtr := mux.NewRouter()
+			rtr.PathPrefix(tokenPathPrefix).HandlerFunc(p.msiHandler)
+			p.registerAppServiceRoutes(rtr)
+			rtr.PathPrefix("/").HandlerFunc(testDefaultHandler)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.header != "" {
+				req.Header.Set(test.header, test.value)
+			}
+			recorder := httptest.NewRecorder()
+			rtr.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectedStatusCode {
+				t.Fatalf("expected status code %d, got %d: %s", test.expectedStatusCode, recorder.Code, recorder.Body.String())
+			}
+			if test.expectedToken != nil {
+				var got appServiceToken
+				if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+					t.Fatalf("failed to unmarshal token: %v", err)
+				}
+				if got != *test.expectedToken {
+					t.Errorf("expected token %+v, got %+v", *test.expectedToken, got)
+				}
+				return
+			}
+			var got appServiceError
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal error: %v", err)
+			}
+			if got.StatusCode != test.expectedStatusCode || got.Message != test.expectedMessage {
+				t.Errorf("expected error %d %q, got %d %q", test.expectedStatusCode, test.expectedMessage, got.StatusCode, got.Message)
+			}
+		})
+	}
+}
+
+func TestParseAppServiceTokenRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected tokenRequest
+	}{
+		{
+			name:     "api-version 2019-08-01",
+			query:    "api-version=2019-08-01&resource=resource&client_id=client_id",
+			expected: tokenRequest{apiVersion: "2019-08-01", resource: "resource", clientID: "client_id"},
+		},
+		{
+			name:     "api-version 2017-09-01",
+			query:    "api-version=2017-09-01&resource=resource&clientid=client_id",
+			expected: tokenRequest{apiVersion: "2017-09-01", resource: "resource", clientID: "client_id"},
+		},
+		{
+			name:     "principal_id",
+			query:    "principal_id=principal_id",
+			expected: tokenRequest{objectID: "principal_id"},
+		},
+		{
+			name:     "object_id and mi_res_id",
+			query:    "object_id=object_id&mi_res_id=mi_res_id",
+			expected: tokenRequest{objectID: "object_id", resourceID: "mi_res_id"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/msi/token?"+test.query, nil)
+			if got := parseAppServiceTokenRequest(req); got != test.expected {
+				t.Errorf("expected token request %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
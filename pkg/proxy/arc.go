@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+const (
+	// arcKeyFileExtension is the extension of the key files that the Azure Arc clients accept
+	arcKeyFileExtension = ".key"
+	// arcKeyTTL is how long the secret in a key file can be used
+	arcKeyTTL = time.Minute
+
+	descArcChallenge   = "Retry the request with the secret in the file of the WWW-Authenticate header as basic authorization"
+	descArcInvalidAuth = "The secret in the Authorization header is invalid or has expired"
+)
+
+// arcKey is the key file of a challenge
+type arcKey struct {
+	path      string
+	expiresOn time.Time
+}
+
+// arcChallenges issues and verifies the challenges of the Azure Arc token endpoint. Each challenge
+// is a random secret written to a key file in dir, which is shared with the containers of the pod.
+// A secret can only be used once.
+type arcChallenges struct {
+	dir  string
+	mu   sync.Mutex
+	keys map[string]arcKey
+	// now is used to get the current time and can be replaced in tests
+	now func() time.Time
+}
+
+func newArcChallenges(dir string) *arcChallenges {
+	return &arcChallenges{
+		dir:  dir,
+		keys: make(map[string]arcKey),
+		now:  time.Now,
+	}
+}
+
+// issue writes a new secret to a key file and returns the path of the key file
+func (c *arcChallenges) issue() (string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	name, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(c.dir, name+arcKeyFileExtension)
+	// the key file is read by the containers of the pod, which may run as a different user
+	if err := os.WriteFile(path, []byte(secret), 0644); err != nil { //nolint:gosec // the key file is only shared within the pod
+		return "", errors.Wrapf(err, "failed to write key file %s", path)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	c.keys[secret] = arcKey{path: path, expiresOn: c.now().Add(arcKeyTTL)}
+	return path, nil
+}
+
+// verify returns true if the secret was issued and has not expired. The key file is removed.
+func (c *arcChallenges) verify(secret string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+	key, ok := c.keys[secret]
+	if !ok {
+		return false
+	}
+	delete(c.keys, secret)
+	_ = os.Remove(key.path)
+	return true
+}
+
+// pruneLocked removes the expired keys. c.mu must be held.
+func (c *arcChallenges) pruneLocked() {
+	now := c.now()
+	for secret, key := range c.keys {
+		if now.After(key.expiresOn) {
+			delete(c.keys, secret)
+			_ = os.Remove(key.path)
+		}
+	}
+}
+
+// registerArcRoutes adds the Azure Arc token endpoint to the router. Token requests
+// to the endpoint are challenged and served by the IMDS token handler once authorized.
+func (p *proxy) registerArcRoutes(rtr *mux.Router) {
+	arc := rtr.PathPrefix(webhook.AzureArcTokenPath).Subrouter()
+	arc.Use(p.arcChallenge)
+	arc.NewRoute().HandlerFunc(p.msiHandler)
+}
+
+// arcChallenge responds to token requests without basic authorization with a 401 and the path
+// of a new key file in the WWW-Authenticate header, and rejects requests with an invalid secret
+func (p *proxy) arcChallenge(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// don't write key files for requests that IMDS would reject
+		if !strings.EqualFold(r.Header.Get("Metadata"), "true") {
+			writeIMDSError(w, http.StatusBadRequest, errInvalidRequest, descMetadataHeaderMissing)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			path, err := p.arc.issue()
+			if err != nil {
+				p.logger.Error("failed to issue Azure Arc challenge", err)
+				writeIMDSError(w, http.StatusInternalServerError, errUnknown, err.Error())
+				return
+			}
+			p.logger.Info("issued Azure Arc challenge", "method", r.Method, "uri", r.RequestURI, "keyFile", path)
+			w.Header().Set("WWW-Authenticate", "Basic realm="+path)
+			writeIMDSError(w, http.StatusUnauthorized, errInvalidRequest, descArcChallenge)
+			return
+		}
+
+		secret, ok := strings.CutPrefix(auth, "Basic ")
+		if !ok || !p.arc.verify(secret) {
+			p.logger.Info("rejected Azure Arc token request with invalid secret", "method", r.Method, "uri", r.RequestURI)
+			reportTokenRequest(r.Context(), outcomeUnauthorized, r.URL.Query().Get("resource"), 0)
+			writeIMDSError(w, http.StatusUnauthorized, errInvalidRequest, descArcInvalidAuth)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate random bytes")
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"monis.app/mlog"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+func TestArcChallenges(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := newArcChallenges(dir)
+	c.now = clock.Now
+
+	path, err := c.issue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Dir(path) != dir || filepath.Ext(path) != arcKeyFileExtension {
+		t.Errorf("expected a .key file in %s, got %s", dir, path)
+	}
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read key file: %v", err)
+	}
+
+	if c.verify("invalid") {
+		t.Errorf("expected invalid secret to be rejected")
+	}
+	if !c.verify(string(secret)) {
+		t.Errorf("expected issued secret to be accepted")
+	}
+	if c.verify(string(secret)) {
+		t.Errorf("expected secret to only be accepted once")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected key file to be removed after use, got %v", err)
+	}
+
+	// expired secrets are rejected and their key files removed
+	path, err = c.issue()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secret, err = os.ReadFile(path); err != nil {
+		t.Fatalf("failed to read key file: %v", err)
+	}
+	clock.Advance(arcKeyTTL + time.Second)
+	if c.verify(string(secret)) {
+		t.Errorf("expected expired secret to be rejected")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected expired key file to be removed, got %v", err)
+	}
+}
+
+func TestProxy_ArcChallenge(t *testing.T) {
+	p := &proxy{logger: mlog.New(), arc: newArcChallenges(t.TempDir())}
+	rtr := mux.NewRouter()
+	rtr.PathPrefix(tokenPathPrefix).HandlerFunc(testTokenHandler)
+	arc := rtr.PathPrefix(webhook.AzureArcTokenPath).Subrouter()
+	arc.Use(p.arcChallenge)
+	arc.NewRoute().HandlerFunc(testTokenHandler)
+	rtr.PathPrefix("/").HandlerFunc(testDefaultHandler)
+
+	const path = webhook.AzureArcTokenPath + "?api-version=2019-11-01&resource=https%3A%2F%2Fvault.azure.net"
+	do := func(metadata bool, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if metadata {
+			req.Header.Set("Metadata", "true")
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		recorder := httptest.NewRecorder()
+		rtr.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if got := do(false, ""); got.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d without Metadata header, got %d", http.StatusBadRequest, got.Code)
+	}
+
+	challenge := do(true, "")
+	if challenge.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, challenge.Code)
+	}
+	keyFile, ok := strings.CutPrefix(challenge.Header().Get("WWW-Authenticate"), "Basic realm=")
+	if !ok {
+		t.Fatalf("expected WWW-Authenticate header with basic realm, got %q", challenge.Header().Get("WWW-Authenticate"))
+	}
+	secret, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatalf("failed to read key file: %v", err)
+	}
+
+	if got := do(true, "Basic invalid"); got.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with invalid secret, got %d", http.StatusUnauthorized, got.Code)
+	}
+	if got := do(true, "Bearer "+string(secret)); got.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d without basic authorization, got %d", http.StatusUnauthorized, got.Code)
+	}
+	if got := do(true, "Basic "+string(secret)); got.Code != http.StatusOK || got.Body.String() != "token_request_handler" {
+		t.Errorf("expected the token request to be served, got %d %s", got.Code, got.Body.String())
+	}
+	if got := do(true, "Basic "+string(secret)); got.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d when the secret is reused, got %d", http.StatusUnauthorized, got.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+// checkFederatedToken checks that the federated token file is readable and that the
+// token in it has not expired at now. The signature of the token is not verified,
+// as it's only verified by Microsoft Entra ID when the token is exchanged.
+func checkFederatedToken(path string, now time.Time) error {
+	if path == "" {
+		return errors.Errorf("%s not set", webhook.AzureFederatedTokenFileEnvVar)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the federated token file")
+	}
+	token, err := jwt.ParseSigned(strings.TrimSpace(string(data)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the federated token in %s", path)
+	}
+	var claims jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return errors.Wrapf(err, "failed to get the claims of the federated token in %s", path)
+	}
+	if claims.Expiry == nil {
+		return errors.Errorf("federated token in %s has no expiry", path)
+	}
+	if expiry := claims.Expiry.Time(); !now.Before(expiry) {
+		return errors.Errorf("federated token in %s expired at %s", path, expiry.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jose "gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+// writeFederatedToken writes a token that expires at expiry to a file in dir and returns its path
+func writeFederatedToken(t *testing.T, dir string, expiry *time.Time) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}, nil)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	claims := jwt.Claims{Subject: "system:serviceaccount:default:sa"}
+	if expiry != nil {
+		claims.Expiry = jwt.NewNumericDate(*expiry)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	path := filepath.Join(dir, "azure-identity-token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write token: %v", err)
+	}
+	return path
+}
+
+func TestCheckFederatedToken(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	valid := now.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		path        func(t *testing.T) string
+		expectedErr string
+	}{
+		{
+			name:        "path not set",
+			path:        func(t *testing.T) string { return "" },
+			expectedErr: "AZURE_FEDERATED_TOKEN_FILE not set",
+		},
+		{
+			name:        "file doesn't exist",
+			path:        func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing") },
+			expectedErr: "failed to read the federated token file",
+		},
+		{
+			name: "not a token",
+			path: func(t *testing.T) string {
+				path := filepath.Join(t.TempDir(), "token")
+				if err := os.WriteFile(path, []byte("not-a-token"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				return path
+			},
+			expectedErr: "failed to parse the federated token",
+		},
+		{
+			name:        "no expiry",
+			path:        func(t *testing.T) string { return writeFederatedToken(t, t.TempDir(), nil) },
+			expectedErr: "has no expiry",
+		},
+		{
+			name:        "expired",
+			path:        func(t *testing.T) string { return writeFederatedToken(t, t.TempDir(), &expired) },
+			expectedErr: "expired at",
+		},
+		{
+			name: "valid",
+			path: func(t *testing.T) string { return writeFederatedToken(t, t.TempDir(), &valid) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkFederatedToken(test.path(t), now)
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Errorf("checkFederatedToken() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("checkFederatedToken() = %v, want error containing %q", err, test.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// IdentityMapEnvVar is the environment variable that contains the identity map
+// when the identity map is not read from a file
+const IdentityMapEnvVar = "AZWI_IDENTITY_MAP"
+
+// Identity maps the object ID and/or the resource ID of a user-assigned managed identity
+// or an application to the client ID that the proxy uses to request a token
+type Identity struct {
+	ClientID   string `json:"clientID"`
+	ObjectID   string `json:"objectID,omitempty"`
+	ResourceID string `json:"resourceID,omitempty"`
+}
+
+// IdentityMap resolves the object_id and mi_res_id/msi_res_id parameters of an IMDS token
+// request to client IDs. Object IDs and resource IDs are matched case-insensitively.
+type IdentityMap struct {
+	byObjectID   map[string]string
+	byResourceID map[string]string
+}
+
+// LoadIdentityMap reads the identity map from the file if path is set, otherwise from
+// the AZWI_IDENTITY_MAP environment variable. An empty identity map is returned if neither is set.
+func LoadIdentityMap(path string) (*IdentityMap, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, errors.Wrapf(err, "failed to read identity map file %s", path)
+		}
+	} else {
+		data = []byte(os.Getenv(IdentityMapEnvVar))
+	}
+	return ParseIdentityMap(data)
+}
+
+// ParseIdentityMap parses a JSON or YAML list of identities
+func ParseIdentityMap(data []byte) (*IdentityMap, error) {
+	m := &IdentityMap{
+		byObjectID:   make(map[string]string),
+		byResourceID: make(map[string]string),
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return m, nil
+	}
+
+	var identities []Identity
+	if err := yaml.UnmarshalStrict(data, &identities); err != nil {
+		return nil, errors.Wrap(err, "failed to parse identity map")
+	}
+	for i, identity := range identities {
+		if identity.ClientID == "" {
+			return nil, errors.Errorf("identity %d: clientID is required", i)
+		}
+		if identity.ObjectID == "" && identity.ResourceID == "" {
+			return nil, errors.Errorf("identity %d: one of objectID or resourceID is required", i)
+		}
+		if identity.ObjectID != "" {
+			if err := addIdentity(m.byObjectID, identity.ObjectID, identity.ClientID); err != nil {
+				return nil, errors.Wrapf(err, "identity %d", i)
+			}
+		}
+		if identity.ResourceID != "" {
+			if err := addIdentity(m.byResourceID, identity.ResourceID, identity.ClientID); err != nil {
+				return nil, errors.Wrapf(err, "identity %d", i)
+			}
+		}
+	}
+	return m, nil
+}
+
+// ClientIDForObjectID returns the client ID of the identity with the object ID
+func (m *IdentityMap) ClientIDForObjectID(objectID string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	clientID, ok := m.byObjectID[strings.ToLower(objectID)]
+	return clientID, ok
+}
+
+// ClientIDForResourceID returns the client ID of the identity with the resource ID
+func (m *IdentityMap) ClientIDForResourceID(resourceID string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	clientID, ok := m.byResourceID[strings.ToLower(resourceID)]
+	return clientID, ok
+}
+
+func addIdentity(ids map[string]string, id, clientID string) error {
+	id = strings.ToLower(id)
+	if existing, ok := ids[id]; ok && existing != clientID {
+		return errors.Errorf("%s is mapped to both %s and %s", id, existing, clientID)
+	}
+	ids[id] = clientID
+	return nil
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIdentityMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr bool
+	}{
+		{
+			name: "empty",
+			data: "",
+		},
+		{
+			name: "json",
+			data: `[{"clientID": "client_id", "objectID": "object_id", "resourceID": "resource_id"}]`,
+		},
+		{
+			name: "yaml",
+			data: "- clientID: client_id\n  objectID: object_id\n",
+		},
+		{
+			name: "same identity listed twice",
+			data: "- clientID: client_id\n  objectID: object_id\n- clientID: client_id\n  objectID: OBJECT_ID\n",
+		},
+		{
+			name:        "clientID missing",
+			data:        "- objectID: object_id\n",
+			expectedErr: true,
+		},
+		{
+			name:        "objectID and resourceID missing",
+			data:        "- clientID: client_id\n",
+			expectedErr: true,
+		},
+		{
+			name:        "object ID mapped to different client IDs",
+			data:        "- clientID: client_id_1\n  objectID: object_id\n- clientID: client_id_2\n  objectID: Object_ID\n",
+			expectedErr: true,
+		},
+		{
+			name:        "unknown field",
+			data:        "- clientID: client_id\n  principalID: object_id\n",
+			expectedErr: true,
+		},
+		{
+			name:        "not a list",
+			data:        "clientID: client_id\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseIdentityMap([]byte(test.data))
+			if (err != nil) != test.expectedErr {
+				t.Errorf("expected error: %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestIdentityMapLookup(t *testing.T) {
+	m, err := ParseIdentityMap([]byte(`
+- clientID: client_id
+  objectID: 00000000-0000-0000-0000-00000000000A
+  resourceID: /subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id
+`))
+	if err != nil {
+		t.Fatalf("failed to parse identity map: %v", err)
+	}
+
+	if clientID, ok := m.ClientIDForObjectID("00000000-0000-0000-0000-00000000000a"); !ok || clientID != "client_id" {
+		t.Errorf("expected client_id for object ID, got %q", clientID)
+	}
+	if clientID, ok := m.ClientIDForResourceID("/subscriptions/SUB/resourcegroups/RG/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id"); !ok || clientID != "client_id" {
+		t.Errorf("expected client_id for resource ID, got %q", clientID)
+	}
+	if _, ok := m.ClientIDForObjectID("unknown"); ok {
+		t.Errorf("expected unknown object ID to not be found")
+	}
+
+	var nilMap *IdentityMap
+	if _, ok := nilMap.ClientIDForResourceID("id"); ok {
+		t.Errorf("expected nil identity map to not contain identities")
+	}
+}
+
+func TestLoadIdentityMap(t *testing.T) {
+	t.Setenv(IdentityMapEnvVar, `[{"clientID": "env_client_id", "objectID": "object_id"}]`)
+
+	m, err := LoadIdentityMap("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clientID, _ := m.ClientIDForObjectID("object_id"); clientID != "env_client_id" {
+		t.Errorf("expected identity map from %s, got client ID %q", IdentityMapEnvVar, clientID)
+	}
+
+	path := filepath.Join(t.TempDir(), "identities.yaml")
+	if err := os.WriteFile(path, []byte("- clientID: file_client_id\n  objectID: object_id\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = LoadIdentityMap(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clientID, _ := m.ClientIDForObjectID("object_id"); clientID != "file_client_id" {
+		t.Errorf("expected identity map from file, got client ID %q", clientID)
+	}
+
+	if _, err := LoadIdentityMap(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PassthroughAction is the action of the proxy for the IMDS requests that are not token requests
+type PassthroughAction string
+
+const (
+	// PassthroughAllow forwards the request to IMDS
+	PassthroughAllow PassthroughAction = "allow"
+	// PassthroughDeny rejects the request with 403 Forbidden
+	PassthroughDeny PassthroughAction = "deny"
+	// PassthroughStub responds with the status code and body of the rule without calling IMDS
+	PassthroughStub PassthroughAction = "stub"
+)
+
+const (
+	// PassthroughPolicyEnvVar is the environment variable that contains the passthrough policy
+	// when the passthrough policy is not read from a file
+	PassthroughPolicyEnvVar = "AZWI_IMDS_PASSTHROUGH_POLICY"
+
+	// defaultPassthroughTimeout is the default timeout of the requests forwarded to IMDS
+	defaultPassthroughTimeout = 10 * time.Second
+	// identityPathPrefix is the prefix of the IMDS identity endpoints. Requests to these endpoints are
+	// denied unless a rule for them allows them, so that the pod can't use the identity of the node.
+	identityPathPrefix = "/metadata/identity"
+
+	errForbidden    = "forbidden"
+	descPathBlocked = "Requests to %s are blocked by the passthrough policy of the proxy (path prefix %s)"
+	// descIdentityPathBlocked is returned in strict mode for the identity endpoints that the proxy doesn't serve
+	descIdentityPathBlocked = "Requests to %s are blocked because the proxy runs in strict mode"
+)
+
+// PassthroughRule applies the action to the IMDS requests with the path prefix.
+// Path prefixes match whole path segments and are case-insensitive.
+type PassthroughRule struct {
+	PathPrefix string            `json:"pathPrefix"`
+	Action     PassthroughAction `json:"action"`
+	// StatusCode and Body are the response of the stub action. StatusCode defaults to 200.
+	StatusCode int    `json:"statusCode,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+// PassthroughPolicy decides which IMDS requests that are not token requests are forwarded to IMDS.
+// The rule with the longest matching path prefix is applied. Requests to the identity endpoints are
+// denied unless a rule for a path prefix under /metadata/identity applies to them. Requests that
+// don't match a rule get the default action.
+type PassthroughPolicy struct {
+	Rules []PassthroughRule `json:"rules,omitempty"`
+	// DefaultAction defaults to allow
+	DefaultAction PassthroughAction `json:"defaultAction,omitempty"`
+	// Timeout of the requests forwarded to IMDS, defaults to 10s
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// DefaultPassthroughPolicy returns the policy that forwards all requests to IMDS except for the identity endpoints
+func DefaultPassthroughPolicy() *PassthroughPolicy {
+	return &PassthroughPolicy{
+		DefaultAction: PassthroughAllow,
+		Timeout:       metav1.Duration{Duration: defaultPassthroughTimeout},
+	}
+}
+
+// LoadPassthroughPolicy reads the passthrough policy from the file if path is set, otherwise from the
+// AZWI_IMDS_PASSTHROUGH_POLICY environment variable. The default policy is returned if neither is set.
+func LoadPassthroughPolicy(path string) (*PassthroughPolicy, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, errors.Wrapf(err, "failed to read passthrough policy file %s", path)
+		}
+	} else {
+		data = []byte(os.Getenv(PassthroughPolicyEnvVar))
+	}
+	return ParsePassthroughPolicy(data)
+}
+
+// ParsePassthroughPolicy parses a JSON or YAML passthrough policy and sets the defaults
+func ParsePassthroughPolicy(data []byte) (*PassthroughPolicy, error) {
+	policy := DefaultPassthroughPolicy()
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return policy, nil
+	}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, errors.Wrap(err, "failed to parse passthrough policy")
+	}
+
+	if policy.DefaultAction == "" {
+		policy.DefaultAction = PassthroughAllow
+	}
+	if err := validatePassthroughAction(policy.DefaultAction); err != nil {
+		return nil, errors.Wrap(err, "invalid defaultAction")
+	}
+	if policy.Timeout.Duration < 0 {
+		return nil, errors.Errorf("invalid timeout %s, must not be negative", policy.Timeout.Duration)
+	}
+	if policy.Timeout.Duration == 0 {
+		policy.Timeout.Duration = defaultPassthroughTimeout
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			return nil, errors.Errorf("rule %d: pathPrefix %q must start with /", i, rule.PathPrefix)
+		}
+		if err := validatePassthroughAction(rule.Action); err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+		if rule.Action != PassthroughStub && (rule.StatusCode != 0 || rule.Body != "") {
+			return nil, errors.Errorf("rule %d: statusCode and body can only be set for the %s action", i, PassthroughStub)
+		}
+		if rule.Action == PassthroughStub && rule.StatusCode == 0 {
+			rule.StatusCode = http.StatusOK
+		}
+		if rule.StatusCode != 0 && (rule.StatusCode < 100 || rule.StatusCode > 599) {
+			return nil, errors.Errorf("rule %d: invalid statusCode %d", i, rule.StatusCode)
+		}
+	}
+	// the longest path prefix takes precedence
+	sort.SliceStable(policy.Rules, func(i, j int) bool {
+		return len(normalizePathPrefix(policy.Rules[i].PathPrefix)) > len(normalizePathPrefix(policy.Rules[j].PathPrefix))
+	})
+	return policy, nil
+}
+
+// match returns the rule that applies to the request path.
+// A nil policy is the default policy.
+func (p *PassthroughPolicy) match(path string) PassthroughRule {
+	if p == nil {
+		p = DefaultPassthroughPolicy()
+	}
+	identity := hasPathPrefix(path, identityPathPrefix)
+	for _, rule := range p.Rules {
+		if !hasPathPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		// only rules for the identity endpoints apply to them, so that a
+		// rule like /metadata doesn't allow them by accident
+		if identity && !hasPathPrefix(rule.PathPrefix, identityPathPrefix) {
+			break
+		}
+		return rule
+	}
+	if identity {
+		return PassthroughRule{PathPrefix: identityPathPrefix, Action: PassthroughDeny}
+	}
+	return PassthroughRule{PathPrefix: "/", Action: p.DefaultAction}
+}
+
+// hasPathPrefix returns true if the path starts with the path segments of the prefix, ignoring case
+func hasPathPrefix(path, prefix string) bool {
+	path = strings.ToLower(path)
+	prefix = normalizePathPrefix(prefix)
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// normalizePathPrefix lower-cases the prefix and removes the trailing slash
+func normalizePathPrefix(prefix string) string {
+	return strings.TrimSuffix(strings.ToLower(prefix), "/")
+}
+
+func validatePassthroughAction(action PassthroughAction) error {
+	switch action {
+	case PassthroughAllow, PassthroughDeny, PassthroughStub:
+		return nil
+	default:
+		return errors.Errorf("unknown action %q, must be one of %s, %s or %s", action, PassthroughAllow, PassthroughDeny, PassthroughStub)
+	}
+}
+
+// newIMDSClient returns the client used to forward requests to IMDS. The client
+// reuses connections across requests and times out after the timeout.
+func newIMDSClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// IMDS is link-local and must never be reached through an HTTP proxy
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
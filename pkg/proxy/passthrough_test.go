@@ -0,0 +1,482 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"monis.app/mlog"
+)
+
+func TestParsePassthroughPolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		expectedErr     bool
+		expectedTimeout time.Duration
+		expectedDefault PassthroughAction
+	}{
+		{
+			name:            "empty",
+			data:            "",
+			expectedTimeout: defaultPassthroughTimeout,
+			expectedDefault: PassthroughAllow,
+		},
+		{
+			name:            "json",
+			data:            `{"defaultAction": "deny", "timeout": "2s", "rules": [{"pathPrefix": "/metadata/instance", "action": "allow"}]}`,
+			expectedTimeout: 2 * time.Second,
+			expectedDefault: PassthroughDeny,
+		},
+		{
+			name:            "yaml",
+			data:            "rules:\n- pathPrefix: /metadata/scheduledevents\n  action: stub\n  body: '{}'\n",
+			expectedTimeout: defaultPassthroughTimeout,
+			expectedDefault: PassthroughAllow,
+		},
+		{
+			name:        "unknown field",
+			data:        `{"rules": [{"path": "/metadata/instance", "action": "allow"}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown action",
+			data:        `{"rules": [{"pathPrefix": "/metadata/instance", "action": "forward"}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown default action",
+			data:        `{"defaultAction": "forward"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "relative path prefix",
+			data:        `{"rules": [{"pathPrefix": "metadata/instance", "action": "allow"}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "body set for allow",
+			data:        `{"rules": [{"pathPrefix": "/metadata/instance", "action": "allow", "body": "{}"}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid stub status code",
+			data:        `{"rules": [{"pathPrefix": "/metadata/instance", "action": "stub", "statusCode": 1000}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "negative timeout",
+			data:        `{"timeout": "-1s"}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := ParsePassthroughPolicy([]byte(test.data))
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", test.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if policy.Timeout.Duration != test.expectedTimeout {
+				t.Errorf("expected timeout %s, got %s", test.expectedTimeout, policy.Timeout.Duration)
+			}
+			if policy.DefaultAction != test.expectedDefault {
+				t.Errorf("expected default action %s, got %s", test.expectedDefault, policy.DefaultAction)
+			}
+		})
+	}
+}
+
+func TestLoadPassthroughPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("defaultAction: deny\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PassthroughPolicyEnvVar, `{"defaultAction": "stub"}`)
+
+	policy, err := LoadPassthroughPolicy(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.DefaultAction != PassthroughDeny {
+		t.Errorf("expected the policy to be read from the file, got default action %s", policy.DefaultAction)
+	}
+
+	policy, err = LoadPassthroughPolicy("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.DefaultAction != PassthroughStub {
+		t.Errorf("expected the policy to be read from %s, got default action %s", PassthroughPolicyEnvVar, policy.DefaultAction)
+	}
+
+	if _, err := LoadPassthroughPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestPassthroughPolicyMatch(t *testing.T) {
+	policy, err := ParsePassthroughPolicy([]byte(`
+defaultAction: deny
+rules:
+- pathPrefix: /metadata
+  action: allow
+- pathPrefix: /metadata/instance/compute/
+  action: deny
+- pathPrefix: /metadata/scheduledevents
+  action: stub
+- pathPrefix: /metadata/identity/info
+  action: allow
+`))
+	if err != nil {
+		t.Fatalf("failed to parse passthrough policy: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		policy         *PassthroughPolicy
+		path           string
+		expectedAction PassthroughAction
+	}{
+		{
+			name:           "nil policy allows instance metadata",
+			path:           "/metadata/instance",
+			expectedAction: PassthroughAllow,
+		},
+		{
+			name:           "nil policy denies identity endpoints",
+			path:           "/metadata/identity/info",
+			expectedAction: PassthroughDeny,
+		},
+		{
+			name:           "identity endpoints are matched ignoring case",
+			path:           "/Metadata/IDENTITY/oauth2/token",
+			expectedAction: PassthroughDeny,
+		},
+		{
+			name:           "prefix matches whole segments",
+			path:           "/metadata/identityfoo",
+			expectedAction: PassthroughAllow,
+		},
+		{
+			name:           "default action",
+			policy:         policy,
+			path:           "/healthz",
+			expectedAction: PassthroughDeny,
+		},
+		{
+			name:           "prefix rule",
+			policy:         policy,
+			path:           "/metadata/instance/network",
+			expectedAction: PassthroughAllow,
+		},
+		{
+			name:           "longest prefix rule",
+			policy:         policy,
+			path:           "/metadata/instance/compute/userData",
+			expectedAction: PassthroughDeny,
+		},
+		{
+			name:           "stub rule",
+			policy:         policy,
+			path:           "/metadata/scheduledevents",
+			expectedAction: PassthroughStub,
+		},
+		{
+			name:           "identity endpoint allowed by rule",
+			policy:         policy,
+			path:           "/metadata/identity/info",
+			expectedAction: PassthroughAllow,
+		},
+		{
+			name:           "identity endpoint not allowed by a broader rule",
+			policy:         policy,
+			path:           "/metadata/identity/oauth2/token",
+			expectedAction: PassthroughDeny,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.match(test.path); got.Action != test.expectedAction {
+				t.Errorf("expected action %s for %s, got %s", test.expectedAction, test.path, got.Action)
+			}
+		})
+	}
+}
+
+func TestProxy_DefaultPathHandler(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Metadata-Path", r.URL.Path)
+		_, _ = w.Write([]byte("imds"))
+	}))
+	defer imds.Close()
+
+	policy, err := ParsePassthroughPolicy([]byte(`
+timeout: 50ms
+rules:
+- pathPrefix: /metadata/scheduledevents
+  action: stub
+  body: '{"DocumentIncarnation":0,"Events":[]}'
+- pathPrefix: /metadata/instance/compute/userData
+  action: deny
+`))
+	if err != nil {
+		t.Fatalf("failed to parse passthrough policy: %v", err)
+	}
+	p := &proxy{
+		logger:      mlog.New(),
+		passthrough: policy,
+		imdsClient:  newIMDSClient(policy.Timeout.Duration),
+		imdsHost:    strings.TrimPrefix(imds.URL, "http://"),
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "allowed",
+			path:               "/metadata/instance?api-version=2021-02-01",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "imds",
+		},
+		{
+			name:               "denied",
+			path:               "/metadata/instance/compute/userData?api-version=2021-01-01",
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"forbidden","error_description":"Requests to /metadata/instance/compute/userData are blocked by the passthrough policy of the proxy (path prefix /metadata/instance/compute/userData)"}` + "\n",
+		},
+		{
+			name:               "identity endpoint denied by default",
+			path:               "/metadata/identity/info?api-version=2018-02-01",
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"forbidden","error_description":"Requests to /metadata/identity/info are blocked by the passthrough policy of the proxy (path prefix /metadata/identity)"}` + "\n",
+		},
+		{
+			name:               "stubbed",
+			path:               "/metadata/scheduledevents?api-version=2020-07-01",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"DocumentIncarnation":0,"Events":[]}`,
+		},
+		{
+			name:               "upstream timeout",
+			path:               "/metadata/slow",
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Header.Set("Metadata", "true")
+			recorder := httptest.NewRecorder()
+			p.defaultPathHandler(recorder, req)
+
+			if recorder.Code != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, recorder.Code)
+			}
+			if test.expectedBody != "" && recorder.Body.String() != test.expectedBody {
+				t.Errorf("expected body %s, got %s", test.expectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxy_StrictMode(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	var forwarded []string
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.URL.Path)
+		_, _ = w.Write([]byte("imds"))
+	}))
+	defer imds.Close()
+
+	// the policy allows the identity endpoints, which strict mode overrides
+	policy, err := ParsePassthroughPolicy([]byte(`{"rules": [{"pathPrefix": "/metadata/identity", "action": "allow"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse passthrough policy: %v", err)
+	}
+
+	const query = "?api-version=2018-02-01&resource=https%3A%2F%2Fvault.azure.net&mi_res_id=%2Fsubscriptions%2Fsub%2FresourceGroups%2Frg%2Fproviders%2FMicrosoft.ManagedIdentity%2FuserAssignedIdentities%2Fid"
+	tests := []struct {
+		name               string
+		strict             bool
+		path               string
+		expectedStatusCode int
+		expectedBody       string
+		expectedForwarded  bool
+	}{
+		{
+			name:               "token request",
+			strict:             true,
+			path:               "/metadata/identity/oauth2/token" + query,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Identity not found"}` + "\n",
+		},
+		{
+			name:               "token request with unusual casing",
+			strict:             true,
+			path:               "/metadata/IDENTITY/OAuth2/Token" + query,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Identity not found"}` + "\n",
+		},
+		{
+			name:               "token request with trailing segments",
+			strict:             true,
+			path:               "/Metadata/Identity/oauth2/token/extra/" + query,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Identity not found"}` + "\n",
+		},
+		{
+			name:               "other identity endpoint",
+			strict:             true,
+			path:               "/metadata/identity/info?api-version=2018-02-01",
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"forbidden","error_description":"Requests to /metadata/identity/info are blocked because the proxy runs in strict mode"}` + "\n",
+		},
+		{
+			name:               "instance metadata",
+			strict:             true,
+			path:               "/metadata/instance?api-version=2021-02-01",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "imds",
+			expectedForwarded:  true,
+		},
+		{
+			name:               "token request with unusual casing without strict mode",
+			path:               "/metadata/IDENTITY/OAuth2/Token" + query,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "imds",
+			expectedForwarded:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forwarded = nil
+			p := &proxy{
+				logger:      mlog.New(),
+				passthrough: policy,
+				imdsClient:  newIMDSClient(policy.Timeout.Duration),
+				imdsHost:    strings.TrimPrefix(imds.URL, "http://"),
+				strict:      test.strict,
+			}
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Header.Set("Metadata", "true")
+			recorder := httptest.NewRecorder()
+			p.router().ServeHTTP(recorder, req)
+
+			if recorder.Code != test.expectedStatusCode {
+				t.Errorf("expected status code %d, got %d", test.expectedStatusCode, recorder.Code)
+			}
+			if recorder.Body.String() != test.expectedBody {
+				t.Errorf("expected body %s, got %s", test.expectedBody, recorder.Body.String())
+			}
+			if (len(forwarded) > 0) != test.expectedForwarded {
+				t.Errorf("expected request to be forwarded to IMDS: %v, got forwarded paths %v", test.expectedForwarded, forwarded)
+			}
+		})
+	}
+}
+
+// TestProxy_RunIPv6Passthrough runs the proxy and sends the requests to the IPv4 and IPv6 loopback addresses,
+// as redirected by the proxy init container, and checks that they are forwarded to the metadata endpoint
+// of the same IP family.
+func TestProxy_RunIPv6Passthrough(t *testing.T) {
+	l6, err := net.Listen("tcp6", net.JoinHostPort(loopbackIPv6, "0"))
+	if err != nil {
+		t.Skipf("IPv6 is not supported: %v", err)
+	}
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	imds4 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("imds-ipv4"))
+	}))
+	defer imds4.Close()
+	imds6 := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("imds-ipv6"))
+	}))
+	imds6.Listener.Close()
+	imds6.Listener = l6
+	imds6.Start()
+	defer imds6.Close()
+
+	// find a free port on the IPv4 loopback address for the proxy
+	l4, err := net.Listen("tcp4", net.JoinHostPort(loopbackIPv4, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l4.Addr().(*net.TCPAddr).Port
+	l4.Close()
+
+	logger := mlog.New()
+	policy := DefaultPassthroughPolicy()
+	p := &proxy{
+		port:        port,
+		logger:      logger,
+		tokenCache:  NewTokenCache(logger),
+		passthrough: policy,
+		imdsClient:  newIMDSClient(policy.Timeout.Duration),
+		imdsHost:    strings.TrimPrefix(imds4.URL, "http://"),
+		imdsHost6:   strings.TrimPrefix(imds6.URL, "http://"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error from Run: %v", err)
+		}
+	}()
+
+	for _, test := range []struct {
+		addr         string
+		expectedBody string
+	}{
+		{addr: loopbackIPv4, expectedBody: "imds-ipv4"},
+		{addr: loopbackIPv6, expectedBody: "imds-ipv6"},
+	} {
+		url := fmt.Sprintf("http://%s/metadata/instance?api-version=2021-02-01", net.JoinHostPort(test.addr, strconv.Itoa(port)))
+		var body []byte
+		for i := 0; i < 50; i++ {
+			resp, err := http.Get(url)
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err == nil {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if string(body) != test.expectedBody {
+			t.Errorf("expected the request to %s to be forwarded to %s, got %q", test.addr, test.expectedBody, body)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package proxy
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,6 +17,11 @@ const (
 	waitTime = time.Second
 	// clientTimeout is the timeout for the client.
 	clientTimeout = time.Second * 5
+
+	// HealthCheckReadyz checks if the proxy is ready to serve requests.
+	HealthCheckReadyz = "readyz"
+	// HealthCheckHealthz checks if the proxy can read a federated token that has not expired.
+	HealthCheckHealthz = "healthz"
 )
 
 // Probe checks if the proxy is ready to serve requests.
@@ -43,3 +50,38 @@ func probe(url string) error {
 	}
 	return errors.Errorf("failed to probe proxy")
 }
+
+// Check runs a single health check on the proxy. Unlike Probe, it doesn't retry, so that
+// it can be used by the probes of the proxy sidecar container.
+func Check(port int, healthCheck string) error {
+	var path string
+	switch healthCheck {
+	case HealthCheckReadyz:
+		path = readyzPathPrefix
+	case HealthCheckHealthz:
+		path = healthzPathPrefix
+	default:
+		return errors.Errorf("invalid health check %q, must be %s or %s", healthCheck, HealthCheckReadyz, HealthCheckHealthz)
+	}
+	return check(fmt.Sprintf("http://%s:%d%s", localhost, port, path))
+}
+
+func check(url string) error {
+	client := &http.Client{
+		Timeout: clientTimeout,
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("health check returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
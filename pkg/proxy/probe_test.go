@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"net/http"
+	"strings"
 	"testing"
 
 	"monis.app/mlog"
@@ -26,3 +28,29 @@ func TestProbeError(t *testing.T) {
 		t.Errorf("probe() = nil, want error")
 	}
 }
+
+func TestCheck(t *testing.T) {
+	setup()
+	defer teardown()
+
+	rtr.PathPrefix("/readyz").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	rtr.PathPrefix("/healthz").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "federated token expired", http.StatusServiceUnavailable)
+	})
+
+	if err := check(server.URL + "/readyz"); err != nil {
+		t.Errorf("check() = %v, want nil", err)
+	}
+	err := check(server.URL + "/healthz")
+	if err == nil || !strings.Contains(err.Error(), "status code 503: federated token expired") {
+		t.Errorf("check() = %v, want error with the status code and body", err)
+	}
+}
+
+func TestCheckInvalidHealthCheck(t *testing.T) {
+	if err := Check(8000, "livez"); err == nil {
+		t.Errorf("Check() = nil, want error")
+	}
+}
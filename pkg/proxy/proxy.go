@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/gorilla/mux"
@@ -26,8 +28,15 @@ const (
 	// "/metadata" portion is case-insensitive in IMDS
 	tokenPathPrefix = "/{type:(?i:metadata)}/identity/oauth2/token" // #nosec
 
+	// strictTokenPathPrefix is the IMDS token path matched case-insensitively in strict mode
+	strictTokenPathPrefix = "/metadata/identity/oauth2/token"
+
 	// readyzPathPrefix is the path for readiness probe
 	readyzPathPrefix = "/readyz"
+	// healthzPathPrefix is the path for liveness probe
+	healthzPathPrefix = "/healthz"
+	// tokensPathPrefix is the path that lists the metadata of the cached tokens
+	tokensPathPrefix = "/azwi/tokens"
 
 	// metadataIPAddress is the IP address of the metadata service
 	metadataIPAddress = "169.254.169.254"
@@ -35,6 +44,28 @@ const (
 	metadataPort = 80
 	// localhost is the hostname of the localhost
 	localhost = "localhost"
+	// loopbackIPv4 and loopbackIPv6 are the addresses the proxy listens on. The traffic to
+	// the IPv6 metadata endpoint is redirected to the IPv6 loopback address.
+	loopbackIPv4 = "127.0.0.1"
+	loopbackIPv6 = "::1"
+
+	// minIdentityAPIVersion is the first api-version of the IMDS identity endpoint
+	minIdentityAPIVersion = "2018-02-01"
+
+	// IMDS error codes returned by the token endpoint
+	errInvalidRequest = "invalid_request"
+	errUnknown        = "unknown_error"
+)
+
+// IMDS error descriptions returned by the token endpoint
+const (
+	descMetadataHeaderMissing = "Required metadata header not specified"
+	descAPIVersionMissing     = "Required query variable 'api-version' is missing"
+	descAPIVersionInvalid     = "Invalid api-version %s, the minimum supported api-version is %s"
+	descResourceMissing       = "Required query variable 'resource' is missing"
+	descMultipleIdentities    = "Only one of client_id, object_id or mi_res_id can be specified"
+	descIdentityNotFound      = "Identity not found"
+	descClientIDMissing       = "The client_id parameter or AZURE_CLIENT_ID environment variable must be set"
 )
 
 var (
@@ -50,8 +81,48 @@ type proxy struct {
 	tenantID string
 	logger   mlog.Logger
 
-	credCache *CredCache
-	credGroup singleflight.Group
+	credCache  *CredCache
+	credGroup  singleflight.Group
+	tokenCache *TokenCache
+	identities *IdentityMap
+	// identityHeader is the secret of the App Service managed identity endpoint,
+	// the endpoint is only served when it's set
+	identityHeader string
+	// arc issues the challenges of the Azure Arc token endpoint,
+	// the endpoint is only served when it's set
+	arc *arcChallenges
+
+	// passthrough decides which requests that are not token requests are forwarded to imdsHost
+	passthrough *PassthroughPolicy
+	imdsClient  *http.Client
+	imdsHost    string
+	// imdsHost6 is the host of the IPv6 metadata endpoint, which the requests received on
+	// the IPv6 loopback address are forwarded to. It's empty if METADATA_IPV6 is not set.
+	imdsHost6 string
+	// strict serves or rejects all requests to the IMDS identity endpoints
+	// in the proxy, so that they never reach the identity of the node
+	strict bool
+	// tokenFile is the federated token file that is checked by the liveness probe
+	tokenFile string
+}
+
+// tokenRequest is the parsed IMDS token request
+type tokenRequest struct {
+	clientID   string
+	objectID   string
+	resourceID string
+	resource   string
+	apiVersion string
+	claims     string
+	// cloudShell is true for a Cloud Shell token request, which has the parameters
+	// form-encoded in the body and no api-version
+	cloudShell bool
+}
+
+// imdsError is the error response of the IMDS token endpoint
+type imdsError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
 }
 
 // using this from https://github.com/Azure/go-autorest/blob/b3899c1057425994796c92293e931f334af63b4e/autorest/adal/token.go#L1055-L1067
@@ -70,41 +141,74 @@ type token struct {
 	Type     string `json:"token_type"`
 }
 
-// NewProxy returns a proxy instance
-func NewProxy(port int, logger mlog.Logger, credCache *CredCache) (Proxy, error) {
+// NewProxy returns a proxy instance. The Azure Arc token endpoint is served
+// with the key files written to arcKeyDir if it's set. The default passthrough
+// policy is used if passthrough is nil. In strict mode, requests to the IMDS
+// identity endpoints are never forwarded to IMDS.
+func NewProxy(port int, logger mlog.Logger, credCache *CredCache, tokenCache *TokenCache, identities *IdentityMap, arcKeyDir string, passthrough *PassthroughPolicy, strict bool) (Proxy, error) {
 	// tenantID is required for fetching a token using client assertions
 	// the mutating webhook will inject the tenantID for the cluster
 	tenantID := os.Getenv(webhook.AzureTenantIDEnvVar)
 	if tenantID == "" {
 		return nil, errors.Errorf("%s not set", webhook.AzureTenantIDEnvVar)
 	}
+	if err := registerMetrics(); err != nil {
+		return nil, errors.Wrap(err, "failed to register metrics")
+	}
+	var arc *arcChallenges
+	if arcKeyDir != "" {
+		arc = newArcChallenges(arcKeyDir)
+	}
+	if passthrough == nil {
+		passthrough = DefaultPassthroughPolicy()
+	}
+	metadataIPv6 := os.Getenv(webhook.MetadataIPv6EnvVar)
+	if ip := net.ParseIP(metadataIPv6); metadataIPv6 != "" && (ip == nil || ip.To4() != nil) {
+		return nil, errors.Errorf("invalid %s %q, must be an IPv6 address", webhook.MetadataIPv6EnvVar, metadataIPv6)
+	}
 	return &proxy{
-		port:      port,
-		tenantID:  tenantID,
-		logger:    logger,
-		credCache: credCache,
+		port:       port,
+		tenantID:   tenantID,
+		logger:     logger,
+		credCache:  credCache,
+		tokenCache: tokenCache,
+		identities: identities,
+		// the webhook injects IDENTITY_HEADER when the pod is annotated with
+		// azure.workload.identity/inject-app-service-env
+		identityHeader: os.Getenv(webhook.IdentityHeaderEnvVar),
+		arc:            arc,
+		passthrough:    passthrough,
+		imdsClient:     newIMDSClient(passthrough.Timeout.Duration),
+		imdsHost:       net.JoinHostPort(metadataIPAddress, strconv.Itoa(metadataPort)),
+		imdsHost6:      imdsHost6(metadataIPv6),
+		strict:         strict,
+		tokenFile:      os.Getenv(webhook.AzureFederatedTokenFileEnvVar),
 	}, nil
 }
 
-// Run runs the proxy server
+// Run runs the proxy server on the IPv4 and IPv6 loopback addresses
 func (p *proxy) Run(ctx context.Context) error {
-	rtr := mux.NewRouter()
-	rtr.PathPrefix(tokenPathPrefix).HandlerFunc(p.msiHandler)
-	rtr.PathPrefix(readyzPathPrefix).HandlerFunc(p.readyzHandler)
-	rtr.PathPrefix("/").HandlerFunc(p.defaultPathHandler)
+	rtr := p.router()
 
-	p.logger.Info("starting the proxy server", "port", p.port, "userAgent", userAgent)
+	p.logger.Info("starting the proxy server", "port", p.port, "userAgent", userAgent, "strict", p.strict)
 	server := &http.Server{
-		Addr:              fmt.Sprintf("%s:%d", localhost, p.port),
 		ReadHeaderTimeout: 5 * time.Second,
 		Handler:           rtr,
 	}
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			panic(err)
-		}
-	}()
+	listeners, err := p.listen()
+	if err != nil {
+		return err
+	}
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}(l)
+	}
+	// refresh the cached tokens in the background before they expire
+	go p.tokenCache.Run(ctx)
 
 	<-ctx.Done()
 
@@ -115,41 +219,93 @@ func (p *proxy) Run(ctx context.Context) error {
 	return server.Shutdown(shutdownCtx)
 }
 
+// listen listens on the port of the IPv4 and IPv6 loopback addresses. Listening on "localhost" only
+// binds one of them, but the traffic to the IPv6 metadata endpoint is redirected to the IPv6 loopback
+// address. The IPv6 loopback address is skipped if IPv6 is disabled in the network namespace of the pod.
+func (p *proxy) listen() ([]net.Listener, error) {
+	port := strconv.Itoa(p.port)
+	l4, err := net.Listen("tcp4", net.JoinHostPort(loopbackIPv4, port))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", net.JoinHostPort(loopbackIPv4, port))
+	}
+	l6, err := net.Listen("tcp6", net.JoinHostPort(loopbackIPv6, port))
+	if err != nil {
+		if p.imdsHost6 != "" {
+			l4.Close()
+			return nil, errors.Wrapf(err, "failed to listen on %s", net.JoinHostPort(loopbackIPv6, port))
+		}
+		p.logger.Info("not listening on the IPv6 loopback address", "error", err.Error())
+		return []net.Listener{l4}, nil
+	}
+	return []net.Listener{l4, l6}, nil
+}
+
+// router returns the router of the proxy server
+func (p *proxy) router() *mux.Router {
+	rtr := mux.NewRouter()
+	rtr.PathPrefix(tokenPathPrefix).HandlerFunc(p.msiHandler)
+	rtr.PathPrefix(readyzPathPrefix).HandlerFunc(p.readyzHandler)
+	rtr.PathPrefix(healthzPathPrefix).HandlerFunc(p.healthzHandler)
+	rtr.PathPrefix(tokensPathPrefix).HandlerFunc(p.tokensHandler)
+	if p.identityHeader != "" {
+		p.registerAppServiceRoutes(rtr)
+	}
+	if p.arc != nil {
+		p.registerArcRoutes(rtr)
+	}
+	rtr.PathPrefix("/").HandlerFunc(p.defaultPathHandler)
+	return rtr
+}
+
 func (p *proxy) msiHandler(w http.ResponseWriter, r *http.Request) {
 	p.logger.Info("received token request", "method", r.Method, "uri", r.RequestURI)
 	w.Header().Set("Server", userAgent)
-	clientID, resource := parseTokenRequest(r)
-	// if clientID not found in request, then we default to the AZURE_CLIENT_ID if present.
-	// This is to keep consistent with the current behavior in pod identity v1 where we
-	// default the client id to the one in AzureIdentity.
-	if clientID == "" {
-		p.logger.Info("client_id not found in request, defaulting to AZURE_CLIENT_ID", "method", r.Method, "uri", r.RequestURI)
-		clientID = os.Getenv(webhook.AzureClientIDEnvVar)
-	}
+	req := parseTokenRequest(r)
 
-	if clientID == "" {
-		http.Error(w, "The client_id parameter or AZURE_CLIENT_ID environment variable must be set", http.StatusBadRequest)
+	timeStart := time.Now()
+	outcome := outcomeBadRequest
+	defer func() {
+		reportTokenRequest(r.Context(), outcome, req.resource, time.Since(timeStart))
+	}()
+
+	// IMDS rejects requests without the Metadata header to protect against SSRF
+	if !strings.EqualFold(r.Header.Get("Metadata"), "true") {
+		writeIMDSError(w, http.StatusBadRequest, errInvalidRequest, descMetadataHeaderMissing)
+		return
+	}
+	// Cloud Shell token requests don't send the api-version
+	if !req.cloudShell || req.apiVersion != "" {
+		if err := validateAPIVersion(req.apiVersion); err != nil {
+			writeIMDSError(w, http.StatusBadRequest, errInvalidRequest, err.Error())
+			return
+		}
+	}
+	if req.resource == "" {
+		writeIMDSError(w, http.StatusBadRequest, errInvalidRequest, descResourceMissing)
 		return
 	}
-	if resource == "" {
-		http.Error(w, "The resource parameter is required.", http.StatusBadRequest)
+	clientID, err := p.resolveClientID(req)
+	if err != nil {
+		writeIMDSError(w, http.StatusBadRequest, errInvalidRequest, err.Error())
 		return
 	}
 
-	cred, err := p.getOrCreateCred(clientID, p.tenantID)
+	outcome = outcomeError
+	cred, err := p.getOrCreateCred(r.Context(), clientID, p.tenantID)
 	if err != nil {
 		p.logger.Error("failed to get or create credential", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeIMDSError(w, http.StatusInternalServerError, errUnknown, err.Error())
 		return
 	}
 
-	// get the token using the azidentity
-	token, err := doTokenRequest(r.Context(), resource, cred)
+	// get the token from the token cache or using the azidentity
+	token, err := p.doTokenRequest(r.Context(), clientID, req.resource, req.claims, cred)
 	if err != nil {
 		p.logger.Error("failed to get token", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeIMDSError(w, tokenErrorStatusCode(err), errUnknown, err.Error())
 		return
 	}
+	outcome = outcomeSuccess
 	p.logger.Info("successfully acquired token", "method", r.Method, "uri", r.RequestURI)
 	// write the token to the response
 	w.Header().Set("Content-Type", "application/json")
@@ -158,12 +314,55 @@ func (p *proxy) msiHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (p *proxy) getOrCreateCred(clientID, tenantID string) (*azidentity.WorkloadIdentityCredential, error) {
+// resolveClientID returns the client ID of the identity in the token request.
+// The object_id and mi_res_id parameters are resolved using the identity map.
+// AZURE_CLIENT_ID is returned if the request doesn't specify an identity.
+func (p *proxy) resolveClientID(req tokenRequest) (string, error) {
+	n := 0
+	for _, id := range []string{req.clientID, req.objectID, req.resourceID} {
+		if id != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return "", errors.New(descMultipleIdentities)
+	}
+
+	switch {
+	case req.objectID != "":
+		clientID, ok := p.identities.ClientIDForObjectID(req.objectID)
+		if !ok {
+			return "", errors.New(descIdentityNotFound)
+		}
+		return clientID, nil
+	case req.resourceID != "":
+		clientID, ok := p.identities.ClientIDForResourceID(req.resourceID)
+		if !ok {
+			return "", errors.New(descIdentityNotFound)
+		}
+		return clientID, nil
+	case req.clientID != "":
+		return req.clientID, nil
+	}
+
+	// if clientID not found in request, then we default to the AZURE_CLIENT_ID if present.
+	// This is to keep consistent with the current behavior in pod identity v1 where we
+	// default the client id to the one in AzureIdentity.
+	p.logger.Info("client_id not found in request, defaulting to AZURE_CLIENT_ID")
+	clientID := os.Getenv(webhook.AzureClientIDEnvVar)
+	if clientID == "" {
+		return "", errors.New(descClientIDMissing)
+	}
+	return clientID, nil
+}
+
+func (p *proxy) getOrCreateCred(ctx context.Context, clientID, tenantID string) (*azidentity.WorkloadIdentityCredential, error) {
 	key := wiCredCacheKey{
 		clientID: clientID,
 		tenantID: tenantID,
 	}
 	cred, ok := p.credCache.Get(key)
+	reportCredCacheLookup(ctx, ok)
 	if ok {
 		return cred, nil
 	}
@@ -190,33 +389,55 @@ func (p *proxy) getOrCreateCred(clientID, tenantID string) (*azidentity.Workload
 	return val.(*azidentity.WorkloadIdentityCredential), nil
 }
 
+// defaultPathHandler applies the passthrough policy to the requests that are not token requests
 func (p *proxy) defaultPathHandler(w http.ResponseWriter, r *http.Request) {
-	client := &http.Client{}
-	req, err := http.NewRequest(r.Method, r.URL.String(), r.Body)
+	if p.strict && hasPathPrefix(r.URL.Path, identityPathPrefix) {
+		p.strictIdentityHandler(w, r)
+		return
+	}
+
+	rule := p.passthrough.match(r.URL.Path)
+	switch rule.Action {
+	case PassthroughDeny:
+		p.logger.Info("blocked IMDS request by passthrough policy", "method", r.Method, "uri", r.RequestURI, "pathPrefix", rule.PathPrefix)
+		writeIMDSError(w, http.StatusForbidden, errForbidden, fmt.Sprintf(descPathBlocked, r.URL.Path, rule.PathPrefix))
+		return
+	case PassthroughStub:
+		p.logger.Info("stubbed IMDS request by passthrough policy", "method", r.Method, "uri", r.RequestURI, "pathPrefix", rule.PathPrefix)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rule.StatusCode)
+		_, _ = io.WriteString(w, rule.Body)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, r.URL.String(), r.Body)
 	if err != nil || req == nil {
 		p.logger.Error("failed to create new request", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	host := fmt.Sprintf("%s:%d", metadataIPAddress, metadataPort)
-	req.Host = host
-	req.URL.Host = host
+	imdsHost := p.imdsHostFor(r)
+	req.Host = imdsHost
+	req.URL.Host = imdsHost
 	req.URL.Scheme = "http"
 	if r.Header != nil {
 		copyHeader(req.Header, r.Header)
 	}
-	resp, err := client.Do(req)
+	resp, err := p.imdsClient.Do(req)
 	if err != nil {
 		p.logger.Error("failed executing request", err, "url", req.URL.String())
+		reportIMDSPassthrough(r.Context(), 0)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
+	reportIMDSPassthrough(r.Context(), resp.StatusCode)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		p.logger.Error("failed to read response body", err, "url", req.URL.String())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	p.logger.Info("received response from IMDS", "method", r.Method, "uri", r.RequestURI, "status", resp.StatusCode)
 
@@ -225,15 +446,77 @@ func (p *proxy) defaultPathHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(body)
 }
 
+// imdsHostFor returns the host of the metadata endpoint to forward the request to. Requests received on
+// the IPv6 loopback address were sent to the IPv6 metadata endpoint, so they are forwarded to it if it's set.
+func (p *proxy) imdsHostFor(r *http.Request) string {
+	if p.imdsHost6 == "" {
+		return p.imdsHost
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr); ok && addr.IP.To4() == nil {
+		return p.imdsHost6
+	}
+	return p.imdsHost
+}
+
+// imdsHost6 returns the host of the IPv6 metadata endpoint, or an empty string if the IPv6 address is not set
+func imdsHost6(metadataIPv6 string) string {
+	if metadataIPv6 == "" {
+		return ""
+	}
+	return net.JoinHostPort(metadataIPv6, strconv.Itoa(metadataPort))
+}
+
+// strictIdentityHandler serves the requests to the IMDS identity endpoints that didn't match the token route,
+// such as token requests with unusual casing. Token requests are served by the proxy and all other requests
+// are rejected, so that the identity of the node can't be used through IMDS.
+func (p *proxy) strictIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if hasPathPrefix(r.URL.Path, strictTokenPathPrefix) {
+		p.msiHandler(w, r)
+		return
+	}
+	p.logger.Info("blocked IMDS identity request in strict mode", "method", r.Method, "uri", r.RequestURI)
+	writeIMDSError(w, http.StatusForbidden, errForbidden, fmt.Sprintf(descIdentityPathBlocked, r.URL.Path))
+}
+
 func (p *proxy) readyzHandler(w http.ResponseWriter, r *http.Request) {
 	p.logger.Info("received readyz request", "method", r.Method, "uri", r.RequestURI)
 	fmt.Fprintf(w, "ok")
 }
 
-func doTokenRequest(ctx context.Context, resource string, cred *azidentity.WorkloadIdentityCredential) (*token, error) {
-	result, err := cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{getScope(resource)},
-	})
+// healthzHandler reports the proxy as healthy if it can read a federated token that has not expired,
+// as tokens can't be acquired otherwise
+func (p *proxy) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	p.logger.Info("received healthz request", "method", r.Method, "uri", r.RequestURI)
+	if err := checkFederatedToken(p.tokenFile, time.Now()); err != nil {
+		p.logger.Error("health check failed", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "ok")
+}
+
+// tokensHandler lists the metadata of the cached tokens without the tokens
+func (p *proxy) tokensHandler(w http.ResponseWriter, r *http.Request) {
+	p.logger.Info("received tokens request", "method", r.Method, "uri", r.RequestURI)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.tokenCache.List()); err != nil {
+		p.logger.Error("failed to encode cached tokens", err)
+	}
+}
+
+func (p *proxy) doTokenRequest(ctx context.Context, clientID, resource, claims string, cred azcore.TokenCredential) (*token, error) {
+	var result azcore.AccessToken
+	var err error
+	if claims != "" {
+		// tokens for a claims challenge are specific to the challenge, so they bypass the token cache
+		result, err = cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{getScope(resource)}, Claims: claims})
+	} else {
+		result, err = p.tokenCache.GetToken(ctx, tokenCacheKey{
+			clientID: clientID,
+			tenantID: p.tenantID,
+			scope:    getScope(resource),
+		}, cred)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -251,14 +534,65 @@ func doTokenRequest(ctx context.Context, resource string, cred *azidentity.Workl
 	}, nil
 }
 
-func parseTokenRequest(r *http.Request) (string, string) {
-	var clientID, resource string
+func parseTokenRequest(r *http.Request) tokenRequest {
+	var req tokenRequest
 	if r.URL != nil {
 		// Query always return a non-nil map
-		clientID = r.URL.Query().Get("client_id")
-		resource = r.URL.Query().Get("resource")
+		query := r.URL.Query()
+		req.clientID = query.Get("client_id")
+		req.objectID = query.Get("object_id")
+		// msi_res_id is the older name of mi_res_id
+		req.resourceID = query.Get("mi_res_id")
+		if req.resourceID == "" {
+			req.resourceID = query.Get("msi_res_id")
+		}
+		req.resource = query.Get("resource")
+		req.apiVersion = query.Get("api-version")
+		req.claims = query.Get("claims")
+	}
+
+	// The Azure SDKs send a Cloud Shell token request when MSI_ENDPOINT is set without MSI_SECRET,
+	// which is the case in the env proxy sidecar mode. It's a POST with the resource form-encoded
+	// in the body. Only the default identity of the pod can be requested this way.
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err == nil {
+			req.cloudShell = true
+			if resource := r.PostForm.Get("resource"); resource != "" {
+				req.resource = resource
+			}
+		}
+	}
+	return req
+}
+
+// validateAPIVersion validates the api-version of the token request
+func validateAPIVersion(apiVersion string) error {
+	if apiVersion == "" {
+		return errors.New(descAPIVersionMissing)
+	}
+	if _, err := time.Parse(time.DateOnly, apiVersion); err != nil || apiVersion < minIdentityAPIVersion {
+		return errors.Errorf(descAPIVersionInvalid, apiVersion, minIdentityAPIVersion)
+	}
+	return nil
+}
+
+// writeIMDSError writes an IMDS error response with the status code
+func writeIMDSError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(imdsError{Error: code, ErrorDescription: description})
+}
+
+// tokenErrorStatusCode returns the status code of the token response for the error.
+// Errors returned by Microsoft Entra ID for the request are returned with the same
+// status code, all other errors are internal errors.
+func tokenErrorStatusCode(err error) int {
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) && authErr.RawResponse != nil &&
+		authErr.RawResponse.StatusCode >= http.StatusBadRequest && authErr.RawResponse.StatusCode < http.StatusInternalServerError {
+		return authErr.RawResponse.StatusCode
 	}
-	return clientID, resource
+	return http.StatusInternalServerError
 }
 
 func copyHeader(dst, src http.Header) {
@@ -1,14 +1,21 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/gorilla/mux"
 	"monis.app/mlog"
@@ -26,6 +33,9 @@ func setup() {
 	server = httptest.NewServer(rtr)
 
 	os.Setenv(webhook.AzureTenantIDEnvVar, "tenant_id")
+	if err := registerMetrics(); err != nil {
+		panic(err)
+	}
 }
 
 func teardown() {
@@ -35,23 +45,60 @@ func teardown() {
 }
 
 func TestProxy_MSIHandler(t *testing.T) {
+	identities, err := ParseIdentityMap([]byte(`[{"clientID": "client_id", "objectID": "object_id"}]`))
+	if err != nil {
+		t.Fatalf("failed to parse identity map: %v", err)
+	}
+
 	tests := []struct {
 		name               string
 		path               string
+		noMetadataHeader   bool
 		expectedStatusCode int
 		expectedBody       string
 	}{
+		{
+			name:               "metadata header is missing",
+			path:               `/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fvault.azure.net%2F&client_id=client_id`,
+			noMetadataHeader:   true,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Required metadata header not specified"}` + "\n",
+		},
+		{
+			name:               "api-version is missing",
+			path:               `/metadata/identity/oauth2/token?resource=https%3A%2F%2Fvault.azure.net%2F&client_id=client_id`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Required query variable 'api-version' is missing"}` + "\n",
+		},
+		{
+			name:               "api-version is invalid",
+			path:               `/metadata/identity/oauth2/token?api-version=2017-09-01&resource=https%3A%2F%2Fvault.azure.net%2F&client_id=client_id`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Invalid api-version 2017-09-01, the minimum supported api-version is 2018-02-01"}` + "\n",
+		},
 		{
 			name:               "client_id is missing",
 			path:               `/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fvault.azure.net%2F`,
 			expectedStatusCode: http.StatusBadRequest,
-			expectedBody:       "The client_id parameter or AZURE_CLIENT_ID environment variable must be set\n",
+			expectedBody:       `{"error":"invalid_request","error_description":"The client_id parameter or AZURE_CLIENT_ID environment variable must be set"}` + "\n",
 		},
 		{
 			name:               "resource is missing",
 			path:               `/metadata/identity/oauth2/token?api-version=2018-02-01&client_id=client_id`,
 			expectedStatusCode: http.StatusBadRequest,
-			expectedBody:       "The resource parameter is required.\n",
+			expectedBody:       `{"error":"invalid_request","error_description":"Required query variable 'resource' is missing"}` + "\n",
+		},
+		{
+			name:               "multiple identities",
+			path:               `/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fvault.azure.net%2F&client_id=client_id&object_id=object_id`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Only one of client_id, object_id or mi_res_id can be specified"}` + "\n",
+		},
+		{
+			name:               "mi_res_id not in identity map",
+			path:               `/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fvault.azure.net%2F&mi_res_id=%2Fsubscriptions%2Fsub%2FresourceGroups%2Frg%2Fproviders%2FMicrosoft.ManagedIdentity%2FuserAssignedIdentities%2Fid`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"invalid_request","error_description":"Identity not found"}` + "\n",
 		},
 	}
 
@@ -60,7 +107,7 @@ func TestProxy_MSIHandler(t *testing.T) {
 			setup()
 			defer teardown()
 
-			p := &proxy{logger: mlog.New()}
+			p := &proxy{logger: mlog.New(), identities: identities}
 			rtr.PathPrefix(tokenPathPrefix).HandlerFunc(p.msiHandler)
 			rtr.PathPrefix("/").HandlerFunc(p.defaultPathHandler)
 
@@ -68,6 +115,9 @@ func TestProxy_MSIHandler(t *testing.T) {
 			if err != nil {
 				t.Error(err)
 			}
+			if !test.noMetadataHeader {
+				req.Header.Set("Metadata", "true")
+			}
 
 			recorder := httptest.NewRecorder()
 			rtr.ServeHTTP(recorder, req)
@@ -82,6 +132,53 @@ func TestProxy_MSIHandler(t *testing.T) {
 	}
 }
 
+// TestProxy_MSIHandlerCloudShell gets a token from the proxy with the ManagedIdentityCredential of the
+// Azure SDK, which sends a Cloud Shell token request when MSI_ENDPOINT is set as in the env proxy sidecar mode.
+func TestProxy_MSIHandlerCloudShell(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("fake-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(webhook.AzureFederatedTokenFileEnvVar, tokenFile)
+	t.Setenv(webhook.AzureClientIDEnvVar, "client_id")
+	for _, env := range []string{webhook.IdentityEndpointEnvVar, webhook.IdentityHeaderEnvVar, webhook.MSISecretEnvVar, webhook.IMDSEndpointEnvVar} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is served from the token cache to avoid a request to Microsoft Entra ID
+	clock := &fakeClock{now: time.Now()}
+	p := &proxy{
+		tenantID:   "00000000-0000-0000-0000-000000000000",
+		logger:     mlog.New(),
+		credCache:  CreateWICredCache(),
+		tokenCache: newTestTokenCache(clock),
+	}
+	key := tokenCacheKey{clientID: "client_id", tenantID: p.tenantID, scope: "https://vault.azure.net/.default"}
+	if _, err := p.tokenCache.GetToken(context.Background(), key, &fakeCredential{now: clock.Now, lifetime: time.Hour}); err != nil {
+		t.Fatalf("failed to cache token: %v", err)
+	}
+
+	proxyServer := httptest.NewServer(p.router())
+	defer proxyServer.Close()
+	t.Setenv(webhook.MSIEndpointEnvVar, proxyServer.URL+webhook.IMDSTokenPath)
+
+	cred, err := azidentity.NewManagedIdentityCredential(nil)
+	if err != nil {
+		t.Fatalf("failed to create managed identity credential: %v", err)
+	}
+	tok, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}})
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	if !strings.HasPrefix(tok.Token, "https://vault.azure.net/.default-") {
+		t.Errorf("expected the cached token, got %s", tok.Token)
+	}
+}
+
 func TestRouterPathPrefix(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -154,16 +251,14 @@ func TestRouterPathPrefix(t *testing.T) {
 
 func TestParseTokenRequest(t *testing.T) {
 	tests := []struct {
-		name             string
-		req              *http.Request
-		expectedClientID string
-		expectedResource string
+		name     string
+		req      *http.Request
+		expected tokenRequest
 	}{
 		{
-			name:             "no query params",
-			req:              &http.Request{URL: &url.URL{Path: "/metadata/identity/oauth2/token/"}},
-			expectedClientID: "",
-			expectedResource: "",
+			name:     "no query params",
+			req:      &http.Request{URL: &url.URL{Path: "/metadata/identity/oauth2/token/"}},
+			expected: tokenRequest{},
 		},
 		{
 			name: "client_id query param set",
@@ -172,8 +267,7 @@ func TestParseTokenRequest(t *testing.T) {
 					RawQuery: "client_id=client_id",
 				},
 			},
-			expectedClientID: "client_id",
-			expectedResource: "",
+			expected: tokenRequest{clientID: "client_id"},
 		},
 		{
 			name: "resource query param set",
@@ -182,8 +276,7 @@ func TestParseTokenRequest(t *testing.T) {
 					RawQuery: "resource=resource",
 				},
 			},
-			expectedClientID: "",
-			expectedResource: "resource",
+			expected: tokenRequest{resource: "resource"},
 		},
 		{
 			name: "client_id query param set and resource query param set",
@@ -192,20 +285,159 @@ func TestParseTokenRequest(t *testing.T) {
 					RawQuery: "client_id=client_id&resource=resource",
 				},
 			},
+			expected: tokenRequest{clientID: "client_id", resource: "resource"},
+		},
+		{
+			name: "object_id, api-version and claims query params set",
+			req: &http.Request{
+				URL: &url.URL{
+					RawQuery: "object_id=object_id&resource=resource&api-version=2018-02-01&claims=claims",
+				},
+			},
+			expected: tokenRequest{objectID: "object_id", resource: "resource", apiVersion: "2018-02-01", claims: "claims"},
+		},
+		{
+			name: "mi_res_id query param set",
+			req: &http.Request{
+				URL: &url.URL{
+					RawQuery: "mi_res_id=mi_res_id&msi_res_id=msi_res_id",
+				},
+			},
+			expected: tokenRequest{resourceID: "mi_res_id"},
+		},
+		{
+			name: "msi_res_id query param set",
+			req: &http.Request{
+				URL: &url.URL{
+					RawQuery: "msi_res_id=msi_res_id",
+				},
+			},
+			expected: tokenRequest{resourceID: "msi_res_id"},
+		},
+		{
+			name: "cloud shell form-encoded resource",
+			req: &http.Request{
+				Method: http.MethodPost,
+				URL:    &url.URL{Path: "/metadata/identity/oauth2/token"},
+				Header: http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}},
+				Body:   io.NopCloser(strings.NewReader("resource=resource")),
+			},
+			expected: tokenRequest{resource: "resource", cloudShell: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := parseTokenRequest(test.req)
+			if req != test.expected {
+				t.Errorf("expected token request %+v, got %+v", test.expected, req)
+			}
+		})
+	}
+}
+
+func TestResolveClientID(t *testing.T) {
+	identities, err := ParseIdentityMap([]byte(`
+- clientID: client_id_1
+  objectID: object_id_1
+  resourceID: /subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id1
+- clientID: client_id_2
+  objectID: object_id_2
+`))
+	if err != nil {
+		t.Fatalf("failed to parse identity map: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		req              tokenRequest
+		envClientID      string
+		expectedClientID string
+		expectedErr      string
+	}{
+		{
+			name:        "no identity and AZURE_CLIENT_ID not set",
+			req:         tokenRequest{},
+			expectedErr: descClientIDMissing,
+		},
+		{
+			name:             "no identity defaults to AZURE_CLIENT_ID",
+			req:              tokenRequest{},
+			envClientID:      "env_client_id",
+			expectedClientID: "env_client_id",
+		},
+		{
+			name:             "client_id takes precedence over AZURE_CLIENT_ID",
+			req:              tokenRequest{clientID: "client_id"},
+			envClientID:      "env_client_id",
 			expectedClientID: "client_id",
-			expectedResource: "resource",
+		},
+		{
+			name:             "client_id",
+			req:              tokenRequest{clientID: "client_id"},
+			expectedClientID: "client_id",
+		},
+		{
+			name:             "object_id",
+			req:              tokenRequest{objectID: "OBJECT_ID_2"},
+			expectedClientID: "client_id_2",
+		},
+		{
+			name:             "mi_res_id",
+			req:              tokenRequest{resourceID: "/subscriptions/sub/resourcegroups/rg/providers/microsoft.managedidentity/userassignedidentities/id1"},
+			expectedClientID: "client_id_1",
+		},
+		{
+			name:        "object_id not found",
+			req:         tokenRequest{objectID: "object_id_3"},
+			expectedErr: descIdentityNotFound,
+		},
+		{
+			name:        "client_id and mi_res_id",
+			req:         tokenRequest{clientID: "client_id", resourceID: "id"},
+			expectedErr: descMultipleIdentities,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			req := test.req
-			clientID, resource := parseTokenRequest(req)
+			t.Setenv(webhook.AzureClientIDEnvVar, test.envClientID)
+
+			p := &proxy{logger: mlog.New(), identities: identities}
+			clientID, err := p.resolveClientID(test.req)
+			if test.expectedErr != "" {
+				if err == nil || err.Error() != test.expectedErr {
+					t.Fatalf("expected error %s, got %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if clientID != test.expectedClientID {
 				t.Errorf("expected clientID %s, got %s", test.expectedClientID, clientID)
 			}
-			if resource != test.expectedResource {
-				t.Errorf("expected resource %s, got %s", test.expectedResource, resource)
+		})
+	}
+}
+
+func TestValidateAPIVersion(t *testing.T) {
+	tests := []struct {
+		apiVersion string
+		wantErr    bool
+	}{
+		{apiVersion: "", wantErr: true},
+		{apiVersion: "2018-02-01", wantErr: false},
+		{apiVersion: "2019-08-01", wantErr: false},
+		{apiVersion: "2017-09-01", wantErr: true},
+		{apiVersion: "2018-02-01-preview", wantErr: true},
+		{apiVersion: "latest", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.apiVersion, func(t *testing.T) {
+			if err := validateAPIVersion(test.apiVersion); (err != nil) != test.wantErr {
+				t.Errorf("expected error: %v, got %v", test.wantErr, err)
 			}
 		})
 	}
@@ -259,6 +491,53 @@ func TestProxy_ReadyZHandler(t *testing.T) {
 	}
 }
 
+func TestProxy_HealthZHandler(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	valid := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		expiry *time.Time
+		code   int
+	}{
+		{
+			name:   "valid token",
+			expiry: &valid,
+			code:   http.StatusOK,
+		},
+		{
+			name:   "expired token",
+			expiry: &expired,
+			code:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setup()
+			defer teardown()
+
+			p := &proxy{
+				logger:    mlog.New(),
+				tokenFile: writeFederatedToken(t, t.TempDir(), test.expiry),
+			}
+			rtr.PathPrefix("/healthz").HandlerFunc(p.healthzHandler)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/healthz", nil)
+			if err != nil {
+				t.Error(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			rtr.ServeHTTP(recorder, req)
+			if recorder.Code != test.code {
+				t.Errorf("Expected code %d, got %d", test.code, recorder.Code)
+			}
+		})
+	}
+}
+
 func TestGetScope(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -295,12 +574,15 @@ func TestGetScope(t *testing.T) {
 func TestNewProxy(t *testing.T) {
 	testLogger := mlog.New()
 	credCache := CreateWICredCache()
+	tokenCache := NewTokenCache(testLogger)
+	identities := &IdentityMap{}
 
 	tests := []struct {
-		name        string
-		tenantID    string
-		expected    *proxy
-		expectedErr string
+		name         string
+		tenantID     string
+		metadataIPv6 string
+		expected     *proxy
+		expectedErr  string
 	}{
 		{
 			name:        "tenant id not set",
@@ -311,7 +593,19 @@ func TestNewProxy(t *testing.T) {
 		{
 			name:     "valid tenant id",
 			tenantID: "tenant_id",
-			expected: &proxy{logger: testLogger, tenantID: "tenant_id", port: 8000, credCache: credCache},
+			expected: &proxy{logger: testLogger, tenantID: "tenant_id", port: 8000, credCache: credCache, tokenCache: tokenCache, identities: identities, passthrough: DefaultPassthroughPolicy(), imdsHost: "169.254.169.254:80"},
+		},
+		{
+			name:         "metadata IPv6 set",
+			tenantID:     "tenant_id",
+			metadataIPv6: "fd00:ec2::254",
+			expected:     &proxy{logger: testLogger, tenantID: "tenant_id", port: 8000, credCache: credCache, tokenCache: tokenCache, identities: identities, passthrough: DefaultPassthroughPolicy(), imdsHost: "169.254.169.254:80", imdsHost6: "[fd00:ec2::254]:80"},
+		},
+		{
+			name:         "invalid metadata IPv6",
+			tenantID:     "tenant_id",
+			metadataIPv6: "169.254.169.254",
+			expectedErr:  `invalid METADATA_IPV6 "169.254.169.254", must be an IPv6 address`,
 		},
 	}
 
@@ -319,16 +613,24 @@ func TestNewProxy(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			os.Setenv(webhook.AzureTenantIDEnvVar, test.tenantID)
 			defer os.Unsetenv(webhook.AzureTenantIDEnvVar)
+			t.Setenv(webhook.MetadataIPv6EnvVar, test.metadataIPv6)
 
 			defer os.Unsetenv(webhook.AzureAuthorityHostEnvVar)
 
-			got, err := NewProxy(8000, testLogger, credCache)
+			got, err := NewProxy(8000, testLogger, credCache, tokenCache, identities, "", nil, false)
 			if err != nil && err.Error() != test.expectedErr {
 				t.Errorf("expected error %s, got %s", test.expectedErr, err.Error())
 			}
 			if err == nil && test.expectedErr != "" {
 				t.Errorf("expected error %s, got none", test.expectedErr)
 			}
+			if p, ok := got.(*proxy); ok {
+				if p.imdsClient == nil || p.imdsClient.Timeout != defaultPassthroughTimeout {
+					t.Errorf("expected IMDS client with timeout %s, got %v", defaultPassthroughTimeout, p.imdsClient)
+				}
+				// the IMDS client has its own transport
+				p.imdsClient = nil
+			}
 			if test.expected != nil && !reflect.DeepEqual(got, test.expected) {
 				t.Errorf("expected proxy %v, got %v", test.expected, got)
 			}
@@ -336,6 +638,67 @@ func TestNewProxy(t *testing.T) {
 	}
 }
 
+func TestDoTokenRequestClaims(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cred := &fakeCredential{now: clock.Now, lifetime: time.Hour}
+	p := &proxy{tenantID: "tenant_id", tokenCache: newTestTokenCache(clock)}
+
+	if _, err := p.doTokenRequest(context.Background(), "client_id", "https://vault.azure.net", "", cred); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// tokens for a claims challenge are not served from or added to the token cache
+	tok, err := p.doTokenRequest(context.Background(), "client_id", "https://vault.azure.net", `{"access_token":{"nbf":{"essential":true}}}`, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.getCalls() != 2 || cred.claims != `{"access_token":{"nbf":{"essential":true}}}` {
+		t.Errorf("expected a token request with the claims, got %d token requests with claims %q", cred.getCalls(), cred.claims)
+	}
+	if tok.Resource != "https://vault.azure.net" || tok.Type != "Bearer" {
+		t.Errorf("unexpected token %+v", tok)
+	}
+	if infos := p.tokenCache.List(); len(infos) != 1 || infos[0].Hits != 0 {
+		t.Errorf("expected only the token without claims to be cached, got %+v", infos)
+	}
+}
+
+func TestTokenErrorStatusCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "error without response",
+			err:      errors.New("failed to read token file"),
+			expected: http.StatusInternalServerError,
+		},
+		{
+			name:     "authentication failed with bad request",
+			err:      &azidentity.AuthenticationFailedError{RawResponse: &http.Response{StatusCode: http.StatusBadRequest}},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name:     "authentication failed with unauthorized",
+			err:      &azidentity.AuthenticationFailedError{RawResponse: &http.Response{StatusCode: http.StatusUnauthorized}},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "authentication failed with service unavailable",
+			err:      &azidentity.AuthenticationFailedError{RawResponse: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+			expected: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenErrorStatusCode(test.err); got != test.expected {
+				t.Errorf("expected status code %d, got %d", test.expected, got)
+			}
+		})
+	}
+}
+
 func TestGetOrCreateCredSingleFlight(t *testing.T) {
 	// Set up a temporary token file so NewWorkloadIdentityCredential succeeds
 	tokenFile, err := os.CreateTemp("", "token")
@@ -351,6 +714,10 @@ func TestGetOrCreateCredSingleFlight(t *testing.T) {
 	t.Setenv(webhook.AzureFederatedTokenFileEnvVar, tokenFile.Name())
 	t.Setenv(webhook.AzureTenantIDEnvVar, "00000000-0000-0000-0000-000000000000")
 
+	if err := registerMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
 	p := &proxy{
 		credCache: CreateWICredCache(),
 		logger:    mlog.New(),
@@ -365,7 +732,7 @@ func TestGetOrCreateCredSingleFlight(t *testing.T) {
 	for i := 0; i < goroutines; i++ {
 		go func() {
 			<-start
-			cred, err := p.getOrCreateCred("client_id", "00000000-0000-0000-0000-000000000000")
+			cred, err := p.getOrCreateCred(context.Background(), "client_id", "00000000-0000-0000-0000-000000000000")
 			errs <- err
 			creds <- cred
 		}()
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	tokenRequestDurationMetricName = "azwi_proxy_token_request"
+	credCacheMetricName            = "azwi_proxy_cred_cache"
+	imdsPassthroughMetricName      = "azwi_proxy_imds_passthrough"
+
+	outcomeKey  = "outcome"
+	resourceKey = "resource"
+	resultKey   = "result"
+	statusKey   = "status_code"
+
+	// outcomeSuccess is the outcome of a token request that returned a token
+	outcomeSuccess = "success"
+	// outcomeBadRequest is the outcome of a token request with missing or invalid parameters
+	outcomeBadRequest = "bad_request"
+	// outcomeError is the outcome of a token request that failed to acquire a token
+	outcomeError = "error"
+	// outcomeUnauthorized is the outcome of a token request without a valid secret header
+	outcomeUnauthorized = "unauthorized"
+
+	// resourceOther is the resource label of the token requests for resources that are not well known
+	resourceOther = "other"
+)
+
+var (
+	tokenReq        metric.Float64Histogram
+	credCache       metric.Int64Counter
+	imdsPassthrough metric.Int64Counter
+	// if service.name is not specified, the default is "unknown_service:<exe name>"
+	// xref: https://opentelemetry.io/docs/reference/specification/resource/semantic_conventions/#service
+	labels = []attribute.KeyValue{attribute.String("service.name", "proxy")}
+
+	// knownResources are the well-known resources reported in the resource label. The resource is
+	// set by the client, so the other resources are reported as "other" to bound the number of series.
+	knownResources = map[string]bool{
+		"https://management.azure.com":              true,
+		"https://management.core.windows.net":       true,
+		"https://vault.azure.net":                   true,
+		"https://storage.azure.com":                 true,
+		"https://database.windows.net":              true,
+		"https://ossrdbms-aad.database.windows.net": true,
+		"https://cosmos.azure.com":                  true,
+		"https://redis.azure.com":                   true,
+		"https://eventhubs.azure.net":               true,
+		"https://servicebus.azure.net":              true,
+		"https://graph.microsoft.com":               true,
+		"https://cognitiveservices.azure.com":       true,
+		"https://monitor.azure.com":                 true,
+		"https://api.loganalytics.io":               true,
+		"https://azconfig.io":                       true,
+		"https://digitaltwins.azure.net":            true,
+		// the server application of the AKS-managed Microsoft Entra integration
+		"6dae42f8-4368-4678-94ff-3960e28e3630": true,
+	}
+)
+
+func registerMetrics() error {
+	var err error
+	meter := otel.Meter("proxy")
+
+	if tokenReq, err = meter.Float64Histogram(
+		tokenRequestDurationMetricName,
+		metric.WithDescription("Distribution of how long it took for the proxy to serve a token request")); err != nil {
+		return err
+	}
+	if credCache, err = meter.Int64Counter(
+		credCacheMetricName,
+		metric.WithDescription("Number of credential cache lookups in the proxy")); err != nil {
+		return err
+	}
+	imdsPassthrough, err = meter.Int64Counter(
+		imdsPassthroughMetricName,
+		metric.WithDescription("Number of requests the proxy passed through to IMDS"))
+
+	return err
+}
+
+// reportTokenRequest reports the token request duration for the given outcome and resource.
+func reportTokenRequest(ctx context.Context, outcome, resource string, duration time.Duration) {
+	l := append(labels, attribute.String(outcomeKey, outcome), attribute.String(resourceKey, resourceLabel(resource)))
+	tokenReq.Record(ctx, duration.Seconds(), metric.WithAttributes(l...))
+}
+
+// reportCredCacheLookup reports a credential cache hit or miss.
+func reportCredCacheLookup(ctx context.Context, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	l := append(labels, attribute.String(resultKey, result))
+	credCache.Add(ctx, 1, metric.WithAttributes(l...))
+}
+
+// reportIMDSPassthrough reports a request passed through to IMDS with the status code of the response.
+// A status code of 0 means no response was received from IMDS.
+func reportIMDSPassthrough(ctx context.Context, statusCode int) {
+	l := append(labels, attribute.Int(statusKey, statusCode))
+	imdsPassthrough.Add(ctx, 1, metric.WithAttributes(l...))
+}
+
+// resourceLabel returns the resource label of a token request for the resource, which is the resource
+// without the trailing slash or .default suffix if it is well known, or "other".
+func resourceLabel(resource string) string {
+	resource = strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(resource), "/.default"), "/")
+	if knownResources[resource] {
+		return resource
+	}
+	return resourceOther
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"monis.app/mlog"
+
+	"github.com/Azure/azure-workload-identity/pkg/webhook"
+)
+
+func setupTestMeterProvider(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	return reader
+}
+
+// collect returns the data points of the metric with the given name keyed by the attribute value of key
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string, key attribute.Key) map[string]uint64 {
+	t.Helper()
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	got := make(map[string]uint64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					v, _ := dp.Attributes.Value(key)
+					got[v.Emit()] += uint64(dp.Value) //nolint:gosec // counters are never negative
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					v, _ := dp.Attributes.Value(key)
+					got[v.Emit()] += dp.Count
+				}
+			}
+		}
+	}
+	return got
+}
+
+func TestReportTokenRequest(t *testing.T) {
+	reader := setupTestMeterProvider(t)
+
+	p := &proxy{logger: mlog.New()}
+	for _, path := range []string{
+		"/metadata/identity/oauth2/token?resource=https%3A%2F%2Fvault.azure.net",
+		"/metadata/identity/oauth2/token?client_id=client_id",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		p.msiHandler(httptest.NewRecorder(), req)
+	}
+	reportTokenRequest(context.Background(), outcomeSuccess, "https://vault.azure.net/", time.Second)
+	reportTokenRequest(context.Background(), outcomeSuccess, "https://example.com", time.Second)
+
+	got := collect(t, reader, tokenRequestDurationMetricName, outcomeKey)
+	if got[outcomeBadRequest] != 2 {
+		t.Errorf("expected 2 bad requests, got %d", got[outcomeBadRequest])
+	}
+	if got[outcomeSuccess] != 2 {
+		t.Errorf("expected 2 successful requests, got %d", got[outcomeSuccess])
+	}
+
+	got = collect(t, reader, tokenRequestDurationMetricName, resourceKey)
+	if got["https://vault.azure.net"] != 2 {
+		t.Errorf("expected 2 requests for https://vault.azure.net, got %d", got["https://vault.azure.net"])
+	}
+	if got[resourceOther] != 2 {
+		t.Errorf("expected 2 requests for other resources, got %d", got[resourceOther])
+	}
+}
+
+func TestReportCredCacheLookup(t *testing.T) {
+	reader := setupTestMeterProvider(t)
+
+	p := &proxy{
+		credCache: CreateWICredCache(),
+		logger:    mlog.New(),
+	}
+	t.Setenv(webhook.AzureFederatedTokenFileEnvVar, "/var/run/secrets/azure/tokens/azure-identity-token")
+	for i := 0; i < 3; i++ {
+		if _, err := p.getOrCreateCred(context.Background(), "client_id", "00000000-0000-0000-0000-000000000000"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	got := collect(t, reader, credCacheMetricName, resultKey)
+	if got["miss"] != 1 || got["hit"] != 2 {
+		t.Errorf("expected 1 miss and 2 hits, got %v", got)
+	}
+}
+
+func TestReportIMDSPassthrough(t *testing.T) {
+	reader := setupTestMeterProvider(t)
+
+	reportIMDSPassthrough(context.Background(), http.StatusOK)
+	reportIMDSPassthrough(context.Background(), http.StatusOK)
+	reportIMDSPassthrough(context.Background(), 0)
+
+	got := collect(t, reader, imdsPassthroughMetricName, statusKey)
+	if got["200"] != 2 || got["0"] != 1 {
+		t.Errorf("expected 2 passthrough requests with status 200 and 1 without response, got %v", got)
+	}
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/sync/singleflight"
+	"monis.app/mlog"
+)
+
+const (
+	// defaultTokenRefreshBefore is how long before ExpiresOn a token is refreshed
+	// when the token doesn't have a suggested RefreshOn time
+	defaultTokenRefreshBefore = 5 * time.Minute
+	// defaultTokenExpiryDelta is how long before ExpiresOn a cached token is no longer served
+	defaultTokenExpiryDelta = 30 * time.Second
+	// defaultTokenRefreshInterval is how often the cached tokens are checked for refresh
+	defaultTokenRefreshInterval = 30 * time.Second
+	// defaultTokenIdleTTL is how long a token is kept refreshed after it was last requested
+	defaultTokenIdleTTL = 24 * time.Hour
+	// defaultTokenRequestTimeout is the timeout of a token request shared by the concurrent requests for a token
+	defaultTokenRequestTimeout = 30 * time.Second
+)
+
+type tokenCacheKey struct {
+	clientID string
+	tenantID string
+	scope    string
+}
+
+// cachedToken is a token in the TokenCache along with the credential used to refresh it
+type cachedToken struct {
+	cred        azcore.TokenCredential
+	token       azcore.AccessToken
+	refreshOn   time.Time
+	lastRefresh time.Time
+	lastAccess  time.Time
+	lastErr     error
+	hits        int64
+}
+
+// CachedTokenInfo is the metadata of a cached token. It never contains the token itself.
+type CachedTokenInfo struct {
+	ClientID    string    `json:"clientID"`
+	TenantID    string    `json:"tenantID"`
+	Scope       string    `json:"scope"`
+	ExpiresOn   time.Time `json:"expiresOn"`
+	RefreshOn   time.Time `json:"refreshOn"`
+	LastRefresh time.Time `json:"lastRefresh"`
+	LastAccess  time.Time `json:"lastAccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	Hits        int64     `json:"hits"`
+}
+
+// TokenCache caches access tokens by client ID, tenant ID and scope and refreshes
+// them in the background before they expire, so that requests for a cached token
+// never block on Entra ID.
+type TokenCache struct {
+	mu      sync.Mutex
+	entries map[tokenCacheKey]*cachedToken
+	group   singleflight.Group
+	logger  mlog.Logger
+
+	refreshBefore   time.Duration
+	expiryDelta     time.Duration
+	refreshInterval time.Duration
+	idleTTL         time.Duration
+	// now is used to get the current time and can be replaced in tests
+	now func() time.Time
+}
+
+// NewTokenCache returns an empty token cache
+func NewTokenCache(logger mlog.Logger) *TokenCache {
+	return &TokenCache{
+		entries:         make(map[tokenCacheKey]*cachedToken),
+		logger:          logger,
+		refreshBefore:   defaultTokenRefreshBefore,
+		expiryDelta:     defaultTokenExpiryDelta,
+		refreshInterval: defaultTokenRefreshInterval,
+		idleTTL:         defaultTokenIdleTTL,
+		now:             time.Now,
+	}
+}
+
+// GetToken returns the cached token for the key if it's still valid, otherwise it
+// acquires a new token with the credential and caches it
+func (c *TokenCache) GetToken(ctx context.Context, key tokenCacheKey, cred azcore.TokenCredential) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && c.valid(entry) {
+		entry.hits++
+		entry.lastAccess = c.now()
+		token := entry.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	c.mu.Unlock()
+
+	// the token request is shared by the concurrent requests for the token, so it is not canceled
+	// with the context of the request that started it. The token is still cached if it's canceled.
+	ch := c.group.DoChan(key.clientID+"\x00"+key.tenantID+"\x00"+key.scope, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultTokenRequestTimeout)
+		defer cancel()
+		return c.refresh(ctx, key, cred, true)
+	})
+	select {
+	case <-ctx.Done():
+		return azcore.AccessToken{}, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return azcore.AccessToken{}, res.Err
+		}
+		return res.Val.(azcore.AccessToken), nil
+	}
+}
+
+// Run refreshes the cached tokens in the background until the context is done
+func (c *TokenCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refreshAll(ctx)
+		}
+	}
+}
+
+// List returns the metadata of the cached tokens sorted by client ID, tenant ID and scope
+func (c *TokenCache) List() []CachedTokenInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos := make([]CachedTokenInfo, 0, len(c.entries))
+	for key, entry := range c.entries {
+		info := CachedTokenInfo{
+			ClientID:    key.clientID,
+			TenantID:    key.tenantID,
+			Scope:       key.scope,
+			ExpiresOn:   entry.token.ExpiresOn,
+			RefreshOn:   entry.refreshOn,
+			LastRefresh: entry.lastRefresh,
+			LastAccess:  entry.lastAccess,
+			Hits:        entry.hits,
+		}
+		if entry.lastErr != nil {
+			info.LastError = entry.lastErr.Error()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ClientID != infos[j].ClientID {
+			return infos[i].ClientID < infos[j].ClientID
+		}
+		if infos[i].TenantID != infos[j].TenantID {
+			return infos[i].TenantID < infos[j].TenantID
+		}
+		return infos[i].Scope < infos[j].Scope
+	})
+	return infos
+}
+
+// refreshAll refreshes the tokens that are due for refresh and evicts
+// the tokens that have not been requested within the idle TTL
+func (c *TokenCache) refreshAll(ctx context.Context) {
+	type due struct {
+		key  tokenCacheKey
+		cred azcore.TokenCredential
+	}
+	var refresh []due
+
+	c.mu.Lock()
+	now := c.now()
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastAccess) > c.idleTTL {
+			delete(c.entries, key)
+			continue
+		}
+		if !now.Before(entry.refreshOn) {
+			refresh = append(refresh, due{key: key, cred: entry.cred})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, d := range refresh {
+		key := d.key
+		if _, err, _ := c.group.Do(key.clientID+"\x00"+key.tenantID+"\x00"+key.scope, func() (any, error) {
+			return c.refresh(ctx, key, d.cred, false)
+		}); err != nil {
+			// the cached token is still served until it expires, the refresh is retried on the next tick
+			c.logger.Error("failed to refresh token", err, "clientID", key.clientID, "scope", key.scope)
+		}
+	}
+}
+
+// refresh acquires a new token with the credential and stores it in the cache.
+// If the token can't be acquired, the error is recorded on the existing entry.
+// access is true when the refresh is done for a token request.
+func (c *TokenCache) refresh(ctx context.Context, key tokenCacheKey, cred azcore.TokenCredential, access bool) (azcore.AccessToken, error) {
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{key.scope}})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry, ok := c.entries[key]
+	if err != nil {
+		if ok {
+			entry.lastErr = err
+		}
+		return azcore.AccessToken{}, err
+	}
+	if !ok {
+		entry = &cachedToken{}
+		c.entries[key] = entry
+	}
+	entry.cred = cred
+	entry.token = token
+	entry.refreshOn = c.refreshOn(token)
+	entry.lastRefresh = now
+	entry.lastErr = nil
+	if access {
+		entry.lastAccess = now
+	}
+	return token, nil
+}
+
+// valid returns true if the cached token can still be served
+func (c *TokenCache) valid(entry *cachedToken) bool {
+	return c.now().Add(c.expiryDelta).Before(entry.token.ExpiresOn)
+}
+
+// refreshOn returns when the token should be refreshed
+func (c *TokenCache) refreshOn(token azcore.AccessToken) time.Time {
+	if !token.RefreshOn.IsZero() && token.RefreshOn.Before(token.ExpiresOn) {
+		return token.RefreshOn
+	}
+	return token.ExpiresOn.Add(-c.refreshBefore)
+}
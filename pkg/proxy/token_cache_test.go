@@ -0,0 +1,274 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"monis.app/mlog"
+)
+
+// fakeCredential returns tokens that expire after the lifetime and counts the token requests
+type fakeCredential struct {
+	mu       sync.Mutex
+	calls    int
+	now      func() time.Time
+	lifetime time.Duration
+	err      error
+	// claims is the claims of the last token request
+	claims string
+}
+
+func (f *fakeCredential) GetToken(_ context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.claims = opts.Claims
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	return azcore.AccessToken{
+		Token:     strings.Join(opts.Scopes, ",") + "-" + f.now().Format(time.RFC3339),
+		ExpiresOn: f.now().Add(f.lifetime),
+	}, nil
+}
+
+func (f *fakeCredential) getCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestTokenCache(clock *fakeClock) *TokenCache {
+	c := NewTokenCache(mlog.New())
+	c.now = clock.Now
+	return c
+}
+
+func TestTokenCacheGetToken(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cred := &fakeCredential{now: clock.Now, lifetime: time.Hour}
+	c := newTestTokenCache(clock)
+	key := tokenCacheKey{clientID: "client_id", tenantID: "tenant_id", scope: "https://vault.azure.net/.default"}
+
+	first, err := c.GetToken(context.Background(), key, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// served from the cache
+	clock.Advance(30 * time.Minute)
+	second, err := c.GetToken(context.Background(), key, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Token != second.Token || cred.getCalls() != 1 {
+		t.Errorf("expected token to be served from the cache, got %d token requests", cred.getCalls())
+	}
+
+	// a different scope is cached separately
+	otherKey := key
+	otherKey.scope = "https://storage.azure.com/.default"
+	if _, err := c.GetToken(context.Background(), otherKey, cred); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cred.getCalls() != 2 {
+		t.Errorf("expected 2 token requests, got %d", cred.getCalls())
+	}
+
+	// expired tokens are not served
+	clock.Advance(30 * time.Minute)
+	third, err := c.GetToken(context.Background(), key, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if third.Token == first.Token || cred.getCalls() != 3 {
+		t.Errorf("expected a new token after expiry, got %d token requests", cred.getCalls())
+	}
+}
+
+// blockingCredential blocks the token requests until it's released
+type blockingCredential struct {
+	started  chan struct{}
+	released chan struct{}
+	// err is the error of the context of the token request when it's released
+	err error
+}
+
+func (b *blockingCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	close(b.started)
+	<-b.released
+	b.err = ctx.Err()
+	return azcore.AccessToken{Token: "token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTokenCacheGetTokenCanceled(t *testing.T) {
+	c := NewTokenCache(mlog.New())
+	cred := &blockingCredential{started: make(chan struct{}), released: make(chan struct{})}
+	key := tokenCacheKey{clientID: "client_id", tenantID: "tenant_id", scope: "https://vault.azure.net/.default"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.GetToken(ctx, key, cred)
+		errCh <- err
+	}()
+	<-cred.started
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// the token request is not canceled with the request that started it and the token is cached
+	close(cred.released)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.List()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the token to be cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cred.err != nil {
+		t.Errorf("expected the token request not to be canceled, got %v", cred.err)
+	}
+	token, err := c.GetToken(context.Background(), key, cred)
+	if err != nil || token.Token != "token" {
+		t.Errorf("expected the cached token, got %q, %v", token.Token, err)
+	}
+}
+
+func TestTokenCacheGetTokenError(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cred := &fakeCredential{now: clock.Now, lifetime: time.Hour, err: errors.New("failed to get token")}
+	c := newTestTokenCache(clock)
+
+	if _, err := c.GetToken(context.Background(), tokenCacheKey{scope: "scope"}, cred); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if len(c.List()) != 0 {
+		t.Errorf("expected failed token requests not to be cached")
+	}
+}
+
+func TestTokenCacheRefreshAll(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cred := &fakeCredential{now: clock.Now, lifetime: time.Hour}
+	c := newTestTokenCache(clock)
+	key := tokenCacheKey{clientID: "client_id", tenantID: "tenant_id", scope: "scope"}
+
+	first, err := c.GetToken(context.Background(), key, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// not due for refresh yet
+	clock.Advance(time.Hour - defaultTokenRefreshBefore - time.Second)
+	c.refreshAll(context.Background())
+	if cred.getCalls() != 1 {
+		t.Fatalf("expected no refresh before refreshOn, got %d token requests", cred.getCalls())
+	}
+
+	// refreshed before ExpiresOn and the refreshed token is served without a token request
+	clock.Advance(time.Second)
+	c.refreshAll(context.Background())
+	if cred.getCalls() != 2 {
+		t.Fatalf("expected the token to be refreshed, got %d token requests", cred.getCalls())
+	}
+	refreshed, err := c.GetToken(context.Background(), key, cred)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refreshed.Token == first.Token || cred.getCalls() != 2 {
+		t.Errorf("expected the refreshed token to be served from the cache")
+	}
+
+	// a failed refresh is recorded and the cached token is still served
+	cred.err = errors.New("failed to get token")
+	clock.Advance(time.Hour - defaultTokenRefreshBefore)
+	c.refreshAll(context.Background())
+	infos := c.List()
+	if len(infos) != 1 || infos[0].LastError != "failed to get token" {
+		t.Fatalf("expected the refresh error to be recorded, got %+v", infos)
+	}
+	if _, err := c.GetToken(context.Background(), key, cred); err != nil {
+		t.Errorf("expected the cached token to be served, got error: %v", err)
+	}
+
+	// tokens that are not requested within the idle TTL are evicted
+	cred.err = nil
+	clock.Advance(defaultTokenIdleTTL + time.Second)
+	c.refreshAll(context.Background())
+	if len(c.List()) != 0 {
+		t.Errorf("expected idle token to be evicted")
+	}
+}
+
+func TestTokenCacheRefreshOn(t *testing.T) {
+	c := NewTokenCache(mlog.New())
+	expiresOn := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)
+
+	if got := c.refreshOn(azcore.AccessToken{ExpiresOn: expiresOn}); !got.Equal(expiresOn.Add(-defaultTokenRefreshBefore)) {
+		t.Errorf("expected refresh %s before expiry, got %s", defaultTokenRefreshBefore, got)
+	}
+	refreshOn := expiresOn.Add(-30 * time.Minute)
+	if got := c.refreshOn(azcore.AccessToken{ExpiresOn: expiresOn, RefreshOn: refreshOn}); !got.Equal(refreshOn) {
+		t.Errorf("expected suggested refresh time %s, got %s", refreshOn, got)
+	}
+}
+
+func TestProxy_TokensHandler(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cred := &fakeCredential{now: clock.Now, lifetime: time.Hour}
+	c := newTestTokenCache(clock)
+	for _, scope := range []string{"scope-b", "scope-a"} {
+		if _, err := c.GetToken(context.Background(), tokenCacheKey{clientID: "client_id", tenantID: "tenant_id", scope: scope}, cred); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	p := &proxy{logger: mlog.New(), tokenCache: c}
+	recorder := httptest.NewRecorder()
+	p.tokensHandler(recorder, httptest.NewRequest(http.MethodGet, tokensPathPrefix, nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "scope-a-2024") {
+		t.Errorf("expected the response to not contain the tokens, got %s", recorder.Body.String())
+	}
+	var infos []CachedTokenInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Scope != "scope-a" || infos[1].Scope != "scope-b" {
+		t.Errorf("expected 2 cached tokens sorted by scope, got %+v", infos)
+	}
+	if !infos[0].ExpiresOn.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("expected expiresOn %s, got %s", clock.Now().Add(time.Hour), infos[0].ExpiresOn)
+	}
+}
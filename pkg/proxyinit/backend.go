@@ -0,0 +1,201 @@
+package proxyinit
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"monis.app/mlog"
+)
+
+// Backend is the packet filtering framework used to program the redirect
+type Backend string
+
+const (
+	// BackendAuto detects the backend supported by the kernel and the image
+	BackendAuto Backend = "auto"
+	// BackendNFT programs the redirect with nft
+	BackendNFT Backend = "nft"
+	// BackendIPTablesNFT programs the redirect with iptables using the nf_tables kernel API
+	BackendIPTablesNFT Backend = "iptables-nft"
+	// BackendIPTablesLegacy programs the redirect with iptables using the legacy kernel API
+	BackendIPTablesLegacy Backend = "iptables-legacy"
+)
+
+// candidate is a binary that can program the redirect for the backend
+type candidate struct {
+	backend Backend
+	binary  string
+	// binary6 programs the IPv6 redirect if it's set, otherwise binary programs both IP families
+	binary6 string
+	// probe are the arguments of a command that only succeeds if the kernel supports the backend
+	probe []string
+}
+
+// candidates are the binaries that are detected, in order of preference. iptables is
+// the legacy binary in images that don't have the iptables-legacy alias.
+var candidates = []candidate{
+	{backend: BackendNFT, binary: "nft", probe: []string{"list", "tables"}},
+	{backend: BackendIPTablesNFT, binary: "iptables-nft", binary6: "ip6tables-nft", probe: []string{"-t", "nat", "-n", "-L", "OUTPUT"}},
+	{backend: BackendIPTablesLegacy, binary: "iptables-legacy", binary6: "ip6tables-legacy", probe: []string{"-t", "nat", "-n", "-L", "OUTPUT"}},
+	{backend: BackendIPTablesLegacy, binary: "iptables", binary6: "ip6tables", probe: []string{"-t", "nat", "-n", "-L", "OUTPUT"}},
+}
+
+// runner runs the commands that program the redirect and can be replaced in tests
+type runner interface {
+	lookPath(file string) (string, error)
+	run(ctx context.Context, stdin string, name string, args ...string) ([]byte, error)
+}
+
+// execRunner runs the commands with os/exec
+type execRunner struct{}
+
+func (execRunner) lookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (execRunner) run(ctx context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.Bytes(), errors.Wrapf(err, "failed to run %s %s: %s", name, strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// ParseBackend returns the backend with the name
+func ParseBackend(name string) (Backend, error) {
+	switch backend := Backend(name); backend {
+	case BackendAuto, BackendNFT, BackendIPTablesNFT, BackendIPTablesLegacy:
+		return backend, nil
+	default:
+		return "", errors.Errorf("unknown backend %q, must be one of %s, %s, %s or %s", name, BackendAuto, BackendNFT, BackendIPTablesNFT, BackendIPTablesLegacy)
+	}
+}
+
+// Setup programs the redirect of the traffic to the metadata endpoint to the proxy sidecar with the
+// backend. The backend is detected if it's BackendAuto. Setup can be run again, for example when the
+// container restarts, and replaces the redirect programmed by the previous run.
+func Setup(ctx context.Context, logger mlog.Logger, cfg Config, backend Backend) error {
+	return setup(ctx, logger, execRunner{}, cfg, backend)
+}
+
+// Cleanup removes the redirect programmed by Setup with the same config. With BackendAuto,
+// the redirect is removed from all the backends that are installed and supported by the kernel.
+func Cleanup(ctx context.Context, logger mlog.Logger, cfg Config, backend Backend) error {
+	return cleanup(ctx, logger, execRunner{}, cfg, backend)
+}
+
+func setup(ctx context.Context, logger mlog.Logger, r runner, cfg Config, backend Backend) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cs, err := selectCandidates(ctx, r, backend, cfg.MetadataIPv6 != "")
+	if err != nil {
+		return err
+	}
+	c := cs[0]
+	logger.Info("programming redirect to the proxy", "backend", c.backend, "binary", c.binary, "metadataIP", cfg.MetadataIP,
+		"metadataIPv6", cfg.MetadataIPv6, "metadataPort", cfg.MetadataPort, "proxyPort", cfg.ProxyPort, "proxyUID", cfg.ProxyUID)
+
+	var rules []byte
+	if c.backend == BackendNFT {
+		rules, err = applyNFT(ctx, r, c.binary, cfg)
+	} else {
+		for _, f := range cfg.families() {
+			var out []byte
+			if out, err = applyIPTables(ctx, r, c.binaryFor(f), cfg, f.metadataIP); err != nil {
+				break
+			}
+			rules = append(rules, out...)
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to program redirect with %s", c.backend)
+	}
+	logger.Info("programmed redirect to the proxy", "backend", c.backend, "rules", string(rules))
+	return nil
+}
+
+func cleanup(ctx context.Context, logger mlog.Logger, r runner, cfg Config, backend Backend) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	cs, err := selectCandidates(ctx, r, backend, cfg.MetadataIPv6 != "")
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		logger.Info("removing redirect to the proxy", "backend", c.backend, "binary", c.binary)
+		if c.backend == BackendNFT {
+			err = cleanupNFT(ctx, r, c.binary, cfg)
+		} else {
+			for _, f := range cfg.families() {
+				if err = cleanupIPTables(ctx, r, c.binaryFor(f), cfg, f.metadataIP); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove redirect with %s", c.backend)
+		}
+	}
+	logger.Info("removed redirect to the proxy")
+	return nil
+}
+
+// binaryFor returns the binary that programs the redirect for the IP family
+func (c candidate) binaryFor(f family) string {
+	if f.ipv6 && c.binary6 != "" {
+		return c.binary6
+	}
+	return c.binary
+}
+
+// selectCandidates returns the candidates of the backend that are installed and supported by the kernel,
+// in order of preference and with one candidate per backend. The IPv6 binaries must be installed as well
+// if ipv6 is true.
+func selectCandidates(ctx context.Context, r runner, backend Backend, ipv6 bool) ([]candidate, error) {
+	var selected []candidate
+	var errs []string
+	found := map[Backend]bool{}
+	for _, c := range candidates {
+		if (backend != BackendAuto && c.backend != backend) || found[c.backend] {
+			continue
+		}
+		binaries := []*string{&c.binary}
+		if ipv6 && c.binary6 != "" {
+			binaries = append(binaries, &c.binary6)
+		}
+		supported := true
+		for _, binary := range binaries {
+			path, err := r.lookPath(*binary)
+			if err != nil {
+				errs = append(errs, *binary+": not found")
+				supported = false
+				break
+			}
+			if _, err := r.run(ctx, "", path, c.probe...); err != nil {
+				errs = append(errs, *binary+": "+err.Error())
+				supported = false
+				break
+			}
+			*binary = path
+		}
+		if supported {
+			found[c.backend] = true
+			selected = append(selected, c)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.Errorf("no supported backend found for %s: %s", backend, strings.Join(errs, "; "))
+	}
+	return selected, nil
+}
@@ -0,0 +1,99 @@
+package proxyinit
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// The proxy init container only depends on this package, so the environment variables set by the
+// webhook are defined here instead of importing the webhook and its Kubernetes dependencies.
+const (
+	// ProxyPortEnvVar is the environment variable with the port of the proxy sidecar
+	ProxyPortEnvVar = "PROXY_PORT"
+	// MetadataIPEnvVar is the environment variable with the IP address of the metadata endpoint
+	MetadataIPEnvVar = "METADATA_IP"
+	// MetadataIPv6EnvVar is the environment variable with the IPv6 address of the metadata endpoint.
+	// The traffic to the IPv6 address is only redirected if it's set.
+	MetadataIPv6EnvVar = "METADATA_IPV6"
+	// MetadataPortEnvVar is the environment variable with the port of the metadata endpoint
+	MetadataPortEnvVar = "METADATA_PORT"
+	// ProxyUIDEnvVar is the environment variable with the uid of the proxy sidecar, whose
+	// traffic to the metadata endpoint is not redirected
+	ProxyUIDEnvVar = "PROXY_UID"
+	// DefaultProxyUID is the uid of the user of the proxy image
+	DefaultProxyUID = 1501
+
+	defaultProxyPort    = 8000
+	defaultMetadataIP   = "169.254.169.254"
+	defaultMetadataPort = 80
+)
+
+// Config is the redirect of the traffic to the metadata endpoint to the proxy sidecar
+type Config struct {
+	// ProxyPort is the port the proxy sidecar listens on
+	ProxyPort int
+	// MetadataIP and MetadataPort are the address of the metadata endpoint
+	MetadataIP   string
+	MetadataPort int
+	// MetadataIPv6 is the IPv6 address of the metadata endpoint, for example fd00:ec2::254.
+	// The traffic to the IPv6 address is only redirected if it's set.
+	MetadataIPv6 string
+	// ProxyUID is the uid of the proxy sidecar
+	ProxyUID int
+}
+
+// ConfigFromEnv returns the config set in the PROXY_PORT, METADATA_IP, METADATA_IPV6, METADATA_PORT
+// and PROXY_UID environment variables. Unset environment variables get the default values.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		ProxyPort:    defaultProxyPort,
+		MetadataIP:   defaultMetadataIP,
+		MetadataPort: defaultMetadataPort,
+		ProxyUID:     DefaultProxyUID,
+	}
+	for name, value := range map[string]*int{
+		ProxyPortEnvVar:    &cfg.ProxyPort,
+		MetadataPortEnvVar: &cfg.MetadataPort,
+		ProxyUIDEnvVar:     &cfg.ProxyUID,
+	} {
+		env := os.Getenv(name)
+		if env == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(env)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "failed to parse %s", name)
+		}
+		*value = parsed
+	}
+	if ip := os.Getenv(MetadataIPEnvVar); ip != "" {
+		cfg.MetadataIP = ip
+	}
+	cfg.MetadataIPv6 = os.Getenv(MetadataIPv6EnvVar)
+	return cfg, cfg.Validate()
+}
+
+// Validate returns an error if the config can't be programmed
+func (c Config) Validate() error {
+	if c.ProxyPort < 1 || c.ProxyPort > 65535 {
+		return errors.Errorf("invalid proxy port %d, must be between 1 and 65535", c.ProxyPort)
+	}
+	if c.MetadataPort < 1 || c.MetadataPort > 65535 {
+		return errors.Errorf("invalid metadata port %d, must be between 1 and 65535", c.MetadataPort)
+	}
+	if c.ProxyUID < 0 {
+		return errors.Errorf("invalid proxy uid %d, must not be negative", c.ProxyUID)
+	}
+	if ip := net.ParseIP(c.MetadataIP); ip == nil || ip.To4() == nil {
+		return errors.Errorf("invalid metadata IP %q, must be an IPv4 address", c.MetadataIP)
+	}
+	if c.MetadataIPv6 != "" {
+		if ip := net.ParseIP(c.MetadataIPv6); ip == nil || ip.To4() != nil {
+			return errors.Errorf("invalid metadata IPv6 %q, must be an IPv6 address", c.MetadataIPv6)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package proxyinit
+
+import (
+	"testing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		expected    Config
+		expectedErr bool
+	}{
+		{
+			name:     "defaults",
+			expected: Config{ProxyPort: 8000, MetadataIP: "169.254.169.254", MetadataPort: 80, ProxyUID: 1501},
+		},
+		{
+			name:     "overrides",
+			env:      map[string]string{"PROXY_PORT": "8080", "METADATA_IP": "10.0.0.1", "METADATA_IPV6": "fd00:ec2::254", "METADATA_PORT": "8081", "PROXY_UID": "1000"},
+			expected: Config{ProxyPort: 8080, MetadataIP: "10.0.0.1", MetadataIPv6: "fd00:ec2::254", MetadataPort: 8081, ProxyUID: 1000},
+		},
+		{
+			name:        "invalid proxy port",
+			env:         map[string]string{"PROXY_PORT": "port"},
+			expectedErr: true,
+		},
+		{
+			name:        "proxy port out of range",
+			env:         map[string]string{"PROXY_PORT": "70000"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid metadata IP",
+			env:         map[string]string{"METADATA_IP": "metadata"},
+			expectedErr: true,
+		},
+		{
+			name:        "IPv4 metadata IPv6",
+			env:         map[string]string{"METADATA_IPV6": "169.254.169.254"},
+			expectedErr: true,
+		},
+		{
+			name:        "negative proxy uid",
+			env:         map[string]string{"PROXY_UID": "-1"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"PROXY_PORT", "METADATA_IP", "METADATA_IPV6", "METADATA_PORT", "PROXY_UID"} {
+				t.Setenv(name, test.env[name])
+			}
+			got, err := ConfigFromEnv()
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", test.expectedErr, err)
+			}
+			if err == nil && got != test.expected {
+				t.Errorf("expected config %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
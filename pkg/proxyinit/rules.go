@@ -0,0 +1,192 @@
+package proxyinit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// nftTable is the nftables table with the redirect
+	nftTable = "azwi_proxy"
+
+	// iptablesOutputChain is the chain for the outbound traffic to the metadata endpoint
+	iptablesOutputChain = "AZWI_PROXY_OUTPUT"
+	// iptablesRedirectChain is the chain that redirects the traffic to the proxy
+	iptablesRedirectChain = "AZWI_PROXY_REDIRECT"
+)
+
+// family is an IP family of the redirect
+type family struct {
+	// nft is the nftables family, ip or ip6
+	nft string
+	// ipv6 is true if the rules are programmed with ip6tables
+	ipv6       bool
+	metadataIP string
+}
+
+// families returns the IP families of the redirect. IPv6 is only included if the IPv6 metadata address is set.
+func (c Config) families() []family {
+	families := []family{{nft: "ip", metadataIP: c.MetadataIP}}
+	if c.MetadataIPv6 != "" {
+		families = append(families, family{nft: "ip6", ipv6: true, metadataIP: c.MetadataIPv6})
+	}
+	return families
+}
+
+// iptablesRule is a rule appended to a chain of the nat table
+type iptablesRule struct {
+	chain string
+	spec  []string
+}
+
+// nftRuleset returns the nft script that programs the redirect. Adding and deleting the
+// tables before defining them makes the script replace the tables of a previous run atomically.
+func nftRuleset(cfg Config) string {
+	var b strings.Builder
+	for _, f := range cfg.families() {
+		match := fmt.Sprintf("%s daddr %s tcp dport %d", f.nft, f.metadataIP, cfg.MetadataPort)
+		fmt.Fprintf(&b, "add table %s %s\n", f.nft, nftTable)
+		fmt.Fprintf(&b, "delete table %s %s\n", f.nft, nftTable)
+		fmt.Fprintf(&b, "table %s %s {\n", f.nft, nftTable)
+		b.WriteString("\tchain output {\n")
+		b.WriteString("\t\ttype nat hook output priority -100; policy accept;\n")
+		// skip redirection of the proxy traffic back to itself
+		fmt.Fprintf(&b, "\t\t%s meta skuid %d accept\n", match, cfg.ProxyUID)
+		// redirect all other TCP traffic to the metadata endpoint to the proxy
+		fmt.Fprintf(&b, "\t\t%s redirect to :%d\n", match, cfg.ProxyPort)
+		b.WriteString("\t}\n")
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// nftCleanupRuleset returns the nft script that removes the tables. Adding the tables
+// before deleting them makes the script succeed if the tables don't exist.
+func nftCleanupRuleset(cfg Config) string {
+	var b strings.Builder
+	for _, f := range cfg.families() {
+		fmt.Fprintf(&b, "add table %s %s\n", f.nft, nftTable)
+		fmt.Fprintf(&b, "delete table %s %s\n", f.nft, nftTable)
+	}
+	return b.String()
+}
+
+// iptablesChains returns the chains created in the nat table
+func iptablesChains() []string {
+	return []string{iptablesOutputChain, iptablesRedirectChain}
+}
+
+// iptablesRules returns the rules of the chains created in the nat table
+func iptablesRules(cfg Config) []iptablesRule {
+	return []iptablesRule{
+		// redirect all TCP traffic for the metadata endpoint to the proxy
+		{chain: iptablesRedirectChain, spec: []string{"-p", "tcp", "-j", "REDIRECT", "--to-port", strconv.Itoa(cfg.ProxyPort)}},
+		// skip redirection of proxy traffic back to itself, return to next chain for further processing
+		{chain: iptablesOutputChain, spec: []string{"-m", "owner", "--uid-owner", strconv.Itoa(cfg.ProxyUID), "-j", "ACCEPT"}},
+		// for all other traffic to the metadata endpoint, jump to the redirect chain
+		{chain: iptablesOutputChain, spec: []string{"-j", iptablesRedirectChain}},
+	}
+}
+
+// iptablesJumpRule returns the rule that jumps from the OUTPUT chain to the output chain
+// for outbound TCP traffic to the metadata IP
+func iptablesJumpRule(cfg Config, metadataIP string) iptablesRule {
+	return iptablesRule{
+		chain: "OUTPUT",
+		spec:  []string{"-p", "tcp", "-d", metadataIP, "--dport", strconv.Itoa(cfg.MetadataPort), "-j", iptablesOutputChain},
+	}
+}
+
+// applyNFT replaces the nftables tables with the redirect and returns the programmed tables
+func applyNFT(ctx context.Context, r runner, binary string, cfg Config) ([]byte, error) {
+	if _, err := r.run(ctx, nftRuleset(cfg), binary, "-f", "-"); err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, f := range cfg.families() {
+		table, err := r.run(ctx, "", binary, "list", "table", f.nft, nftTable)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, table...)
+	}
+	return out, nil
+}
+
+// cleanupNFT removes the nftables tables
+func cleanupNFT(ctx context.Context, r runner, binary string, cfg Config) error {
+	_, err := r.run(ctx, nftCleanupRuleset(cfg), binary, "-f", "-")
+	return err
+}
+
+// applyIPTables recreates the chains in the nat table with the redirect to the proxy and adds the
+// jump for the metadata IP from the OUTPUT chain if it's missing, then returns the programmed nat table.
+// The chains exist if the container restarted in the same network namespace, so they are flushed
+// instead of created.
+func applyIPTables(ctx context.Context, r runner, binary string, cfg Config, metadataIP string) ([]byte, error) {
+	nat := iptablesNAT(ctx, r, binary)
+	for _, chain := range iptablesChains() {
+		if _, err := nat("-n", "-L", chain); err != nil {
+			if _, err := nat("-N", chain); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := nat("-F", chain); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range iptablesRules(cfg) {
+		if _, err := nat(append([]string{"-A", rule.chain}, rule.spec...)...); err != nil {
+			return nil, err
+		}
+	}
+	jump := iptablesJumpRule(cfg, metadataIP)
+	if _, err := nat(append([]string{"-C", jump.chain}, jump.spec...)...); err != nil {
+		if _, err := nat(append([]string{"-A", jump.chain}, jump.spec...)...); err != nil {
+			return nil, err
+		}
+	}
+	return nat("-n", "-L")
+}
+
+// cleanupIPTables removes the jump for the metadata IP from the OUTPUT chain and deletes the chains
+// in the nat table. Rules and chains that don't exist are skipped.
+func cleanupIPTables(ctx context.Context, r runner, binary string, cfg Config, metadataIP string) error {
+	nat := iptablesNAT(ctx, r, binary)
+	// the jump is appended once per run by older versions of the proxy init container, so remove every copy
+	jump := iptablesJumpRule(cfg, metadataIP)
+	for {
+		if _, err := nat(append([]string{"-C", jump.chain}, jump.spec...)...); err != nil {
+			break
+		}
+		if _, err := nat(append([]string{"-D", jump.chain}, jump.spec...)...); err != nil {
+			return err
+		}
+	}
+	var existing []string
+	for _, chain := range iptablesChains() {
+		if _, err := nat("-n", "-L", chain); err != nil {
+			continue
+		}
+		existing = append(existing, chain)
+		if _, err := nat("-F", chain); err != nil {
+			return err
+		}
+	}
+	// the chains can only be deleted once no rules reference them
+	for _, chain := range existing {
+		if _, err := nat("-X", chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iptablesNAT returns a func that runs the binary with the arguments on the nat table
+func iptablesNAT(ctx context.Context, r runner, binary string) func(args ...string) ([]byte, error) {
+	return func(args ...string) ([]byte, error) {
+		return r.run(ctx, "", binary, append([]string{"-t", "nat"}, args...)...)
+	}
+}
@@ -0,0 +1,420 @@
+package proxyinit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"monis.app/mlog"
+)
+
+// fakeRunner records the commands and fails the commands for which fail returns an error
+type fakeRunner struct {
+	binaries map[string]bool
+	fail     func(cmd string) error
+	commands []string
+	stdin    []string
+}
+
+func (f *fakeRunner) lookPath(file string) (string, error) {
+	if !f.binaries[file] {
+		return "", errors.New("not found")
+	}
+	return "/usr/sbin/" + file, nil
+}
+
+func (f *fakeRunner) run(_ context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	cmd := strings.TrimSpace(name + " " + strings.Join(args, " "))
+	f.commands = append(f.commands, cmd)
+	if stdin != "" {
+		f.stdin = append(f.stdin, stdin)
+	}
+	if f.fail != nil {
+		if err := f.fail(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return []byte("rules"), nil
+}
+
+var testConfig = Config{ProxyPort: 8000, MetadataIP: "169.254.169.254", MetadataPort: 80, ProxyUID: 1501}
+
+func TestNFTRuleset(t *testing.T) {
+	dualStackConfig := testConfig
+	dualStackConfig.MetadataIPv6 = "fd00:ec2::254"
+
+	tests := []struct {
+		name            string
+		cfg             Config
+		expected        string
+		expectedCleanup string
+	}{
+		{
+			name: "IPv4",
+			cfg:  testConfig,
+			expected: `add table ip azwi_proxy
+delete table ip azwi_proxy
+table ip azwi_proxy {
+	chain output {
+		type nat hook output priority -100; policy accept;
+		ip daddr 169.254.169.254 tcp dport 80 meta skuid 1501 accept
+		ip daddr 169.254.169.254 tcp dport 80 redirect to :8000
+	}
+}
+`,
+			expectedCleanup: `add table ip azwi_proxy
+delete table ip azwi_proxy
+`,
+		},
+		{
+			name: "dual-stack",
+			cfg:  dualStackConfig,
+			expected: `add table ip azwi_proxy
+delete table ip azwi_proxy
+table ip azwi_proxy {
+	chain output {
+		type nat hook output priority -100; policy accept;
+		ip daddr 169.254.169.254 tcp dport 80 meta skuid 1501 accept
+		ip daddr 169.254.169.254 tcp dport 80 redirect to :8000
+	}
+}
+add table ip6 azwi_proxy
+delete table ip6 azwi_proxy
+table ip6 azwi_proxy {
+	chain output {
+		type nat hook output priority -100; policy accept;
+		ip6 daddr fd00:ec2::254 tcp dport 80 meta skuid 1501 accept
+		ip6 daddr fd00:ec2::254 tcp dport 80 redirect to :8000
+	}
+}
+`,
+			expectedCleanup: `add table ip azwi_proxy
+delete table ip azwi_proxy
+add table ip6 azwi_proxy
+delete table ip6 azwi_proxy
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := nftRuleset(test.cfg); got != test.expected {
+				t.Errorf("expected ruleset:\n%s\ngot:\n%s", test.expected, got)
+			}
+			if got := nftCleanupRuleset(test.cfg); got != test.expectedCleanup {
+				t.Errorf("expected cleanup ruleset:\n%s\ngot:\n%s", test.expectedCleanup, got)
+			}
+		})
+	}
+}
+
+func TestIPTablesRules(t *testing.T) {
+	expected := []iptablesRule{
+		{chain: "AZWI_PROXY_REDIRECT", spec: []string{"-p", "tcp", "-j", "REDIRECT", "--to-port", "8000"}},
+		{chain: "AZWI_PROXY_OUTPUT", spec: []string{"-m", "owner", "--uid-owner", "1501", "-j", "ACCEPT"}},
+		{chain: "AZWI_PROXY_OUTPUT", spec: []string{"-j", "AZWI_PROXY_REDIRECT"}},
+	}
+	if got := iptablesRules(testConfig); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected rules %v, got %v", expected, got)
+	}
+	expectedJump := iptablesRule{chain: "OUTPUT", spec: []string{"-p", "tcp", "-d", "169.254.169.254", "--dport", "80", "-j", "AZWI_PROXY_OUTPUT"}}
+	if got := iptablesJumpRule(testConfig, "169.254.169.254"); !reflect.DeepEqual(got, expectedJump) {
+		t.Errorf("expected jump rule %v, got %v", expectedJump, got)
+	}
+}
+
+func TestApplyIPTables(t *testing.T) {
+	tests := []struct {
+		name             string
+		existing         bool
+		expectedCommands []string
+	}{
+		{
+			name: "first run",
+			expectedCommands: []string{
+				"iptables -t nat -n -L AZWI_PROXY_OUTPUT",
+				"iptables -t nat -N AZWI_PROXY_OUTPUT",
+				"iptables -t nat -F AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_REDIRECT",
+				"iptables -t nat -N AZWI_PROXY_REDIRECT",
+				"iptables -t nat -F AZWI_PROXY_REDIRECT",
+				"iptables -t nat -A AZWI_PROXY_REDIRECT -p tcp -j REDIRECT --to-port 8000",
+				"iptables -t nat -A AZWI_PROXY_OUTPUT -m owner --uid-owner 1501 -j ACCEPT",
+				"iptables -t nat -A AZWI_PROXY_OUTPUT -j AZWI_PROXY_REDIRECT",
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -A OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L",
+			},
+		},
+		{
+			name:     "container restarted",
+			existing: true,
+			expectedCommands: []string{
+				"iptables -t nat -n -L AZWI_PROXY_OUTPUT",
+				"iptables -t nat -F AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_REDIRECT",
+				"iptables -t nat -F AZWI_PROXY_REDIRECT",
+				"iptables -t nat -A AZWI_PROXY_REDIRECT -p tcp -j REDIRECT --to-port 8000",
+				"iptables -t nat -A AZWI_PROXY_OUTPUT -m owner --uid-owner 1501 -j ACCEPT",
+				"iptables -t nat -A AZWI_PROXY_OUTPUT -j AZWI_PROXY_REDIRECT",
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &fakeRunner{fail: func(cmd string) error {
+				if !test.existing && (strings.Contains(cmd, " -L AZWI_") || strings.Contains(cmd, " -C ")) {
+					return errors.New("no chain/target/match by that name")
+				}
+				return nil
+			}}
+			if _, err := applyIPTables(context.Background(), r, "iptables", testConfig, "169.254.169.254"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r.commands, test.expectedCommands) {
+				t.Errorf("expected commands:\n%s\ngot:\n%s", strings.Join(test.expectedCommands, "\n"), strings.Join(r.commands, "\n"))
+			}
+		})
+	}
+}
+
+func TestCleanupIPTables(t *testing.T) {
+	tests := []struct {
+		name             string
+		jumps            int
+		existing         bool
+		expectedCommands []string
+	}{
+		{
+			name: "nothing to remove",
+			expectedCommands: []string{
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_REDIRECT",
+			},
+		},
+		{
+			name:     "jump appended twice",
+			jumps:    2,
+			existing: true,
+			expectedCommands: []string{
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -D OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -D OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -C OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_OUTPUT",
+				"iptables -t nat -F AZWI_PROXY_OUTPUT",
+				"iptables -t nat -n -L AZWI_PROXY_REDIRECT",
+				"iptables -t nat -F AZWI_PROXY_REDIRECT",
+				"iptables -t nat -X AZWI_PROXY_OUTPUT",
+				"iptables -t nat -X AZWI_PROXY_REDIRECT",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jumps := test.jumps
+			r := &fakeRunner{fail: func(cmd string) error {
+				switch {
+				case strings.Contains(cmd, " -C "):
+					if jumps == 0 {
+						return errors.New("bad rule")
+					}
+				case strings.Contains(cmd, " -D "):
+					jumps--
+				case strings.Contains(cmd, " -L AZWI_"):
+					if !test.existing {
+						return errors.New("no chain/target/match by that name")
+					}
+				}
+				return nil
+			}}
+			if err := cleanupIPTables(context.Background(), r, "iptables", testConfig, "169.254.169.254"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r.commands, test.expectedCommands) {
+				t.Errorf("expected commands:\n%s\ngot:\n%s", strings.Join(test.expectedCommands, "\n"), strings.Join(r.commands, "\n"))
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	probeFails := func(binaries ...string) func(string) error {
+		return func(cmd string) error {
+			for _, binary := range binaries {
+				if strings.HasPrefix(cmd, "/usr/sbin/"+binary+" ") && (strings.HasSuffix(cmd, " list tables") || strings.HasSuffix(cmd, " -n -L OUTPUT")) {
+					return errors.New("not supported by the kernel")
+				}
+			}
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name          string
+		backend       Backend
+		binaries      []string
+		fail          func(string) error
+		expectedFirst string
+		expectedErr   string
+	}{
+		{
+			name:          "nft is preferred",
+			backend:       BackendAuto,
+			binaries:      []string{"nft", "iptables-nft", "iptables-legacy"},
+			expectedFirst: "/usr/sbin/nft -f -",
+		},
+		{
+			name:          "iptables-nft without nft",
+			backend:       BackendAuto,
+			binaries:      []string{"iptables-nft", "iptables-legacy"},
+			expectedFirst: "/usr/sbin/iptables-nft -t nat -n -L AZWI_PROXY_OUTPUT",
+		},
+		{
+			name:          "iptables-legacy when nf_tables is not supported",
+			backend:       BackendAuto,
+			binaries:      []string{"nft", "iptables-nft", "iptables-legacy"},
+			fail:          probeFails("nft", "iptables-nft"),
+			expectedFirst: "/usr/sbin/iptables-legacy -t nat -n -L AZWI_PROXY_OUTPUT",
+		},
+		{
+			name:          "iptables without the iptables-legacy alias",
+			backend:       BackendIPTablesLegacy,
+			binaries:      []string{"nft", "iptables"},
+			expectedFirst: "/usr/sbin/iptables -t nat -n -L AZWI_PROXY_OUTPUT",
+		},
+		{
+			name:        "backend not installed",
+			backend:     BackendNFT,
+			binaries:    []string{"iptables-legacy"},
+			expectedErr: "no supported backend found for nft: nft: not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &fakeRunner{binaries: map[string]bool{}, fail: test.fail}
+			for _, binary := range test.binaries {
+				r.binaries[binary] = true
+			}
+			err := setup(context.Background(), mlog.New(), r, testConfig, test.backend)
+			if test.expectedErr != "" {
+				if err == nil || err.Error() != test.expectedErr {
+					t.Fatalf("expected error %q, got %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// skip the probes of the detected backends
+			var applied []string
+			for _, cmd := range r.commands {
+				if !strings.HasSuffix(cmd, " list tables") && !strings.HasSuffix(cmd, " -n -L OUTPUT") {
+					applied = append(applied, cmd)
+				}
+			}
+			if len(applied) == 0 || applied[0] != test.expectedFirst {
+				t.Errorf("expected first command %q, got %v", test.expectedFirst, applied)
+			}
+		})
+	}
+}
+
+func TestSetupIPv6(t *testing.T) {
+	cfg := testConfig
+	cfg.MetadataIPv6 = "fd00:ec2::254"
+
+	r := &fakeRunner{binaries: map[string]bool{"iptables-legacy": true, "ip6tables-legacy": true}}
+	if err := setup(context.Background(), mlog.New(), r, cfg, BackendAuto); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"/usr/sbin/iptables-legacy -t nat -A OUTPUT -p tcp -d 169.254.169.254 --dport 80 -j AZWI_PROXY_OUTPUT",
+		"/usr/sbin/ip6tables-legacy -t nat -A OUTPUT -p tcp -d fd00:ec2::254 --dport 80 -j AZWI_PROXY_OUTPUT",
+	} {
+		found := false
+		for _, cmd := range r.commands {
+			// the jump is only appended if the check fails, which the fake runner doesn't do
+			if strings.Replace(cmd, " -C ", " -A ", 1) == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected command %q, got:\n%s", expected, strings.Join(r.commands, "\n"))
+		}
+	}
+
+	// the IPv6 binary must be installed to program the IPv6 redirect
+	r = &fakeRunner{binaries: map[string]bool{"iptables-legacy": true}}
+	if err := setup(context.Background(), mlog.New(), r, cfg, BackendAuto); err == nil {
+		t.Errorf("expected error without ip6tables-legacy")
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		name             string
+		backend          Backend
+		expectedBinaries []string
+	}{
+		{
+			name:             "auto removes the redirect from all backends",
+			backend:          BackendAuto,
+			expectedBinaries: []string{"/usr/sbin/nft", "/usr/sbin/iptables-nft", "/usr/sbin/iptables-legacy"},
+		},
+		{
+			name:             "backend",
+			backend:          BackendIPTablesNFT,
+			expectedBinaries: []string{"/usr/sbin/iptables-nft"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &fakeRunner{
+				binaries: map[string]bool{"nft": true, "iptables-nft": true, "iptables-legacy": true, "iptables": true},
+				fail: func(cmd string) error {
+					// nothing to remove
+					if strings.Contains(cmd, " -C ") || strings.Contains(cmd, " -L AZWI_") {
+						return errors.New("no chain/target/match by that name")
+					}
+					return nil
+				},
+			}
+			if err := cleanup(context.Background(), mlog.New(), r, testConfig, test.backend); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var binaries []string
+			for _, cmd := range r.commands {
+				// skip the probes of the detected backends
+				if strings.HasSuffix(cmd, " list tables") || strings.HasSuffix(cmd, " -n -L OUTPUT") {
+					continue
+				}
+				binary := strings.Fields(cmd)[0]
+				if len(binaries) == 0 || binaries[len(binaries)-1] != binary {
+					binaries = append(binaries, binary)
+				}
+			}
+			if !reflect.DeepEqual(binaries, test.expectedBinaries) {
+				t.Errorf("expected the redirect to be removed with %v, got %v", test.expectedBinaries, binaries)
+			}
+		})
+	}
+
+	r := &fakeRunner{binaries: map[string]bool{"nft": true}}
+	if err := cleanup(context.Background(), mlog.New(), r, testConfig, BackendNFT); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(r.stdin, []string{nftCleanupRuleset(testConfig)}) {
+		t.Errorf("expected the nft tables to be removed with the cleanup ruleset, got %v", r.stdin)
+	}
+}
@@ -1,5 +1,7 @@
 package webhook
 
+import "github.com/Azure/azure-workload-identity/pkg/proxyinit"
+
 // Annotations and labels defined in service account
 const (
 	// UseWorkloadIdentityLabel represents the service account is to be used for workload identity
@@ -15,10 +17,49 @@ const (
 	// SkipContainersAnnotation represents list of containers to skip adding projected service account token volume.
 	// By default, the projected service account token volume will be added to all containers if the service account is labeled with `azure.workload.identity/use: true`
 	SkipContainersAnnotation = "azure.workload.identity/skip-containers"
+	// ContainerClientIDsAnnotation represents a comma-separated list of container name to client ID mappings (e.g. `app=<client-id>,uploader=<client-id>`).
+	// Containers in the list are configured with the mapped client ID instead of the client ID annotated on the service account.
+	ContainerClientIDsAnnotation = "azure.workload.identity/container-client-ids"
+	// ExtraAudiencesAnnotation represents a comma-separated list of name to audience mappings (e.g. `vault=https://vault.example.com,aws=sts.amazonaws.com`)
+	// for which an additional service account token is projected. Each token is projected to
+	// <VolumeMountPath>/<ExtraAudienceTokenDirPath>/<name>/<TokenFileName> and the path is exposed to the containers with
+	// the <ExtraAudienceTokenFileEnvVarPrefix><NAME> environment variable.
+	ExtraAudiencesAnnotation = "azure.workload.identity/extra-audiences"
 	// InjectProxySidecarAnnotation represents the annotation to be used to inject proxy sidecar into the pod
 	InjectProxySidecarAnnotation = "azure.workload.identity/inject-proxy-sidecar"
 	// ProxySidecarPortAnnotation represents the annotation to be used to specify the port for proxy sidecar
 	ProxySidecarPortAnnotation = "azure.workload.identity/proxy-sidecar-port"
+	// ProxySidecarMetricsPortAnnotation represents the annotation to be used to enable the metrics endpoint of the proxy sidecar on the port
+	ProxySidecarMetricsPortAnnotation = "azure.workload.identity/proxy-sidecar-metrics-port"
+	// InjectAppServiceEnvAnnotation represents the annotation to be used to inject the App Service managed identity
+	// environment variables pointing to the proxy sidecar into the containers
+	InjectAppServiceEnvAnnotation = "azure.workload.identity/inject-app-service-env"
+	// InjectAzureArcEnvAnnotation represents the annotation to be used to inject the Azure Arc environment
+	// variables and key volume pointing to the proxy sidecar into the containers
+	InjectAzureArcEnvAnnotation = "azure.workload.identity/inject-azure-arc-env"
+	// ProxySidecarStrictModeAnnotation represents the annotation to be used to run the proxy sidecar in strict mode,
+	// where requests to the IMDS identity endpoints are never forwarded to IMDS
+	ProxySidecarStrictModeAnnotation = "azure.workload.identity/proxy-sidecar-strict-mode"
+	// ProxySidecarModeAnnotation represents the annotation to be used to select how the containers reach the proxy sidecar,
+	// either ProxySidecarModeRedirect or ProxySidecarModeEnv
+	ProxySidecarModeAnnotation = "azure.workload.identity/proxy-sidecar-mode"
+	// ProxyCPURequestAnnotation, ProxyCPULimitAnnotation, ProxyMemoryRequestAnnotation and ProxyMemoryLimitAnnotation represent
+	// the annotations to be used to override the resources of the proxy sidecar and init containers
+	ProxyCPURequestAnnotation    = "azure.workload.identity/proxy-cpu-request"
+	ProxyCPULimitAnnotation      = "azure.workload.identity/proxy-cpu-limit"
+	ProxyMemoryRequestAnnotation = "azure.workload.identity/proxy-memory-request"
+	ProxyMemoryLimitAnnotation   = "azure.workload.identity/proxy-memory-limit"
+	// ProxyImagePullPolicyAnnotation represents the annotation to be used to override the image pull policy
+	// of the proxy sidecar and init containers
+	ProxyImagePullPolicyAnnotation = "azure.workload.identity/proxy-image-pull-policy"
+	// ProxyStartupProbeAnnotation, ProxyReadinessProbeAnnotation and ProxyLivenessProbeAnnotation represent the annotations
+	// to be used to override the timing of the probes of the proxy sidecar with a JSON object, or to disable the probe when empty
+	ProxyStartupProbeAnnotation   = "azure.workload.identity/proxy-startup-probe"
+	ProxyReadinessProbeAnnotation = "azure.workload.identity/proxy-readiness-probe"
+	ProxyLivenessProbeAnnotation  = "azure.workload.identity/proxy-liveness-probe"
+	// PodSecurityEnforceLabel is the namespace label with the Pod Security Standard level
+	// enforced by the Pod Security admission controller
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
 
 	// MinServiceAccountTokenExpiration is the minimum service account token expiration in seconds
 	MinServiceAccountTokenExpiration = int64(3600)
@@ -31,6 +72,21 @@ const (
 	DefaultProxySidecarPort = 8000
 )
 
+// Pod Security Standard levels, from the least to the most restrictive
+const (
+	PodSecurityLevelPrivileged = "privileged"
+	PodSecurityLevelBaseline   = "baseline"
+	PodSecurityLevelRestricted = "restricted"
+)
+
+const (
+	// ProxySidecarModeRedirect redirects the traffic to IMDS to the proxy sidecar with the proxy init container
+	ProxySidecarModeRedirect = "redirect"
+	// ProxySidecarModeEnv points the containers to the proxy sidecar with environment variables instead
+	// of redirecting the traffic, so the proxy init container and its NET_ADMIN capability are not needed
+	ProxySidecarModeEnv = "env"
+)
+
 const (
 	// ProxyInitContainerName is the name of the init container that will be used to inject proxy sidecar
 	ProxyInitContainerName = "azwi-proxy-init"
@@ -41,7 +97,28 @@ const (
 	// ProxySidecarImageName is the name of the image that will be used to inject proxy sidecar
 	ProxySidecarImageName = "proxy"
 	// ProxyPortEnvVar is the environment variable name for the proxy port
-	ProxyPortEnvVar = "PROXY_PORT"
+	ProxyPortEnvVar = proxyinit.ProxyPortEnvVar
+	// ProxyUIDEnvVar is the environment variable name for the uid of the proxy sidecar,
+	// whose traffic is not redirected by the proxy init container
+	ProxyUIDEnvVar = proxyinit.ProxyUIDEnvVar
+	// MetadataIPv6EnvVar is the environment variable name for the IPv6 address of the metadata endpoint.
+	// The proxy init container only redirects the IPv6 traffic to the metadata endpoint if it's set,
+	// and the proxy sidecar forwards the IPv6 requests that are passed through to it.
+	MetadataIPv6EnvVar = proxyinit.MetadataIPv6EnvVar
+	// ProxySidecarUID is the uid and gid the proxy sidecar runs as, which is the user of the proxy image
+	ProxySidecarUID = int64(proxyinit.DefaultProxyUID)
+	// IMDSTokenPath is the path of the IMDS token endpoint served by the proxy sidecar
+	IMDSTokenPath = "/metadata/identity/oauth2/token" // #nosec
+	// AppServiceTokenPath is the path of the App Service managed identity endpoint emulated by the proxy sidecar
+	AppServiceTokenPath = "/msi/token"
+	// AzureArcTokenPath is the path of the Azure Arc token endpoint emulated by the proxy sidecar
+	AzureArcTokenPath = "/arc/metadata/identity/oauth2/token" // #nosec
+	// AzureArcKeyDir is the directory of the Azure Arc challenge key files. The Azure Arc clients
+	// only accept key files in this directory, so the emptyDir volume is mounted at the same
+	// path in the proxy sidecar and the containers.
+	AzureArcKeyDir = "/var/opt/azcmagent/tokens" // #nosec
+	// AzureArcKeyVolumeName is the name of the emptyDir volume for the Azure Arc challenge key files
+	AzureArcKeyVolumeName = "azwi-arc-keys"
 )
 
 // Environment variables injected in the pod
@@ -53,13 +130,31 @@ const (
 	// ProjectedVolumeNamePrefix is the prefix for the projected volume name
 	// The sha256 hash of the pod name will be appended to this prefix
 	ProjectedVolumeNamePrefix = "azure-workload-identity-reserved-"
-	TokenFilePath             = "token/azure-identity-token"
+	TokenFileName             = "azure-identity-token"
+	TokenFilePath             = "token/" + TokenFileName
 	VolumeMountPath           = "/var/run/secrets/azure/wi" // #nosec
+	// ExtraAudienceTokenDirPath is the directory in the projected volume that holds the tokens for extra audiences
+	ExtraAudienceTokenDirPath = "audiences"
+	// ExtraAudienceTokenFileEnvVarPrefix is the prefix for the environment variables pointing to the tokens for extra audiences
+	// The upper-cased name of the extra audience with dashes replaced by underscores will be appended to this prefix
+	ExtraAudienceTokenFileEnvVarPrefix = "AZURE_FEDERATED_TOKEN_FILE_" // #nosec
 	// DefaultAudience is the audience added to the service account token audience
 	// This value is to be consistent with other token exchange flows in AAD and has
 	// no impact on the actual token exchange flow.
 	DefaultAudience = "api://AzureADTokenExchange"
 
+	// App Service managed identity environment variables injected with the proxy sidecar
+	// IDENTITY_ENDPOINT and IDENTITY_HEADER are used by api-version 2019-08-01,
+	// MSI_ENDPOINT and MSI_SECRET are used by api-version 2017-09-01
+	IdentityEndpointEnvVar = "IDENTITY_ENDPOINT"
+	IdentityHeaderEnvVar   = "IDENTITY_HEADER"
+	MSIEndpointEnvVar      = "MSI_ENDPOINT"
+	MSISecretEnvVar        = "MSI_SECRET" // #nosec
+	// IMDSEndpointEnvVar is set together with IDENTITY_ENDPOINT to use the Azure Arc token endpoint
+	IMDSEndpointEnvVar = "IMDS_ENDPOINT"
+	// AzurePodIdentityAuthorityHostEnvVar overrides the IMDS host used by the Azure SDKs
+	AzurePodIdentityAuthorityHostEnvVar = "AZURE_POD_IDENTITY_AUTHORITY_HOST"
+
 	AzureKubernetesCADataEnvVar     = "AZURE_KUBERNETES_CA_DATA" // #nosec
 	AzureKubernetesCAFileEnvVar     = "AZURE_KUBERNETES_CA_FILE" // #nosec
 	AzureKubernetesSNINameEnvVar    = "AZURE_KUBERNETES_SNI_NAME"
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/utils/ptr"
+	"monis.app/mlog"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+)
+
+// maxExplainRequestBytes is the maximum size of the pod manifest accepted by the explain endpoint
+const maxExplainRequestBytes = 1 << 20
+
+// decisionTrace records the decisions made while mutating a pod.
+// A nil decisionTrace discards all records.
+type decisionTrace struct {
+	steps []string
+}
+
+// record adds a formatted decision to the trace
+func (t *decisionTrace) record(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, fmt.Sprintf(format, args...))
+}
+
+// ExplainResponse is the response of the explain endpoint
+type ExplainResponse struct {
+	// Allowed is true if the pod would be admitted by the mutating webhook
+	Allowed bool `json:"allowed"`
+	// Reason is the reason the pod would not be admitted
+	Reason string `json:"reason,omitempty"`
+	// Patches is the JSON patch the mutating webhook would apply to the pod
+	Patches []jsonpatch.JsonPatchOperation `json:"patches,omitempty"`
+	// Trace is the human-readable list of decisions made by the mutating webhook
+	Trace []string `json:"trace"`
+}
+
+// podExplainer runs the pod mutation against a pod manifest without admitting it
+type podExplainer struct {
+	mutator *podMutator
+}
+
+// NewPodExplainer returns an HTTP handler that accepts a pod manifest in YAML or JSON
+// and returns the patch the pod mutator would apply along with the decision trace
+func NewPodExplainer(mutator admission.Handler) (http.Handler, error) {
+	m, ok := mutator.(*podMutator)
+	if !ok {
+		return nil, errors.Errorf("expected a pod mutator, got %T", mutator)
+	}
+	return &podExplainer{mutator: m}, nil
+}
+
+// ServeHTTP explains the mutation of the pod in the request body.
+// The namespace is read from the "namespace" query parameter or the pod manifest.
+func (e *podExplainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxExplainRequestBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	raw, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse pod manifest: %v", err), http.StatusBadRequest)
+		return
+	}
+	pod := &corev1.Pod{}
+	if err = json.Unmarshal(raw, pod); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse pod manifest: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	resp := e.explain(r, namespace, raw)
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		mlog.New().WithName("explainer").Error("failed to write explain response", err)
+	}
+}
+
+// explain runs the pod mutation for the raw pod and returns the result with the decision trace
+func (e *podExplainer) explain(r *http.Request, namespace string, raw []byte) *ExplainResponse {
+	trace := &decisionTrace{}
+	resp := e.mutator.mutate(r.Context(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID: uuid.NewUUID(),
+			Kind: metav1.GroupVersionKind{
+				Group:   "",
+				Version: "v1",
+				Kind:    "Pod",
+			},
+			Object:    runtime.RawExtension{Raw: raw},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			DryRun:    ptr.To(true),
+		},
+	}, trace)
+
+	explained := &ExplainResponse{
+		Allowed: resp.Allowed,
+		Patches: resp.Patches,
+		Trace:   trace.steps,
+	}
+	if resp.Result != nil {
+		explained.Reason = resp.Result.Message
+	}
+	return explained
+}
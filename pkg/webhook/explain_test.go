@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/azure-workload-identity/pkg/config"
+)
+
+func TestPodExplainer(t *testing.T) {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "client-id"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		body            string
+		expectedStatus  int
+		expectedAllowed bool
+		expectedReason  string
+		expectedTrace   []string
+	}{
+		{
+			name:   "yaml pod manifest",
+			method: http.MethodPost,
+			url:    "/explain-v1-pod",
+			body: `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: ns1
+  labels:
+    azure.workload.identity/use: "true"
+  annotations:
+    azure.workload.identity/skip-containers: sidecar
+spec:
+  serviceAccountName: sa
+  containers:
+  - name: container
+    image: image
+  - name: sidecar
+    image: image
+`,
+			expectedStatus:  http.StatusOK,
+			expectedAllowed: true,
+			expectedTrace: []string{
+				"using service account ns1/sa",
+				"proxy sidecar not injected because the pod is not annotated with azure.workload.identity/inject-proxy-sidecar",
+				"service account token expiration is 3600 seconds",
+				"client ID client-id from the service account annotation",
+				"tenant ID tenant-id from the webhook config",
+				"container sidecar skipped because it is listed in azure.workload.identity/skip-containers",
+			},
+		},
+		{
+			name:            "namespace from query parameter and missing label",
+			method:          http.MethodPost,
+			url:             "/explain-v1-pod?namespace=ns1",
+			body:            `{"metadata":{"name":"pod"},"spec":{"serviceAccountName":"sa","containers":[{"name":"container","image":"image"}]}}`,
+			expectedStatus:  http.StatusOK,
+			expectedAllowed: true,
+			expectedTrace: []string{
+				"pod is not labeled with azure.workload.identity/use=true, the webhook is not called for this pod",
+				"using service account ns1/sa",
+			},
+		},
+		{
+			name:   "proxy sidecar with host network",
+			method: http.MethodPost,
+			url:    "/explain-v1-pod",
+			body: `
+metadata:
+  name: pod
+  namespace: ns1
+  annotations:
+    azure.workload.identity/inject-proxy-sidecar: "true"
+spec:
+  serviceAccountName: sa
+  hostNetwork: true
+  containers:
+  - name: container
+    image: image
+`,
+			expectedStatus:  http.StatusOK,
+			expectedAllowed: false,
+			expectedReason:  "hostNetwork is set to true, cannot inject proxy sidecar",
+			expectedTrace: []string{
+				"proxy sidecar not injected: hostNetwork is set to true, cannot inject proxy sidecar",
+			},
+		},
+		{
+			name:           "service account not found",
+			method:         http.MethodPost,
+			url:            "/explain-v1-pod",
+			body:           `{"metadata":{"name":"pod","namespace":"ns2"},"spec":{"serviceAccountName":"sa","containers":[{"name":"container","image":"image"}]}}`,
+			expectedStatus: http.StatusOK,
+			expectedReason: `serviceaccounts "sa" not found`,
+		},
+		{
+			name:           "invalid manifest",
+			method:         http.MethodPost,
+			url:            "/explain-v1-pod",
+			body:           "metadata: [",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "method not allowed",
+			method:         http.MethodGet,
+			url:            "/explain-v1-pod",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &podMutator{
+				client:  fake.NewClientBuilder().WithObjects(serviceAccount).Build(),
+				reader:  fake.NewClientBuilder().Build(),
+				config:  &config.Config{TenantID: "tenant-id"},
+				decoder: decoder,
+			}
+			explainer, err := NewPodExplainer(m)
+			if err != nil {
+				t.Fatalf("failed to create pod explainer: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			explainer.ServeHTTP(rec, httptest.NewRequest(test.method, test.url, strings.NewReader(test.body)))
+			if rec.Code != test.expectedStatus {
+				t.Fatalf("expected status: %d, got: %d (%s)", test.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			resp := &ExplainResponse{}
+			if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if resp.Allowed != test.expectedAllowed {
+				t.Errorf("expected allowed: %v, got: %v (%s)", test.expectedAllowed, resp.Allowed, resp.Reason)
+			}
+			if !strings.Contains(resp.Reason, test.expectedReason) {
+				t.Errorf("expected reason to contain: %s, got: %s", test.expectedReason, resp.Reason)
+			}
+			if resp.Allowed && len(resp.Patches) == 0 {
+				t.Errorf("expected patches, got none")
+			}
+			trace := strings.Join(resp.Trace, "\n")
+			for _, step := range test.expectedTrace {
+				if !strings.Contains(trace, step) {
+					t.Errorf("expected trace to contain: %s, got:\n%s", step, trace)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPodExplainerInvalidHandler(t *testing.T) {
+	if _, err := NewPodExplainer(&podValidator{decoder: decoder}); err == nil {
+		t.Fatalf("expected error for non pod mutator handler")
+	}
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"monis.app/mlog"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/azure-workload-identity/pkg/config"
+)
+
+// this is required to watch the webhook policy ConfigMap
+// +kubebuilder:rbac:groups="",namespace=azure-workload-identity-system,resources=configmaps,verbs=get;list;watch
+
+// WorkloadIdentityConfigKey is the key in the policy ConfigMap that holds the WorkloadIdentityConfig
+const WorkloadIdentityConfigKey = "config.yaml"
+
+// policyReconciler loads the WorkloadIdentityConfig from the policy ConfigMap into the policy store
+type policyReconciler struct {
+	client client.Client
+	policy *config.PolicyStore
+	logger mlog.Logger
+}
+
+// SetupPolicyReconciler registers a controller with the manager that watches the policy ConfigMap
+// and returns the store that holds the latest valid WorkloadIdentityConfig
+func SetupPolicyReconciler(mgr ctrl.Manager, key types.NamespacedName) (*config.PolicyStore, error) {
+	r := &policyReconciler{
+		client: mgr.GetClient(),
+		policy: &config.PolicyStore{},
+		logger: mlog.New().WithName("policy"),
+	}
+	err := ctrl.NewControllerManagedBy(mgr).
+		Named("workload-identity-config").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetNamespace() == key.Namespace && obj.GetName() == key.Name
+		}))).
+		Complete(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up policy reconciler")
+	}
+	return r.policy, nil
+}
+
+// Reconcile updates the policy store from the policy ConfigMap. An invalid policy is
+// logged and ignored so that the last valid policy stays in effect.
+func (r *policyReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.client.Get(ctx, req.NamespacedName, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.logger.Info("policy configmap not found, resetting policy", "configmap", req.NamespacedName.String())
+			r.policy.Store(nil)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	wic, err := parseWorkloadIdentityConfig(cm)
+	if err != nil {
+		r.logger.Error("invalid policy, keeping the previous policy", err, "configmap", req.NamespacedName.String())
+		return reconcile.Result{}, nil
+	}
+	r.policy.Store(wic)
+	r.logger.Info("loaded policy", "configmap", req.NamespacedName.String(), "resourceVersion", cm.ResourceVersion)
+	return reconcile.Result{}, nil
+}
+
+// parseWorkloadIdentityConfig parses and validates the WorkloadIdentityConfig in the policy ConfigMap
+func parseWorkloadIdentityConfig(cm *corev1.ConfigMap) (*config.WorkloadIdentityConfig, error) {
+	data, ok := cm.Data[WorkloadIdentityConfigKey]
+	if !ok {
+		return nil, errors.Errorf("key %s not found in configmap", WorkloadIdentityConfigKey)
+	}
+	wic, err := config.ParseWorkloadIdentityConfig([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	if exp := wic.ServiceAccountTokenExpiration; exp != 0 && !validServiceAccountTokenExpiry(exp) {
+		return nil, errors.Errorf("serviceAccountTokenExpiration %d must be between %d and %d",
+			exp, MinServiceAccountTokenExpiration, MaxServiceAccountTokenExpiration)
+	}
+	for name, ns := range wic.Namespaces {
+		if exp := ns.ServiceAccountTokenExpiration; exp != 0 && !validServiceAccountTokenExpiry(exp) {
+			return nil, errors.Errorf("serviceAccountTokenExpiration %d for namespace %s must be between %d and %d",
+				exp, name, MinServiceAccountTokenExpiration, MaxServiceAccountTokenExpiration)
+		}
+	}
+	return wic, nil
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"monis.app/mlog"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Azure/azure-workload-identity/pkg/config"
+)
+
+func newPolicyConfigMap(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "azure-wi-webhook-policy",
+			Namespace: "azure-workload-identity-system",
+		},
+		Data: map[string]string{WorkloadIdentityConfigKey: data},
+	}
+}
+
+func TestParseWorkloadIdentityConfigFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name        string
+		cm          *corev1.ConfigMap
+		expectedErr string
+	}{
+		{
+			name: "valid policy",
+			cm:   newPolicyConfigMap("tenantID: tenant-id\nserviceAccountTokenExpiration: 7200"),
+		},
+		{
+			name: "missing key",
+			cm: &corev1.ConfigMap{
+				Data: map[string]string{"config.json": "{}"},
+			},
+			expectedErr: "key config.yaml not found in configmap",
+		},
+		{
+			name:        "invalid yaml",
+			cm:          newPolicyConfigMap("tenantID: [tenant-id"),
+			expectedErr: "failed to parse workload identity config",
+		},
+		{
+			name:        "token expiration out of range",
+			cm:          newPolicyConfigMap("serviceAccountTokenExpiration: 100"),
+			expectedErr: "serviceAccountTokenExpiration 100 must be between 3600 and 86400",
+		},
+		{
+			name:        "namespace token expiration out of range",
+			cm:          newPolicyConfigMap("namespaces:\n  team-a:\n    serviceAccountTokenExpiration: 90000"),
+			expectedErr: "serviceAccountTokenExpiration 90000 for namespace team-a must be between 3600 and 86400",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseWorkloadIdentityConfig(test.cm)
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("expected error to contain: %s, got: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestPolicyReconciler(t *testing.T) {
+	ctx := context.Background()
+	cm := newPolicyConfigMap("tenantID: tenant-id")
+	c := fake.NewClientBuilder().WithObjects(cm).Build()
+	r := &policyReconciler{
+		client: c,
+		policy: &config.PolicyStore{},
+		logger: mlog.New().WithName("policy"),
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}}
+
+	// valid policy is loaded
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if wic := r.policy.Load(); wic == nil || wic.TenantID != "tenant-id" {
+		t.Fatalf("expected policy with tenant id tenant-id, got: %+v", wic)
+	}
+
+	// invalid policy keeps the previous policy
+	cm.Data[WorkloadIdentityConfigKey] = "tenantID: [tenant-id"
+	if err := c.Update(ctx, cm); err != nil {
+		t.Fatalf("failed to update configmap: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if wic := r.policy.Load(); wic == nil || wic.TenantID != "tenant-id" {
+		t.Fatalf("expected previous policy to be kept, got: %+v", wic)
+	}
+
+	// deleting the configmap resets the policy
+	if err := c.Delete(ctx, cm); err != nil {
+		t.Fatalf("failed to delete configmap: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if wic := r.policy.Load(); wic != nil {
+		t.Fatalf("expected policy to be reset, got: %+v", wic)
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	policy := &config.PolicyStore{}
+	m := &podMutator{
+		config:         &config.Config{TenantID: "tenant-id"},
+		proxyImage:     "proxy:v0",
+		proxyInitImage: "proxy-init:v0",
+		policy:         policy,
+	}
+
+	if got := m.withPolicy("default"); got != m {
+		t.Fatalf("expected the mutator to be returned as is without a policy")
+	}
+
+	policy.Store(&config.WorkloadIdentityConfig{
+		TenantID:   "policy-tenant-id",
+		ProxyImage: "proxy:v1",
+		Namespaces: map[string]config.NamespaceConfig{
+			"team-a": {TenantID: "tenant-a"},
+		},
+	})
+
+	tests := []struct {
+		namespace              string
+		expectedTenantID       string
+		expectedProxyImage     string
+		expectedProxyInitImage string
+	}{
+		{
+			namespace:              "default",
+			expectedTenantID:       "policy-tenant-id",
+			expectedProxyImage:     "proxy:v1",
+			expectedProxyInitImage: "proxy-init:v0",
+		},
+		{
+			namespace:              "team-a",
+			expectedTenantID:       "tenant-a",
+			expectedProxyImage:     "proxy:v1",
+			expectedProxyInitImage: "proxy-init:v0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.namespace, func(t *testing.T) {
+			got := m.withPolicy(test.namespace)
+			if got.config.TenantID != test.expectedTenantID {
+				t.Errorf("expected tenant id: %s, got: %s", test.expectedTenantID, got.config.TenantID)
+			}
+			if got.proxyImage != test.expectedProxyImage {
+				t.Errorf("expected proxy image: %s, got: %s", test.expectedProxyImage, got.proxyImage)
+			}
+			if got.proxyInitImage != test.expectedProxyInitImage {
+				t.Errorf("expected proxy init image: %s, got: %s", test.expectedProxyInitImage, got.proxyInitImage)
+			}
+		})
+	}
+
+	if m.config.TenantID != "tenant-id" || m.proxyImage != "proxy:v0" {
+		t.Errorf("expected the original mutator to be unchanged")
+	}
+}
@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"monis.app/mlog"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate-v1-serviceaccount,mutating=false,failurePolicy=ignore,groups="",resources=serviceaccounts,verbs=create;update,versions=v1,name=serviceaccount.validation.azure-workload-identity.io,sideEffects=None,admissionReviewVersions=v1;v1beta1,matchPolicy=Equivalent
+// +kubebuilder:webhook:path=/validate-v1-pod,mutating=false,failurePolicy=fail,groups="",resources=pods,verbs=create,versions=v1,name=pod.validation.azure-workload-identity.io,sideEffects=None,admissionReviewVersions=v1;v1beta1,matchPolicy=Equivalent
+
+// this is required for the validating webhook certs to be injected as part of cert-controller rotator
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;update
+
+var annotationsPath = field.NewPath("metadata", "annotations")
+
+// serviceAccountValidator validates the workload identity annotations on service accounts
+type serviceAccountValidator struct {
+	decoder admission.Decoder
+}
+
+// podValidator validates the workload identity annotations on pods
+type podValidator struct {
+	decoder admission.Decoder
+}
+
+// NewServiceAccountValidator returns a service account validation handler
+func NewServiceAccountValidator(scheme *runtime.Scheme) admission.Handler {
+	return &serviceAccountValidator{
+		decoder: admission.NewDecoder(scheme),
+	}
+}
+
+// NewPodValidator returns a pod validation handler
+func NewPodValidator(scheme *runtime.Scheme) admission.Handler {
+	return &podValidator{
+		decoder: admission.NewDecoder(scheme),
+	}
+}
+
+// Handle rejects service accounts with invalid workload identity annotations
+func (v *serviceAccountValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sa := &corev1.ServiceAccount{}
+	if err := v.decoder.Decode(req, sa); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if errs := validateServiceAccount(sa); len(errs) > 0 {
+		mlog.New().WithName("validator").Debug("denied service account",
+			"service-account", sa.GetName(), "namespace", req.Namespace, "reason", errs.ToAggregate().Error())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// Handle rejects pods with invalid workload identity annotations and warns about
+// annotations that are ignored
+func (v *podValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := v.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	errs, warnings := validatePod(pod)
+	if len(errs) > 0 {
+		podName := pod.GetName()
+		if podName == "" {
+			podName = pod.GetGenerateName() + " (prefix)"
+		}
+		mlog.New().WithName("validator").Debug("denied pod",
+			"pod", podName, "namespace", req.Namespace, "reason", errs.ToAggregate().Error())
+		return admission.Denied(errs.ToAggregate().Error()).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// validateServiceAccount validates the workload identity annotations in the service account.
+// Annotations with empty values are treated as unset, which is consistent with the mutating webhook.
+func validateServiceAccount(sa *corev1.ServiceAccount) field.ErrorList {
+	var errs field.ErrorList
+	if clientID := sa.Annotations[ClientIDAnnotation]; clientID != "" {
+		errs = append(errs, validateUUID(annotationsPath.Key(ClientIDAnnotation), clientID)...)
+	}
+	if tenantID := sa.Annotations[TenantIDAnnotation]; tenantID != "" {
+		errs = append(errs, validateUUID(annotationsPath.Key(TenantIDAnnotation), tenantID)...)
+	}
+	if expiry := sa.Annotations[ServiceAccountTokenExpiryAnnotation]; expiry != "" {
+		errs = append(errs, validateServiceAccountTokenExpiry(annotationsPath.Key(ServiceAccountTokenExpiryAnnotation), expiry)...)
+	}
+	return errs
+}
+
+// validatePod validates the workload identity annotations in the pod. Containers in the skip-containers
+// annotation that do not exist in the pod are returned as warnings, as they were allowed before the
+// pod validation was added and skipping a missing container is a no-op.
+func validatePod(pod *corev1.Pod) (field.ErrorList, admission.Warnings) {
+	var errs field.ErrorList
+	var warnings admission.Warnings
+	if clientID := pod.Annotations[ClientIDAnnotation]; clientID != "" {
+		errs = append(errs, validateUUID(annotationsPath.Key(ClientIDAnnotation), clientID)...)
+	}
+	if tenantID := pod.Annotations[TenantIDAnnotation]; tenantID != "" {
+		errs = append(errs, validateUUID(annotationsPath.Key(TenantIDAnnotation), tenantID)...)
+	}
+	if expiry := pod.Annotations[ServiceAccountTokenExpiryAnnotation]; expiry != "" {
+		errs = append(errs, validateServiceAccountTokenExpiry(annotationsPath.Key(ServiceAccountTokenExpiryAnnotation), expiry)...)
+	}
+	containers := sets.New[string]()
+	for _, c := range pod.Spec.InitContainers {
+		containers.Insert(c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		containers.Insert(c.Name)
+	}
+	if _, ok := pod.Annotations[SkipContainersAnnotation]; ok {
+		for _, name := range sets.List(getSkipContainers(pod)) {
+			if name == "" {
+				continue
+			}
+			if !containers.Has(name) {
+				warnings = append(warnings, fmt.Sprintf("%s: container %q does not exist in the pod", annotationsPath.Key(SkipContainersAnnotation), name))
+			}
+		}
+	}
+	if _, ok := pod.Annotations[ContainerClientIDsAnnotation]; ok {
+		fldPath := annotationsPath.Key(ContainerClientIDsAnnotation)
+		containerClientIDs, err := getContainerClientIDs(pod)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath, pod.Annotations[ContainerClientIDsAnnotation], err.Error()))
+		}
+		for _, name := range sets.List(sets.KeySet(containerClientIDs)) {
+			if !containers.Has(name) {
+				errs = append(errs, field.Invalid(fldPath, name, "container does not exist in the pod"))
+			}
+			errs = append(errs, validateUUID(fldPath, containerClientIDs[name])...)
+		}
+	}
+	if _, ok := pod.Annotations[ExtraAudiencesAnnotation]; ok {
+		if _, err := getExtraAudiences(pod); err != nil {
+			errs = append(errs, field.Invalid(annotationsPath.Key(ExtraAudiencesAnnotation), pod.Annotations[ExtraAudiencesAnnotation], err.Error()))
+		}
+	}
+	for _, annotation := range []string{InjectAppServiceEnvAnnotation, InjectAzureArcEnvAnnotation, ProxySidecarStrictModeAnnotation} {
+		value, ok := pod.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		fldPath := annotationsPath.Key(annotation)
+		if enabled, err := strconv.ParseBool(value); err != nil {
+			errs = append(errs, field.Invalid(fldPath, value, "must be true or false"))
+		} else if enabled && !shouldInjectProxySidecar(pod) {
+			errs = append(errs, field.Forbidden(fldPath, fmt.Sprintf("requires the %s annotation", InjectProxySidecarAnnotation)))
+		}
+	}
+	if _, ok := pod.Annotations[ProxySidecarModeAnnotation]; ok {
+		fldPath := annotationsPath.Key(ProxySidecarModeAnnotation)
+		if _, err := getProxySidecarMode(pod); err != nil {
+			errs = append(errs, field.NotSupported(fldPath, pod.Annotations[ProxySidecarModeAnnotation], []string{ProxySidecarModeRedirect, ProxySidecarModeEnv}))
+		} else if !shouldInjectProxySidecar(pod) {
+			errs = append(errs, field.Forbidden(fldPath, fmt.Sprintf("requires the %s annotation", InjectProxySidecarAnnotation)))
+		}
+	}
+	if shouldInjectAppServiceEnv(pod) && shouldInjectAzureArcEnv(pod) {
+		errs = append(errs, field.Forbidden(annotationsPath.Key(InjectAzureArcEnvAnnotation), fmt.Sprintf("cannot be used together with the %s annotation", InjectAppServiceEnvAnnotation)))
+	}
+	if shouldInjectProxySidecar(pod) {
+		if pod.Spec.HostNetwork {
+			errs = append(errs, field.Forbidden(annotationsPath.Key(InjectProxySidecarAnnotation), "proxy sidecar cannot be injected when hostNetwork is set to true"))
+		}
+		for _, annotation := range []string{ProxySidecarPortAnnotation, ProxySidecarMetricsPortAnnotation} {
+			if port, ok := pod.Annotations[annotation]; ok {
+				if parsed, err := strconv.ParseInt(port, 10, 32); err != nil || parsed < 1 || parsed > 65535 {
+					errs = append(errs, field.Invalid(annotationsPath.Key(annotation), port, "must be a valid port number between 1 and 65535"))
+				}
+			}
+		}
+		for _, annotation := range []string{ProxyCPURequestAnnotation, ProxyCPULimitAnnotation, ProxyMemoryRequestAnnotation, ProxyMemoryLimitAnnotation} {
+			if quantity := pod.Annotations[annotation]; quantity != "" {
+				if _, err := resource.ParseQuantity(quantity); err != nil {
+					errs = append(errs, field.Invalid(annotationsPath.Key(annotation), quantity, "must be a valid quantity"))
+				}
+			}
+		}
+		if policy, ok := pod.Annotations[ProxyImagePullPolicyAnnotation]; ok {
+			switch corev1.PullPolicy(policy) {
+			case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+			default:
+				errs = append(errs, field.NotSupported(annotationsPath.Key(ProxyImagePullPolicyAnnotation), policy, []corev1.PullPolicy{corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever}))
+			}
+		}
+		for _, annotation := range []string{ProxyStartupProbeAnnotation, ProxyReadinessProbeAnnotation, ProxyLivenessProbeAnnotation} {
+			if _, err := getProxyProbe(pod, annotation); err != nil {
+				errs = append(errs, field.Invalid(annotationsPath.Key(annotation), pod.Annotations[annotation], err.Error()))
+			}
+		}
+	}
+	return errs, warnings
+}
+
+// validateUUID validates that the value is a UUID in the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form
+func validateUUID(fldPath *field.Path, value string) field.ErrorList {
+	// uuid.Parse also accepts the urn and braced forms, which AAD does not
+	if _, err := uuid.Parse(value); err != nil || len(value) != 36 {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be a valid UUID")}
+	}
+	return nil
+}
+
+// validateServiceAccountTokenExpiry validates that the value is an integer within the accepted expiration range
+func validateServiceAccountTokenExpiry(fldPath *field.Path, value string) field.ErrorList {
+	expiry, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be an integer number of seconds")}
+	}
+	if !validServiceAccountTokenExpiry(expiry) {
+		return field.ErrorList{field.Invalid(fldPath, value,
+			fmt.Sprintf("must be between %d and %d", MinServiceAccountTokenExpiration, MaxServiceAccountTokenExpiration))}
+	}
+	return nil
+}
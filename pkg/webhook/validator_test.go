@@ -0,0 +1,411 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	testClientID = "00000000-0000-0000-0000-000000000001"
+	testTenantID = "00000000-0000-0000-0000-000000000002"
+)
+
+func TestValidateServiceAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expectedErr string
+	}{
+		{
+			name:        "no annotations",
+			annotations: nil,
+		},
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				ClientIDAnnotation:                  testClientID,
+				TenantIDAnnotation:                  testTenantID,
+				ServiceAccountTokenExpiryAnnotation: "86400",
+			},
+		},
+		{
+			name:        "empty client id is treated as unset",
+			annotations: map[string]string{ClientIDAnnotation: ""},
+		},
+		{
+			name:        "client id is not a uuid",
+			annotations: map[string]string{ClientIDAnnotation: "client-id"},
+			expectedErr: `metadata.annotations[azure.workload.identity/client-id]: Invalid value: "client-id": must be a valid UUID`,
+		},
+		{
+			name:        "client id in braced form",
+			annotations: map[string]string{ClientIDAnnotation: "{" + testClientID + "}"},
+			expectedErr: "must be a valid UUID",
+		},
+		{
+			name:        "tenant id is not a uuid",
+			annotations: map[string]string{TenantIDAnnotation: "contoso.onmicrosoft.com"},
+			expectedErr: `metadata.annotations[azure.workload.identity/tenant-id]: Invalid value: "contoso.onmicrosoft.com": must be a valid UUID`,
+		},
+		{
+			name:        "token expiry is not an integer",
+			annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "3600s"},
+			expectedErr: "must be an integer number of seconds",
+		},
+		{
+			name:        "token expiry < 3600",
+			annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "3599"},
+			expectedErr: "must be between 3600 and 86400",
+		},
+		{
+			name:        "token expiry > 86400",
+			annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "86401"},
+			expectedErr: "must be between 3600 and 86400",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: test.annotations,
+				},
+			}
+			errs := validateServiceAccount(sa)
+			if test.expectedErr == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no error, got: %v", errs.ToAggregate())
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatalf("expected error to contain: %s, got none", test.expectedErr)
+			}
+			if !strings.Contains(errs.ToAggregate().Error(), test.expectedErr) {
+				t.Fatalf("expected error to contain: %s, got: %v", test.expectedErr, errs.ToAggregate())
+			}
+		})
+	}
+}
+
+func TestValidatePod(t *testing.T) {
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		hostNetwork     bool
+		expectedErr     string
+		expectedWarning string
+	}{
+		{
+			name:        "no annotations",
+			annotations: nil,
+		},
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				ServiceAccountTokenExpiryAnnotation: "3600",
+				SkipContainersAnnotation:            "init-container; container",
+				InjectProxySidecarAnnotation:        "true",
+				ProxySidecarPortAnnotation:          "8080",
+			},
+		},
+		{
+			name:        "valid client id and tenant id",
+			annotations: map[string]string{ClientIDAnnotation: testClientID, TenantIDAnnotation: testTenantID},
+		},
+		{
+			name:        "client id is not a uuid",
+			annotations: map[string]string{ClientIDAnnotation: "client-id"},
+			expectedErr: `metadata.annotations[azure.workload.identity/client-id]: Invalid value: "client-id": must be a valid UUID`,
+		},
+		{
+			name:        "tenant id is not a uuid",
+			annotations: map[string]string{TenantIDAnnotation: "tenant-id"},
+			expectedErr: `metadata.annotations[azure.workload.identity/tenant-id]: Invalid value: "tenant-id": must be a valid UUID`,
+		},
+		{
+			name:        "invalid token expiry",
+			annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "100"},
+			expectedErr: "must be between 3600 and 86400",
+		},
+		{
+			name:            "unknown skip container",
+			annotations:     map[string]string{SkipContainersAnnotation: "container;sidecar"},
+			expectedWarning: `metadata.annotations[azure.workload.identity/skip-containers]: container "sidecar" does not exist in the pod`,
+		},
+		{
+			name:        "valid container client ids",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "container=" + testClientID},
+		},
+		{
+			name:        "container client ids for unknown container",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "sidecar=" + testClientID},
+			expectedErr: `metadata.annotations[azure.workload.identity/container-client-ids]: Invalid value: "sidecar": container does not exist in the pod`,
+		},
+		{
+			name:        "container client ids with invalid client id",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "container=client-id"},
+			expectedErr: `Invalid value: "client-id": must be a valid UUID`,
+		},
+		{
+			name:        "malformed container client ids",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "container"},
+			expectedErr: "Expected format is <container name>=<client id>",
+		},
+		{
+			name:        "invalid extra audiences",
+			annotations: map[string]string{ExtraAudiencesAnnotation: "Vault=https://vault.example.com"},
+			expectedErr: `invalid extra audience name "Vault"`,
+		},
+		{
+			name:        "proxy sidecar with host network",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true"},
+			hostNetwork: true,
+			expectedErr: "proxy sidecar cannot be injected when hostNetwork is set to true",
+		},
+		{
+			name:        "host network without proxy sidecar",
+			annotations: nil,
+			hostNetwork: true,
+		},
+		{
+			name:        "invalid proxy metrics port",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarMetricsPortAnnotation: "0"},
+			expectedErr: `metadata.annotations[azure.workload.identity/proxy-sidecar-metrics-port]: Invalid value: "0": must be a valid port number between 1 and 65535`,
+		},
+		{
+			name:        "invalid proxy port",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarPortAnnotation: "70000"},
+			expectedErr: "must be a valid port number between 1 and 65535",
+		},
+		{
+			name:        "app service env with proxy sidecar",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAppServiceEnvAnnotation: "true"},
+		},
+		{
+			name:        "app service env without proxy sidecar",
+			annotations: map[string]string{InjectAppServiceEnvAnnotation: "true"},
+			expectedErr: "requires the azure.workload.identity/inject-proxy-sidecar annotation",
+		},
+		{
+			name:        "app service env disabled without proxy sidecar",
+			annotations: map[string]string{InjectAppServiceEnvAnnotation: "false"},
+		},
+		{
+			name:        "invalid app service env",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAppServiceEnvAnnotation: "yes"},
+			expectedErr: "must be true or false",
+		},
+		{
+			name:        "azure arc env with proxy sidecar",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAzureArcEnvAnnotation: "true"},
+		},
+		{
+			name:        "azure arc env without proxy sidecar",
+			annotations: map[string]string{InjectAzureArcEnvAnnotation: "True"},
+			expectedErr: "requires the azure.workload.identity/inject-proxy-sidecar annotation",
+		},
+		{
+			name:        "azure arc env and app service env",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAppServiceEnvAnnotation: "true", InjectAzureArcEnvAnnotation: "true"},
+			expectedErr: "cannot be used together with the azure.workload.identity/inject-app-service-env annotation",
+		},
+		{
+			name:        "proxy sidecar strict mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarStrictModeAnnotation: "true"},
+		},
+		{
+			name:        "proxy sidecar strict mode without proxy sidecar",
+			annotations: map[string]string{ProxySidecarStrictModeAnnotation: "true"},
+			expectedErr: "requires the azure.workload.identity/inject-proxy-sidecar annotation",
+		},
+		{
+			name:        "invalid proxy sidecar strict mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarStrictModeAnnotation: "strict"},
+			expectedErr: "must be true or false",
+		},
+		{
+			name: "proxy resources and image pull policy",
+			annotations: map[string]string{
+				InjectProxySidecarAnnotation:   "true",
+				ProxyCPURequestAnnotation:      "10m",
+				ProxyMemoryLimitAnnotation:     "64Mi",
+				ProxyImagePullPolicyAnnotation: "Always",
+			},
+		},
+		{
+			name:        "invalid proxy resource",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxyMemoryLimitAnnotation: "64MB"},
+			expectedErr: "must be a valid quantity",
+		},
+		{
+			name:        "invalid proxy image pull policy",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxyImagePullPolicyAnnotation: "always"},
+			expectedErr: `Unsupported value: "always"`,
+		},
+		{
+			name: "proxy probes",
+			annotations: map[string]string{
+				InjectProxySidecarAnnotation:  "true",
+				ProxyStartupProbeAnnotation:   "",
+				ProxyLivenessProbeAnnotation:  `{"periodSeconds": 60}`,
+				ProxyReadinessProbeAnnotation: `{"failureThreshold": 5}`,
+			},
+		},
+		{
+			name:        "invalid proxy probe",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxyLivenessProbeAnnotation: `{"successThreshold": 3}`},
+			expectedErr: "successThreshold in azure.workload.identity/proxy-liveness-probe annotation must be 1",
+		},
+		{
+			name:        "proxy sidecar env mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: "env"},
+		},
+		{
+			name:        "proxy sidecar env mode without proxy sidecar",
+			annotations: map[string]string{ProxySidecarModeAnnotation: "env"},
+			expectedErr: "requires the azure.workload.identity/inject-proxy-sidecar annotation",
+		},
+		{
+			name:        "invalid proxy sidecar mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: "iptables"},
+			expectedErr: `Unsupported value: "iptables"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := newPod("pod", "default", "sa", nil, test.annotations, test.hostNetwork)
+			errs, warnings := validatePod(pod)
+			if test.expectedWarning == "" && len(warnings) > 0 {
+				t.Fatalf("expected no warning, got: %v", warnings)
+			}
+			if test.expectedWarning != "" && (len(warnings) != 1 || warnings[0] != test.expectedWarning) {
+				t.Fatalf("expected warning: %s, got: %v", test.expectedWarning, warnings)
+			}
+			if test.expectedErr == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no error, got: %v", errs.ToAggregate())
+				}
+				return
+			}
+			if len(errs) == 0 {
+				t.Fatalf("expected error to contain: %s, got none", test.expectedErr)
+			}
+			if !strings.Contains(errs.ToAggregate().Error(), test.expectedErr) {
+				t.Fatalf("expected error to contain: %s, got: %v", test.expectedErr, errs.ToAggregate())
+			}
+		})
+	}
+}
+
+func TestServiceAccountValidatorHandle(t *testing.T) {
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		expectedAllowed bool
+	}{
+		{
+			name:            "valid service account",
+			annotations:     map[string]string{ClientIDAnnotation: testClientID},
+			expectedAllowed: true,
+		},
+		{
+			name:            "invalid service account",
+			annotations:     map[string]string{ClientIDAnnotation: "client-id"},
+			expectedAllowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw, err := json.Marshal(&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "ns1",
+					Annotations: test.annotations,
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal service account: %v", err)
+			}
+
+			v := &serviceAccountValidator{decoder: decoder}
+			resp := v.Handle(context.Background(), atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "ServiceAccount",
+					},
+					Object:    runtime.RawExtension{Raw: raw},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			})
+			if resp.Allowed != test.expectedAllowed {
+				t.Fatalf("expected allowed: %v, got: %v (%v)", test.expectedAllowed, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestPodValidatorHandle(t *testing.T) {
+	tests := []struct {
+		name             string
+		rawPod           []byte
+		expectedAllowed  bool
+		expectedWarnings int
+	}{
+		{
+			name:            "valid pod",
+			rawPod:          newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"}, map[string]string{SkipContainersAnnotation: "container"}, false),
+			expectedAllowed: true,
+		},
+		{
+			name:             "unknown skip container",
+			rawPod:           newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"}, map[string]string{SkipContainersAnnotation: "unknown"}, false),
+			expectedAllowed:  true,
+			expectedWarnings: 1,
+		},
+		{
+			name:            "invalid pod",
+			rawPod:          newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"}, map[string]string{ClientIDAnnotation: "client-id"}, false),
+			expectedAllowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &podValidator{decoder: decoder}
+			resp := v.Handle(context.Background(), atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "Pod",
+					},
+					Object:    runtime.RawExtension{Raw: test.rawPod},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			})
+			if resp.Allowed != test.expectedAllowed {
+				t.Fatalf("expected allowed: %v, got: %v (%v)", test.expectedAllowed, resp.Allowed, resp.Result)
+			}
+			if len(resp.Warnings) != test.expectedWarnings {
+				t.Fatalf("expected %d warnings, got: %v", test.expectedWarnings, resp.Warnings)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package webhook
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -15,6 +17,7 @@ import (
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -41,6 +44,7 @@ var (
 
 // +kubebuilder:webhook:path=/mutate-v1-pod,mutating=true,failurePolicy=fail,groups="",resources=pods,verbs=create,versions=v1,name=mutation.azure-workload-identity.io,sideEffects=None,admissionReviewVersions=v1;v1beta1,matchPolicy=Equivalent,reinvocationPolicy=IfNeeded
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // this is required for the webhook server certs generated and rotated as part of cert-controller rotator
 // +kubebuilder:rbac:groups="",namespace=azure-workload-identity-system,resources=secrets,verbs=get;list;watch;create;update;patch;delete
@@ -60,6 +64,8 @@ type podMutator struct {
 	proxyInitImage      string
 	useNativeSidecar    bool
 	customTokenEndpoint customTokenEndpointConfig
+	// policy holds the WorkloadIdentityConfig that is hot-reloaded from the policy ConfigMap
+	policy *config.PolicyStore
 }
 
 // customTokenEndpointConfig holds the configuration for custom token endpoint
@@ -70,7 +76,7 @@ type customTokenEndpointConfig struct {
 }
 
 // NewPodMutator returns a pod mutation handler
-func NewPodMutator(client client.Client, reader client.Reader, audience string, scheme *runtime.Scheme, restConfig *rest.Config, customTokenEndpointAnnotationSuffix, customTokenEndpointAudience string) (admission.Handler, error) {
+func NewPodMutator(client client.Client, reader client.Reader, audience string, scheme *runtime.Scheme, restConfig *rest.Config, customTokenEndpointAnnotationSuffix, customTokenEndpointAudience string, policy *config.PolicyStore) (admission.Handler, error) {
 	c, err := config.ParseConfig()
 	if err != nil {
 		return nil, err
@@ -148,6 +154,7 @@ func NewPodMutator(client client.Client, reader client.Reader, audience string,
 		proxyInitImage:      proxyInitImage,
 		useNativeSidecar:    useNativeSidecar,
 		customTokenEndpoint: cteConfig,
+		policy:              policy,
 	}, nil
 }
 
@@ -158,6 +165,12 @@ func (m *podMutator) Handle(ctx context.Context, req admission.Request) (respons
 		ReportRequest(ctx, req.Namespace, time.Since(timeStart))
 	}()
 
+	return m.mutate(ctx, req, nil)
+}
+
+// mutate runs the pod mutation for the admission request and records
+// the decisions that were made in the trace if it's not nil
+func (m *podMutator) mutate(ctx context.Context, req admission.Request, trace *decisionTrace) admission.Response {
 	pod := &corev1.Pod{}
 	err := m.decoder.Decode(req, pod)
 	if err != nil {
@@ -180,6 +193,16 @@ func (m *podMutator) Handle(ctx context.Context, req admission.Request) (respons
 	}
 
 	logger := mlog.New().WithName("handler").WithValues("pod", podName, "namespace", pod.Namespace, "service-account", serviceAccountName)
+	if pod.Labels[UseWorkloadIdentityLabel] != "true" {
+		trace.record("pod is not labeled with %s=true, the webhook is not called for this pod", UseWorkloadIdentityLabel)
+	}
+	// apply the current policy once for the whole request so that
+	// policy updates do not affect requests that are in flight
+	if m.policy.Load() != nil {
+		trace.record("applied the webhook policy for namespace %s", pod.Namespace)
+	}
+	m = m.withPolicy(pod.Namespace)
+
 	// get service account associated with the pod
 	serviceAccount := &corev1.ServiceAccount{}
 	if err = m.client.Get(ctx, types.NamespacedName{Name: serviceAccountName, Namespace: pod.Namespace}, serviceAccount); err != nil {
@@ -194,13 +217,36 @@ func (m *podMutator) Handle(ctx context.Context, req admission.Request) (respons
 			return admission.Errored(http.StatusBadRequest, err)
 		}
 	}
+	trace.record("using service account %s/%s", pod.Namespace, serviceAccountName)
 
+	// get the namespace of the pod for the namespace level default annotations
+	namespace := &corev1.Namespace{}
+	if err = m.client.Get(ctx, types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error("failed to get namespace", err)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// bypass cache and get from the API server as it's not found in cache
+		if err = m.reader.Get(ctx, types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+			if !apierrors.IsNotFound(err) {
+				logger.Error("failed to get namespace", err)
+				return admission.Errored(http.StatusBadRequest, err)
+			}
+			// the namespace has no defaults if it doesn't exist
+			namespace = &corev1.Namespace{}
+			trace.record("namespace %s not found, no namespace defaults are used", pod.Namespace)
+		}
+	}
+
+	// endpoint is the token endpoint served by the proxy sidecar in addition to IMDS
+	var endpoint *proxyEndpoint
 	if shouldInjectProxySidecar(pod) {
 		// if the pod has hostNetwork set to true, we cannot inject the proxy sidecar
 		// as it'll end up modifying the network stack of the host and affecting other pods
 		if pod.Spec.HostNetwork {
 			err := errors.New("hostNetwork is set to true, cannot inject proxy sidecar")
 			logger.Error("failed to inject proxy sidecar", err)
+			trace.record("proxy sidecar not injected: %v", err)
 			return admission.Errored(http.StatusBadRequest, err)
 		}
 
@@ -210,33 +256,126 @@ func (m *podMutator) Handle(ctx context.Context, req admission.Request) (respons
 			return admission.Errored(http.StatusBadRequest, err)
 		}
 
-		pod.Spec.InitContainers = m.injectProxyInitContainer(pod.Spec.InitContainers, proxyPort)
+		proxyMetricsPort, err := getProxyMetricsPort(pod, proxyPort)
+		if err != nil {
+			logger.Error("failed to get proxy metrics port", err)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		mode, err := getProxySidecarMode(pod)
+		if err != nil {
+			logger.Error("failed to get proxy sidecar mode", err)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		level := getPodSecurityLevel(namespace)
+		if err := validateProxyPodSecurity(level, mode); err != nil {
+			err = errors.Wrapf(err, "cannot inject proxy sidecar in namespace %s", pod.Namespace)
+			logger.Error("failed to inject proxy sidecar", err)
+			trace.record("proxy sidecar not injected: %v", err)
+			return admission.Denied(err.Error())
+		}
+		trace.record("proxy containers comply with the %s Pod Security Standard enforced in namespace %s", level, pod.Namespace)
+
+		opts, err := getProxyOptions(pod, m.config)
+		if err != nil {
+			logger.Error("failed to get proxy options", err)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+
+		switch {
+		case shouldInjectAppServiceEnv(pod) && shouldInjectAzureArcEnv(pod):
+			err := errors.Errorf("%s and %s cannot be used together", InjectAppServiceEnvAnnotation, InjectAzureArcEnvAnnotation)
+			logger.Error("failed to inject proxy sidecar", err)
+			return admission.Errored(http.StatusBadRequest, err)
+		case shouldInjectAppServiceEnv(pod):
+			identityHeader, err := getIdentityHeader(pod)
+			if err != nil {
+				logger.Error("failed to generate identity header", err)
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+			endpoint = appServiceEndpoint(proxyPort, identityHeader)
+			trace.record("App Service managed identity environment variables injected because the pod is annotated with %s", InjectAppServiceEnvAnnotation)
+		case shouldInjectAzureArcEnv(pod):
+			endpoint = azureArcEndpoint(proxyPort)
+			trace.record("Azure Arc environment variables and key volume injected because the pod is annotated with %s", InjectAzureArcEnvAnnotation)
+		}
+
+		strictMode := shouldRunProxyInStrictMode(pod)
+		if strictMode {
+			trace.record("proxy sidecar runs in strict mode because the pod is annotated with %s", ProxySidecarStrictModeAnnotation)
+		}
+
+		if mode == ProxySidecarModeEnv {
+			// the environment variables of the endpoint take precedence as they are more specific
+			endpoint = endpoint.withMissingEnvs(proxyEnvs(proxyPort))
+			trace.record("proxy init container not injected and containers use the proxy sidecar through environment variables because the pod is annotated with %s=%s", ProxySidecarModeAnnotation, mode)
+		} else {
+			pod.Spec.InitContainers = m.injectProxyInitContainer(pod.Spec.InitContainers, proxyPort, opts)
+		}
 		if m.useNativeSidecar {
-			pod.Spec.InitContainers = m.injectProxySidecarContainer(pod.Spec.InitContainers, proxyPort, ptr.To(corev1.ContainerRestartPolicyAlways))
+			pod.Spec.InitContainers = m.injectProxySidecarContainer(pod.Spec.InitContainers, proxyPort, proxyMetricsPort, endpoint, strictMode, opts, ptr.To(corev1.ContainerRestartPolicyAlways))
 		} else {
-			pod.Spec.Containers = m.injectProxySidecarContainer(pod.Spec.Containers, proxyPort, nil)
+			pod.Spec.Containers = m.injectProxySidecarContainer(pod.Spec.Containers, proxyPort, proxyMetricsPort, endpoint, strictMode, opts, nil)
+		}
+		if endpoint != nil {
+			addVolumes(pod, endpoint.volumes)
+		}
+		addImagePullSecrets(pod, m.config.ProxyImagePullSecrets)
+		for _, name := range m.config.ProxyImagePullSecrets {
+			trace.record("image pull secret %s added for the proxy images", name)
 		}
+		trace.record("proxy sidecar injected on port %d because the pod is annotated with %s", proxyPort, InjectProxySidecarAnnotation)
+	} else {
+		trace.record("proxy sidecar not injected because the pod is not annotated with %s", InjectProxySidecarAnnotation)
 	}
 
-	// get service account token expiration
-	serviceAccountTokenExpiration, err := getServiceAccountTokenExpiration(pod, serviceAccount)
+	// resolve the clientID, tenantID and service account token expiration
+	identity, err := resolveIdentity(pod, serviceAccount, namespace, m.config)
 	if err != nil {
-		logger.Error("failed to get service account token expiration", err)
+		logger.Error("failed to resolve identity", err)
 		return admission.Errored(http.StatusBadRequest, err)
 	}
-	// get the clientID
-	clientID := getClientID(serviceAccount)
-	// get the tenantID
-	tenantID := getTenantID(serviceAccount, m.config)
+	trace.record("service account token expiration is %d seconds", identity.serviceAccountTokenExpiration)
+	if identity.clientID == "" {
+		trace.record("client ID is not set in the pod, service account or namespace annotations, %s is not injected", AzureClientIDEnvVar)
+	} else {
+		trace.record("client ID %s from the %s", identity.clientID, identity.clientIDSource)
+	}
+	trace.record("tenant ID %s from the %s", identity.tenantID, identity.tenantIDSource)
 	// get containers to skip
 	skipContainers := getSkipContainers(pod)
+	for _, name := range sets.List(skipContainers) {
+		trace.record("container %s skipped because it is listed in %s", name, SkipContainersAnnotation)
+	}
+	// get the per-container clientIDs
+	containerClientIDs, err := getContainerClientIDs(pod)
+	if err != nil {
+		logger.Error("failed to get container client ids", err)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	for _, name := range sets.List(sets.KeySet(containerClientIDs)) {
+		trace.record("container %s uses client ID %s from %s", name, containerClientIDs[name], ContainerClientIDsAnnotation)
+	}
+	// get the extra audiences to project tokens for
+	extraAudiences, err := getExtraAudiences(pod)
+	if err != nil {
+		logger.Error("failed to get extra audiences", err)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	for _, ea := range extraAudiences {
+		trace.record("token for audience %s projected for %s", ea.audience, ea.envVarName())
+	}
 	podUsingCustomTokenEndpoint := m.isUsingCustomTokenEndpoint(pod)
+	if podUsingCustomTokenEndpoint {
+		trace.record("pod uses the custom token endpoint")
+	}
 	volumeName := buildVolumeName(podName)
 
-	pod.Spec.InitContainers = m.mutateContainers(pod.Spec.InitContainers, clientID, tenantID, skipContainers, podUsingCustomTokenEndpoint, volumeName)
-	pod.Spec.Containers = m.mutateContainers(pod.Spec.Containers, clientID, tenantID, skipContainers, podUsingCustomTokenEndpoint, volumeName)
+	pod.Spec.InitContainers = m.mutateContainers(pod.Spec.InitContainers, identity.clientID, identity.tenantID, containerClientIDs, skipContainers, extraAudiences, endpoint, podUsingCustomTokenEndpoint, volumeName)
+	pod.Spec.Containers = m.mutateContainers(pod.Spec.Containers, identity.clientID, identity.tenantID, containerClientIDs, skipContainers, extraAudiences, endpoint, podUsingCustomTokenEndpoint, volumeName)
 
-	m.addProjectedVolume(pod, serviceAccountTokenExpiration, volumeName, podUsingCustomTokenEndpoint)
+	m.addProjectedVolume(pod, identity.serviceAccountTokenExpiration, volumeName, podUsingCustomTokenEndpoint, extraAudiences)
 
 	marshaledPod, err := json.Marshal(pod)
 	if err != nil {
@@ -248,14 +387,26 @@ func (m *podMutator) Handle(ctx context.Context, req admission.Request) (respons
 
 // mutateContainers mutates the containers by injecting the projected
 // service account token volume and environment variables
-func (m *podMutator) mutateContainers(containers []corev1.Container, clientID, tenantID string, skipContainers sets.Set[string], podUsingCustomTokenEndpoint bool, volumeName string) []corev1.Container {
+func (m *podMutator) mutateContainers(containers []corev1.Container, clientID, tenantID string, containerClientIDs map[string]string, skipContainers sets.Set[string], extraAudiences []extraAudience, endpoint *proxyEndpoint, podUsingCustomTokenEndpoint bool, volumeName string) []corev1.Container {
 	for i := range containers {
 		// container is in the skip list
 		if skipContainers.Has(containers[i].Name) {
 			continue
 		}
+		// use the container specific clientID if one is mapped for the container
+		containerClientID := clientID
+		if id, ok := containerClientIDs[containers[i].Name]; ok {
+			containerClientID = id
+		}
 		// add environment variables to container if not exists
-		containers[i] = m.addEnvironmentVariables(containers[i], clientID, tenantID, m.azureAuthorityHost, podUsingCustomTokenEndpoint)
+		containers[i] = m.addEnvironmentVariables(containers[i], containerClientID, tenantID, m.azureAuthorityHost, podUsingCustomTokenEndpoint)
+		// add the token file environment variables for extra audiences if not exists
+		containers[i] = addExtraAudienceEnvironmentVariables(containers[i], extraAudiences)
+		// add the environment variables and volume mounts of the proxy endpoint if not exists
+		if endpoint != nil {
+			containers[i] = addMissingEnvironmentVariables(containers[i], endpoint.envs)
+			containers[i] = addMissingVolumeMounts(containers[i], endpoint.volumeMounts)
+		}
 		// add the volume mount if not exists
 		containers[i] = addProjectedVolumeMount(containers[i], volumeName)
 	}
@@ -263,7 +414,7 @@ func (m *podMutator) mutateContainers(containers []corev1.Container, clientID, t
 	return containers
 }
 
-func (m *podMutator) injectProxyInitContainer(containers []corev1.Container, proxyPort int32) []corev1.Container {
+func (m *podMutator) injectProxyInitContainer(containers []corev1.Container, proxyPort int32, opts proxyOptions) []corev1.Container {
 	for _, container := range containers {
 		if container.Name == ProxyInitContainerName {
 			return containers
@@ -272,7 +423,8 @@ func (m *podMutator) injectProxyInitContainer(containers []corev1.Container, pro
 	containers = append(containers, corev1.Container{
 		Name:            ProxyInitContainerName,
 		Image:           m.proxyInitImage,
-		ImagePullPolicy: corev1.PullIfNotPresent,
+		ImagePullPolicy: opts.imagePullPolicy,
+		Resources:       opts.resources,
 		SecurityContext: &corev1.SecurityContext{
 			Capabilities: &corev1.Capabilities{
 				Add:  []corev1.Capability{"NET_ADMIN"},
@@ -282,33 +434,72 @@ func (m *podMutator) injectProxyInitContainer(containers []corev1.Container, pro
 			RunAsNonRoot: ptr.To(false),
 			RunAsUser:    ptr.To[int64](0),
 		},
-		Env: []corev1.EnvVar{{
-			Name:  ProxyPortEnvVar,
-			Value: strconv.FormatInt(int64(proxyPort), 10),
-		}},
+		Env: []corev1.EnvVar{
+			{
+				Name:  ProxyPortEnvVar,
+				Value: strconv.FormatInt(int64(proxyPort), 10),
+			},
+			{
+				Name:  ProxyUIDEnvVar,
+				Value: strconv.FormatInt(ProxySidecarUID, 10),
+			},
+		},
 	})
+	if opts.metadataIPv6 != "" {
+		init := &containers[len(containers)-1]
+		init.Env = append(init.Env, corev1.EnvVar{Name: MetadataIPv6EnvVar, Value: opts.metadataIPv6})
+	}
 
 	return containers
 }
 
-func (m *podMutator) injectProxySidecarContainer(containers []corev1.Container, proxyPort int32, restartPolicy *corev1.ContainerRestartPolicy) []corev1.Container {
+// injectProxySidecarContainer injects the proxy sidecar container. The metrics endpoint of the proxy
+// is enabled on the metrics port if it's not 0, the proxy is configured to serve the endpoint if it's not nil,
+// and the proxy never forwards requests to the IMDS identity endpoints if strictMode is true.
+func (m *podMutator) injectProxySidecarContainer(containers []corev1.Container, proxyPort, metricsPort int32, endpoint *proxyEndpoint, strictMode bool, opts proxyOptions, restartPolicy *corev1.ContainerRestartPolicy) []corev1.Container {
 	for _, container := range containers {
 		if container.Name == ProxySidecarContainerName {
 			return containers
 		}
 	}
 	logLevel := currentLogLevel() // run the proxy at the same log level as the webhook
+	args := []string{
+		fmt.Sprintf("--proxy-port=%d", proxyPort),
+		fmt.Sprintf("--log-level=%s", logLevel),
+	}
+	ports := []corev1.ContainerPort{{
+		ContainerPort: proxyPort,
+	}}
+	if metricsPort != 0 {
+		args = append(args, fmt.Sprintf("--metrics-addr=:%d", metricsPort))
+		ports = append(ports, corev1.ContainerPort{
+			Name:          "metrics",
+			ContainerPort: metricsPort,
+		})
+	}
+	var env []corev1.EnvVar
+	var volumeMounts []corev1.VolumeMount
+	if endpoint != nil {
+		args = append(args, endpoint.proxyArgs...)
+		env = append(env, endpoint.proxyEnvs...)
+		volumeMounts = endpoint.proxyVolumeMounts
+	}
+	// the proxy forwards the requests redirected from the IPv6 metadata endpoint to it
+	if opts.metadataIPv6 != "" {
+		env = append(env, corev1.EnvVar{Name: MetadataIPv6EnvVar, Value: opts.metadataIPv6})
+	}
+	if strictMode {
+		args = append(args, "--strict-mode")
+	}
 	containers = append([]corev1.Container{{
 		Name:            ProxySidecarContainerName,
 		Image:           m.proxyImage,
-		ImagePullPolicy: corev1.PullIfNotPresent,
-		Args: []string{
-			fmt.Sprintf("--proxy-port=%d", proxyPort),
-			fmt.Sprintf("--log-level=%s", logLevel),
-		},
-		Ports: []corev1.ContainerPort{{
-			ContainerPort: proxyPort,
-		}},
+		ImagePullPolicy: opts.imagePullPolicy,
+		Resources:       opts.resources,
+		Args:            args,
+		Ports:           ports,
+		Env:             env,
+		VolumeMounts:    volumeMounts,
 		Lifecycle: &corev1.Lifecycle{
 			PostStart: &corev1.LifecycleHandler{
 				Exec: &corev1.ExecAction{
@@ -321,21 +512,267 @@ func (m *podMutator) injectProxySidecarContainer(containers []corev1.Container,
 				},
 			},
 		},
-		SecurityContext: &corev1.SecurityContext{
-			AllowPrivilegeEscalation: ptr.To(false),
-			Capabilities: &corev1.Capabilities{
-				Drop: []corev1.Capability{"ALL"},
-			},
-			Privileged:             ptr.To(false),
-			ReadOnlyRootFilesystem: ptr.To(true),
-			RunAsNonRoot:           ptr.To(true),
-		},
-		RestartPolicy: restartPolicy,
+		StartupProbe:    withHealthCheck(opts.startupProbe, proxyPort, "readyz"),
+		ReadinessProbe:  withHealthCheck(opts.readinessProbe, proxyPort, "readyz"),
+		LivenessProbe:   withHealthCheck(opts.livenessProbe, proxyPort, "healthz"),
+		SecurityContext: proxySidecarSecurityContext(),
+		RestartPolicy:   restartPolicy,
 	}}, containers...)
 
 	return containers
 }
 
+// proxyOptions are the settings of the proxy sidecar and init containers that are configured
+// by the webhook and can be overridden by pod annotations
+type proxyOptions struct {
+	resources       corev1.ResourceRequirements
+	imagePullPolicy corev1.PullPolicy
+	// the probes of the proxy sidecar without handlers, a probe is disabled if it's nil
+	startupProbe   *corev1.Probe
+	readinessProbe *corev1.Probe
+	livenessProbe  *corev1.Probe
+	// metadataIPv6 is the IPv6 address of the metadata endpoint, the IPv6 traffic
+	// to the metadata endpoint is only redirected to the proxy sidecar if it's set
+	metadataIPv6 string
+}
+
+// getProxyOptions returns the options of the proxy containers from the webhook configuration
+// with the pod annotations applied
+func getProxyOptions(pod *corev1.Pod, c *config.Config) (proxyOptions, error) {
+	opts := proxyOptions{imagePullPolicy: corev1.PullIfNotPresent, metadataIPv6: c.ProxyMetadataIPv6}
+	if len(c.ProxyImagePullPolicy) > 0 {
+		opts.imagePullPolicy = corev1.PullPolicy(c.ProxyImagePullPolicy)
+	}
+	if policy, ok := pod.Annotations[ProxyImagePullPolicyAnnotation]; ok {
+		switch p := corev1.PullPolicy(policy); p {
+		case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+			opts.imagePullPolicy = p
+		default:
+			return proxyOptions{}, errors.Errorf("invalid image pull policy %q in %s annotation, must be %s, %s or %s",
+				policy, ProxyImagePullPolicyAnnotation, corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever)
+		}
+	}
+
+	for _, r := range []struct {
+		annotation string
+		name       corev1.ResourceName
+		limit      bool
+		value      string
+	}{
+		{ProxyCPURequestAnnotation, corev1.ResourceCPU, false, c.ProxyCPURequest},
+		{ProxyCPULimitAnnotation, corev1.ResourceCPU, true, c.ProxyCPULimit},
+		{ProxyMemoryRequestAnnotation, corev1.ResourceMemory, false, c.ProxyMemoryRequest},
+		{ProxyMemoryLimitAnnotation, corev1.ResourceMemory, true, c.ProxyMemoryLimit},
+	} {
+		value, ok := pod.Annotations[r.annotation]
+		if !ok {
+			value = r.value
+		}
+		if len(value) == 0 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return proxyOptions{}, errors.Wrapf(err, "invalid quantity %q in %s annotation", value, r.annotation)
+		}
+		list := &opts.resources.Requests
+		if r.limit {
+			list = &opts.resources.Limits
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[r.name] = quantity
+	}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		request, hasRequest := opts.resources.Requests[name]
+		limit, hasLimit := opts.resources.Limits[name]
+		if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			return proxyOptions{}, errors.Errorf("%s request %s of the proxy containers must be less than or equal to the %s limit %s",
+				name, request.String(), name, limit.String())
+		}
+	}
+
+	for _, p := range []struct {
+		annotation string
+		probe      **corev1.Probe
+	}{
+		{ProxyStartupProbeAnnotation, &opts.startupProbe},
+		{ProxyReadinessProbeAnnotation, &opts.readinessProbe},
+		{ProxyLivenessProbeAnnotation, &opts.livenessProbe},
+	} {
+		probe, err := getProxyProbe(pod, p.annotation)
+		if err != nil {
+			return proxyOptions{}, err
+		}
+		*p.probe = probe
+	}
+	return opts, nil
+}
+
+// proxyProbeTiming is the timing of a probe of the proxy sidecar that can be overridden by annotation,
+// the handler of the probe is always set by the webhook
+type proxyProbeTiming struct {
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      *int32 `json:"timeoutSeconds,omitempty"`
+	PeriodSeconds       *int32 `json:"periodSeconds,omitempty"`
+	SuccessThreshold    *int32 `json:"successThreshold,omitempty"`
+	FailureThreshold    *int32 `json:"failureThreshold,omitempty"`
+}
+
+// defaultProxyProbe returns the default probe of the proxy sidecar for the annotation without a handler.
+// The startup probe gives the proxy 30 seconds to start, and the liveness probe restarts the proxy
+// after it failed to read a valid federated token for 90 seconds.
+func defaultProxyProbe(annotation string) corev1.Probe {
+	switch annotation {
+	case ProxyStartupProbeAnnotation:
+		return corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 1, SuccessThreshold: 1, FailureThreshold: 30}
+	case ProxyReadinessProbeAnnotation:
+		return corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 10, SuccessThreshold: 1, FailureThreshold: 3}
+	default:
+		return corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 30, SuccessThreshold: 1, FailureThreshold: 3}
+	}
+}
+
+// getProxyProbe returns the probe of the proxy sidecar for the annotation without a handler. The timing
+// in the annotation overrides the default timing, and the probe is disabled if the annotation is empty.
+func getProxyProbe(pod *corev1.Pod, annotation string) (*corev1.Probe, error) {
+	probe := defaultProxyProbe(annotation)
+	value, ok := pod.Annotations[annotation]
+	if !ok {
+		return &probe, nil
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var timing proxyProbeTiming
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&timing); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s annotation", annotation)
+	}
+	for _, f := range []struct {
+		name  string
+		value *int32
+		probe *int32
+		min   int32
+	}{
+		{"initialDelaySeconds", timing.InitialDelaySeconds, &probe.InitialDelaySeconds, 0},
+		{"timeoutSeconds", timing.TimeoutSeconds, &probe.TimeoutSeconds, 1},
+		{"periodSeconds", timing.PeriodSeconds, &probe.PeriodSeconds, 1},
+		{"successThreshold", timing.SuccessThreshold, &probe.SuccessThreshold, 1},
+		{"failureThreshold", timing.FailureThreshold, &probe.FailureThreshold, 1},
+	} {
+		if f.value == nil {
+			continue
+		}
+		if *f.value < f.min {
+			return nil, errors.Errorf("%s in %s annotation must be greater than or equal to %d", f.name, annotation, f.min)
+		}
+		*f.probe = *f.value
+	}
+	// kubernetes only allows a success threshold of 1 for startup and liveness probes
+	if annotation != ProxyReadinessProbeAnnotation && probe.SuccessThreshold != 1 {
+		return nil, errors.Errorf("successThreshold in %s annotation must be 1", annotation)
+	}
+	return &probe, nil
+}
+
+// withHealthCheck returns a copy of the probe that runs the health check of the proxy,
+// or nil if the probe is disabled. The proxy only listens on localhost, so the probe
+// runs the proxy in the container instead of sending the request to the pod IP.
+func withHealthCheck(probe *corev1.Probe, proxyPort int32, healthCheck string) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	p := *probe
+	p.ProbeHandler = corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{
+				"/proxy",
+				fmt.Sprintf("--proxy-port=%d", proxyPort),
+				fmt.Sprintf("--health-check=%s", healthCheck),
+			},
+		},
+	}
+	return &p
+}
+
+// addImagePullSecrets adds the image pull secrets that are not already referenced by the pod
+func addImagePullSecrets(pod *corev1.Pod, names []string) {
+	existing := sets.New[string]()
+	for _, secret := range pod.Spec.ImagePullSecrets {
+		existing.Insert(secret.Name)
+	}
+	for _, name := range names {
+		if !existing.Has(name) {
+			existing.Insert(name)
+			pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		}
+	}
+}
+
+// proxySidecarSecurityContext returns the security context of the proxy sidecar, which complies with the
+// restricted Pod Security Standard. Every field is set on the container so that the security context
+// of the pod doesn't apply: the proxy must run as the uid that the proxy init container excludes from
+// the redirect, and an unconfined seccomp profile of the pod would not comply.
+func proxySidecarSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		Privileged:             ptr.To(false),
+		ReadOnlyRootFilesystem: ptr.To(true),
+		RunAsGroup:             ptr.To(ProxySidecarUID),
+		RunAsNonRoot:           ptr.To(true),
+		RunAsUser:              ptr.To(ProxySidecarUID),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// getPodSecurityLevel returns the Pod Security Standard level enforced in the namespace. Namespaces
+// without a valid level are treated as privileged, which is the default of the Pod Security admission controller.
+func getPodSecurityLevel(ns *corev1.Namespace) string {
+	switch level := strings.ToLower(strings.TrimSpace(ns.Labels[PodSecurityEnforceLabel])); level {
+	case PodSecurityLevelBaseline, PodSecurityLevelRestricted:
+		return level
+	default:
+		return PodSecurityLevelPrivileged
+	}
+}
+
+// validateProxyPodSecurity returns an error if the proxy containers injected in the mode are not allowed
+// by the Pod Security Standard level. The proxy sidecar complies with every level, but the proxy init
+// container runs as root with the NET_ADMIN capability, which only the privileged level allows.
+func validateProxyPodSecurity(level, mode string) error {
+	if mode == ProxySidecarModeEnv || level == PodSecurityLevelPrivileged {
+		return nil
+	}
+	return errors.Errorf("the proxy init container runs as root with the NET_ADMIN capability, which the %s Pod Security Standard does not allow. Annotate the pod with %s: %s to inject the proxy sidecar without the proxy init container",
+		level, ProxySidecarModeAnnotation, ProxySidecarModeEnv)
+}
+
+// withPolicy returns a copy of the mutator with the current WorkloadIdentityConfig
+// and its overrides for the namespace applied
+func (m *podMutator) withPolicy(namespace string) *podMutator {
+	wic := m.policy.Load()
+	if wic == nil {
+		return m
+	}
+	mc := *m
+	mc.config = m.config.Apply(wic, namespace)
+	if len(wic.ProxyImage) > 0 {
+		mc.proxyImage = wic.ProxyImage
+	}
+	if len(wic.ProxyInitImage) > 0 {
+		mc.proxyInitImage = wic.ProxyInitImage
+	}
+	return &mc
+}
+
 func shouldInjectProxySidecar(pod *corev1.Pod) bool {
 	if len(pod.Annotations) == 0 {
 		return false
@@ -344,6 +781,131 @@ func shouldInjectProxySidecar(pod *corev1.Pod) bool {
 	return ok
 }
 
+// shouldInjectAppServiceEnv returns true if the App Service managed identity
+// environment variables should be injected with the proxy sidecar
+func shouldInjectAppServiceEnv(pod *corev1.Pod) bool {
+	return strings.EqualFold(pod.Annotations[InjectAppServiceEnvAnnotation], "true")
+}
+
+// shouldRunProxyInStrictMode returns true if the proxy sidecar should never
+// forward requests to the IMDS identity endpoints to IMDS
+func shouldRunProxyInStrictMode(pod *corev1.Pod) bool {
+	return strings.EqualFold(pod.Annotations[ProxySidecarStrictModeAnnotation], "true")
+}
+
+// getProxySidecarMode returns how the containers reach the proxy sidecar. The traffic to IMDS
+// is redirected to the proxy sidecar if the annotation is not set.
+func getProxySidecarMode(pod *corev1.Pod) (string, error) {
+	mode, ok := pod.Annotations[ProxySidecarModeAnnotation]
+	if !ok {
+		return ProxySidecarModeRedirect, nil
+	}
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case ProxySidecarModeRedirect, ProxySidecarModeEnv:
+		return mode, nil
+	default:
+		return "", errors.Errorf("invalid proxy sidecar mode %q in %s annotation, must be %s or %s", pod.Annotations[ProxySidecarModeAnnotation], ProxySidecarModeAnnotation, ProxySidecarModeRedirect, ProxySidecarModeEnv)
+	}
+}
+
+// getIdentityHeader returns the IDENTITY_HEADER of the proxy sidecar if the sidecar was injected
+// by a previous invocation of the webhook, otherwise it generates a new random IDENTITY_HEADER
+func getIdentityHeader(pod *corev1.Pod) (string, error) {
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if container.Name != ProxySidecarContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name == IdentityHeaderEnvVar && env.Value != "" {
+				return env.Value, nil
+			}
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate identity header")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// shouldInjectAzureArcEnv returns true if the Azure Arc environment variables
+// and key volume should be injected with the proxy sidecar
+func shouldInjectAzureArcEnv(pod *corev1.Pod) bool {
+	return strings.EqualFold(pod.Annotations[InjectAzureArcEnvAnnotation], "true")
+}
+
+// proxyEndpoint is a token endpoint served by the proxy sidecar in addition to IMDS
+type proxyEndpoint struct {
+	// proxyArgs, proxyEnvs and proxyVolumeMounts configure the proxy sidecar to serve the endpoint
+	proxyArgs         []string
+	proxyEnvs         []corev1.EnvVar
+	proxyVolumeMounts []corev1.VolumeMount
+	// envs and volumeMounts configure the containers to use the endpoint
+	envs         []corev1.EnvVar
+	volumeMounts []corev1.VolumeMount
+	// volumes are added to the pod
+	volumes []corev1.Volume
+}
+
+// withMissingEnvs returns a copy of the endpoint with the environment variables for the containers
+// added that are not set by the endpoint. The endpoint can be nil.
+func (e *proxyEndpoint) withMissingEnvs(envs []corev1.EnvVar) *proxyEndpoint {
+	var endpoint proxyEndpoint
+	if e != nil {
+		endpoint = *e
+	}
+	endpoint.envs = addMissingEnvironmentVariables(corev1.Container{Env: endpoint.envs}, envs).Env
+	return &endpoint
+}
+
+// proxyEnvs returns the environment variables that point the Azure SDKs to the IMDS endpoint of the
+// proxy sidecar on the port. They are used when the traffic to IMDS is not redirected to the proxy sidecar.
+func proxyEnvs(proxyPort int32) []corev1.EnvVar {
+	host := fmt.Sprintf("http://localhost:%d", proxyPort)
+	return []corev1.EnvVar{
+		{Name: AzurePodIdentityAuthorityHostEnvVar, Value: host},
+		{Name: IdentityEndpointEnvVar, Value: host + IMDSTokenPath},
+		{Name: MSIEndpointEnvVar, Value: host + IMDSTokenPath},
+		{Name: IMDSEndpointEnvVar, Value: host},
+	}
+}
+
+// appServiceEndpoint returns the App Service managed identity endpoint of the proxy sidecar on the port.
+// Both the current and the legacy environment variables are injected so that older SDKs can use the
+// endpoint as well. The proxy only serves the endpoint when IDENTITY_HEADER is set.
+func appServiceEndpoint(proxyPort int32, identityHeader string) *proxyEndpoint {
+	url := fmt.Sprintf("http://localhost:%d%s", proxyPort, AppServiceTokenPath)
+	return &proxyEndpoint{
+		proxyEnvs: []corev1.EnvVar{{Name: IdentityHeaderEnvVar, Value: identityHeader}},
+		envs: []corev1.EnvVar{
+			{Name: IdentityEndpointEnvVar, Value: url},
+			{Name: IdentityHeaderEnvVar, Value: identityHeader},
+			{Name: MSIEndpointEnvVar, Value: url},
+			{Name: MSISecretEnvVar, Value: identityHeader},
+		},
+	}
+}
+
+// azureArcEndpoint returns the Azure Arc token endpoint of the proxy sidecar on the port. The proxy
+// writes the challenge key files to an in-memory emptyDir volume that the containers mount read-only.
+func azureArcEndpoint(proxyPort int32) *proxyEndpoint {
+	return &proxyEndpoint{
+		proxyArgs:         []string{fmt.Sprintf("--arc-key-dir=%s", AzureArcKeyDir)},
+		proxyVolumeMounts: []corev1.VolumeMount{{Name: AzureArcKeyVolumeName, MountPath: AzureArcKeyDir}},
+		envs: []corev1.EnvVar{
+			{Name: IdentityEndpointEnvVar, Value: fmt.Sprintf("http://localhost:%d%s", proxyPort, AzureArcTokenPath)},
+			{Name: IMDSEndpointEnvVar, Value: fmt.Sprintf("http://localhost:%d", proxyPort)},
+		},
+		volumeMounts: []corev1.VolumeMount{{Name: AzureArcKeyVolumeName, MountPath: AzureArcKeyDir, ReadOnly: true}},
+		volumes: []corev1.Volume{{
+			Name: AzureArcKeyVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+			},
+		}},
+	}
+}
+
 func (m *podMutator) isUsingCustomTokenEndpoint(pod *corev1.Pod) bool {
 	if !m.customTokenEndpoint.enabled {
 		return false
@@ -371,13 +933,92 @@ func getSkipContainers(pod *corev1.Pod) sets.Set[string] {
 	return sc
 }
 
+// getContainerClientIDs gets the container name to clientID mapping based on the annotation
+func getContainerClientIDs(pod *corev1.Pod) (map[string]string, error) {
+	containerClientIDs := pod.Annotations[ContainerClientIDsAnnotation]
+	if len(containerClientIDs) == 0 {
+		return nil, nil
+	}
+	containerClientIDsList := strings.Split(containerClientIDs, ",")
+	cc := make(map[string]string, len(containerClientIDsList))
+	for _, containerClientID := range containerClientIDsList {
+		containerClientID = strings.TrimSpace(containerClientID)
+		if len(containerClientID) == 0 {
+			continue
+		}
+		name, clientID, ok := strings.Cut(containerClientID, "=")
+		name, clientID = strings.TrimSpace(name), strings.TrimSpace(clientID)
+		if !ok || len(name) == 0 || len(clientID) == 0 {
+			return nil, errors.Errorf("invalid container client id mapping %q in %s annotation. Expected format is <container name>=<client id>", containerClientID, ContainerClientIDsAnnotation)
+		}
+		if _, ok := cc[name]; ok {
+			return nil, errors.Errorf("container %q is mapped more than once in %s annotation", name, ContainerClientIDsAnnotation)
+		}
+		cc[name] = clientID
+	}
+	return cc, nil
+}
+
+// extraAudience is an additional audience for which a service account token is projected
+type extraAudience struct {
+	// name is used to build the token file path and the environment variable name
+	name     string
+	audience string
+}
+
+// tokenFilePath returns the path of the token file relative to the projected volume
+func (e extraAudience) tokenFilePath() string {
+	return filepath.Join(ExtraAudienceTokenDirPath, e.name, TokenFileName)
+}
+
+// envVarName returns the name of the environment variable pointing to the token file
+func (e extraAudience) envVarName() string {
+	return ExtraAudienceTokenFileEnvVarPrefix + strings.ToUpper(strings.ReplaceAll(e.name, "-", "_"))
+}
+
+// getExtraAudiences gets the list of extra audiences based on the annotation
+func getExtraAudiences(pod *corev1.Pod) ([]extraAudience, error) {
+	extraAudiences := pod.Annotations[ExtraAudiencesAnnotation]
+	if len(extraAudiences) == 0 {
+		return nil, nil
+	}
+	var ea []extraAudience
+	names := sets.New[string]()
+	for _, entry := range strings.Split(extraAudiences, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		name, audience, ok := strings.Cut(entry, "=")
+		name, audience = strings.TrimSpace(name), strings.TrimSpace(audience)
+		if !ok || len(name) == 0 || len(audience) == 0 {
+			return nil, errors.Errorf("invalid extra audience %q in %s annotation. Expected format is <name>=<audience>", entry, ExtraAudiencesAnnotation)
+		}
+		// the name is used as a directory in the projected volume and as part of an environment variable name
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, errors.Errorf("invalid extra audience name %q in %s annotation: %s", name, ExtraAudiencesAnnotation, strings.Join(errs, ", "))
+		}
+		if names.Has(name) {
+			return nil, errors.Errorf("extra audience name %q is defined more than once in %s annotation", name, ExtraAudiencesAnnotation)
+		}
+		names.Insert(name)
+		ea = append(ea, extraAudience{name: name, audience: audience})
+	}
+	return ea, nil
+}
+
 // getServiceAccountTokenExpiration returns the expiration seconds for the project service account token volume
 // Order of preference:
 //  1. annotation in the pod
 //  2. annotation in the service account
+//  3. annotation in the namespace
+//  4. default expiration from the webhook policy
 //     default expiration if no annotation specified
-func getServiceAccountTokenExpiration(pod *corev1.Pod, sa *corev1.ServiceAccount) (int64, error) {
+func getServiceAccountTokenExpiration(pod *corev1.Pod, sa *corev1.ServiceAccount, ns *corev1.Namespace, c *config.Config) (int64, error) {
 	serviceAccountTokenExpiration := DefaultServiceAccountTokenExpiration
+	if c.ServiceAccountTokenExpiration > 0 {
+		serviceAccountTokenExpiration = c.ServiceAccountTokenExpiration
+	}
 	var err error
 	// check if expiry defined in the pod with annotation
 	if pod.Annotations != nil && pod.Annotations[ServiceAccountTokenExpiryAnnotation] != "" {
@@ -388,6 +1029,10 @@ func getServiceAccountTokenExpiration(pod *corev1.Pod, sa *corev1.ServiceAccount
 		if serviceAccountTokenExpiration, err = strconv.ParseInt(sa.Annotations[ServiceAccountTokenExpiryAnnotation], 10, 64); err != nil {
 			return 0, err
 		}
+	} else if ns.Annotations != nil && ns.Annotations[ServiceAccountTokenExpiryAnnotation] != "" {
+		if serviceAccountTokenExpiration, err = strconv.ParseInt(ns.Annotations[ServiceAccountTokenExpiryAnnotation], 10, 64); err != nil {
+			return 0, err
+		}
 	}
 	// validate expiration time
 	if !validServiceAccountTokenExpiry(serviceAccountTokenExpiration) {
@@ -396,6 +1041,25 @@ func getServiceAccountTokenExpiration(pod *corev1.Pod, sa *corev1.ServiceAccount
 	return serviceAccountTokenExpiration, nil
 }
 
+// getProxyMetricsPort returns the port for the metrics endpoint of the proxy sidecar container.
+// 0 is returned if the metrics endpoint is not enabled.
+func getProxyMetricsPort(pod *corev1.Pod, proxyPort int32) (int32, error) {
+	metricsPort, ok := pod.Annotations[ProxySidecarMetricsPortAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	parsed, err := parsePort(metricsPort)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse proxy sidecar metrics port")
+	}
+	if parsed == proxyPort {
+		return 0, errors.Errorf("proxy sidecar metrics port %d must be different from the proxy sidecar port", parsed)
+	}
+
+	return parsed, nil
+}
+
 // getProxyPort returns the port for the proxy init container and the proxy sidecar container
 func getProxyPort(pod *corev1.Pod) (int32, error) {
 	if len(pod.Annotations) == 0 {
@@ -407,11 +1071,23 @@ func getProxyPort(pod *corev1.Pod) (int32, error) {
 		return DefaultProxySidecarPort, nil
 	}
 
-	parsed, err := strconv.ParseInt(proxyPort, 10, 32)
+	parsed, err := parsePort(proxyPort)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to parse proxy sidecar port")
 	}
 
+	return parsed, nil
+}
+
+// parsePort parses a port number between 1 and 65535
+func parsePort(port string) (int32, error) {
+	parsed, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if parsed < 1 || parsed > 65535 {
+		return 0, errors.Errorf("port %d must be between 1 and 65535", parsed)
+	}
 	return int32(parsed), nil //nolint:gosec // disable G115
 }
 
@@ -419,19 +1095,63 @@ func validServiceAccountTokenExpiry(tokenExpiry int64) bool {
 	return tokenExpiry <= MaxServiceAccountTokenExpiration && tokenExpiry >= MinServiceAccountTokenExpiration
 }
 
-// getClientID returns the clientID to be configured
-func getClientID(sa *corev1.ServiceAccount) string {
-	return sa.Annotations[ClientIDAnnotation]
+// workloadIdentity is the identity configured for the containers of a pod
+type workloadIdentity struct {
+	clientID                      string
+	clientIDSource                string
+	tenantID                      string
+	tenantIDSource                string
+	serviceAccountTokenExpiration int64
 }
 
-// getTenantID returns the tenantID to be configured
-func getTenantID(sa *corev1.ServiceAccount, c *config.Config) string {
-	// use tenantID if provided in the annotation
-	if tenantID, ok := sa.Annotations[TenantIDAnnotation]; ok {
-		return tenantID
+// resolveIdentity resolves the identity of the pod from the annotations in the pod,
+// service account and namespace, in that order of precedence, and the webhook config
+func resolveIdentity(pod *corev1.Pod, sa *corev1.ServiceAccount, ns *corev1.Namespace, c *config.Config) (*workloadIdentity, error) {
+	serviceAccountTokenExpiration, err := getServiceAccountTokenExpiration(pod, sa, ns, c)
+	if err != nil {
+		return nil, err
+	}
+	clientID, clientIDSource := getClientID(pod, sa, ns)
+	tenantID, tenantIDSource := getTenantID(pod, sa, ns, c)
+	return &workloadIdentity{
+		clientID:                      clientID,
+		clientIDSource:                clientIDSource,
+		tenantID:                      tenantID,
+		tenantIDSource:                tenantIDSource,
+		serviceAccountTokenExpiration: serviceAccountTokenExpiration,
+	}, nil
+}
+
+// getClientID returns the clientID to be configured and where it was read from
+func getClientID(pod *corev1.Pod, sa *corev1.ServiceAccount, ns *corev1.Namespace) (string, string) {
+	// use clientID if provided in the pod annotation. Empty annotations are skipped, as in the validator.
+	if clientID := pod.Annotations[ClientIDAnnotation]; clientID != "" {
+		return clientID, "pod annotation"
+	}
+	// use clientID if provided in the service account annotation
+	if clientID := sa.Annotations[ClientIDAnnotation]; clientID != "" {
+		return clientID, "service account annotation"
+	}
+	// use the namespace clientID as default value
+	return ns.Annotations[ClientIDAnnotation], "namespace annotation"
+}
+
+// getTenantID returns the tenantID to be configured and where it was read from
+func getTenantID(pod *corev1.Pod, sa *corev1.ServiceAccount, ns *corev1.Namespace, c *config.Config) (string, string) {
+	// use tenantID if provided in the pod annotation. Empty annotations are skipped, as in the validator.
+	if tenantID := pod.Annotations[TenantIDAnnotation]; tenantID != "" {
+		return tenantID, "pod annotation"
+	}
+	// use tenantID if provided in the service account annotation
+	if tenantID := sa.Annotations[TenantIDAnnotation]; tenantID != "" {
+		return tenantID, "service account annotation"
+	}
+	// use tenantID if provided in the namespace annotation
+	if tenantID := ns.Annotations[TenantIDAnnotation]; tenantID != "" {
+		return tenantID, "namespace annotation"
 	}
 	// use the cluster tenantID as default value
-	return c.TenantID
+	return c.TenantID, "webhook config"
 }
 
 // addEnvironmentVariables adds the clientID, tenantID and token file path environment variables needed for SDK
@@ -465,6 +1185,68 @@ func (m *podMutator) addEnvironmentVariables(container corev1.Container, clientI
 	return container
 }
 
+// addExtraAudienceEnvironmentVariables adds the token file path environment variables for the extra audiences
+func addExtraAudienceEnvironmentVariables(container corev1.Container, extraAudiences []extraAudience) corev1.Container {
+	envs := make(map[string]string)
+	for _, env := range container.Env {
+		envs[env.Name] = env.Value
+	}
+
+	for _, ea := range extraAudiences {
+		if _, ok := envs[ea.envVarName()]; !ok {
+			container.Env = append(container.Env, corev1.EnvVar{Name: ea.envVarName(), Value: filepath.Join(VolumeMountPath, ea.tokenFilePath())})
+		}
+	}
+
+	return container
+}
+
+// addMissingEnvironmentVariables adds the environment variables that are not already set in the container
+func addMissingEnvironmentVariables(container corev1.Container, envs []corev1.EnvVar) corev1.Container {
+	existing := sets.New[string]()
+	for _, env := range container.Env {
+		existing.Insert(env.Name)
+	}
+
+	for _, env := range envs {
+		if !existing.Has(env.Name) {
+			container.Env = append(container.Env, env)
+		}
+	}
+
+	return container
+}
+
+// addMissingVolumeMounts adds the volume mounts of the volumes that are not already mounted in the container
+func addMissingVolumeMounts(container corev1.Container, volumeMounts []corev1.VolumeMount) corev1.Container {
+	existing := sets.New[string]()
+	for _, vm := range container.VolumeMounts {
+		existing.Insert(vm.Name)
+	}
+
+	for _, vm := range volumeMounts {
+		if !existing.Has(vm.Name) {
+			container.VolumeMounts = append(container.VolumeMounts, vm)
+		}
+	}
+
+	return container
+}
+
+// addVolumes adds the volumes that don't already exist in the pod
+func addVolumes(pod *corev1.Pod, volumes []corev1.Volume) {
+	existing := sets.New[string]()
+	for _, v := range pod.Spec.Volumes {
+		existing.Insert(v.Name)
+	}
+
+	for _, v := range volumes {
+		if !existing.Has(v.Name) {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, v)
+		}
+	}
+}
+
 func addProjectedVolumeMount(container corev1.Container, volumeName string) corev1.Container {
 	volumeMount := corev1.VolumeMount{
 		Name:      volumeName,
@@ -483,7 +1265,7 @@ func addProjectedVolumeMount(container corev1.Container, volumeName string) core
 	return container
 }
 
-func (m *podMutator) addProjectedVolume(pod *corev1.Pod, serviceAccountTokenExpiration int64, volumeName string, podUsingCustomTokenEndpoint bool) {
+func (m *podMutator) addProjectedVolume(pod *corev1.Pod, serviceAccountTokenExpiration int64, volumeName string, podUsingCustomTokenEndpoint bool, extraAudiences []extraAudience) {
 	aud := m.audience
 	if podUsingCustomTokenEndpoint {
 		aud = m.customTokenEndpoint.audience
@@ -506,6 +1288,18 @@ func (m *podMutator) addProjectedVolume(pod *corev1.Pod, serviceAccountTokenExpi
 		},
 	}
 
+	for _, ea := range extraAudiences {
+		volume.VolumeSource.Projected.Sources = append(volume.VolumeSource.Projected.Sources,
+			corev1.VolumeProjection{
+				ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+					Path:              ea.tokenFilePath(),
+					ExpirationSeconds: &serviceAccountTokenExpiration,
+					Audience:          ea.audience,
+				},
+			},
+		)
+	}
+
 	if podUsingCustomTokenEndpoint {
 		if len(m.config.AzureKubernetesCAConfigMapName) > 0 {
 			volume.VolumeSource.Projected.Sources = append(volume.VolumeSource.Projected.Sources,
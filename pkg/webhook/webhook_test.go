@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -75,6 +77,8 @@ func TestGetServiceAccountTokenExpiration(t *testing.T) {
 		name               string
 		pod                *corev1.Pod
 		sa                 *corev1.ServiceAccount
+		ns                 *corev1.Namespace
+		config             *config.Config
 		expectedExpiration int64
 		expectedErr        bool
 	}{
@@ -182,11 +186,127 @@ func TestGetServiceAccountTokenExpiration(t *testing.T) {
 			expectedExpiration: 4000,
 			expectedErr:        false,
 		},
+		{
+			name: "default token expiry from policy",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+			},
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sa",
+					Namespace: "default",
+				},
+			},
+			config:             &config.Config{ServiceAccountTokenExpiration: 7200},
+			expectedExpiration: 7200,
+			expectedErr:        false,
+		},
+		{
+			name: "token expiry in service account preferred over policy",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+			},
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "4800"},
+				},
+			},
+			config:             &config.Config{ServiceAccountTokenExpiration: 7200},
+			expectedExpiration: 4800,
+			expectedErr:        false,
+		},
+		{
+			name: "token expiry in namespace preferred over policy",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+			},
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sa",
+					Namespace: "default",
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "5400"},
+				},
+			},
+			config:             &config.Config{ServiceAccountTokenExpiration: 7200},
+			expectedExpiration: 5400,
+			expectedErr:        false,
+		},
+		{
+			name: "token expiry in service account preferred over namespace",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+			},
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "4800"},
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "5400"},
+				},
+			},
+			expectedExpiration: 4800,
+			expectedErr:        false,
+		},
+		{
+			name: "invalid token expiry in namespace",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+			},
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sa",
+					Namespace: "default",
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ServiceAccountTokenExpiryAnnotation: "100"},
+				},
+			},
+			expectedExpiration: 0,
+			expectedErr:        true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			exp, err := getServiceAccountTokenExpiration(test.pod, test.sa)
+			ns := test.ns
+			if ns == nil {
+				ns = &corev1.Namespace{}
+			}
+			c := test.config
+			if c == nil {
+				c = &config.Config{}
+			}
+			exp, err := getServiceAccountTokenExpiration(test.pod, test.sa, ns, c)
 			if exp != test.expectedExpiration {
 				t.Fatalf("expected: %d, got: %d", test.expectedExpiration, exp)
 			}
@@ -201,6 +321,7 @@ func TestGetClientID(t *testing.T) {
 	tests := []struct {
 		name             string
 		sa               *corev1.ServiceAccount
+		ns               *corev1.Namespace
 		expectedClientID string
 	}{
 		{
@@ -224,11 +345,65 @@ func TestGetClientID(t *testing.T) {
 			},
 			expectedClientID: "client-id",
 		},
+		{
+			name: "client id not present, use namespace annotation",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sa",
+					Namespace: "default",
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ClientIDAnnotation: "namespace-client-id"},
+				},
+			},
+			expectedClientID: "namespace-client-id",
+		},
+		{
+			name: "client id present, preferred over namespace annotation",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{ClientIDAnnotation: "client-id"},
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ClientIDAnnotation: "namespace-client-id"},
+				},
+			},
+			expectedClientID: "client-id",
+		},
+		{
+			name: "empty client id annotation, use namespace annotation",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{ClientIDAnnotation: ""},
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{ClientIDAnnotation: "namespace-client-id"},
+				},
+			},
+			expectedClientID: "namespace-client-id",
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			clientID := getClientID(test.sa)
+			ns := test.ns
+			if ns == nil {
+				ns = &corev1.Namespace{}
+			}
+			clientID, _ := getClientID(&corev1.Pod{}, test.sa, ns)
 			if clientID != test.expectedClientID {
 				t.Fatalf("expected: %s, got: %s", test.expectedClientID, clientID)
 			}
@@ -240,6 +415,7 @@ func TestGetTenantID(t *testing.T) {
 	tests := []struct {
 		name             string
 		sa               *corev1.ServiceAccount
+		ns               *corev1.Namespace
 		config           *config.Config
 		expectedTenantID string
 	}{
@@ -268,11 +444,74 @@ func TestGetTenantID(t *testing.T) {
 			},
 			expectedTenantID: "tenant-id",
 		},
+		{
+			name: "tenant ID annotation not defined, use namespace annotation",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "sa",
+					Namespace: "default",
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{TenantIDAnnotation: "namespace-tenant-id"},
+				},
+			},
+			config: &config.Config{
+				TenantID: "tenant-id",
+			},
+			expectedTenantID: "namespace-tenant-id",
+		},
+		{
+			name: "tenant ID annotation defined, preferred over namespace annotation",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{TenantIDAnnotation: "sa-tenant-id"},
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{TenantIDAnnotation: "namespace-tenant-id"},
+				},
+			},
+			config: &config.Config{
+				TenantID: "tenant-id",
+			},
+			expectedTenantID: "sa-tenant-id",
+		},
+		{
+			name: "empty tenant ID annotations, use default",
+			sa: &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "sa",
+					Namespace:   "default",
+					Annotations: map[string]string{TenantIDAnnotation: ""},
+				},
+			},
+			ns: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "default",
+					Annotations: map[string]string{TenantIDAnnotation: ""},
+				},
+			},
+			config: &config.Config{
+				TenantID: "tenant-id",
+			},
+			expectedTenantID: "tenant-id",
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			tenantID := getTenantID(test.sa, test.config)
+			ns := test.ns
+			if ns == nil {
+				ns = &corev1.Namespace{}
+			}
+			tenantID, _ := getTenantID(&corev1.Pod{}, test.sa, ns, test.config)
 			if tenantID != test.expectedTenantID {
 				t.Fatalf("expected: %s, got: %s", test.expectedTenantID, tenantID)
 			}
@@ -280,6 +519,132 @@ func TestGetTenantID(t *testing.T) {
 	}
 }
 
+func TestResolveIdentity(t *testing.T) {
+	annotated := func(annotations map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: "name", Namespace: "default", Annotations: annotations}
+	}
+
+	tests := []struct {
+		name             string
+		pod              *corev1.Pod
+		sa               *corev1.ServiceAccount
+		ns               *corev1.Namespace
+		expectedIdentity *workloadIdentity
+		expectedErr      bool
+	}{
+		{
+			name: "no annotations, use webhook config",
+			pod:  &corev1.Pod{},
+			sa:   &corev1.ServiceAccount{},
+			ns:   &corev1.Namespace{},
+			expectedIdentity: &workloadIdentity{
+				clientID:                      "",
+				clientIDSource:                "namespace annotation",
+				tenantID:                      "config-tenant-id",
+				tenantIDSource:                "webhook config",
+				serviceAccountTokenExpiration: DefaultServiceAccountTokenExpiration,
+			},
+		},
+		{
+			name: "namespace annotations",
+			pod:  &corev1.Pod{},
+			sa:   &corev1.ServiceAccount{},
+			ns: &corev1.Namespace{ObjectMeta: annotated(map[string]string{
+				ClientIDAnnotation:                  "ns-client-id",
+				TenantIDAnnotation:                  "ns-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "7200",
+			})},
+			expectedIdentity: &workloadIdentity{
+				clientID:                      "ns-client-id",
+				clientIDSource:                "namespace annotation",
+				tenantID:                      "ns-tenant-id",
+				tenantIDSource:                "namespace annotation",
+				serviceAccountTokenExpiration: 7200,
+			},
+		},
+		{
+			name: "service account annotations preferred over namespace",
+			pod:  &corev1.Pod{},
+			sa: &corev1.ServiceAccount{ObjectMeta: annotated(map[string]string{
+				ClientIDAnnotation:                  "sa-client-id",
+				TenantIDAnnotation:                  "sa-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "5400",
+			})},
+			ns: &corev1.Namespace{ObjectMeta: annotated(map[string]string{
+				ClientIDAnnotation:                  "ns-client-id",
+				TenantIDAnnotation:                  "ns-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "7200",
+			})},
+			expectedIdentity: &workloadIdentity{
+				clientID:                      "sa-client-id",
+				clientIDSource:                "service account annotation",
+				tenantID:                      "sa-tenant-id",
+				tenantIDSource:                "service account annotation",
+				serviceAccountTokenExpiration: 5400,
+			},
+		},
+		{
+			name: "pod annotations preferred over service account",
+			pod: &corev1.Pod{ObjectMeta: annotated(map[string]string{
+				ClientIDAnnotation:                  "pod-client-id",
+				TenantIDAnnotation:                  "pod-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "4000",
+			})},
+			sa: &corev1.ServiceAccount{ObjectMeta: annotated(map[string]string{
+				ClientIDAnnotation:                  "sa-client-id",
+				TenantIDAnnotation:                  "sa-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "5400",
+			})},
+			ns: &corev1.Namespace{},
+			expectedIdentity: &workloadIdentity{
+				clientID:                      "pod-client-id",
+				clientIDSource:                "pod annotation",
+				tenantID:                      "pod-tenant-id",
+				tenantIDSource:                "pod annotation",
+				serviceAccountTokenExpiration: 4000,
+			},
+		},
+		{
+			name: "pod client id with service account tenant id",
+			pod:  &corev1.Pod{ObjectMeta: annotated(map[string]string{ClientIDAnnotation: "pod-client-id"})},
+			sa:   &corev1.ServiceAccount{ObjectMeta: annotated(map[string]string{TenantIDAnnotation: "sa-tenant-id"})},
+			ns:   &corev1.Namespace{},
+			expectedIdentity: &workloadIdentity{
+				clientID:                      "pod-client-id",
+				clientIDSource:                "pod annotation",
+				tenantID:                      "sa-tenant-id",
+				tenantIDSource:                "service account annotation",
+				serviceAccountTokenExpiration: DefaultServiceAccountTokenExpiration,
+			},
+		},
+		{
+			name:        "invalid token expiration",
+			pod:         &corev1.Pod{ObjectMeta: annotated(map[string]string{ServiceAccountTokenExpiryAnnotation: "100"})},
+			sa:          &corev1.ServiceAccount{},
+			ns:          &corev1.Namespace{},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := resolveIdentity(test.pod, test.sa, test.ns, &config.Config{TenantID: "config-tenant-id"})
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(identity, test.expectedIdentity) {
+				t.Errorf("expected: %+v, got: %+v", test.expectedIdentity, identity)
+			}
+		})
+	}
+}
+
 func TestGetSkipContainers(t *testing.T) {
 	tests := []struct {
 		name                   string
@@ -341,10 +706,70 @@ func TestGetSkipContainers(t *testing.T) {
 	}
 }
 
+func TestGetContainerClientIDs(t *testing.T) {
+	tests := []struct {
+		name                       string
+		annotations                map[string]string
+		expectedContainerClientIDs map[string]string
+		expectedErr                bool
+	}{
+		{
+			name:                       "no container client ids defined",
+			annotations:                nil,
+			expectedContainerClientIDs: nil,
+		},
+		{
+			name:                       "one container client id defined",
+			annotations:                map[string]string{ContainerClientIDsAnnotation: "app=client-id-1"},
+			expectedContainerClientIDs: map[string]string{"app": "client-id-1"},
+		},
+		{
+			name:                       "multiple container client ids defined with extra space",
+			annotations:                map[string]string{ContainerClientIDsAnnotation: "app=client-id-1, uploader = client-id-2,"},
+			expectedContainerClientIDs: map[string]string{"app": "client-id-1", "uploader": "client-id-2"},
+		},
+		{
+			name:        "missing separator",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "app"},
+			expectedErr: true,
+		},
+		{
+			name:        "missing client id",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "app="},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate container",
+			annotations: map[string]string{ContainerClientIDsAnnotation: "app=client-id-1,app=client-id-2"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "pod",
+					Namespace:   "default",
+					Annotations: test.annotations,
+				},
+			}
+			containerClientIDs, err := getContainerClientIDs(pod)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(containerClientIDs, test.expectedContainerClientIDs) {
+				t.Fatalf("expected: %v, got: %v", test.expectedContainerClientIDs, containerClientIDs)
+			}
+		})
+	}
+}
+
 func TestAddProjectedVolume(t *testing.T) {
 	tests := []struct {
 		name           string
 		pod            *corev1.Pod
+		extraAudiences []extraAudience
 		expectedVolume []corev1.Volume
 	}{
 		{
@@ -375,24 +800,59 @@ func TestAddProjectedVolume(t *testing.T) {
 			},
 		},
 		{
-			name: "azure-identity-token projected volume already exists",
+			name: "extra audiences",
 			pod: &corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "pod",
 					Namespace: "default",
 				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: testVolumeName,
-							VolumeSource: corev1.VolumeSource{
-								Projected: &corev1.ProjectedVolumeSource{
-									Sources: []corev1.VolumeProjection{
-										{
-											ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
-												Path:              TokenFilePath,
-												ExpirationSeconds: &serviceAccountTokenExpiry,
-												Audience:          DefaultAudience,
+			},
+			extraAudiences: []extraAudience{{name: "vault", audience: "https://vault.example.com"}},
+			expectedVolume: []corev1.Volume{
+				{
+					Name: testVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{
+									ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+										Path:              TokenFilePath,
+										ExpirationSeconds: &serviceAccountTokenExpiry,
+										Audience:          DefaultAudience,
+									},
+								},
+								{
+									ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+										Path:              "audiences/vault/azure-identity-token",
+										ExpirationSeconds: &serviceAccountTokenExpiry,
+										Audience:          "https://vault.example.com",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "azure-identity-token projected volume already exists",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pod",
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: testVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+												Path:              TokenFilePath,
+												ExpirationSeconds: &serviceAccountTokenExpiry,
+												Audience:          DefaultAudience,
 											},
 										},
 									},
@@ -473,7 +933,7 @@ func TestAddProjectedVolume(t *testing.T) {
 	m := &podMutator{audience: DefaultAudience}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			m.addProjectedVolume(test.pod, serviceAccountTokenExpiry, testVolumeName, false)
+			m.addProjectedVolume(test.pod, serviceAccountTokenExpiry, testVolumeName, false, test.extraAudiences)
 
 			if !reflect.DeepEqual(test.pod.Spec.Volumes, test.expectedVolume) {
 				t.Fatalf("expected: %v, got: %v", test.pod.Spec.Volumes, test.expectedVolume)
@@ -645,6 +1105,666 @@ func TestAddEnvironmentVariables(t *testing.T) {
 	})
 }
 
+func TestGetExtraAudiences(t *testing.T) {
+	tests := []struct {
+		name                   string
+		annotations            map[string]string
+		expectedExtraAudiences []extraAudience
+		expectedErr            bool
+	}{
+		{
+			name:                   "no extra audiences defined",
+			annotations:            nil,
+			expectedExtraAudiences: nil,
+		},
+		{
+			name:        "multiple extra audiences defined with extra space",
+			annotations: map[string]string{ExtraAudiencesAnnotation: "vault=https://vault.example.com, aws = sts.amazonaws.com"},
+			expectedExtraAudiences: []extraAudience{
+				{name: "vault", audience: "https://vault.example.com"},
+				{name: "aws", audience: "sts.amazonaws.com"},
+			},
+		},
+		{
+			name:                   "audience containing separator",
+			annotations:            map[string]string{ExtraAudiencesAnnotation: "rp=api://rp?tenant=1"},
+			expectedExtraAudiences: []extraAudience{{name: "rp", audience: "api://rp?tenant=1"}},
+		},
+		{
+			name:        "missing audience",
+			annotations: map[string]string{ExtraAudiencesAnnotation: "vault"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid name",
+			annotations: map[string]string{ExtraAudiencesAnnotation: "../vault=https://vault.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "duplicate name",
+			annotations: map[string]string{ExtraAudiencesAnnotation: "vault=aud1,vault=aud2"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "pod",
+					Namespace:   "default",
+					Annotations: test.annotations,
+				},
+			}
+			extraAudiences, err := getExtraAudiences(pod)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(extraAudiences, test.expectedExtraAudiences) {
+				t.Fatalf("expected: %v, got: %v", test.expectedExtraAudiences, extraAudiences)
+			}
+		})
+	}
+}
+
+func TestAddExtraAudienceEnvironmentVariables(t *testing.T) {
+	container := corev1.Container{
+		Name: "container",
+		Env: []corev1.EnvVar{
+			{Name: "AZURE_FEDERATED_TOKEN_FILE_AWS", Value: "/custom/path"},
+		},
+	}
+	extraAudiences := []extraAudience{
+		{name: "my-vault", audience: "https://vault.example.com"},
+		{name: "aws", audience: "sts.amazonaws.com"},
+	}
+
+	expectedEnv := []corev1.EnvVar{
+		{Name: "AZURE_FEDERATED_TOKEN_FILE_AWS", Value: "/custom/path"},
+		{Name: "AZURE_FEDERATED_TOKEN_FILE_MY_VAULT", Value: "/var/run/secrets/azure/wi/audiences/my-vault/azure-identity-token"},
+	}
+
+	actualContainer := addExtraAudienceEnvironmentVariables(container, extraAudiences)
+	if !reflect.DeepEqual(actualContainer.Env, expectedEnv) {
+		t.Fatalf("expected: %v, got: %v", expectedEnv, actualContainer.Env)
+	}
+}
+
+func TestAddMissingEnvironmentVariables(t *testing.T) {
+	container := corev1.Container{
+		Name: "container",
+		Env: []corev1.EnvVar{
+			{Name: IdentityEndpointEnvVar, Value: "http://localhost:8080/custom"},
+		},
+	}
+
+	expectedEnv := []corev1.EnvVar{
+		{Name: IdentityEndpointEnvVar, Value: "http://localhost:8080/custom"},
+		{Name: IdentityHeaderEnvVar, Value: "secret"},
+		{Name: MSIEndpointEnvVar, Value: "http://localhost:8000/msi/token"},
+		{Name: MSISecretEnvVar, Value: "secret"},
+	}
+
+	actualContainer := addMissingEnvironmentVariables(container, appServiceEndpoint(8000, "secret").envs)
+	if !reflect.DeepEqual(actualContainer.Env, expectedEnv) {
+		t.Fatalf("expected: %v, got: %v", expectedEnv, actualContainer.Env)
+	}
+}
+
+func TestAddMissingVolumeMounts(t *testing.T) {
+	container := corev1.Container{
+		Name: "container",
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "data", MountPath: "/data"},
+		},
+	}
+	volumeMounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: "/other"},
+		{Name: AzureArcKeyVolumeName, MountPath: AzureArcKeyDir, ReadOnly: true},
+	}
+
+	expectedVolumeMounts := []corev1.VolumeMount{
+		{Name: "data", MountPath: "/data"},
+		{Name: AzureArcKeyVolumeName, MountPath: AzureArcKeyDir, ReadOnly: true},
+	}
+
+	actualContainer := addMissingVolumeMounts(container, volumeMounts)
+	if !reflect.DeepEqual(actualContainer.VolumeMounts, expectedVolumeMounts) {
+		t.Fatalf("expected: %v, got: %v", expectedVolumeMounts, actualContainer.VolumeMounts)
+	}
+}
+
+func TestAddVolumes(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "data"}},
+		},
+	}
+	volumes := azureArcEndpoint(8000).volumes
+	addVolumes(pod, volumes)
+	addVolumes(pod, volumes)
+
+	expectedVolumes := append([]corev1.Volume{{Name: "data"}}, volumes...)
+	if !reflect.DeepEqual(pod.Spec.Volumes, expectedVolumes) {
+		t.Fatalf("expected: %v, got: %v", expectedVolumes, pod.Spec.Volumes)
+	}
+}
+
+func TestGetIdentityHeader(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "container"}},
+		},
+	}
+	first, err := getIdentityHeader(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := getIdentityHeader(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first) != 32 || first == second {
+		t.Errorf("expected a new random identity header, got %q and %q", first, second)
+	}
+
+	// the identity header of a proxy sidecar injected by a previous invocation is reused
+	pod.Spec.InitContainers = []corev1.Container{{
+		Name: ProxySidecarContainerName,
+		Env:  []corev1.EnvVar{{Name: IdentityHeaderEnvVar, Value: "existing"}},
+	}}
+	if got, err := getIdentityHeader(pod); err != nil || got != "existing" {
+		t.Errorf("expected the existing identity header, got %q, %v", got, err)
+	}
+}
+
+func TestHandleAppServiceEnv(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "clientID"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expectEnv   bool
+		expectErr   bool
+	}{
+		{
+			name: "app service env injected with the proxy sidecar",
+			annotations: map[string]string{
+				InjectProxySidecarAnnotation:  "true",
+				ProxySidecarPortAnnotation:    "8080",
+				InjectAppServiceEnvAnnotation: "true",
+			},
+			expectEnv: true,
+		},
+		{
+			name:        "app service env not injected without the proxy sidecar",
+			annotations: map[string]string{InjectAppServiceEnvAnnotation: "true"},
+			expectEnv:   false,
+		},
+		{
+			name:        "app service env not injected when the annotation is not true",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAppServiceEnvAnnotation: "false"},
+			expectEnv:   false,
+		},
+		{
+			name:        "app service env not injected with azure arc env",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", InjectAppServiceEnvAnnotation: "true", InjectAzureArcEnvAnnotation: "true"},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &podMutator{
+				client:  fake.NewClientBuilder().WithObjects(serviceAccount).Build(),
+				reader:  fake.NewClientBuilder().Build(),
+				config:  &config.Config{TenantID: "tenantID"},
+				decoder: decoder,
+			}
+
+			req := atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "Pod",
+					},
+					Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, test.annotations, false)},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			}
+
+			resp := m.Handle(context.Background(), req)
+			if resp.Allowed == test.expectErr {
+				t.Fatalf("expected to be allowed: %v, got: %v", !test.expectErr, resp.Result)
+			}
+			if test.expectErr {
+				return
+			}
+			patches, err := json.Marshal(resp.Patches)
+			if err != nil {
+				t.Fatalf("failed to marshal patches: %v", err)
+			}
+			// IDENTITY_HEADER is injected into the proxy init container, the proxy sidecar, the init container and the container
+			headers := regexp.MustCompile(`"name":"IDENTITY_HEADER","value":"([0-9a-f]{32})"`).FindAllStringSubmatch(string(patches), -1)
+			if !test.expectEnv {
+				if len(headers) != 0 || strings.Contains(string(patches), IdentityEndpointEnvVar) {
+					t.Errorf("expected App Service environment variables to not be injected, got: %s", patches)
+				}
+				return
+			}
+			if len(headers) != 4 {
+				t.Fatalf("expected %s to be injected into 4 containers, got: %s", IdentityHeaderEnvVar, patches)
+			}
+			for _, header := range headers[1:] {
+				if header[1] != headers[0][1] {
+					t.Errorf("expected the proxy sidecar and the containers to use the same secret, got: %s", patches)
+				}
+			}
+			for _, want := range []string{
+				`{"name":"IDENTITY_ENDPOINT","value":"http://localhost:8080/msi/token"}`,
+				`{"name":"MSI_SECRET","value":"` + headers[0][1] + `"}`,
+			} {
+				if !strings.Contains(string(patches), want) {
+					t.Errorf("expected patches to contain %s, got: %s", want, patches)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleAzureArcEnv(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "clientID"},
+		},
+	}
+	annotations := map[string]string{
+		InjectProxySidecarAnnotation: "true",
+		InjectAzureArcEnvAnnotation:  "true",
+	}
+
+	m := &podMutator{
+		client:  fake.NewClientBuilder().WithObjects(serviceAccount).Build(),
+		reader:  fake.NewClientBuilder().Build(),
+		config:  &config.Config{TenantID: "tenantID"},
+		decoder: decoder,
+	}
+	req := atypes.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind: metav1.GroupVersionKind{
+				Group:   "",
+				Version: "v1",
+				Kind:    "Pod",
+			},
+			Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, annotations, false)},
+			Namespace: "ns1",
+			Operation: admissionv1.Create,
+		},
+	}
+
+	resp := m.Handle(context.Background(), req)
+	if !resp.Allowed {
+		t.Fatalf("expected to be allowed, got: %v", resp.Result)
+	}
+	patches, err := json.Marshal(resp.Patches)
+	if err != nil {
+		t.Fatalf("failed to marshal patches: %v", err)
+	}
+	for _, want := range []string{
+		`{"name":"IDENTITY_ENDPOINT","value":"http://localhost:8000/arc/metadata/identity/oauth2/token"}`,
+		`{"name":"IMDS_ENDPOINT","value":"http://localhost:8000"}`,
+		`{"emptyDir":{"medium":"Memory"},"name":"azwi-arc-keys"}`,
+		`"--arc-key-dir=/var/opt/azcmagent/tokens"`,
+		`{"mountPath":"/var/opt/azcmagent/tokens","name":"azwi-arc-keys"}`,
+		`{"mountPath":"/var/opt/azcmagent/tokens","name":"azwi-arc-keys","readOnly":true}`,
+	} {
+		if !strings.Contains(string(patches), want) {
+			t.Errorf("expected patches to contain %s, got: %s", want, patches)
+		}
+	}
+	if strings.Contains(string(patches), IdentityHeaderEnvVar) {
+		t.Errorf("expected %s to not be injected, got: %s", IdentityHeaderEnvVar, patches)
+	}
+}
+
+func TestHandleProxySidecarEnvMode(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "clientID"},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		expectProxyInit  bool
+		expectPatches    []string
+		notExpectPatches []string
+		expectErr        bool
+	}{
+		{
+			name:            "traffic redirected to the proxy sidecar by default",
+			annotations:     map[string]string{InjectProxySidecarAnnotation: "true"},
+			expectProxyInit: true,
+			notExpectPatches: []string{
+				AzurePodIdentityAuthorityHostEnvVar,
+				IdentityEndpointEnvVar,
+			},
+		},
+		{
+			name:            "traffic redirected to the proxy sidecar in redirect mode",
+			annotations:     map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: "redirect"},
+			expectProxyInit: true,
+		},
+		{
+			name:        "containers pointed to the proxy sidecar in env mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarPortAnnotation: "8080", ProxySidecarModeAnnotation: "Env"},
+			expectPatches: []string{
+				`{"name":"AZURE_POD_IDENTITY_AUTHORITY_HOST","value":"http://localhost:8080"}`,
+				`{"name":"IDENTITY_ENDPOINT","value":"http://localhost:8080/metadata/identity/oauth2/token"}`,
+				`{"name":"MSI_ENDPOINT","value":"http://localhost:8080/metadata/identity/oauth2/token"}`,
+				`{"name":"IMDS_ENDPOINT","value":"http://localhost:8080"}`,
+			},
+		},
+		{
+			name:        "app service env takes precedence in env mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: "env", InjectAppServiceEnvAnnotation: "true"},
+			expectPatches: []string{
+				`{"name":"AZURE_POD_IDENTITY_AUTHORITY_HOST","value":"http://localhost:8000"}`,
+				`{"name":"IDENTITY_ENDPOINT","value":"http://localhost:8000/msi/token"}`,
+				`{"name":"MSI_ENDPOINT","value":"http://localhost:8000/msi/token"}`,
+				`{"name":"IMDS_ENDPOINT","value":"http://localhost:8000"}`,
+			},
+			notExpectPatches: []string{
+				`{"name":"IDENTITY_ENDPOINT","value":"http://localhost:8000/metadata/identity/oauth2/token"}`,
+			},
+		},
+		{
+			name:        "invalid proxy sidecar mode",
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: "iptables"},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &podMutator{
+				client:  fake.NewClientBuilder().WithObjects(serviceAccount).Build(),
+				reader:  fake.NewClientBuilder().Build(),
+				config:  &config.Config{TenantID: "tenantID"},
+				decoder: decoder,
+			}
+
+			req := atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "Pod",
+					},
+					Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, test.annotations, false)},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			}
+
+			resp := m.Handle(context.Background(), req)
+			if resp.Allowed == test.expectErr {
+				t.Fatalf("expected to be allowed: %v, got: %v", !test.expectErr, resp.Result)
+			}
+			if test.expectErr {
+				return
+			}
+			patches, err := json.Marshal(resp.Patches)
+			if err != nil {
+				t.Fatalf("failed to marshal patches: %v", err)
+			}
+			if got := strings.Contains(string(patches), ProxyInitContainerName); got != test.expectProxyInit {
+				t.Errorf("expected proxy init container to be injected: %v, got: %s", test.expectProxyInit, patches)
+			}
+			for _, want := range test.expectPatches {
+				if !strings.Contains(string(patches), want) {
+					t.Errorf("expected patches to contain %s, got: %s", want, patches)
+				}
+			}
+			for _, notWant := range test.notExpectPatches {
+				if strings.Contains(string(patches), notWant) {
+					t.Errorf("expected patches to not contain %s, got: %s", notWant, patches)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePodSecurity(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "clientID"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		level           string
+		annotations     map[string]string
+		expectDenied    bool
+		expectProxyInit bool
+	}{
+		{
+			name:            "proxy init container injected without pod security level",
+			annotations:     map[string]string{InjectProxySidecarAnnotation: "true"},
+			expectProxyInit: true,
+		},
+		{
+			name:            "proxy init container injected in privileged namespace",
+			level:           PodSecurityLevelPrivileged,
+			annotations:     map[string]string{InjectProxySidecarAnnotation: "true"},
+			expectProxyInit: true,
+		},
+		{
+			name:         "proxy init container denied in baseline namespace",
+			level:        PodSecurityLevelBaseline,
+			annotations:  map[string]string{InjectProxySidecarAnnotation: "true"},
+			expectDenied: true,
+		},
+		{
+			name:         "proxy init container denied in restricted namespace",
+			level:        PodSecurityLevelRestricted,
+			annotations:  map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: ProxySidecarModeRedirect},
+			expectDenied: true,
+		},
+		{
+			name:        "proxy sidecar injected in env mode in restricted namespace",
+			level:       PodSecurityLevelRestricted,
+			annotations: map[string]string{InjectProxySidecarAnnotation: "true", ProxySidecarModeAnnotation: ProxySidecarModeEnv},
+		},
+		{
+			name:        "pod security level ignored without proxy sidecar",
+			level:       PodSecurityLevelRestricted,
+			annotations: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}}
+			if test.level != "" {
+				namespace.Labels = map[string]string{PodSecurityEnforceLabel: test.level}
+			}
+			m := &podMutator{
+				client:  fake.NewClientBuilder().WithObjects(serviceAccount, namespace).Build(),
+				reader:  fake.NewClientBuilder().Build(),
+				config:  &config.Config{TenantID: "tenantID"},
+				decoder: decoder,
+			}
+
+			req := atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "Pod",
+					},
+					Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, test.annotations, false)},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			}
+
+			resp := m.Handle(context.Background(), req)
+			if resp.Allowed == test.expectDenied {
+				t.Fatalf("expected to be allowed: %v, got: %v", !test.expectDenied, resp.Result)
+			}
+			if test.expectDenied {
+				for _, want := range []string{"namespace ns1", test.level + " Pod Security Standard", ProxySidecarModeAnnotation} {
+					if !strings.Contains(resp.Result.Message, want) {
+						t.Errorf("expected denial message to contain %q, got: %s", want, resp.Result.Message)
+					}
+				}
+				return
+			}
+			patches, err := json.Marshal(resp.Patches)
+			if err != nil {
+				t.Fatalf("failed to marshal patches: %v", err)
+			}
+			if got := strings.Contains(string(patches), ProxyInitContainerName); got != test.expectProxyInit {
+				t.Errorf("expected proxy init container to be injected: %v, got: %s", test.expectProxyInit, patches)
+			}
+		})
+	}
+}
+
+func TestHandleProxyOptions(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sa",
+			Namespace:   "ns1",
+			Annotations: map[string]string{ClientIDAnnotation: "clientID"},
+		},
+	}
+	m := &podMutator{
+		client: fake.NewClientBuilder().WithObjects(serviceAccount).Build(),
+		reader: fake.NewClientBuilder().Build(),
+		config: &config.Config{
+			TenantID:              "tenantID",
+			ProxyMemoryLimit:      "64Mi",
+			ProxyImagePullSecrets: []string{"proxy-mirror"},
+		},
+		decoder: decoder,
+	}
+	annotations := map[string]string{
+		InjectProxySidecarAnnotation:   "true",
+		ProxyCPURequestAnnotation:      "10m",
+		ProxyImagePullPolicyAnnotation: "Always",
+		ProxyReadinessProbeAnnotation:  "",
+		ProxyLivenessProbeAnnotation:   `{"periodSeconds": 60}`,
+	}
+	req := atypes.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Kind: metav1.GroupVersionKind{
+				Group:   "",
+				Version: "v1",
+				Kind:    "Pod",
+			},
+			Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, annotations, false)},
+			Namespace: "ns1",
+			Operation: admissionv1.Create,
+		},
+	}
+
+	resp := m.Handle(context.Background(), req)
+	if !resp.Allowed {
+		t.Fatalf("expected to be allowed, got: %v", resp.Result)
+	}
+	patches, err := json.Marshal(resp.Patches)
+	if err != nil {
+		t.Fatalf("failed to marshal patches: %v", err)
+	}
+	for _, want := range []string{
+		`"path":"/spec/imagePullSecrets","value":[{"name":"proxy-mirror"}]`,
+		`"imagePullPolicy":"Always"`,
+		`"resources":{"limits":{"memory":"64Mi"},"requests":{"cpu":"10m"}}`,
+		`{"exec":{"command":["/proxy","--proxy-port=8000","--health-check=healthz"]},"failureThreshold":3,"periodSeconds":60,"successThreshold":1,"timeoutSeconds":5}`,
+		`{"exec":{"command":["/proxy","--proxy-port=8000","--health-check=readyz"]},"failureThreshold":30,"periodSeconds":1,"successThreshold":1,"timeoutSeconds":5}`,
+	} {
+		if !strings.Contains(string(patches), want) {
+			t.Errorf("expected patches to contain %s, got: %s", want, patches)
+		}
+	}
+	if strings.Contains(string(patches), `"imagePullPolicy":"IfNotPresent"`) {
+		t.Errorf("expected the proxy containers to use the annotated image pull policy, got: %s", patches)
+	}
+	if strings.Contains(string(patches), `"readinessProbe"`) {
+		t.Errorf("expected the readiness probe to be disabled by the empty annotation, got: %s", patches)
+	}
+}
+
+func TestGetPodSecurityLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected string
+	}{
+		{
+			name:     "no label",
+			expected: PodSecurityLevelPrivileged,
+		},
+		{
+			name:     "baseline",
+			labels:   map[string]string{PodSecurityEnforceLabel: "baseline"},
+			expected: PodSecurityLevelBaseline,
+		},
+		{
+			name:     "restricted",
+			labels:   map[string]string{PodSecurityEnforceLabel: " Restricted "},
+			expected: PodSecurityLevelRestricted,
+		},
+		{
+			name:     "unknown level",
+			labels:   map[string]string{PodSecurityEnforceLabel: "strict"},
+			expected: PodSecurityLevelPrivileged,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: test.labels}}
+			if got := getPodSecurityLevel(ns); got != test.expected {
+				t.Errorf("expected level %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
 func TestAddProjectServiceAccountTokenVolumeMount(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -798,9 +1918,86 @@ func TestHandle(t *testing.T) {
 			if !resp.Allowed {
 				t.Fatalf("expected to be allowed")
 			}
-			for _, patch := range resp.Patches {
-				if patch.Operation == "remove" {
-					t.Errorf("expected no remove patches, got: %v", patch)
+			for _, patch := range resp.Patches {
+				if patch.Operation == "remove" {
+					t.Errorf("expected no remove patches, got: %v", patch)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleNamespaceDefaults(t *testing.T) {
+	if err := registerMetrics(); err != nil {
+		t.Fatalf("failed to register metrics: %v", err)
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sa",
+			Namespace: "ns1",
+		},
+	}
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ns1",
+			Annotations: map[string]string{
+				ClientIDAnnotation:                  "namespace-client-id",
+				TenantIDAnnotation:                  "namespace-tenant-id",
+				ServiceAccountTokenExpiryAnnotation: "5400",
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		clientObjects []client.Object
+		readerObjects []client.Object
+	}{
+		{
+			name:          "namespace in cache",
+			clientObjects: []client.Object{serviceAccount, namespace},
+		},
+		{
+			name:          "namespace not in cache",
+			clientObjects: []client.Object{serviceAccount},
+			readerObjects: []client.Object{namespace},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &podMutator{
+				client:  fake.NewClientBuilder().WithObjects(test.clientObjects...).Build(),
+				reader:  fake.NewClientBuilder().WithObjects(test.readerObjects...).Build(),
+				config:  &config.Config{TenantID: "tenantID"},
+				decoder: decoder,
+			}
+
+			req := atypes.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Kind: metav1.GroupVersionKind{
+						Group:   "",
+						Version: "v1",
+						Kind:    "Pod",
+					},
+					Object:    runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", nil, nil, false)},
+					Namespace: "ns1",
+					Operation: admissionv1.Create,
+				},
+			}
+
+			resp := m.Handle(context.Background(), req)
+			if !resp.Allowed {
+				t.Fatalf("expected to be allowed, got: %v", resp.Result)
+			}
+			patches, err := json.Marshal(resp.Patches)
+			if err != nil {
+				t.Fatalf("failed to marshal patches: %v", err)
+			}
+			for _, want := range []string{`"namespace-client-id"`, `"namespace-tenant-id"`, `"expirationSeconds":5400`} {
+				if !strings.Contains(string(patches), want) {
+					t.Errorf("expected patches to contain %s, got: %s", want, patches)
 				}
 			}
 		})
@@ -878,6 +2075,7 @@ func TestMutateContainers(t *testing.T) {
 	tests := []struct {
 		name               string
 		containers         []corev1.Container
+		containerClientIDs map[string]string
 		skipContainers     sets.Set[string]
 		expectedContainers []corev1.Container
 	}{{
@@ -961,6 +2159,73 @@ func TestMutateContainers(t *testing.T) {
 			Name:  "skip-container",
 			Image: "skip-image",
 		}},
+	}, {
+		name: "one container with container specific client id",
+		containers: []corev1.Container{{
+			Name:  "my-container",
+			Image: "my-image",
+		}, {
+			Name:  "uploader",
+			Image: "uploader-image",
+		}},
+		containerClientIDs: map[string]string{"uploader": "uploader-client-id"},
+		expectedContainers: []corev1.Container{{
+			Name:  "my-container",
+			Image: "my-image",
+			Env: []corev1.EnvVar{
+				{
+					Name:  AzureClientIDEnvVar,
+					Value: azureClientID,
+				},
+				{
+					Name:  AzureTenantIDEnvVar,
+					Value: azureTenantID,
+				},
+				{
+					Name:  AzureFederatedTokenFileEnvVar,
+					Value: filepath.Join(VolumeMountPath, TokenFilePath),
+				},
+				{
+					Name:  AzureAuthorityHostEnvVar,
+					Value: azureAuthorityHost,
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      testVolumeName,
+					MountPath: VolumeMountPath,
+					ReadOnly:  true,
+				},
+			},
+		}, {
+			Name:  "uploader",
+			Image: "uploader-image",
+			Env: []corev1.EnvVar{
+				{
+					Name:  AzureClientIDEnvVar,
+					Value: "uploader-client-id",
+				},
+				{
+					Name:  AzureTenantIDEnvVar,
+					Value: azureTenantID,
+				},
+				{
+					Name:  AzureFederatedTokenFileEnvVar,
+					Value: filepath.Join(VolumeMountPath, TokenFilePath),
+				},
+				{
+					Name:  AzureAuthorityHostEnvVar,
+					Value: azureAuthorityHost,
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      testVolumeName,
+					MountPath: VolumeMountPath,
+					ReadOnly:  true,
+				},
+			},
+		}},
 	}}
 
 	m := &podMutator{
@@ -973,7 +2238,7 @@ func TestMutateContainers(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			containers := m.mutateContainers(test.containers, azureClientID, azureTenantID, test.skipContainers, false, testVolumeName)
+			containers := m.mutateContainers(test.containers, azureClientID, azureTenantID, test.containerClientIDs, test.skipContainers, nil, nil, false, testVolumeName)
 			if !reflect.DeepEqual(containers, test.expectedContainers) {
 				t.Errorf("expected: %v, got: %v", test.expectedContainers, test.containers)
 			}
@@ -999,22 +2264,55 @@ func TestInjectProxyInitContainer(t *testing.T) {
 			RunAsNonRoot: ptr.To(false),
 			RunAsUser:    ptr.To[int64](0),
 		},
-		Env: []corev1.EnvVar{{
-			Name:  ProxyPortEnvVar,
-			Value: strconv.FormatInt(int64(proxyPort), 10),
-		}},
+		Env: []corev1.EnvVar{
+			{
+				Name:  ProxyPortEnvVar,
+				Value: strconv.FormatInt(int64(proxyPort), 10),
+			},
+			{
+				Name:  ProxyUIDEnvVar,
+				Value: "1501",
+			},
+		},
+	}
+
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
 	}
+	proxyInitContainerWithOptions := proxyInitContainer
+	proxyInitContainerWithOptions.ImagePullPolicy = corev1.PullAlways
+	proxyInitContainerWithOptions.Resources = resources
+
+	proxyInitContainerWithMetadataIPv6 := proxyInitContainer
+	proxyInitContainerWithMetadataIPv6.Env = append(append([]corev1.EnvVar{}, proxyInitContainer.Env...), corev1.EnvVar{
+		Name:  MetadataIPv6EnvVar,
+		Value: "fd00:ec2::254",
+	})
 
 	tests := []struct {
 		name               string
 		containers         []corev1.Container
 		expectedContainers []corev1.Container
+		opts               *proxyOptions
 	}{
 		{
 			name:               "no init containers",
 			containers:         []corev1.Container{},
 			expectedContainers: []corev1.Container{proxyInitContainer},
 		},
+		{
+			name:               "inject proxy init container with resources and image pull policy",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyInitContainerWithOptions},
+			opts:               &proxyOptions{resources: resources, imagePullPolicy: corev1.PullAlways},
+		},
+		{
+			name:               "inject proxy init container with metadata IPv6",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyInitContainerWithMetadataIPv6},
+			opts:               &proxyOptions{imagePullPolicy: corev1.PullIfNotPresent, metadataIPv6: "fd00:ec2::254"},
+		},
 		{
 			name:               "proxy init container manually injected",
 			containers:         []corev1.Container{proxyInitContainer},
@@ -1041,7 +2339,11 @@ func TestInjectProxyInitContainer(t *testing.T) {
 	m := &podMutator{proxyInitImage: imageURL}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			containers := m.injectProxyInitContainer(test.containers, proxyPort)
+			opts := proxyOptions{imagePullPolicy: corev1.PullIfNotPresent}
+			if test.opts != nil {
+				opts = *test.opts
+			}
+			containers := m.injectProxyInitContainer(test.containers, proxyPort, opts)
 			if !reflect.DeepEqual(containers, test.expectedContainers) {
 				t.Errorf("expected: %v, got: %v", test.expectedContainers, test.containers)
 			}
@@ -1104,17 +2406,71 @@ func TestInjectProxySidecarContainer(t *testing.T) {
 			},
 			Privileged:             ptr.To(false),
 			ReadOnlyRootFilesystem: ptr.To(true),
+			RunAsGroup:             ptr.To[int64](1501),
 			RunAsNonRoot:           ptr.To(true),
+			RunAsUser:              ptr.To[int64](1501),
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
 		},
 	}
 
 	proxyNativeSidecarContainer := proxySidecarContainer
 	proxyNativeSidecarContainer.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
 
+	proxyMetricsSidecarContainer := proxySidecarContainer
+	proxyMetricsSidecarContainer.Args = append([]string{}, proxySidecarContainer.Args...)
+	proxyMetricsSidecarContainer.Args = append(proxyMetricsSidecarContainer.Args, "--metrics-addr=:9090")
+	proxyMetricsSidecarContainer.Ports = []corev1.ContainerPort{
+		{ContainerPort: proxyPort},
+		{Name: "metrics", ContainerPort: 9090},
+	}
+
+	proxyAppServiceSidecarContainer := proxySidecarContainer
+	proxyAppServiceSidecarContainer.Env = []corev1.EnvVar{{Name: IdentityHeaderEnvVar, Value: "secret"}}
+
+	proxyMetadataIPv6SidecarContainer := proxySidecarContainer
+	proxyMetadataIPv6SidecarContainer.Env = []corev1.EnvVar{
+		{Name: IdentityHeaderEnvVar, Value: "secret"},
+		{Name: MetadataIPv6EnvVar, Value: "fd00:ec2::254"},
+	}
+
+	proxyArcSidecarContainer := proxySidecarContainer
+	proxyArcSidecarContainer.Args = append([]string{}, proxySidecarContainer.Args...)
+	proxyArcSidecarContainer.Args = append(proxyArcSidecarContainer.Args, "--arc-key-dir=/var/opt/azcmagent/tokens")
+	proxyArcSidecarContainer.VolumeMounts = []corev1.VolumeMount{{Name: AzureArcKeyVolumeName, MountPath: AzureArcKeyDir}}
+
+	proxyStrictSidecarContainer := proxySidecarContainer
+	proxyStrictSidecarContainer.Args = append([]string{}, proxySidecarContainer.Args...)
+	proxyStrictSidecarContainer.Args = append(proxyStrictSidecarContainer.Args, "--strict-mode")
+
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+	}
+	proxySidecarContainerWithOptions := proxySidecarContainer
+	proxySidecarContainerWithOptions.ImagePullPolicy = corev1.PullNever
+	proxySidecarContainerWithOptions.Resources = resources
+
+	healthCheck := func(check string) corev1.ProbeHandler {
+		return corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/proxy", fmt.Sprintf("--proxy-port=%d", proxyPort), "--health-check=" + check},
+			},
+		}
+	}
+	proxySidecarContainerWithProbes := proxySidecarContainer
+	proxySidecarContainerWithProbes.StartupProbe = &corev1.Probe{ProbeHandler: healthCheck("readyz"), PeriodSeconds: 1, FailureThreshold: 30}
+	proxySidecarContainerWithProbes.LivenessProbe = &corev1.Probe{ProbeHandler: healthCheck("healthz"), PeriodSeconds: 30, FailureThreshold: 3}
+
 	tests := []struct {
 		name               string
 		containers         []corev1.Container
 		expectedContainers []corev1.Container
+		metricsPort        int32
+		endpoint           *proxyEndpoint
+		strictMode         bool
+		opts               *proxyOptions
 		restartPolicy      *corev1.ContainerRestartPolicy
 	}{
 		{
@@ -1163,12 +2519,70 @@ func TestInjectProxySidecarContainer(t *testing.T) {
 			},
 			restartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
 		},
+		{
+			name:               "inject proxy sidecar container with metrics endpoint",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyMetricsSidecarContainer},
+			metricsPort:        9090,
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container with app service endpoint",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyAppServiceSidecarContainer},
+			endpoint:           appServiceEndpoint(proxyPort, "secret"),
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container with metadata IPv6",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyMetadataIPv6SidecarContainer},
+			endpoint:           appServiceEndpoint(proxyPort, "secret"),
+			opts:               &proxyOptions{imagePullPolicy: corev1.PullIfNotPresent, metadataIPv6: "fd00:ec2::254"},
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container with azure arc endpoint",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyArcSidecarContainer},
+			endpoint:           azureArcEndpoint(proxyPort),
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container in strict mode",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxyStrictSidecarContainer},
+			strictMode:         true,
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container with resources and image pull policy",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxySidecarContainerWithOptions},
+			opts:               &proxyOptions{resources: resources, imagePullPolicy: corev1.PullNever},
+			restartPolicy:      nil,
+		},
+		{
+			name:               "inject proxy sidecar container with probes",
+			containers:         []corev1.Container{},
+			expectedContainers: []corev1.Container{proxySidecarContainerWithProbes},
+			opts: &proxyOptions{
+				imagePullPolicy: corev1.PullIfNotPresent,
+				startupProbe:    &corev1.Probe{PeriodSeconds: 1, FailureThreshold: 30},
+				livenessProbe:   &corev1.Probe{PeriodSeconds: 30, FailureThreshold: 3},
+			},
+			restartPolicy: nil,
+		},
 	}
 
 	m := &podMutator{proxyImage: imageURL}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			containers := m.injectProxySidecarContainer(test.containers, proxyPort, test.restartPolicy)
+			opts := proxyOptions{imagePullPolicy: corev1.PullIfNotPresent}
+			if test.opts != nil {
+				opts = *test.opts
+			}
+			containers := m.injectProxySidecarContainer(test.containers, proxyPort, test.metricsPort, test.endpoint, test.strictMode, opts, test.restartPolicy)
 			if !reflect.DeepEqual(containers, test.expectedContainers) {
 				t.Errorf("expected: %v, got: %v", test.expectedContainers, containers)
 			}
@@ -1176,6 +2590,210 @@ func TestInjectProxySidecarContainer(t *testing.T) {
 	}
 }
 
+func TestGetProxyOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		config       *config.Config
+		expectedOpts proxyOptions
+		expectedErr  string
+	}{
+		{
+			name:         "defaults",
+			config:       &config.Config{},
+			expectedOpts: proxyOptions{imagePullPolicy: corev1.PullIfNotPresent},
+		},
+		{
+			name: "webhook config",
+			config: &config.Config{
+				ProxyCPURequest:      "10m",
+				ProxyMemoryLimit:     "64Mi",
+				ProxyImagePullPolicy: "Always",
+			},
+			expectedOpts: proxyOptions{
+				resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+				},
+				imagePullPolicy: corev1.PullAlways,
+			},
+		},
+		{
+			name:         "metadata IPv6",
+			config:       &config.Config{ProxyMetadataIPv6: "fd00:ec2::254"},
+			expectedOpts: proxyOptions{imagePullPolicy: corev1.PullIfNotPresent, metadataIPv6: "fd00:ec2::254"},
+		},
+		{
+			name: "annotations override webhook config",
+			annotations: map[string]string{
+				ProxyCPURequestAnnotation:      "50m",
+				ProxyCPULimitAnnotation:        "100m",
+				ProxyMemoryRequestAnnotation:   "32Mi",
+				ProxyImagePullPolicyAnnotation: "Never",
+			},
+			config: &config.Config{
+				ProxyCPURequest:      "10m",
+				ProxyMemoryLimit:     "64Mi",
+				ProxyImagePullPolicy: "Always",
+			},
+			expectedOpts: proxyOptions{
+				resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+				},
+				imagePullPolicy: corev1.PullNever,
+			},
+		},
+		{
+			name:         "empty annotation removes webhook default",
+			annotations:  map[string]string{ProxyMemoryLimitAnnotation: ""},
+			config:       &config.Config{ProxyMemoryLimit: "64Mi"},
+			expectedOpts: proxyOptions{imagePullPolicy: corev1.PullIfNotPresent},
+		},
+		{
+			name:        "invalid quantity",
+			annotations: map[string]string{ProxyCPULimitAnnotation: "one"},
+			config:      &config.Config{},
+			expectedErr: `invalid quantity "one" in azure.workload.identity/proxy-cpu-limit annotation`,
+		},
+		{
+			name:        "request greater than limit",
+			annotations: map[string]string{ProxyMemoryRequestAnnotation: "128Mi"},
+			config:      &config.Config{ProxyMemoryLimit: "64Mi"},
+			expectedErr: "memory request 128Mi of the proxy containers must be less than or equal to the memory limit 64Mi",
+		},
+		{
+			name:        "invalid image pull policy",
+			annotations: map[string]string{ProxyImagePullPolicyAnnotation: "Sometimes"},
+			config:      &config.Config{},
+			expectedErr: `invalid image pull policy "Sometimes" in azure.workload.identity/proxy-image-pull-policy annotation, must be Always, IfNotPresent or Never`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			opts, err := getProxyOptions(pod, test.config)
+			if test.expectedErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error %q, got: %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the probes are tested in TestGetProxyProbe
+			if opts.startupProbe == nil || opts.readinessProbe == nil || opts.livenessProbe == nil {
+				t.Fatalf("expected the default probes, got %+v", opts)
+			}
+			opts.startupProbe, opts.readinessProbe, opts.livenessProbe = nil, nil, nil
+			if !reflect.DeepEqual(opts, test.expectedOpts) {
+				t.Errorf("expected options %+v, got %+v", test.expectedOpts, opts)
+			}
+		})
+	}
+}
+
+func TestGetProxyProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotation    string
+		annotations   map[string]string
+		expectedProbe *corev1.Probe
+		expectedErr   string
+	}{
+		{
+			name:          "default startup probe",
+			annotation:    ProxyStartupProbeAnnotation,
+			expectedProbe: &corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 1, SuccessThreshold: 1, FailureThreshold: 30},
+		},
+		{
+			name:          "default readiness probe",
+			annotation:    ProxyReadinessProbeAnnotation,
+			expectedProbe: &corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 10, SuccessThreshold: 1, FailureThreshold: 3},
+		},
+		{
+			name:          "default liveness probe",
+			annotation:    ProxyLivenessProbeAnnotation,
+			expectedProbe: &corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 30, SuccessThreshold: 1, FailureThreshold: 3},
+		},
+		{
+			name:          "annotation overrides default timing",
+			annotation:    ProxyLivenessProbeAnnotation,
+			annotations:   map[string]string{ProxyLivenessProbeAnnotation: `{"initialDelaySeconds": 10, "periodSeconds": 60, "failureThreshold": 5}`},
+			expectedProbe: &corev1.Probe{InitialDelaySeconds: 10, TimeoutSeconds: 5, PeriodSeconds: 60, SuccessThreshold: 1, FailureThreshold: 5},
+		},
+		{
+			name:          "readiness probe success threshold",
+			annotation:    ProxyReadinessProbeAnnotation,
+			annotations:   map[string]string{ProxyReadinessProbeAnnotation: `{"successThreshold": 2}`},
+			expectedProbe: &corev1.Probe{TimeoutSeconds: 5, PeriodSeconds: 10, SuccessThreshold: 2, FailureThreshold: 3},
+		},
+		{
+			name:        "empty annotation disables probe",
+			annotation:  ProxyStartupProbeAnnotation,
+			annotations: map[string]string{ProxyStartupProbeAnnotation: ""},
+		},
+		{
+			name:        "invalid json",
+			annotation:  ProxyReadinessProbeAnnotation,
+			annotations: map[string]string{ProxyReadinessProbeAnnotation: "10s"},
+			expectedErr: "failed to parse azure.workload.identity/proxy-readiness-probe annotation",
+		},
+		{
+			name:        "handler can't be overridden",
+			annotation:  ProxyLivenessProbeAnnotation,
+			annotations: map[string]string{ProxyLivenessProbeAnnotation: `{"httpGet": {"path": "/healthz", "port": 8000}}`},
+			expectedErr: "failed to parse azure.workload.identity/proxy-liveness-probe annotation",
+		},
+		{
+			name:        "invalid period",
+			annotation:  ProxyReadinessProbeAnnotation,
+			annotations: map[string]string{ProxyReadinessProbeAnnotation: `{"periodSeconds": 0}`},
+			expectedErr: "periodSeconds in azure.workload.identity/proxy-readiness-probe annotation must be greater than or equal to 1",
+		},
+		{
+			name:        "liveness probe success threshold",
+			annotation:  ProxyLivenessProbeAnnotation,
+			annotations: map[string]string{ProxyLivenessProbeAnnotation: `{"successThreshold": 2}`},
+			expectedErr: "successThreshold in azure.workload.identity/proxy-liveness-probe annotation must be 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			probe, err := getProxyProbe(pod, test.annotation)
+			if test.expectedErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+					t.Fatalf("expected error %q, got: %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(probe, test.expectedProbe) {
+				t.Errorf("expected probe %+v, got %+v", test.expectedProbe, probe)
+			}
+		})
+	}
+}
+
+func TestAddImagePullSecrets(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "app"}, {Name: "mirror"}},
+		},
+	}
+	addImagePullSecrets(pod, []string{"mirror", "proxy-mirror", "proxy-mirror"})
+	expected := []corev1.LocalObjectReference{{Name: "app"}, {Name: "mirror"}, {Name: "proxy-mirror"}}
+	if !reflect.DeepEqual(pod.Spec.ImagePullSecrets, expected) {
+		t.Errorf("expected image pull secrets %v, got %v", expected, pod.Spec.ImagePullSecrets)
+	}
+}
+
 func TestShouldInjectProxySidecar(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1268,6 +2886,21 @@ func TestGetProxyPort(t *testing.T) {
 			want:    8080,
 			wantErr: false,
 		},
+		{
+			name: "pod is annotated with azure.workload.identity/proxy-sidecar-port=70000",
+			args: args{
+				pod: &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "pod",
+						Annotations: map[string]string{
+							ProxySidecarPortAnnotation: "70000",
+						},
+					},
+				},
+			},
+			want:    0,
+			wantErr: true,
+		},
 		{
 			name: "pod is annotated with azure.workload.identity/proxy-sidecar-port=invalid",
 			args: args{
@@ -1298,6 +2931,69 @@ func TestGetProxyPort(t *testing.T) {
 	}
 }
 
+func TestGetProxyMetricsPort(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int32
+		wantErr     bool
+	}{
+		{
+			name:        "pod not annotated",
+			annotations: nil,
+			want:        0,
+		},
+		{
+			name:        "pod is annotated with azure.workload.identity/proxy-sidecar-metrics-port=9090",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "9090"},
+			want:        9090,
+		},
+		{
+			name:        "pod is annotated with azure.workload.identity/proxy-sidecar-metrics-port=invalid",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "invalid"},
+			want:        0,
+			wantErr:     true,
+		},
+		{
+			name:        "pod is annotated with azure.workload.identity/proxy-sidecar-metrics-port=0",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "0"},
+			want:        0,
+			wantErr:     true,
+		},
+		{
+			name:        "pod is annotated with azure.workload.identity/proxy-sidecar-metrics-port=-1",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "-1"},
+			want:        0,
+			wantErr:     true,
+		},
+		{
+			name:        "pod is annotated with azure.workload.identity/proxy-sidecar-metrics-port=65536",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "65536"},
+			want:        0,
+			wantErr:     true,
+		},
+		{
+			name:        "metrics port is the same as the proxy port",
+			annotations: map[string]string{ProxySidecarMetricsPortAnnotation: "8000"},
+			want:        0,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tt.annotations}}
+			got, err := getProxyMetricsPort(pod, DefaultProxySidecarPort)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getProxyMetricsPort() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getProxyMetricsPort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestHandleError(t *testing.T) {
 	serviceAccounts := []client.Object{}
 	for _, name := range []string{"default", "sa"} {
@@ -1344,6 +3040,20 @@ func TestHandleError(t *testing.T) {
 			clientObjects: serviceAccounts,
 			expectedErr:   `failed to parse proxy sidecar port: strconv.ParseInt: parsing "invalid": invalid syntax`,
 		},
+		{
+			name: "invalid container client ids",
+			object: runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"},
+				map[string]string{ContainerClientIDsAnnotation: "container"}, false)},
+			clientObjects: serviceAccounts,
+			expectedErr:   `invalid container client id mapping "container"`,
+		},
+		{
+			name: "invalid extra audiences",
+			object: runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"},
+				map[string]string{ExtraAudiencesAnnotation: "vault"}, false)},
+			clientObjects: serviceAccounts,
+			expectedErr:   `invalid extra audience "vault"`,
+		},
 		{
 			name: "invalid sa token expiry",
 			object: runtime.RawExtension{Raw: newPodRaw("pod", "ns1", "sa", map[string]string{UseWorkloadIdentityLabel: "true"},
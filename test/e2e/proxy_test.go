@@ -148,4 +148,197 @@ var _ = ginkgo.Describe("Proxy [LinuxOnly] [AKSSoakOnly]", func() {
 			}, framework.PollShortTimeout, framework.Poll).Should(gomega.BeTrue())
 		}
 	})
+
+	// This test is to validate that the proxy sidecar in strict mode never forwards requests to the IMDS identity
+	// endpoints to IMDS, where they could be served with the identity of the node.
+	ginkgo.It("should not forward identity requests to IMDS when the proxy sidecar runs in strict mode", func(ctx context.Context) {
+		clientID, ok := os.LookupEnv("APPLICATION_CLIENT_ID")
+		gomega.Expect(ok).To(gomega.BeTrue(), "APPLICATION_CLIENT_ID must be set")
+		// trust is only set up for 'proxy-test-sa' service account in the default namespace for now
+		const namespace = "default"
+		serviceAccount := createServiceAccount(f.ClientSet, namespace, "proxy-test-sa", map[string]string{clientIDAnnotation: clientID})
+		defer f.ClientSet.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), serviceAccount, metav1.DeleteOptions{})
+
+		proxyAnnotations := map[string]string{
+			injectProxySidecarAnnotation:     "true",
+			proxySidecarPortAnnotation:       "8080",
+			proxySidecarStrictModeAnnotation: "true",
+		}
+
+		// the resource ID is not in the identity map of the proxy, so IMDS is the only one that could serve these requests
+		const query = "api-version=2018-02-01&resource=https://management.azure.com/&mi_res_id=/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/kubelet"
+		script := fmt.Sprintf(`for path in metadata/identity/oauth2/token metadata/IDENTITY/oauth2/token Metadata/Identity/OAuth2/Token/extra; do
+  curl -s -H Metadata:true "http://169.254.169.254/${path}?%s"; echo
+done
+curl -s -H Metadata:true "http://169.254.169.254/metadata/identity/info?api-version=2018-02-01"; echo
+curl -s -H Metadata:true "http://169.254.169.254/metadata/Identity/oauth2/token?api-version=2018-02-01&resource=https://management.azure.com/&client_id=%s" | grep -o '"token_type":"Bearer"'
+sleep 3600`, query, clientID)
+
+		pod := generatePodWithServiceAccount(
+			f.ClientSet,
+			namespace,
+			serviceAccount,
+			"mcr.microsoft.com/azure-cli",
+			nil,
+			[]string{"/bin/sh", "-c", script},
+			nil,
+			proxyAnnotations,
+			map[string]string{useWorkloadIdentityLabel: "true"},
+			true,
+		)
+
+		pod, err := createPod(f.ClientSet, pod)
+		framework.ExpectNoError(err, "failed to create pod %s in %s", pod.Name, namespace)
+		defer f.ClientSet.CoreV1().Pods(namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+
+		// output proxy and proxy init logs for debugging
+		defer func() {
+			for _, container := range []string{"azwi-proxy-init", "azwi-proxy"} {
+				stdout, _ := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, container)
+				framework.Logf("%s logs: %s", container, stdout)
+			}
+		}()
+
+		validateProxySideCarInMutatedPod(pod)
+		gomega.Expect(getProxySidecarContainer(append(pod.Spec.InitContainers, pod.Spec.Containers...)).Args).To(gomega.ContainElement("--strict-mode"))
+
+		for _, container := range []string{busybox1, busybox2} {
+			framework.Logf("validating that the identity requests of %s in %s are served or rejected by the proxy", container, pod.Name)
+			gomega.Eventually(func() bool {
+				stdout, err := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, container)
+				if err != nil {
+					framework.Logf("failed to get logs from container %s in %s/%s: %v. Retrying...", container, namespace, pod.Name, err)
+					return false
+				}
+				framework.Logf("stdout: %s", stdout)
+				// every token request variant is rejected by the proxy instead of being served by IMDS,
+				// the other identity endpoints are blocked, and token requests with unusual casing
+				// for the workload identity are served by the proxy
+				return strings.Count(stdout, `"error_description":"Identity not found"`) == 3 &&
+					strings.Contains(stdout, "blocked because the proxy runs in strict mode") &&
+					strings.Contains(stdout, `"token_type":"Bearer"`)
+			}, framework.PollShortTimeout, framework.Poll).Should(gomega.BeTrue())
+		}
+
+		stdout, err := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, "azwi-proxy")
+		framework.ExpectNoError(err, "failed to get logs from the proxy sidecar in %s/%s", namespace, pod.Name)
+		gomega.Expect(stdout).NotTo(gomega.ContainSubstring("received response from IMDS"), "the proxy sidecar in strict mode forwarded a request to IMDS")
+	})
+
+	// This test is to validate that the containers can use the proxy sidecar without the proxy init container,
+	// which needs the NET_ADMIN capability, when the proxy sidecar runs in environment mode.
+	ginkgo.It("should get a valid AAD token through the environment variables when the proxy sidecar runs in env mode", func(ctx context.Context) {
+		clientID, ok := os.LookupEnv("APPLICATION_CLIENT_ID")
+		gomega.Expect(ok).To(gomega.BeTrue(), "APPLICATION_CLIENT_ID must be set")
+		// trust is only set up for 'proxy-test-sa' service account in the default namespace for now
+		const namespace = "default"
+		serviceAccount := createServiceAccount(f.ClientSet, namespace, "proxy-test-sa", map[string]string{clientIDAnnotation: clientID})
+		defer f.ClientSet.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), serviceAccount, metav1.DeleteOptions{})
+
+		proxyAnnotations := map[string]string{
+			injectProxySidecarAnnotation: "true",
+			proxySidecarPortAnnotation:   "8080",
+			proxySidecarModeAnnotation:   "env",
+		}
+
+		script := fmt.Sprintf(`curl -s -H Metadata:true "${IDENTITY_ENDPOINT}?api-version=2018-02-01&resource=https://management.azure.com/&client_id=%s" | grep -o '"token_type":"Bearer"'
+sleep 3600`, clientID)
+
+		pod := generatePodWithServiceAccount(
+			f.ClientSet,
+			namespace,
+			serviceAccount,
+			"mcr.microsoft.com/azure-cli",
+			nil,
+			[]string{"/bin/sh", "-c", script},
+			nil,
+			proxyAnnotations,
+			map[string]string{useWorkloadIdentityLabel: "true"},
+			true,
+		)
+
+		pod, err := createPod(f.ClientSet, pod)
+		framework.ExpectNoError(err, "failed to create pod %s in %s", pod.Name, namespace)
+		defer f.ClientSet.CoreV1().Pods(namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+
+		// output proxy logs for debugging
+		defer func() {
+			stdout, _ := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, "azwi-proxy")
+			framework.Logf("azwi-proxy logs: %s", stdout)
+		}()
+
+		validateProxySideCarInMutatedPod(pod)
+		for _, container := range pod.Spec.InitContainers {
+			gomega.Expect(container.Name).NotTo(gomega.Equal("azwi-proxy-init"), "proxy init container is injected to pod %s in env mode", pod.Name)
+		}
+
+		for _, container := range []string{busybox1, busybox2} {
+			framework.Logf("validating that %s in %s gets a token from the proxy sidecar through IDENTITY_ENDPOINT", container, pod.Name)
+			gomega.Eventually(func() bool {
+				stdout, err := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, container)
+				if err != nil {
+					framework.Logf("failed to get logs from container %s in %s/%s: %v. Retrying...", container, namespace, pod.Name, err)
+					return false
+				}
+				framework.Logf("stdout: %s", stdout)
+				return strings.Contains(stdout, `"token_type":"Bearer"`)
+			}, framework.PollShortTimeout, framework.Poll).Should(gomega.BeTrue())
+		}
+	})
+
+	// This test is to validate that the Azure SDKs can get a token with their managed identity credential when the
+	// proxy sidecar runs in environment mode. The SDKs send a Cloud Shell token request because MSI_ENDPOINT is set
+	// without MSI_SECRET, which only supports the default identity of the pod.
+	ginkgo.It("should get a valid AAD token with the managed identity credential of the SDK when the proxy sidecar runs in env mode", func(ctx context.Context) {
+		clientID, ok := os.LookupEnv("APPLICATION_CLIENT_ID")
+		gomega.Expect(ok).To(gomega.BeTrue(), "APPLICATION_CLIENT_ID must be set")
+		// trust is only set up for 'proxy-test-sa' service account in the default namespace for now
+		const namespace = "default"
+		serviceAccount := createServiceAccount(f.ClientSet, namespace, "proxy-test-sa", map[string]string{clientIDAnnotation: clientID})
+		defer f.ClientSet.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), serviceAccount, metav1.DeleteOptions{})
+
+		proxyAnnotations := map[string]string{
+			injectProxySidecarAnnotation: "true",
+			proxySidecarPortAnnotation:   "8080",
+			proxySidecarModeAnnotation:   "env",
+		}
+
+		pod := generatePodWithServiceAccount(
+			f.ClientSet,
+			namespace,
+			serviceAccount,
+			"mcr.microsoft.com/azure-cli",
+			nil,
+			[]string{"/bin/sh", "-c", "az login -i --allow-no-subscriptions --debug; sleep 3600"},
+			nil,
+			proxyAnnotations,
+			map[string]string{useWorkloadIdentityLabel: "true"},
+			true,
+		)
+
+		pod, err := createPod(f.ClientSet, pod)
+		framework.ExpectNoError(err, "failed to create pod %s in %s", pod.Name, namespace)
+		defer f.ClientSet.CoreV1().Pods(namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+
+		// output proxy logs for debugging
+		defer func() {
+			stdout, _ := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, "azwi-proxy")
+			framework.Logf("azwi-proxy logs: %s", stdout)
+		}()
+
+		validateProxySideCarInMutatedPod(pod)
+
+		for _, container := range []string{busybox1, busybox2} {
+			framework.Logf("validating that %s in %s gets a token from the proxy sidecar with the managed identity credential", container, pod.Name)
+			gomega.Eventually(func() bool {
+				stdout, err := e2epod.GetPodLogs(ctx, f.ClientSet, namespace, pod.Name, container)
+				if err != nil {
+					framework.Logf("failed to get logs from container %s in %s/%s: %v. Retrying...", container, namespace, pod.Name, err)
+					return false
+				}
+				framework.Logf("stdout: %s", stdout)
+				return strings.Contains(stdout, `"environmentName": "AzureCloud"`)
+			}, framework.PollShortTimeout, framework.Poll).Should(gomega.BeTrue())
+		}
+	})
 })
@@ -21,6 +21,8 @@ const (
 	serviceAccountTokenExpiryAnnotation = "azure.workload.identity/service-account-token-expiration"
 	injectProxySidecarAnnotation        = "azure.workload.identity/inject-proxy-sidecar"
 	proxySidecarPortAnnotation          = "azure.workload.identity/proxy-sidecar-port"
+	proxySidecarStrictModeAnnotation    = "azure.workload.identity/proxy-sidecar-strict-mode"
+	proxySidecarModeAnnotation          = "azure.workload.identity/proxy-sidecar-mode"
 	volumeMountPath                     = "/var/run/secrets/azure/wi" // #nosec
 	projectedVolumeNamePrefix           = "azure-workload-identity-reserved-"
 	tokenFilePath                       = "token/azure-identity-token"
@@ -38,6 +38,28 @@ var replacements = map[string]string{
   {{- end }}
   {{- if .Values.customTokenEndpoint.azureKubernetesCACTBLabelSelector }}
   AZURE_KUBERNETES_CA_CTB_LABEL_SELECTOR: {{ .Values.customTokenEndpoint.azureKubernetesCACTBLabelSelector | quote }}
+  {{- end }}`,
+
+	`HELMSUBST_CONFIGMAP_PROXY_CONFIG: ""`: `{{- with dig "resources" "requests" "cpu" "" .Values.proxy }}
+  PROXY_CPU_REQUEST: {{ . | quote }}
+  {{- end }}
+  {{- with dig "resources" "limits" "cpu" "" .Values.proxy }}
+  PROXY_CPU_LIMIT: {{ . | quote }}
+  {{- end }}
+  {{- with dig "resources" "requests" "memory" "" .Values.proxy }}
+  PROXY_MEMORY_REQUEST: {{ . | quote }}
+  {{- end }}
+  {{- with dig "resources" "limits" "memory" "" .Values.proxy }}
+  PROXY_MEMORY_LIMIT: {{ . | quote }}
+  {{- end }}
+  {{- with .Values.proxy.imagePullPolicy }}
+  PROXY_IMAGE_PULL_POLICY: {{ . | quote }}
+  {{- end }}
+  {{- with .Values.proxy.imagePullSecrets }}
+  PROXY_IMAGE_PULL_SECRETS: {{ join "," . | quote }}
+  {{- end }}
+  {{- with .Values.proxy.metadataIPv6 }}
+  PROXY_METADATA_IPV6: {{ . | quote }}
   {{- end }}`,
 
 	`- HELMSUBST_DEPLOYMENT_CUSTOM_TOKEN_ENDPOINT_ARGS`: `{{- if .Values.customTokenEndpoint.annotationSuffix }}
@@ -79,6 +101,10 @@ imagePullSecrets:
 
 	`HELMSUBST_MUTATING_WEBHOOK_NAMESPACE_SELECTOR`: `{{- toYaml .Values.mutatingWebhookNamespaceSelector | nindent 4 }}`,
 
+	`HELMSUBST_VALIDATING_WEBHOOK_ANNOTATIONS: ""`: `{{- toYaml .Values.validatingWebhookAnnotations | nindent 4 }}`,
+
+	`HELMSUBST_VALIDATING_WEBHOOK_NAMESPACE_SELECTOR`: `{{- toYaml .Values.validatingWebhookNamespaceSelector | nindent 4 }}`,
+
 	`HELMSUBST_POD_ANNOTATIONS: ""`: `{{- toYaml .Values.podAnnotations | trim | nindent 8 }}`,
 
 	`minAvailable: HELMSUBST_PODDISRUPTIONBUDGET_MINAVAILABLE`: `{{- if .Values.podDisruptionBudget.minAvailable }}